@@ -14,10 +14,14 @@ var emailFS embed.FS
 //go:embed dist/*
 var distFS embed.FS
 
+//go:embed locales/*.json
+var localeFS embed.FS
+
 var (
 	TemplateFS fs.FS
 	EmailFS    fs.FS
 	DistFS     fs.FS
+	LocaleFS   fs.FS
 )
 
 func init() {
@@ -37,4 +41,9 @@ func init() {
 	if err != nil {
 		panic("failed to subtree dist FS " + err.Error())
 	}
+
+	LocaleFS, err = fs.Sub(localeFS, "locales")
+	if err != nil {
+		panic("failed to subtree locale FS " + err.Error())
+	}
 }
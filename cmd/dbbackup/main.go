@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/db/backup"
+	"github.com/willemschots/househunt/migrations"
+)
+
+const helpText = `Usage:
+  dbbackup create [-keep-last n] [-max-age duration] [sqlite_file] [backup_dir]
+  dbbackup list [backup_dir]
+  dbbackup verify [backup_file]
+  dbbackup restore [backup_file] [sqlite_file]
+
+create takes a backup while the database stays in use, and prunes old
+backups if -keep-last or -max-age is provided.
+
+restore replaces the database with the backup, the server must be stopped.
+The replaced database is kept next to the restored one.`
+
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	err := run(os.Args[1:])
+	if errors.Is(err, errUsage) {
+		fmt.Fprintln(os.Stderr, helpText)
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+	defer cancel()
+
+	switch args[0] {
+	case "create":
+		return create(ctx, args[1:])
+	case "list":
+		return list(args[1:])
+	case "verify":
+		return verify(args[1:])
+	case "restore":
+		return restore(ctx, args[1:])
+	default:
+		return errUsage
+	}
+}
+
+func create(ctx context.Context, args []string) error {
+	var policy backup.RetentionPolicy
+
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	fs.IntVar(&policy.KeepLast, "keep-last", 0, "max number of backups to keep, 0 keeps all")
+	fs.DurationVar(&policy.MaxAge, "max-age", 0, "max age of backups to keep, 0 keeps all")
+
+	err := fs.Parse(args)
+	if err != nil || fs.NArg() != 2 {
+		return errUsage
+	}
+
+	dbFile, dir := fs.Arg(0), fs.Arg(1)
+
+	// A read handle is enough to take a backup, and won't block the server from writing.
+	sqlDB, err := db.OpenSQLite(dbFile, false)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer sqlDB.Close()
+
+	now := time.Now()
+
+	b, err := backup.Create(ctx, sqlDB, dir, now)
+	if err != nil {
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
+
+	fmt.Printf("created %s (%d bytes, sha256 %s)\n", b.Path, b.Size, b.Checksum)
+
+	deleted, err := backup.Prune(dir, policy, now)
+	if err != nil {
+		return fmt.Errorf("failed to prune backups: %w", err)
+	}
+
+	for _, d := range deleted {
+		fmt.Printf("deleted %s\n", d.Path)
+	}
+
+	return nil
+}
+
+func list(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	backups, err := backup.List(args[0])
+	if err != nil {
+		return err
+	}
+
+	for _, b := range backups {
+		fmt.Printf("%s\t%d\t%s\t%s\n", b.CreatedAt.Format(time.RFC3339), b.Size, b.Checksum, b.Path)
+	}
+
+	return nil
+}
+
+func verify(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	err := backup.Verify(args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: OK\n", args[0])
+	return nil
+}
+
+func restore(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	backupFile, dbFile := args[0], args[1]
+
+	previous, err := backup.Restore(ctx, backupFile, dbFile, migrations.SQLite(migrations.Deps{}), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to restore backup: %w", err)
+	}
+
+	fmt.Printf("restored %s to %s\n", backupFile, dbFile)
+	if previous != "" {
+		fmt.Printf("the replaced database was moved to %s\n", previous)
+	}
+
+	return nil
+}
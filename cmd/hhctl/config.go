@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/email/postmark"
+	"github.com/willemschots/househunt/internal/email/smtp"
+	"github.com/willemschots/househunt/internal/krypto"
+)
+
+// config is the part of the server configuration hhctl needs to work with the
+// database. It's read from the same env variables as the server uses.
+type config struct {
+	dbFile         string
+	encryptionKeys []krypto.Key
+	blindIndexSalt krypto.Key
+	// email is nil if the command doesn't send emails.
+	email *emailConfig
+}
+
+type emailConfig struct {
+	driver   string
+	service  email.ServiceConfig
+	postmark postmark.Settings
+	smtp     smtp.Settings
+}
+
+// loadConfig reads the config from env variables. Like the server, every variable
+// can also be read from a file by appending _FILE to its name. The email settings
+// are only read if withEmail is true.
+func loadConfig(withEmail bool) (config, error) {
+	e := &envReader{}
+
+	c := config{
+		dbFile:         e.str("DB_FILENAME", "househunt.db"),
+		encryptionKeys: e.keys("DB_ENCRYPTION_KEYS"),
+		blindIndexSalt: e.key("DB_BLIND_INDEX_SALT"),
+	}
+
+	if withEmail {
+		c.email = &emailConfig{
+			driver: e.str("EMAIL_DRIVER", "log"),
+			service: email.ServiceConfig{
+				From:    e.address("EMAIL_FROM"),
+				BaseURL: e.url("BASE_URL", "http://localhost:8888"),
+			},
+			postmark: postmark.Settings{
+				APIURL:        e.url("POSTMARK_API_URL", "https://api.postmarkapp.com/email"),
+				ServerToken:   krypto.NewSecret(e.str("POSTMARK_SERVER_TOKEN", "")),
+				MessageStream: e.str("POSTMARK_MESSAGE_STREAM", "outbound"),
+			},
+			smtp: smtp.Settings{
+				Host:     e.str("SMTP_HOST", ""),
+				Port:     e.int("SMTP_PORT", 587),
+				Username: krypto.NewSecret(e.str("SMTP_USERNAME", "")),
+				Password: krypto.NewSecret(e.str("SMTP_PASSWORD", "")),
+				TLSMode:  parsed(e, "SMTP_TLS_MODE", smtp.TLSModeStartTLS, smtp.ParseTLSMode),
+				Timeout:  e.duration("SMTP_TIMEOUT", 10*time.Second),
+			},
+		}
+
+		// Like the server, only authenticate by default if there is a username.
+		defAuth := smtp.AuthNone
+		if len(c.email.smtp.Username.SecretValue()) > 0 {
+			defAuth = smtp.AuthPlain
+		}
+		c.email.smtp.Auth = parsed(e, "SMTP_AUTH", defAuth, smtp.ParseAuthMechanism)
+	}
+
+	if len(e.errs) > 0 {
+		return config{}, fmt.Errorf("invalid config:\n%w", errors.Join(e.errs...))
+	}
+
+	return c, nil
+}
+
+// envReader reads env variables, errors are collected so they can all be
+// reported at once.
+type envReader struct {
+	errs []error
+}
+
+// lookup returns the value of the env variable key, or the contents of the
+// file in key_FILE.
+func (e *envReader) lookup(key string) (string, bool) {
+	v, ok := os.LookupEnv(key)
+	path, okFile := os.LookupEnv(key + "_FILE")
+
+	switch {
+	case ok && okFile:
+		e.errs = append(e.errs, fmt.Errorf("%s: both %s and %s_FILE are set", key, key, key))
+		return "", false
+	case okFile:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s_FILE: %w", key, err))
+			return "", false
+		}
+		return strings.TrimRight(string(data), "\r\n"), true
+	default:
+		return v, ok
+	}
+}
+
+func (e *envReader) required(key string) (string, bool) {
+	v, ok := e.lookup(key)
+	if !ok || v == "" {
+		e.errs = append(e.errs, fmt.Errorf("missing required env variable %s", key))
+		return "", false
+	}
+	return v, true
+}
+
+func (e *envReader) str(key, def string) string {
+	v, ok := e.lookup(key)
+	if !ok {
+		return def
+	}
+	return v
+}
+
+func (e *envReader) int(key string, def int) int {
+	return parsed(e, key, def, strconv.Atoi)
+}
+
+func (e *envReader) duration(key string, def time.Duration) time.Duration {
+	return parsed(e, key, def, time.ParseDuration)
+}
+
+func (e *envReader) url(key, def string) *url.URL {
+	return parsed(e, key, must(url.Parse(def)), url.Parse)
+}
+
+func (e *envReader) address(key string) email.Address {
+	return requiredParsed(e, key, email.ParseAddress)
+}
+
+func (e *envReader) key(key string) krypto.Key {
+	return requiredParsed(e, key, krypto.ParseKey)
+}
+
+func (e *envReader) keys(key string) []krypto.Key {
+	return requiredParsed(e, key, func(v string) ([]krypto.Key, error) {
+		var out []krypto.Key
+		for _, raw := range strings.Split(v, ",") {
+			k, err := krypto.ParseKey(raw)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, k)
+		}
+		return out, nil
+	})
+}
+
+// parsed parses the env variable key with parseFunc, def is returned if it's not set.
+func parsed[T any](e *envReader, key string, def T, parseFunc func(string) (T, error)) T {
+	v, ok := e.lookup(key)
+	if !ok {
+		return def
+	}
+
+	out, err := parseFunc(v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("invalid %s: %w", key, err))
+		return def
+	}
+	return out
+}
+
+// requiredParsed is like parsed, but the env variable must be set.
+func requiredParsed[T any](e *envReader, key string, parseFunc func(string) (T, error)) T {
+	var zero T
+	if _, ok := e.required(key); !ok {
+		return zero
+	}
+	return parsed(e, key, zero, parseFunc)
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
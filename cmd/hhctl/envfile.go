@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// envLine matches a line that assigns a value to a variable, like KEY=value
+// or export KEY="value".
+var envLine = regexp.MustCompile(`^\s*(export\s+)?([A-Za-z_][A-Za-z0-9_]*)\s*=(.*)$`)
+
+// envFile is an env file, like the .env file used by Docker Compose. Lines are
+// kept as they are, so comments and formatting survive when the file is written.
+type envFile struct {
+	path  string
+	lines []string
+}
+
+func readEnvFile(path string) (*envFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+
+	content := strings.TrimSuffix(string(data), "\n")
+	return &envFile{
+		path:  path,
+		lines: strings.Split(content, "\n"),
+	}, nil
+}
+
+// get returns the value of key. If key is assigned more than once, the last value is
+// returned, like Docker Compose does.
+func (f *envFile) get(key string) (string, bool) {
+	i := f.index(key)
+	if i == -1 {
+		return "", false
+	}
+
+	m := envLine.FindStringSubmatch(f.lines[i])
+	return unquote(strings.TrimSpace(m[3])), true
+}
+
+// set assigns value to key, it replaces the last assignment of key or adds a new
+// one at the end of the file.
+func (f *envFile) set(key, value string) {
+	i := f.index(key)
+	if i == -1 {
+		f.lines = append(f.lines, key+"="+value)
+		return
+	}
+
+	m := envLine.FindStringSubmatch(f.lines[i])
+	f.lines[i] = m[1] + key + "=" + value
+}
+
+func (f *envFile) index(key string) int {
+	for i := len(f.lines) - 1; i >= 0; i-- {
+		m := envLine.FindStringSubmatch(f.lines[i])
+		if m != nil && m[2] == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// write writes the file to its path. It first writes to a temporary file that replaces
+// the original, so the original is kept intact if writing fails.
+func (f *envFile) write() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(strings.Join(f.lines, "\n") + "\n")
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	err = os.Chmod(tmp.Name(), info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
+
+func unquote(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/willemschots/househunt/internal/krypto"
+)
+
+const keyVarsHelp = `  HTTP_COOKIE_KEYS     pairs of keys to authenticate and encrypt cookies
+  HTTP_CSRF_KEY        key for CSRF protection
+  DB_BLIND_INDEX_SALT  salt for blind indexes, can't be rotated
+  DB_ENCRYPTION_KEYS   keys to encrypt columns in the database
+`
+
+// keyVar is an env variable that contains one or more keys.
+type keyVar struct {
+	name string
+	// generate is the number of keys that are generated at once.
+	generate int
+	// validate checks the number of keys, the keys themselves are parsed beforehand.
+	validate func(n int) error
+	// rotate returns the existing keys with the new keys in the correct position.
+	// It's nil if the keys of the variable can't be rotated.
+	rotate func(existing, added []string) []string
+}
+
+var keyVars = []keyVar{
+	{
+		name:     "HTTP_COOKIE_KEYS",
+		generate: 2,
+		validate: func(n int) error {
+			if n < 2 || n%2 != 0 {
+				return fmt.Errorf("expected pairs of keys, got %d keys", n)
+			}
+			return nil
+		},
+		// The first pair is used to encode new cookies, the others are only
+		// used to decode existing cookies.
+		rotate: func(existing, added []string) []string {
+			return append(added, existing...)
+		},
+	},
+	{
+		name:     "HTTP_CSRF_KEY",
+		generate: 1,
+		validate: exactlyOneKey,
+	},
+	{
+		name:     "DB_BLIND_INDEX_SALT",
+		generate: 1,
+		validate: exactlyOneKey,
+	},
+	{
+		name:     "DB_ENCRYPTION_KEYS",
+		generate: 1,
+		validate: func(n int) error {
+			if n < 1 {
+				return errors.New("expected at least 1 key")
+			}
+			return nil
+		},
+		// The list is append only, the last key is used to encrypt new data.
+		// See krypto.Encryptor.
+		rotate: func(existing, added []string) []string {
+			return append(existing, added...)
+		},
+	},
+}
+
+func exactlyOneKey(n int) error {
+	if n != 1 {
+		return fmt.Errorf("expected exactly 1 key, got %d keys", n)
+	}
+	return nil
+}
+
+func findKeyVar(name string) (keyVar, error) {
+	i := slices.IndexFunc(keyVars, func(v keyVar) bool {
+		return v.name == name
+	})
+	if i == -1 {
+		return keyVar{}, fmt.Errorf("%s is not a variable with keys: %w", name, errUsage)
+	}
+	return keyVars[i], nil
+}
+
+func keys(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "generate":
+		return generateKeys(args[1:], w)
+	case "rotate":
+		return rotateKeys(args[1:], w)
+	case "validate":
+		return validateKeys(args[1:], w)
+	default:
+		return errUsage
+	}
+}
+
+func generateKeys(args []string, w io.Writer) error {
+	vars := keyVars
+	switch len(args) {
+	case 0:
+	case 1:
+		v, err := findKeyVar(args[0])
+		if err != nil {
+			return err
+		}
+		vars = []keyVar{v}
+	default:
+		return errUsage
+	}
+
+	for _, v := range vars {
+		generated, err := newKeys(v.generate)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "%s=%s\n", v.name, strings.Join(generated, ","))
+	}
+
+	return nil
+}
+
+func rotateKeys(args []string, w io.Writer) error {
+	var file string
+
+	fs := flag.NewFlagSet("rotate", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&file, "file", ".env", "path of the env file")
+
+	err := fs.Parse(args)
+	if err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+
+	v, err := findKeyVar(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if v.rotate == nil {
+		return fmt.Errorf("keys of %s can't be rotated", v.name)
+	}
+
+	env, err := readEnvFile(file)
+	if err != nil {
+		return err
+	}
+
+	existing, err := parseKeys(env, v)
+	if err != nil {
+		return fmt.Errorf("refusing to rotate invalid keys: %w", err)
+	}
+
+	added, err := newKeys(v.generate)
+	if err != nil {
+		return err
+	}
+
+	rotated := v.rotate(existing, added)
+	env.set(v.name, strings.Join(rotated, ","))
+
+	err = env.write()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "added %d key(s) to %s in %s, it now has %d keys\n", len(added), v.name, file, len(rotated))
+	return nil
+}
+
+func validateKeys(args []string, w io.Writer) error {
+	var file string
+
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&file, "file", ".env", "path of the env file")
+
+	err := fs.Parse(args)
+	if err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	env, err := readEnvFile(file)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	// seen maps keys to the variable they were first seen in, keys
+	// should not be reused for different purposes.
+	seen := make(map[string]string)
+	for _, v := range keyVars {
+		parsed, err := parseKeys(env, v)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, k := range parsed {
+			if other, ok := seen[k]; ok {
+				errs = append(errs, fmt.Errorf("%s: reuses a key of %s", v.name, other))
+				continue
+			}
+			seen[k] = v.name
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid keys in %s:\n%w", file, errors.Join(errs...))
+	}
+
+	fmt.Fprintf(w, "OK, all keys in %s are valid\n", file)
+	return nil
+}
+
+// parseKeys returns the keys of v in env, after validating them.
+func parseKeys(env *envFile, v keyVar) ([]string, error) {
+	raw, ok := env.get(v.name)
+	if !ok || raw == "" {
+		return nil, fmt.Errorf("%s: not set", v.name)
+	}
+
+	keys := strings.Split(raw, ",")
+	for i, k := range keys {
+		_, err := krypto.ParseKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %d: %w, expected %d hex encoded bytes", v.name, i, err, 32)
+		}
+	}
+
+	err := v.validate(len(keys))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", v.name, err)
+	}
+
+	return keys, nil
+}
+
+// newKeys generates n keys, hex encoded.
+func newKeys(n int) ([]string, error) {
+	out := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		k, err := krypto.GenerateKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate key: %w", err)
+		}
+		out = append(out, k.SecretHex())
+	}
+	return out, nil
+}
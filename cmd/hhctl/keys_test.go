@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	key1 = "2b671594b775f371eab4050b4d58326682df6b1a6cc2e886717b1a26b4d6c45d"
+	key2 = "cf55b868d8c7a640265365910093113edce9b6c9226f3bd7c87987d23062d421"
+	key3 = "568554094ec040ab8a6b3e6d7cc138b0dc855f39ba1aeb2ffc903f7260b3a452"
+	key4 = "d503685b5e0848dcd1026711a5d92e8a087dfaffa489fb563e0de73db2f2476c"
+	key5 = "dfab77e26917c6e37a173690443a0016808ef7b24e32424d45cd83454198a6ec"
+)
+
+func Test_Keys_Generate(t *testing.T) {
+	t.Run("ok, generated keys are valid", func(t *testing.T) {
+		out := &strings.Builder{}
+		err := run([]string{"keys", "generate"}, out)
+		if err != nil {
+			t.Fatalf("failed to generate keys: %v", err)
+		}
+
+		file := envFileForTest(t, out.String())
+
+		err = run([]string{"keys", "validate", "-file", file}, &strings.Builder{})
+		if err != nil {
+			t.Fatalf("generated keys are not valid: %v", err)
+		}
+	})
+
+	t.Run("ok, single variable", func(t *testing.T) {
+		out := &strings.Builder{}
+		err := run([]string{"keys", "generate", "HTTP_COOKIE_KEYS"}, out)
+		if err != nil {
+			t.Fatalf("failed to generate keys: %v", err)
+		}
+
+		got := strings.TrimSpace(out.String())
+		value, ok := strings.CutPrefix(got, "HTTP_COOKIE_KEYS=")
+		if !ok {
+			t.Fatalf("unexpected output: %s", got)
+		}
+
+		if n := len(strings.Split(value, ",")); n != 2 {
+			t.Errorf("expected a pair of keys, got %d keys", n)
+		}
+	})
+
+	t.Run("fail, unknown variable", func(t *testing.T) {
+		err := run([]string{"keys", "generate", "HTTP_ADDR"}, &strings.Builder{})
+		if !errors.Is(err, errUsage) {
+			t.Errorf("expected errors to be %v got %v (via errors.Is)", errUsage, err)
+		}
+	})
+}
+
+func Test_Keys_Rotate(t *testing.T) {
+	env := "# Cookie keys.\n" +
+		"HTTP_COOKIE_KEYS=" + key1 + "," + key2 + "\n" +
+		"HTTP_CSRF_KEY=" + key3 + "\n" +
+		"DB_BLIND_INDEX_SALT=" + key4 + "\n" +
+		"export DB_ENCRYPTION_KEYS=\"" + key5 + "\"\n"
+
+	t.Run("ok, encryption key is appended", func(t *testing.T) {
+		file := envFileForTest(t, env)
+
+		err := run([]string{"keys", "rotate", "-file", file, "DB_ENCRYPTION_KEYS"}, &strings.Builder{})
+		if err != nil {
+			t.Fatalf("failed to rotate keys: %v", err)
+		}
+
+		got := mustGet(t, file, "DB_ENCRYPTION_KEYS")
+		if len(got) != 2 || got[0] != key5 || got[1] == key5 {
+			t.Errorf("expected a new key after %s, got %v", key5, got)
+		}
+
+		assertFileContains(t, file, "# Cookie keys.\n", "export DB_ENCRYPTION_KEYS=")
+	})
+
+	t.Run("ok, cookie key pair is prepended", func(t *testing.T) {
+		file := envFileForTest(t, env)
+
+		err := run([]string{"keys", "rotate", "-file", file, "HTTP_COOKIE_KEYS"}, &strings.Builder{})
+		if err != nil {
+			t.Fatalf("failed to rotate keys: %v", err)
+		}
+
+		got := mustGet(t, file, "HTTP_COOKIE_KEYS")
+		if len(got) != 4 || got[2] != key1 || got[3] != key2 {
+			t.Errorf("expected a new pair before %s and %s, got %v", key1, key2, got)
+		}
+
+		err = run([]string{"keys", "validate", "-file", file}, &strings.Builder{})
+		if err != nil {
+			t.Errorf("rotated keys are not valid: %v", err)
+		}
+	})
+
+	for _, name := range []string{"HTTP_CSRF_KEY", "DB_BLIND_INDEX_SALT"} {
+		t.Run("fail, can't rotate "+name, func(t *testing.T) {
+			file := envFileForTest(t, env)
+
+			err := run([]string{"keys", "rotate", "-file", file, name}, &strings.Builder{})
+			if err == nil {
+				t.Fatal("expected error, got <nil>")
+			}
+		})
+	}
+
+	t.Run("fail, invalid existing keys", func(t *testing.T) {
+		file := envFileForTest(t, "DB_ENCRYPTION_KEYS=<your encryption keys here>\n")
+
+		err := run([]string{"keys", "rotate", "-file", file, "DB_ENCRYPTION_KEYS"}, &strings.Builder{})
+		if err == nil {
+			t.Fatal("expected error, got <nil>")
+		}
+
+		assertFileContains(t, file, "<your encryption keys here>")
+	})
+}
+
+func Test_Keys_Validate(t *testing.T) {
+	valid := map[string]string{
+		"HTTP_COOKIE_KEYS":    key1 + "," + key2,
+		"HTTP_CSRF_KEY":       key3,
+		"DB_BLIND_INDEX_SALT": key4,
+		"DB_ENCRYPTION_KEYS":  key5,
+	}
+
+	tests := map[string]struct {
+		key   string
+		value string
+	}{
+		"fail, missing variable":   {key: "HTTP_CSRF_KEY", value: ""},
+		"fail, invalid key":        {key: "HTTP_CSRF_KEY", value: "abc"},
+		"fail, odd cookie keys":    {key: "HTTP_COOKIE_KEYS", value: key1 + "," + key2 + "," + key3},
+		"fail, multiple csrf keys": {key: "HTTP_CSRF_KEY", value: key3 + "," + key5},
+		"fail, reused key":         {key: "DB_ENCRYPTION_KEYS", value: key1},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var env strings.Builder
+			for key, value := range valid {
+				if key == tc.key {
+					value = tc.value
+				}
+				env.WriteString(key + "=" + value + "\n")
+			}
+
+			err := run([]string{"keys", "validate", "-file", envFileForTest(t, env.String())}, &strings.Builder{})
+			if err == nil {
+				t.Fatal("expected error, got <nil>")
+			}
+
+			if !strings.Contains(err.Error(), tc.key) {
+				t.Errorf("expected error to mention %s, got %v", tc.key, err)
+			}
+		})
+	}
+}
+
+func envFileForTest(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), ".env")
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+
+	return path
+}
+
+func mustGet(t *testing.T, file, key string) []string {
+	t.Helper()
+
+	env, err := readEnvFile(file)
+	if err != nil {
+		t.Fatalf("failed to read env file: %v", err)
+	}
+
+	v, ok := env.get(key)
+	if !ok {
+		t.Fatalf("%s not found in env file", key)
+	}
+
+	return strings.Split(v, ",")
+}
+
+func assertFileContains(t *testing.T, file string, want ...string) {
+	t.Helper()
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+
+	for _, w := range want {
+		if !strings.Contains(string(data), w) {
+			t.Errorf("expected file to contain %q, got:\n%s", w, data)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Command hhctl contains tools to operate househunt.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const helpText = `Usage:
+  hhctl keys generate [variable]
+  hhctl keys rotate [-file path] variable
+  hhctl keys validate [-file path]
+  hhctl users list [-json] [-active true|false]
+  hhctl users find [-json] user
+  hhctl users activate [-actor id] user
+  hhctl users deactivate [-actor id] user
+  hhctl users reset-password [-actor id] user
+  hhctl users expire-tokens [-actor id] user
+
+keys generate prints new keys for the env variables that contain keys,
+ready to be added to an env file. If variable is provided, only keys for
+that variable are generated. The variables are:
+` + keyVarsHelp + `
+keys rotate adds a new key to the keys of variable in the env file. The
+new key is put in the position where it's used to encrypt new data, the
+existing keys are kept to decrypt existing data. The file defaults to .env.
+
+keys validate checks that the keys in the env file are valid. The file
+defaults to .env.
+
+The users commands work with the database of the server, they read the
+same env variables as the server to connect to it. user is the ID or the
+email address of a user.
+
+users list lists all users, -active only lists active or inactive users.
+users find shows a single user. Both output a table, or JSON with -json.
+
+users activate activates a user that was deactivated or that never
+finished activation. users deactivate deactivates a user.
+
+users reset-password forces a user to reset their password. The current
+password stops working and a password reset email is sent to the user.
+
+users expire-tokens expires all outstanding email tokens of a user, like
+activation and password reset links.
+
+The actions are recorded in the admin audit log. -actor is the ID of the
+admin on whose behalf the action is taken. Without it, the action is
+recorded as taken by the system.`
+
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	if errors.Is(err, errUsage) {
+		fmt.Fprintln(os.Stderr, helpText)
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "keys":
+		return keys(args[1:], w)
+	case "users":
+		return users(args[1:], w)
+	default:
+		return errUsage
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/willemschots/househunt/assets"
+	"github.com/willemschots/househunt/internal/audit"
+	auditdb "github.com/willemschots/househunt/internal/audit/db"
+	"github.com/willemschots/househunt/internal/auth"
+	authdb "github.com/willemschots/househunt/internal/auth/db"
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/email"
+	emaildb "github.com/willemschots/househunt/internal/email/db"
+	"github.com/willemschots/househunt/internal/email/postmark"
+	"github.com/willemschots/househunt/internal/email/smtp"
+	emailview "github.com/willemschots/househunt/internal/email/view"
+	"github.com/willemschots/househunt/internal/i18n"
+	"github.com/willemschots/househunt/internal/krypto"
+)
+
+var errNoEmail = errors.New("sending emails is not configured for this command")
+
+// services are the services of the server that hhctl works with, connected
+// to the database of the server.
+type services struct {
+	auth    *auth.Service
+	writeDB *sql.DB
+	readDB  *sql.DB
+}
+
+// openServices connects to the database in cfg and creates the services. The
+// business rules live in the services, hhctl never queries the database itself.
+func openServices(ctx context.Context, cfg config) (*services, error) {
+	s := &services{}
+
+	var err error
+	if strings.HasPrefix(cfg.dbFile, "postgres://") || strings.HasPrefix(cfg.dbFile, "postgresql://") {
+		// Unlike SQLite, the same pool can be used for reading and writing.
+		s.writeDB, err = db.OpenPostgres(cfg.dbFile)
+		s.readDB = s.writeDB
+	} else {
+		s.writeDB, err = db.OpenSQLite(cfg.dbFile, true)
+		if err == nil {
+			s.readDB, err = db.OpenSQLite(cfg.dbFile, false)
+		}
+	}
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to open database: %w", err), s.close())
+	}
+
+	err = s.writeDB.PingContext(ctx)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to connect to database: %w", err), s.close())
+	}
+
+	encryptor, err := krypto.NewEncryptor(cfg.encryptionKeys)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to create encryptor: %w", err), s.close())
+	}
+
+	var emailer auth.Emailer = noEmailer{}
+	if cfg.email != nil {
+		emailer, err = newEmailer(cfg, s.writeDB, s.readDB, encryptor)
+		if err != nil {
+			return nil, errors.Join(err, s.close())
+		}
+	}
+
+	auditor := audit.NewRecorder(auditdb.New(s.writeDB, s.readDB, encryptor))
+	authStore := authdb.New(s.writeDB, s.readDB, encryptor, cfg.blindIndexSalt)
+
+	// The commands don't start workers, but errors are reported just in case.
+	errHandler := func(_ context.Context, err error) {
+		fmt.Fprintf(os.Stderr, "authentication service error: %v\n", err)
+	}
+
+	s.auth, err = auth.NewService(authStore, emailer, auditor, errHandler, auth.ServiceConfig{
+		WorkerTimeout: 30 * time.Second,
+		TokenExpiry:   30 * time.Minute,
+	})
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to create auth service: %w", err), s.close())
+	}
+
+	return s, nil
+}
+
+func newEmailer(cfg config, writeDB, readDB *sql.DB, encryptor *krypto.Encryptor) (*email.Service, error) {
+	catalogue, err := i18n.LoadCatalogue(assets.LocaleFS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load translations: %w", err)
+	}
+
+	renderer, err := emailview.NewMemRenderer(assets.EmailFS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create email renderer: %w", err)
+	}
+
+	var sender email.Sender
+	switch cfg.email.driver {
+	case "log":
+		sender = email.NewLogSender(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	case "postmark":
+		httpClient := &http.Client{
+			Timeout: 10 * time.Second,
+		}
+		sender = postmark.NewSender(httpClient, cfg.email.postmark)
+	case "smtp":
+		sender = smtp.NewSender(cfg.email.smtp)
+	default:
+		return nil, fmt.Errorf("unknown email driver %q", cfg.email.driver)
+	}
+
+	emailStore := emaildb.New(writeDB, readDB, encryptor, cfg.blindIndexSalt)
+	return email.NewService(renderer, sender, emailStore, catalogue, cfg.email.service), nil
+}
+
+func (s *services) close() error {
+	var errs []error
+	if s.readDB != nil && s.readDB != s.writeDB {
+		errs = append(errs, s.readDB.Close())
+	}
+	if s.writeDB != nil {
+		errs = append(errs, s.writeDB.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// noEmailer is used by commands that don't send emails.
+type noEmailer struct{}
+
+func (noEmailer) Send(context.Context, string, email.Address, interface{}) error {
+	return errNoEmail
+}
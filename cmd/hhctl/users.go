@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/auth"
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/errorz"
+)
+
+var errActorNotAdmin = errors.New("actor is not an active admin")
+
+// userAction is a command that acts on a single user.
+type userAction struct {
+	// email indicates the action sends emails.
+	email bool
+	do    func(ctx context.Context, svc *auth.Service, actorID, userID uuid.UUID) (string, error)
+}
+
+var userActions = map[string]userAction{
+	"activate": {
+		do: func(ctx context.Context, svc *auth.Service, actorID, userID uuid.UUID) (string, error) {
+			return "activated user", svc.ReactivateUser(ctx, actorID, userID)
+		},
+	},
+	"deactivate": {
+		do: func(ctx context.Context, svc *auth.Service, actorID, userID uuid.UUID) (string, error) {
+			return "deactivated user", svc.DeactivateUser(ctx, actorID, userID)
+		},
+	},
+	"reset-password": {
+		email: true,
+		do: func(ctx context.Context, svc *auth.Service, actorID, userID uuid.UUID) (string, error) {
+			return "sent password reset email to user", svc.ForcePasswordReset(ctx, actorID, userID)
+		},
+	},
+	"expire-tokens": {
+		do: func(ctx context.Context, svc *auth.Service, actorID, userID uuid.UUID) (string, error) {
+			n, err := svc.ExpireTokens(ctx, actorID, userID)
+			return fmt.Sprintf("expired %d token(s) of user", n), err
+		},
+	},
+}
+
+func users(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
+	defer cancel()
+
+	switch args[0] {
+	case "list":
+		return listUsers(ctx, args[1:], w)
+	case "find":
+		return findUser(ctx, args[1:], w)
+	}
+
+	action, ok := userActions[args[0]]
+	if !ok {
+		return errUsage
+	}
+
+	return doUserAction(ctx, args[0], action, args[1:], w)
+}
+
+func listUsers(ctx context.Context, args []string, w io.Writer) error {
+	var (
+		asJSON bool
+		active string
+	)
+
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&asJSON, "json", false, "output JSON instead of a table")
+	fs.StringVar(&active, "active", "", "only list active (true) or inactive (false) users")
+
+	err := fs.Parse(args)
+	if err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	filter := auth.UserFilter{}
+	if active != "" {
+		isActive, err := strconv.ParseBool(active)
+		if err != nil {
+			return errUsage
+		}
+		filter.IsActive = &isActive
+	}
+
+	return withServices(ctx, false, func(s *services) error {
+		users, err := s.auth.FindUsers(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		return writeUsers(w, users, asJSON)
+	})
+}
+
+func findUser(ctx context.Context, args []string, w io.Writer) error {
+	var asJSON bool
+
+	fs := flag.NewFlagSet("find", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&asJSON, "json", false, "output JSON instead of a table")
+
+	err := fs.Parse(args)
+	if err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+
+	filter, err := userFilterFor(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return withServices(ctx, false, func(s *services) error {
+		users, err := s.auth.FindUsers(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		if len(users) == 0 {
+			return fmt.Errorf("user %s: %w", fs.Arg(0), errorz.ErrNotFound)
+		}
+
+		return writeUsers(w, users, asJSON)
+	})
+}
+
+func doUserAction(ctx context.Context, name string, action userAction, args []string, w io.Writer) error {
+	var actor string
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&actor, "actor", "", "ID of the admin on whose behalf the action is taken")
+
+	err := fs.Parse(args)
+	if err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+
+	// Actions without an actor are recorded as taken by the system.
+	actorID := uuid.Nil
+	if actor != "" {
+		actorID, err = uuid.Parse(actor)
+		if err != nil {
+			return fmt.Errorf("invalid actor: %w", err)
+		}
+	}
+
+	filter, err := userFilterFor(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return withServices(ctx, action.email, func(s *services) error {
+		if actorID != uuid.Nil {
+			admin, err := s.auth.ActiveUser(ctx, actorID)
+			if err != nil && !errors.Is(err, errorz.ErrNotFound) {
+				return err
+			}
+
+			if err != nil || admin.Role != auth.RoleAdmin {
+				return fmt.Errorf("%s: %w", actorID, errActorNotAdmin)
+			}
+		}
+
+		users, err := s.auth.FindUsers(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		if len(users) != 1 {
+			return fmt.Errorf("user %s: %w", fs.Arg(0), errorz.ErrNotFound)
+		}
+
+		msg, err := action.do(ctx, s.auth, actorID, users[0].ID)
+		if err != nil {
+			return fmt.Errorf("failed to %s user %s: %w", name, users[0].ID, err)
+		}
+
+		fmt.Fprintf(w, "%s %s\n", msg, users[0].ID)
+		return nil
+	})
+}
+
+// userFilterFor returns a filter for the user identified by idOrEmail.
+func userFilterFor(idOrEmail string) (auth.UserFilter, error) {
+	id, err := uuid.Parse(idOrEmail)
+	if err == nil {
+		return auth.UserFilter{IDs: []uuid.UUID{id}}, nil
+	}
+
+	addr, err := email.ParseAddress(idOrEmail)
+	if err != nil {
+		return auth.UserFilter{}, fmt.Errorf("%s is not a user ID or email address", idOrEmail)
+	}
+
+	return auth.UserFilter{Emails: []email.Address{addr}}, nil
+}
+
+// withServices loads the config, opens the services and calls f with them.
+func withServices(ctx context.Context, withEmail bool, f func(s *services) error) error {
+	cfg, err := loadConfig(withEmail)
+	if err != nil {
+		return err
+	}
+
+	s, err := openServices(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	err = f(s)
+	return errors.Join(err, s.close())
+}
+
+// userOutput is how users are written by the list and find commands.
+type userOutput struct {
+	ID            uuid.UUID     `json:"id"`
+	Email         email.Address `json:"email"`
+	Role          auth.Role     `json:"role"`
+	IsActive      bool          `json:"is_active"`
+	DeactivatedAt *time.Time    `json:"deactivated_at"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+}
+
+func writeUsers(w io.Writer, users []auth.User, asJSON bool) error {
+	out := make([]userOutput, 0, len(users))
+	for _, u := range users {
+		out = append(out, userOutput{
+			ID:            u.ID,
+			Email:         u.Email,
+			Role:          u.Role,
+			IsActive:      u.IsActive,
+			DeactivatedAt: u.DeactivatedAt,
+			CreatedAt:     u.CreatedAt,
+			UpdatedAt:     u.UpdatedAt,
+		})
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tEMAIL\tROLE\tACTIVE\tDEACTIVATED\tCREATED")
+	for _, u := range out {
+		deactivated := "-"
+		if u.DeactivatedAt != nil {
+			deactivated = u.DeactivatedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\t%s\n", u.ID, u.Email, u.Role, u.IsActive, deactivated, u.CreatedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/auth"
+	authdb "github.com/willemschots/househunt/internal/auth/db"
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/db/migrate"
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/krypto"
+	"github.com/willemschots/househunt/migrations"
+)
+
+func Test_Users_List(t *testing.T) {
+	ut := newUsersTest(t)
+	active := ut.createUser("alice@example.com", true, auth.RoleUser)
+	inactive := ut.createUser("bob@example.com", false, auth.RoleUser)
+
+	t.Run("ok, table", func(t *testing.T) {
+		out := &strings.Builder{}
+		err := run([]string{"users", "list"}, out)
+		if err != nil {
+			t.Fatalf("failed to list users: %v", err)
+		}
+
+		for _, want := range []string{"EMAIL", active.ID.String(), "alice@example.com", inactive.ID.String(), "bob@example.com"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("expected output to contain %q, got:\n%s", want, out)
+			}
+		}
+	})
+
+	t.Run("ok, json of active users", func(t *testing.T) {
+		got := ut.runJSON(t, "users", "list", "-json", "-active", "true")
+		if len(got) != 1 || got[0].ID != active.ID || got[0].Email != active.Email {
+			t.Errorf("expected only %s, got %#v", active.Email, got)
+		}
+	})
+
+	t.Run("fail, invalid active flag", func(t *testing.T) {
+		err := run([]string{"users", "list", "-active", "maybe"}, &strings.Builder{})
+		if !errors.Is(err, errUsage) {
+			t.Errorf("expected errors to be %v got %v (via errors.Is)", errUsage, err)
+		}
+	})
+}
+
+func Test_Users_Find(t *testing.T) {
+	ut := newUsersTest(t)
+	user := ut.createUser("alice@example.com", true, auth.RoleUser)
+	ut.createUser("bob@example.com", true, auth.RoleUser)
+
+	for _, arg := range []string{user.ID.String(), "alice@example.com"} {
+		t.Run("ok, find by "+arg, func(t *testing.T) {
+			got := ut.runJSON(t, "users", "find", "-json", arg)
+			if len(got) != 1 || got[0].ID != user.ID || got[0].Email != user.Email {
+				t.Errorf("expected %s, got %#v", user.Email, got)
+			}
+		})
+	}
+
+	t.Run("fail, unknown user", func(t *testing.T) {
+		err := run([]string{"users", "find", "carol@example.com"}, &strings.Builder{})
+		if err == nil {
+			t.Fatal("expected error, got <nil>")
+		}
+	})
+
+	t.Run("fail, not an ID or email address", func(t *testing.T) {
+		err := run([]string{"users", "find", "alice"}, &strings.Builder{})
+		if err == nil {
+			t.Fatal("expected error, got <nil>")
+		}
+	})
+}
+
+func Test_Users_Actions(t *testing.T) {
+	t.Run("ok, deactivate and activate", func(t *testing.T) {
+		ut := newUsersTest(t)
+		admin := ut.createUser("admin@example.com", true, auth.RoleAdmin)
+		user := ut.createUser("alice@example.com", true, auth.RoleUser)
+
+		err := run([]string{"users", "deactivate", "-actor", admin.ID.String(), "alice@example.com"}, &strings.Builder{})
+		if err != nil {
+			t.Fatalf("failed to deactivate user: %v", err)
+		}
+
+		got := ut.runJSON(t, "users", "find", "-json", user.ID.String())
+		if got[0].IsActive || got[0].DeactivatedAt == nil {
+			t.Errorf("expected user to be deactivated, got %#v", got[0])
+		}
+
+		err = run([]string{"users", "activate", user.ID.String()}, &strings.Builder{})
+		if err != nil {
+			t.Fatalf("failed to activate user: %v", err)
+		}
+
+		got = ut.runJSON(t, "users", "find", "-json", user.ID.String())
+		if !got[0].IsActive {
+			t.Errorf("expected user to be active, got %#v", got[0])
+		}
+
+		actions := ut.adminActions(user.ID)
+		if len(actions) != 2 || actions[0].ActorID != uuid.Nil || actions[1].ActorID != admin.ID {
+			t.Errorf("unexpected admin actions: %#v", actions)
+		}
+	})
+
+	t.Run("ok, reset password", func(t *testing.T) {
+		ut := newUsersTest(t)
+		user := ut.createUser("alice@example.com", true, auth.RoleUser)
+		t.Setenv("EMAIL_FROM", "info@example.com")
+
+		out := &strings.Builder{}
+		err := run([]string{"users", "reset-password", user.ID.String()}, out)
+		if err != nil {
+			t.Fatalf("failed to reset password: %v", err)
+		}
+
+		got := ut.findUser(user.ID)
+		if got.PasswordHash.String() == user.PasswordHash.String() {
+			t.Errorf("expected password to be replaced")
+		}
+
+		ut.assertAdminActions(t, user.ID, auth.AdminActionForceReset)
+	})
+
+	t.Run("ok, expire tokens", func(t *testing.T) {
+		ut := newUsersTest(t)
+		user := ut.createUser("alice@example.com", true, auth.RoleUser)
+
+		out := &strings.Builder{}
+		err := run([]string{"users", "expire-tokens", user.ID.String()}, out)
+		if err != nil {
+			t.Fatalf("failed to expire tokens: %v", err)
+		}
+
+		want := "expired 0 token(s) of user " + user.ID.String() + "\n"
+		if out.String() != want {
+			t.Errorf("got output %q, want %q", out, want)
+		}
+
+		ut.assertAdminActions(t, user.ID, auth.AdminActionExpireTokens)
+	})
+
+	t.Run("fail, actor is not an admin", func(t *testing.T) {
+		ut := newUsersTest(t)
+		other := ut.createUser("bob@example.com", true, auth.RoleUser)
+		user := ut.createUser("alice@example.com", true, auth.RoleUser)
+
+		for _, actor := range []uuid.UUID{other.ID, uuid.New()} {
+			err := run([]string{"users", "deactivate", "-actor", actor.String(), user.ID.String()}, &strings.Builder{})
+			if !errors.Is(err, errActorNotAdmin) {
+				t.Errorf("expected errors to be %v got %v (via errors.Is)", errActorNotAdmin, err)
+			}
+		}
+
+		ut.assertAdminActions(t, user.ID)
+	})
+
+	t.Run("fail, reset password without email config", func(t *testing.T) {
+		ut := newUsersTest(t)
+		user := ut.createUser("alice@example.com", true, auth.RoleUser)
+
+		err := run([]string{"users", "reset-password", user.ID.String()}, &strings.Builder{})
+		if err == nil || !strings.Contains(err.Error(), "EMAIL_FROM") {
+			t.Fatalf("expected error about EMAIL_FROM, got %v", err)
+		}
+	})
+
+	t.Run("fail, missing config", func(t *testing.T) {
+		newUsersTest(t)
+		t.Setenv("DB_ENCRYPTION_KEYS", "")
+
+		err := run([]string{"users", "list"}, &strings.Builder{})
+		if err == nil || !strings.Contains(err.Error(), "DB_ENCRYPTION_KEYS") {
+			t.Fatalf("expected error about DB_ENCRYPTION_KEYS, got %v", err)
+		}
+	})
+}
+
+type usersTest struct {
+	t     *testing.T
+	store *authdb.Store
+}
+
+// newUsersTest creates a migrated database and sets the env variables
+// hhctl uses to connect to it.
+func newUsersTest(t *testing.T) *usersTest {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "househunt.db")
+	t.Setenv("DB_FILENAME", file)
+	t.Setenv("DB_ENCRYPTION_KEYS", key1)
+	t.Setenv("DB_BLIND_INDEX_SALT", key2)
+
+	writeDB, err := db.OpenSQLite(file, true)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { writeDB.Close() })
+
+	readDB, err := db.OpenSQLite(file, false)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { readDB.Close() })
+
+	_, err = migrate.RunFS(context.Background(), writeDB, migrations.SQLite(migrations.Deps{}), migrate.Metadata{})
+	if err != nil {
+		t.Fatalf("failed to run migrations: %v", err)
+	}
+
+	encryptor, err := krypto.NewEncryptor([]krypto.Key{must(krypto.ParseKey(key1))})
+	if err != nil {
+		t.Fatalf("failed to create encryptor: %v", err)
+	}
+
+	return &usersTest{
+		t:     t,
+		store: authdb.New(writeDB, readDB, encryptor, must(krypto.ParseKey(key2))),
+	}
+}
+
+func (ut *usersTest) createUser(addr string, active bool, role auth.Role) auth.User {
+	ut.t.Helper()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	user := auth.User{
+		ID:           uuid.New(),
+		Email:        must(email.ParseAddress(addr)),
+		PasswordHash: must(krypto.HashArgon2([]byte("reallyStrongPassword1"))),
+		IsActive:     active,
+		Role:         role,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	tx, err := ut.store.BeginTx(context.Background())
+	if err != nil {
+		ut.t.Fatalf("failed to begin transaction: %v", err)
+	}
+
+	err = tx.CreateUser(user)
+	if err != nil {
+		ut.t.Fatalf("failed to create user: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		ut.t.Fatalf("failed to commit: %v", err)
+	}
+
+	return user
+}
+
+func (ut *usersTest) findUser(id uuid.UUID) auth.User {
+	ut.t.Helper()
+
+	users, err := ut.store.FindUsers(context.Background(), auth.UserFilter{IDs: []uuid.UUID{id}})
+	if err != nil || len(users) != 1 {
+		ut.t.Fatalf("failed to find user %s: %v", id, err)
+	}
+
+	return users[0]
+}
+
+func (ut *usersTest) adminActions(userID uuid.UUID) []auth.AdminAction {
+	ut.t.Helper()
+
+	actions, err := ut.store.FindAdminActions(context.Background(), auth.AdminActionFilter{
+		TargetUserIDs: []uuid.UUID{userID},
+	})
+	if err != nil {
+		ut.t.Fatalf("failed to find admin actions: %v", err)
+	}
+
+	return actions
+}
+
+func (ut *usersTest) assertAdminActions(t *testing.T, userID uuid.UUID, want ...auth.AdminActionType) {
+	t.Helper()
+
+	actions := ut.adminActions(userID)
+	if len(actions) != len(want) {
+		t.Fatalf("expected %d admin actions, got %d: %#v", len(want), len(actions), actions)
+	}
+
+	for i := range want {
+		if actions[i].Action != want[i] {
+			t.Errorf("action %d: got %q, want %q", i, actions[i].Action, want[i])
+		}
+	}
+}
+
+func (ut *usersTest) runJSON(t *testing.T, args ...string) []userOutput {
+	t.Helper()
+
+	out := &strings.Builder{}
+	err := run(args, out)
+	if err != nil {
+		t.Fatalf("failed to run %v: %v", args, err)
+	}
+
+	var got []userOutput
+	err = json.Unmarshal([]byte(out.String()), &got)
+	if err != nil {
+		t.Fatalf("failed to unmarshal output: %v\n%s", err, out)
+	}
+
+	return got
+}
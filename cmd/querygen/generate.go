@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	funcInsert = "insert"
+	funcUpdate = "update"
+	funcSelect = "select"
+)
+
+// generator writes the query functions for a single domain type.
+type generator struct {
+	cfg   config
+	pkg   *srcPackage
+	cols  []column
+	conds []condition
+	pk    *column
+	// imports maps names of imported packages to their paths.
+	imports map[string]string
+	buf     bytes.Buffer
+}
+
+func generate(cfg config) ([]byte, error) {
+	pkg, err := parsePackage(cfg.src)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{
+		cfg: cfg,
+		pkg: pkg,
+		imports: map[string]string{
+			"db":     pkg.module + "/internal/db",
+			"errorz": pkg.module + "/internal/errorz",
+			pkg.name: pkg.path,
+		},
+	}
+
+	if cfg.has(funcInsert) || cfg.has(funcUpdate) {
+		g.imports["fmt"] = "fmt"
+	}
+
+	r := &typeRenderer{pkg: pkg, imports: g.imports}
+	g.cols, err = pkg.columns(cfg.typeName, r)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, c := range g.cols {
+		if c.pk {
+			if g.pk != nil {
+				return nil, fmt.Errorf("%s has multiple pk fields", cfg.typeName)
+			}
+			g.pk = &g.cols[i]
+		}
+	}
+
+	if cfg.has(funcSelect) {
+		if cfg.filter == "" {
+			return nil, fmt.Errorf("a filter type is required to generate %s", funcSelect)
+		}
+
+		g.conds, err = pkg.conditions(cfg.filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range cfg.funcs {
+		switch f {
+		case funcInsert:
+			err = g.insert()
+		case funcUpdate:
+			err = g.update()
+		case funcSelect:
+			g.selectFunc()
+		default:
+			err = fmt.Errorf("unknown function %q", f)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	code := g.buf.Bytes()
+	g.buf = bytes.Buffer{}
+	g.header(cfg.pkgName)
+	g.buf.Write(code)
+
+	out, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w\n%s", err, g.buf.Bytes())
+	}
+
+	return out, nil
+}
+
+func (g *generator) p(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+	g.buf.WriteByte('\n')
+}
+
+func (g *generator) header(pkgName string) {
+	g.p("// Code generated by querygen. DO NOT EDIT.")
+	g.p("")
+	g.p("package %s", pkgName)
+	g.p("")
+
+	names := make([]string, 0, len(g.imports))
+	for name := range g.imports {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return g.imports[names[i]] < g.imports[names[j]]
+	})
+
+	// Write the standard library imports first, like goimports does.
+	g.p("import (")
+	for _, std := range []bool{true, false} {
+		for _, name := range names {
+			impPath := g.imports[name]
+			if isStd(impPath) != std {
+				continue
+			}
+
+			if path.Base(impPath) == name {
+				g.p("%q", impPath)
+			} else {
+				g.p("%s %q", name, impPath)
+			}
+		}
+		g.p("")
+	}
+	g.p(")")
+	g.p("")
+}
+
+// isStd reports whether impPath is a package of the standard library.
+func isStd(impPath string) bool {
+	first, _, _ := strings.Cut(impPath, "/")
+	return !strings.Contains(first, ".")
+}
+
+// typ returns the domain type, qualified with its package.
+func (g *generator) typ(name string) string {
+	return g.pkg.name + "." + name
+}
+
+func (g *generator) insert() error {
+	if g.pk == nil {
+		return fmt.Errorf("%s needs a pk field to generate %s", g.cfg.typeName, funcInsert)
+	}
+
+	names := make([]string, 0, len(g.cols))
+	for _, c := range g.cols {
+		names = append(names, c.name)
+		if c.blindIndex != "" {
+			names = append(names, c.blindIndex)
+		}
+	}
+
+	g.p("func insert%s(q db.Query, ef execFunc, v %s) error {", g.cfg.typeName, g.typ(g.cfg.typeName))
+	g.p("if db.IsZero(v.%s) {", g.pk.field)
+	g.p("return fmt.Errorf(\"zero %s provided: %%w\", errorz.ErrConstraintViolated)", g.pk.name)
+	g.p("}")
+	g.p("")
+	g.p("q.Unsafe(`INSERT INTO %s (%s) VALUES (`)", g.cfg.table, strings.Join(names, ", "))
+	for i, c := range g.cols {
+		if i > 0 {
+			g.p("q.Unsafe(`, `)")
+		}
+		g.param(c)
+		if c.blindIndex != "" {
+			g.p("q.Unsafe(`, `)")
+			g.p("q.ParamBlindIndex([]byte(v.%s))", c.field)
+		}
+	}
+	g.p("q.Unsafe(`)`)")
+	g.p("")
+	g.p("s, params, err := q.Get()")
+	g.p("if err != nil {")
+	g.p("return err")
+	g.p("}")
+	g.p("")
+	g.p("_, err = ef(s, params...)")
+	g.p("if err != nil {")
+	g.p("return errorz.MapDBErr(err)")
+	g.p("}")
+	g.p("")
+	g.p("return nil")
+	g.p("}")
+	g.p("")
+
+	return nil
+}
+
+func (g *generator) update() error {
+	if g.pk == nil {
+		return fmt.Errorf("%s needs a pk field to generate %s", g.cfg.typeName, funcUpdate)
+	}
+
+	g.p("func update%s(q db.Query, ef execFunc, v %s) error {", g.cfg.typeName, g.typ(g.cfg.typeName))
+	g.p("q.Unsafe(`UPDATE %s SET `)", g.cfg.table)
+
+	sep := ""
+	for _, c := range g.cols {
+		if c.pk {
+			continue
+		}
+
+		g.p("")
+		g.p("q.Unsafe(`%s%s = `)", sep, c.name)
+		g.param(c)
+		sep = ", "
+
+		if c.blindIndex != "" {
+			g.p("")
+			g.p("q.Unsafe(`, %s = `)", c.blindIndex)
+			g.p("q.ParamBlindIndex([]byte(v.%s))", c.field)
+		}
+	}
+
+	g.p("")
+	g.p("q.Unsafe(` WHERE %s = `)", g.pk.name)
+	g.p("q.Param(v.%s)", g.pk.field)
+	g.p("")
+	g.p("s, params, err := q.Get()")
+	g.p("if err != nil {")
+	g.p("return err")
+	g.p("}")
+	g.p("")
+	g.p("result, err := ef(s, params...)")
+	g.p("if err != nil {")
+	g.p("return errorz.MapDBErr(err)")
+	g.p("}")
+	g.p("")
+	g.p("rows, err := result.RowsAffected()")
+	g.p("if err != nil {")
+	g.p("return errorz.MapDBErr(err)")
+	g.p("}")
+	g.p("")
+	g.p("if rows == 0 {")
+	g.p("return fmt.Errorf(\"%s not found: %%w\", errorz.ErrNotFound)", words(g.cfg.typeName))
+	g.p("}")
+	g.p("")
+	g.p("return nil")
+	g.p("}")
+	g.p("")
+
+	return nil
+}
+
+// param writes the value of column c of v as a parameter.
+func (g *generator) param(c column) {
+	switch {
+	case c.encrypted && c.nullZero:
+		g.p("if db.IsZero(v.%s) {", c.field)
+		g.p("q.Param(nil)")
+		g.p("} else {")
+		g.p("q.ParamEncrypted([]byte(v.%s))", c.field)
+		g.p("}")
+	case c.encrypted:
+		g.p("q.ParamEncrypted([]byte(v.%s))", c.field)
+	case c.stringer:
+		g.p("q.Param(v.%s.String())", c.field)
+	case c.nullZero:
+		g.p("q.Param(db.NullIfZero(v.%s))", c.field)
+	default:
+		g.p("q.Param(v.%s)", c.field)
+	}
+}
+
+func (g *generator) selectFunc() {
+	names := make([]string, 0, len(g.cols))
+	for _, c := range g.cols {
+		names = append(names, c.name)
+	}
+
+	g.p("func select%s(q db.Query, qf queryFunc, f %s) ([]%s, error) {", g.cfg.plural, g.typ(g.cfg.filter), g.typ(g.cfg.typeName))
+	g.p("q.Unsafe(`SELECT %s FROM %s WHERE 1=1 `)", strings.Join(names, ", "), g.cfg.table)
+
+	var limit *condition
+	for i, c := range g.conds {
+		g.p("")
+		switch c.op {
+		case opIn:
+			g.p("if len(f.%s) > 0 {", c.field)
+			g.p("q.Unsafe(`AND %s IN (`)", c.column)
+			if c.blindIndex {
+				g.p("for i, v := range f.%s {", c.field)
+				g.p("if i > 0 {")
+				g.p("q.Unsafe(`, `)")
+				g.p("}")
+				g.p("q.ParamBlindIndex([]byte(v))")
+				g.p("}")
+			} else {
+				g.p("q.Params(db.AnySlice(f.%s)...)", c.field)
+			}
+			g.p("q.Unsafe(`) `)")
+			g.p("}")
+		case opEq:
+			g.p("if f.%s != nil {", c.field)
+			g.p("q.Unsafe(`AND %s = `)", c.column)
+			g.p("q.Param(*f.%s)", c.field)
+			g.p("q.Unsafe(` `)")
+			g.p("}")
+		case opNotNull:
+			g.p("if f.%s != nil {", c.field)
+			g.p("q.Unsafe(`AND %s IS `)", c.column)
+			g.p("if *f.%s {", c.field)
+			g.p("q.Unsafe(`NOT `)")
+			g.p("}")
+			g.p("q.Unsafe(`NULL `)")
+			g.p("}")
+		case opLimit:
+			limit = &g.conds[i]
+		}
+	}
+
+	if g.cfg.order != "" {
+		g.p("")
+		g.p("q.Unsafe(`ORDER BY %s`)", g.cfg.order)
+	}
+
+	if limit != nil {
+		g.p("")
+		g.p("if f.%s > 0 {", limit.field)
+		g.p("q.Unsafe(` LIMIT `)")
+		g.p("q.Param(f.%s)", limit.field)
+		g.p("}")
+	}
+
+	g.p("")
+	g.p("s, params, err := q.Get()")
+	g.p("if err != nil {")
+	g.p("return nil, err")
+	g.p("}")
+	g.p("")
+	g.p("rows, err := qf(s, params...)")
+	g.p("if err != nil {")
+	g.p("return nil, errorz.MapDBErr(err)")
+	g.p("}")
+	g.p("")
+	g.p("defer rows.Close()")
+	g.p("")
+	g.p("out := make([]%s, 0)", g.typ(g.cfg.typeName))
+	g.p("for rows.Next() {")
+	g.p("var v %s", g.typ(g.cfg.typeName))
+
+	targets := make([]string, 0, len(g.cols))
+	for _, c := range g.cols {
+		switch {
+		case c.encrypted:
+			g.p("%s := q.DecryptionTarget()", dataVar(c))
+			targets = append(targets, dataVar(c))
+		case c.nullZero:
+			g.imports["sql"] = "database/sql"
+			g.p("var %s sql.Null[%s]", nullVar(c), c.typ)
+			targets = append(targets, "&"+nullVar(c))
+		default:
+			targets = append(targets, "&v."+c.field)
+		}
+	}
+
+	g.p("err := rows.Scan(%s)", strings.Join(targets, ", "))
+	g.p("if err != nil {")
+	g.p("return nil, errorz.MapDBErr(err)")
+	g.p("}")
+	g.p("")
+
+	for _, c := range g.cols {
+		switch {
+		case c.encrypted:
+			g.p("v.%s = %s(%s.Data)", c.field, c.typ, dataVar(c))
+		case c.nullZero:
+			g.p("v.%s = %s.V", c.field, nullVar(c))
+		}
+	}
+
+	g.p("")
+	g.p("out = append(out, v)")
+	g.p("}")
+	g.p("")
+	g.p("if err := rows.Err(); err != nil {")
+	g.p("return nil, errorz.MapDBErr(err)")
+	g.p("}")
+	g.p("")
+	g.p("return out, nil")
+	g.p("}")
+	g.p("")
+}
+
+// dataVar is the name of the variable decrypted data of c is scanned into.
+func dataVar(c column) string {
+	return lowerFirst(c.field) + "Data"
+}
+
+// nullVar is the name of the variable nullable values of c are scanned into.
+func nullVar(c column) string {
+	return lowerFirst(c.field) + "Null"
+}
+
+// lowerFirst lowercases the leading upper case letters of s, so "ID" becomes
+// "id" and "ActorID" becomes "actorID".
+func lowerFirst(s string) string {
+	r := []rune(s)
+	for i := range r {
+		if !unicode.IsUpper(r[i]) {
+			break
+		}
+		// Keep the last upper case letter of an initialism before a word, like the P in "URLPath".
+		if i > 0 && i+1 < len(r) && unicode.IsLower(r[i+1]) {
+			break
+		}
+		r[i] = unicode.ToLower(r[i])
+	}
+	return string(r)
+}
+
+// words splits a CamelCase name into lower case words, so "EmailToken" becomes "email token".
+func words(s string) string {
+	var b strings.Builder
+	r := []rune(s)
+	for i := range r {
+		if i > 0 && unicode.IsUpper(r[i]) && (unicode.IsLower(r[i-1]) || (i+1 < len(r) && unicode.IsLower(r[i+1]))) {
+			b.WriteRune(' ')
+		}
+		b.WriteRune(unicode.ToLower(r[i]))
+	}
+	return b.String()
+}
@@ -0,0 +1,140 @@
+// Command querygen generates the query functions of a store from the db tags on domain types.
+//
+// It's intended to be run with go generate from the package of the store, for example:
+//
+//	//go:generate go run ../../../cmd/querygen -src .. -type User -table users -filter UserFilter -order "id ASC" -out users.gen.go
+//
+// The db tag of a field of the domain type holds the name of its column, followed by options:
+//
+//	pk                   the column identifies the row, required for insert and update.
+//	encrypted            the value is encrypted, the field must have a string or []byte type.
+//	blindindex=<column>  also store a blind index of the value in <column>.
+//	stringer             store the value using its String method.
+//	nullzero             store the zero value as NULL.
+//
+// The db tag of a field of the filter type holds the name of a column, followed by an operator:
+//
+//	in          the column must equal one of the values in the slice, if it's not empty.
+//	            Add the blindindex option to compare with the blind index of the values.
+//	eq          the column must equal the pointed to value, if the pointer is not nil.
+//	notnull     the column must not be NULL if the pointed to bool is true, and must be NULL
+//	            if it's false.
+//	limit       limits the number of rows if the value is positive, the column name is empty.
+//
+// Fields without a db tag are ignored. The generated functions use the execFunc and
+// queryFunc types, which must be declared in the package of the store.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// config configures the generation of query functions for a single domain type.
+type config struct {
+	// src is the directory of the package with the domain types.
+	src      string
+	typeName string
+	// plural is used in the name of the select function.
+	plural string
+	table  string
+	filter string
+	order  string
+	funcs  []string
+	// pkgName is the name of the package the code is generated for.
+	pkgName string
+	out     string
+}
+
+func (c config) has(f string) bool {
+	for _, v := range c.funcs {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
+
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	err := run(os.Args[1:])
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "querygen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	cfg, err := parseConfig(".", args)
+	if err != nil {
+		return err
+	}
+
+	code, err := generate(cfg)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(cfg.out, code, 0o644)
+}
+
+// parseConfig parses the arguments of a querygen invocation in dir.
+func parseConfig(dir string, args []string) (config, error) {
+	var (
+		cfg   config
+		funcs string
+	)
+
+	fs := flag.NewFlagSet("querygen", flag.ContinueOnError)
+	fs.StringVar(&cfg.src, "src", ".", "directory of the package with the domain types")
+	fs.StringVar(&cfg.typeName, "type", "", "name of the domain type")
+	fs.StringVar(&cfg.plural, "plural", "", "plural of the domain type, defaults to the type with an s appended")
+	fs.StringVar(&cfg.table, "table", "", "name of the table")
+	fs.StringVar(&cfg.filter, "filter", "", "name of the filter type, required for select")
+	fs.StringVar(&cfg.order, "order", "", "ORDER BY clause of select")
+	fs.StringVar(&funcs, "funcs", "insert,update,select", "comma separated functions to generate")
+	fs.StringVar(&cfg.pkgName, "pkg", "", "name of the generated package, defaults to the package in the current directory")
+	fs.StringVar(&cfg.out, "out", "", "file to write the generated code to")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return config{}, errUsage
+	}
+
+	if cfg.typeName == "" || cfg.table == "" || cfg.out == "" {
+		fs.Usage()
+		return config{}, errUsage
+	}
+
+	if cfg.plural == "" {
+		cfg.plural = cfg.typeName + "s"
+	}
+
+	cfg.funcs = strings.Split(funcs, ",")
+	cfg.src = filepath.Join(dir, cfg.src)
+	cfg.out = filepath.Join(dir, cfg.out)
+
+	if cfg.pkgName == "" {
+		// go generate sets GOPACKAGE to the package of the file with the directive.
+		cfg.pkgName = os.Getenv("GOPACKAGE")
+	}
+
+	if cfg.pkgName == "" {
+		pkg, err := parsePackage(dir)
+		if err != nil {
+			return config{}, fmt.Errorf("failed to determine package name: %w", err)
+		}
+		cfg.pkgName = pkg.name
+	}
+
+	return cfg, nil
+}
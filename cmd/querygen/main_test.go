@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Test_Generated checks that the checked in code of all querygen directives in the
+// repository is up to date, and that generating it is reproducible.
+func Test_Generated(t *testing.T) {
+	directives := findDirectives(t, filepath.Join("..", ".."))
+	if len(directives) == 0 {
+		t.Fatalf("no querygen directives found")
+	}
+
+	for _, d := range directives {
+		t.Run(d.String(), func(t *testing.T) {
+			cfg, err := parseConfig(d.dir, d.args)
+			if err != nil {
+				t.Fatalf("failed to parse config: %v", err)
+			}
+
+			got, err := generate(cfg)
+			if err != nil {
+				t.Fatalf("failed to generate: %v", err)
+			}
+
+			again, err := generate(cfg)
+			if err != nil {
+				t.Fatalf("failed to generate: %v", err)
+			}
+
+			if !bytes.Equal(got, again) {
+				t.Fatalf("generated code differs between runs")
+			}
+
+			want, err := os.ReadFile(cfg.out)
+			if err != nil {
+				t.Fatalf("failed to read generated file: %v", err)
+			}
+
+			if !bytes.Equal(got, want) {
+				t.Fatalf("%s is out of date, run go generate in %s", cfg.out, d.dir)
+			}
+		})
+	}
+}
+
+func Test_Generate(t *testing.T) {
+	tests := map[string]struct {
+		src     string
+		args    []string
+		wantErr bool
+	}{
+		"ok, all functions": {
+			src:  "type T struct {\n\tID int `db:\"id,pk\"`\n\tName string `db:\"name,encrypted,nullzero\"`\n}\ntype F struct {\n\tIDs []int `db:\"id,in\"`\n}",
+			args: []string{"-type", "T", "-table", "t", "-filter", "F", "-out", "t.gen.go"},
+		},
+		"fail, unknown option": {
+			src:     "type T struct {\n\tID int `db:\"id,pk,unknown\"`\n}",
+			args:    []string{"-type", "T", "-table", "t", "-funcs", "insert", "-out", "t.gen.go"},
+			wantErr: true,
+		},
+		"fail, insert without pk": {
+			src:     "type T struct {\n\tID int `db:\"id\"`\n}",
+			args:    []string{"-type", "T", "-table", "t", "-funcs", "insert", "-out", "t.gen.go"},
+			wantErr: true,
+		},
+		"fail, select without filter": {
+			src:     "type T struct {\n\tID int `db:\"id,pk\"`\n}",
+			args:    []string{"-type", "T", "-table", "t", "-funcs", "select", "-out", "t.gen.go"},
+			wantErr: true,
+		},
+		"fail, filter without operator": {
+			src:     "type T struct {\n\tID int `db:\"id,pk\"`\n}\ntype F struct {\n\tIDs []int `db:\"id\"`\n}",
+			args:    []string{"-type", "T", "-table", "t", "-filter", "F", "-out", "t.gen.go"},
+			wantErr: true,
+		},
+		"fail, unknown type": {
+			src:     "type T struct {\n\tID int `db:\"id,pk\"`\n}",
+			args:    []string{"-type", "U", "-table", "t", "-funcs", "insert", "-out", "t.gen.go"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			mustWriteFile(t, filepath.Join(dir, "go.mod"), "module example.com/test\n")
+			mustWriteFile(t, filepath.Join(dir, "domain", "domain.go"), "package domain\n\n"+tc.src+"\n")
+			mustWriteFile(t, filepath.Join(dir, "store", "store.go"), "package store\n")
+
+			args := append([]string{"-src", "../domain"}, tc.args...)
+			cfg, err := parseConfig(filepath.Join(dir, "store"), args)
+			if err != nil {
+				t.Fatalf("failed to parse config: %v", err)
+			}
+
+			code, err := generate(cfg)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got code:\n%s", code)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !bytes.HasPrefix(code, []byte("// Code generated by querygen. DO NOT EDIT.\n\npackage store\n")) {
+				t.Errorf("unexpected header:\n%s", code)
+			}
+		})
+	}
+}
+
+type directive struct {
+	dir  string
+	args []string
+}
+
+func (d directive) String() string {
+	return filepath.ToSlash(d.dir) + " " + strings.Join(d.args, " ")
+}
+
+// findDirectives finds all go:generate directives that run querygen in root.
+func findDirectives(t *testing.T, root string) []directive {
+	t.Helper()
+
+	directives := make([]directive, 0)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() && path != root && (d.Name() == "node_modules" || strings.HasPrefix(d.Name(), ".")) {
+			return filepath.SkipDir
+		}
+
+		if d.IsDir() || !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			line, ok := strings.CutPrefix(s.Text(), "//go:generate go run ")
+			if !ok {
+				continue
+			}
+
+			fields := splitArgs(t, line)
+			if len(fields) == 0 || !strings.HasSuffix(fields[0], "cmd/querygen") {
+				continue
+			}
+
+			directives = append(directives, directive{
+				dir:  filepath.Dir(path),
+				args: fields[1:],
+			})
+		}
+
+		return s.Err()
+	})
+	if err != nil {
+		t.Fatalf("failed to find directives: %v", err)
+	}
+
+	return directives
+}
+
+// splitArgs splits a line into arguments like go generate does, double quoted
+// arguments can contain spaces.
+func splitArgs(t *testing.T, line string) []string {
+	t.Helper()
+
+	args := make([]string, 0)
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimSpace(line) {
+		if line[0] != '"' {
+			arg, rest, _ := strings.Cut(line, " ")
+			args = append(args, arg)
+			line = rest
+			continue
+		}
+
+		end := strings.Index(line[1:], `"`) + 1
+		if end == 0 {
+			t.Fatalf("unterminated quoted argument in %q", line)
+		}
+
+		arg, err := strconv.Unquote(line[:end+1])
+		if err != nil {
+			t.Fatalf("invalid quoted argument in %q: %v", line, err)
+		}
+
+		args = append(args, arg)
+		line = line[end+1:]
+	}
+
+	return args
+}
+
+func mustWriteFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+
+	err = os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+}
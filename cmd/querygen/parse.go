@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// srcPackage is the parsed package containing the domain types.
+type srcPackage struct {
+	name string
+	path string
+	// module is the path of the module the package belongs to.
+	module  string
+	structs map[string]*ast.StructType
+	// imports maps the names of imported packages to their paths. An empty
+	// path means the name refers to different packages in different files.
+	imports map[string]string
+}
+
+// column is a field of a domain type that is stored in a column.
+type column struct {
+	field string
+	name  string
+	// typ is the type of the field, as it should be written in the generated code.
+	typ string
+	// pk marks the column that identifies a row.
+	pk bool
+	// encrypted columns are encrypted before they're stored.
+	encrypted bool
+	// blindIndex is the name of the column that stores a blind index of this field.
+	blindIndex string
+	// stringer columns are stored using their String method.
+	stringer bool
+	// nullZero columns are stored as NULL if they have the zero value.
+	nullZero bool
+}
+
+// condition is a field of a filter type.
+type condition struct {
+	field  string
+	column string
+	op     string
+	// blindIndex conditions compare to the blind index of the values.
+	blindIndex bool
+}
+
+const (
+	// opIn matches rows where the column is one of the values in a slice.
+	opIn = "in"
+	// opEq matches rows where the column equals the value of a pointer.
+	opEq = "eq"
+	// opNotNull matches rows where the column is not NULL if the value of a
+	// bool pointer is true, and rows where it is NULL if it's false.
+	opNotNull = "notnull"
+	// opLimit limits the number of rows.
+	opLimit = "limit"
+)
+
+func parsePackage(dir string) (*srcPackage, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", dir, err)
+	}
+
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected 1 package in %s, found %d", dir, len(pkgs))
+	}
+
+	module, importPath, err := packagePath(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := &srcPackage{
+		path:    importPath,
+		module:  module,
+		structs: make(map[string]*ast.StructType),
+		imports: make(map[string]string),
+	}
+
+	for _, p := range pkgs {
+		pkg.name = p.Name
+
+		// Sort the files, so conflicts are reported consistently.
+		names := make([]string, 0, len(p.Files))
+		for name := range p.Files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			f := p.Files[name]
+			for _, imp := range f.Imports {
+				impPath, err := strconv.Unquote(imp.Path.Value)
+				if err != nil {
+					return nil, err
+				}
+
+				impName := path.Base(impPath)
+				if imp.Name != nil {
+					impName = imp.Name.Name
+				}
+
+				if existing, ok := pkg.imports[impName]; ok && existing != impPath {
+					impPath = ""
+				}
+				pkg.imports[impName] = impPath
+			}
+
+			ast.Inspect(f, func(n ast.Node) bool {
+				spec, ok := n.(*ast.TypeSpec)
+				if !ok {
+					return true
+				}
+
+				if st, ok := spec.Type.(*ast.StructType); ok {
+					pkg.structs[spec.Name.Name] = st
+				}
+				return false
+			})
+		}
+	}
+
+	return pkg, nil
+}
+
+// packagePath returns the module and import path of the package in dir, based on the nearest go.mod.
+func packagePath(dir string) (string, string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	for root := abs; ; root = filepath.Dir(root) {
+		module, err := modulePath(filepath.Join(root, "go.mod"))
+		if errors.Is(err, os.ErrNotExist) {
+			if root == filepath.Dir(root) {
+				return "", "", fmt.Errorf("no go.mod found for %s", dir)
+			}
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+
+		rel, err := filepath.Rel(root, abs)
+		if err != nil {
+			return "", "", err
+		}
+
+		if rel == "." {
+			return module, module, nil
+		}
+		return module, module + "/" + filepath.ToSlash(rel), nil
+	}
+}
+
+func modulePath(goMod string) (string, error) {
+	f, err := os.Open(goMod)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if module, ok := strings.CutPrefix(line, "module "); ok {
+			return strings.Trim(strings.TrimSpace(module), `"`), nil
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("no module directive in %s", goMod)
+}
+
+// columns returns the columns of the struct named typeName, based on the db tags of its fields.
+// Fields without a db tag, or with the tag db:"-", are not stored.
+func (p *srcPackage) columns(typeName string, r *typeRenderer) ([]column, error) {
+	st, ok := p.structs[typeName]
+	if !ok {
+		return nil, fmt.Errorf("struct %s not found in package %s", typeName, p.name)
+	}
+
+	cols := make([]column, 0)
+	for _, field := range st.Fields.List {
+		tag, ok := dbTag(field)
+		if !ok {
+			continue
+		}
+
+		if len(field.Names) != 1 {
+			return nil, fmt.Errorf("%s: db tag requires a single named field", typeName)
+		}
+
+		name, opts := parseTag(tag)
+		c := column{
+			field: field.Names[0].Name,
+			name:  name,
+		}
+
+		for _, opt := range opts {
+			key, value, _ := strings.Cut(opt, "=")
+			switch key {
+			case "pk":
+				c.pk = true
+			case "encrypted":
+				c.encrypted = true
+			case "blindindex":
+				if value == "" {
+					return nil, fmt.Errorf("%s.%s: blindindex requires a column name", typeName, c.field)
+				}
+				c.blindIndex = value
+			case "stringer":
+				c.stringer = true
+			case "nullzero":
+				c.nullZero = true
+			default:
+				return nil, fmt.Errorf("%s.%s: unknown option %q", typeName, c.field, opt)
+			}
+		}
+
+		if c.name == "" {
+			return nil, fmt.Errorf("%s.%s: db tag has no column name", typeName, c.field)
+		}
+
+		if c.stringer && (c.encrypted || c.nullZero) {
+			return nil, fmt.Errorf("%s.%s: stringer can't be combined with encrypted or nullzero", typeName, c.field)
+		}
+
+		if c.blindIndex != "" && c.nullZero {
+			return nil, fmt.Errorf("%s.%s: blindindex can't be combined with nullzero", typeName, c.field)
+		}
+
+		// The type is only needed to convert decrypted data and to scan NULL values.
+		if c.encrypted || c.nullZero {
+			var err error
+			c.typ, err = r.render(field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", typeName, c.field, err)
+			}
+		}
+
+		cols = append(cols, c)
+	}
+
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("struct %s has no fields with a db tag", typeName)
+	}
+
+	return cols, nil
+}
+
+// conditions returns the conditions of the filter struct named typeName, based on
+// the db tags of its fields.
+func (p *srcPackage) conditions(typeName string) ([]condition, error) {
+	st, ok := p.structs[typeName]
+	if !ok {
+		return nil, fmt.Errorf("struct %s not found in package %s", typeName, p.name)
+	}
+
+	conds := make([]condition, 0)
+	for _, field := range st.Fields.List {
+		tag, ok := dbTag(field)
+		if !ok {
+			continue
+		}
+
+		if len(field.Names) != 1 {
+			return nil, fmt.Errorf("%s: db tag requires a single named field", typeName)
+		}
+
+		name, opts := parseTag(tag)
+		c := condition{
+			field:  field.Names[0].Name,
+			column: name,
+		}
+
+		for _, opt := range opts {
+			switch opt {
+			case opIn, opEq, opNotNull, opLimit:
+				if c.op != "" {
+					return nil, fmt.Errorf("%s.%s: multiple operators", typeName, c.field)
+				}
+				c.op = opt
+			case "blindindex":
+				c.blindIndex = true
+			default:
+				return nil, fmt.Errorf("%s.%s: unknown option %q", typeName, c.field, opt)
+			}
+		}
+
+		if c.op == "" {
+			return nil, fmt.Errorf("%s.%s: no operator, expected one of %s, %s, %s or %s", typeName, c.field, opIn, opEq, opNotNull, opLimit)
+		}
+
+		if (c.op == opLimit) != (c.column == "") {
+			return nil, fmt.Errorf("%s.%s: a column name is required for all operators except %s", typeName, c.field, opLimit)
+		}
+
+		if c.blindIndex && c.op != opIn {
+			return nil, fmt.Errorf("%s.%s: blindindex is only supported for %s", typeName, c.field, opIn)
+		}
+
+		conds = append(conds, c)
+	}
+
+	return conds, nil
+}
+
+func dbTag(field *ast.Field) (string, bool) {
+	if field.Tag == nil {
+		return "", false
+	}
+
+	raw, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return "", false
+	}
+
+	tag, ok := reflect.StructTag(raw).Lookup("db")
+	if !ok || tag == "-" {
+		return "", false
+	}
+
+	return tag, true
+}
+
+func parseTag(tag string) (string, []string) {
+	parts := strings.Split(tag, ",")
+	return parts[0], parts[1:]
+}
+
+// typeRenderer writes type expressions of the source package, so they can be
+// used in the generated code. It keeps track of the packages that need to be imported.
+type typeRenderer struct {
+	pkg     *srcPackage
+	imports map[string]string
+}
+
+func (r *typeRenderer) render(expr ast.Expr) (string, error) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if types.Universe.Lookup(e.Name) != nil {
+			return e.Name, nil
+		}
+		// Types declared in the source package itself.
+		r.imports[r.pkg.name] = r.pkg.path
+		return r.pkg.name + "." + e.Name, nil
+	case *ast.SelectorExpr:
+		x, ok := e.X.(*ast.Ident)
+		if !ok {
+			return "", fmt.Errorf("unsupported type %T", e.X)
+		}
+
+		impPath := r.pkg.imports[x.Name]
+		if impPath == "" {
+			return "", fmt.Errorf("can't resolve package %s", x.Name)
+		}
+
+		r.imports[x.Name] = impPath
+		return x.Name + "." + e.Sel.Name, nil
+	case *ast.StarExpr:
+		s, err := r.render(e.X)
+		return "*" + s, err
+	case *ast.ArrayType:
+		if e.Len != nil {
+			return "", errors.New("unsupported array type")
+		}
+		s, err := r.render(e.Elt)
+		return "[]" + s, err
+	default:
+		return "", fmt.Errorf("unsupported type %T", expr)
+	}
+}
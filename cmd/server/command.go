@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+const helpText = `Usage:
+  server
+  server config check
+
+Without arguments, the server is started.
+
+config check prints the effective config and lists all problems with it,
+without starting the server. Secrets are redacted. The exit code is 1 if
+the config is invalid.
+
+The config is read from env variables and the optional TOML or JSON file
+in CONFIG_FILE. Env variables take precedence over the config file. Every
+env variable can also be read from a file by appending _FILE to its name,
+like HTTP_CSRF_KEY_FILE=/run/secrets/csrf_key.`
+
+// runCommand runs the command in args and returns the exit code.
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 2 && args[0] == "config" && args[1] == "check" {
+		return configCheck(stdout)
+	}
+
+	fmt.Fprintln(stderr, helpText)
+	return 1
+}
+
+// configCheck loads the config and writes a report about it to w.
+func configCheck(w io.Writer) int {
+	cfg, report, err := loadConfig()
+
+	if report.file == "" {
+		fmt.Fprintln(w, "Config file: none")
+	} else {
+		fmt.Fprintf(w, "Config file: %s\n", report.file)
+	}
+
+	fmt.Fprintln(w, "\nEffective config:")
+	for _, key := range envKeys() {
+		source, ok := report.sources[key]
+		if !ok {
+			source = "default"
+		}
+
+		// Keys and secrets format as krypto.SecretMarker.
+		fmt.Fprintf(w, "  %s=%v (%s)\n", key, envMap[key].value(&cfg), source)
+	}
+
+	if len(report.warnings) > 0 {
+		fmt.Fprintln(w, "\nWarnings:")
+		for _, warning := range report.warnings {
+			fmt.Fprintf(w, "  - %s\n", warning)
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintln(w, "\nErrors:")
+		for _, e := range unjoin(err) {
+			fmt.Fprintf(w, "  - %s\n", e)
+		}
+		return 1
+	}
+
+	fmt.Fprintln(w, "\nOK")
+	return 0
+}
+
+// unjoin returns the errors that were joined in err.
+func unjoin(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
@@ -6,14 +6,21 @@ import (
 	"math"
 	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/audit"
 	"github.com/willemschots/househunt/internal/auth"
+	"github.com/willemschots/househunt/internal/db/backup"
 	"github.com/willemschots/househunt/internal/email"
 	"github.com/willemschots/househunt/internal/email/postmark"
+	"github.com/willemschots/househunt/internal/email/smtp"
+	"github.com/willemschots/househunt/internal/jobs"
 	"github.com/willemschots/househunt/internal/krypto"
+	"github.com/willemschots/househunt/internal/tracing"
 	"github.com/willemschots/househunt/internal/web"
 )
 
@@ -24,12 +31,42 @@ type httpConfig struct {
 	writeTimeout    time.Duration
 	idleTimeout     time.Duration
 	shutdownTimeout time.Duration
+	// drainDelay is how long we keep serving after /readyz starts failing on
+	// shutdown, so load balancers have time to stop sending us requests.
+	drainDelay time.Duration
 	// cookieKeys are the pairs of keys used to authenticate and encrypt cookies.
 	// see https://pkg.go.dev/github.com/gorilla/sessions for more information on how these
 	// are interpreted.
 	cookieKeys []krypto.Key
-	server     web.ServerConfig
-	viewDir    string // viewDir provides a directory to load templates from. If empty, the embedded templates are used.
+	// adminUserIDs are granted the admin role on startup. This is how the first
+	// admins are appointed, after that roles can be managed via the back-office.
+	adminUserIDs []uuid.UUID
+	// adminAddr is the address of the admin listener, it serves operational endpoints
+	// like /metrics that should not be exposed to the public. If empty, it's disabled.
+	// Not to be confused with the admin back-office, which is served by the main listener.
+	adminAddr string
+	server    web.ServerConfig
+	viewDir   string // viewDir provides a directory to load templates from. If empty, the embedded templates are used.
+	tls       tlsConfig
+}
+
+// tlsConfig configures serving HTTPS.
+type tlsConfig struct {
+	// mode is how certificates are obtained, one of "off", "files", "self-signed" or "acme".
+	mode string
+	// certPath and keyPath are the PEM encoded certificate and key used in the "files" mode.
+	// They are reloaded when they change.
+	certPath string
+	keyPath  string
+	// acmeDomains are the domains certificates are requested for in the "acme" mode.
+	acmeDomains []string
+	// acmeEmail is the contact address registered with the ACME server, it's optional.
+	acmeEmail string
+	// acmeCacheDir is where certificates obtained via ACME are stored.
+	acmeCacheDir string
+	// redirectAddr is the address of a plain HTTP listener that redirects to HTTPS. In
+	// the "acme" mode it also answers HTTP-01 challenges. If empty, it's disabled.
+	redirectAddr string
 }
 
 // dbConfig is the database configuration.
@@ -44,6 +81,17 @@ type emailConfig struct {
 	driver   string
 	service  email.ServiceConfig
 	postmark postmark.Settings
+	smtp     smtp.Settings
+	viewDir  string // viewDir provides a directory to load email templates from. If empty, the embedded templates are used.
+}
+
+// traceConfig is the configuration for tracing.
+type traceConfig struct {
+	// exporter is where spans are exported to, one of "none", "stdout" or "otlp".
+	exporter string
+	// otlpEndpoint is the URL spans are posted to by the otlp exporter.
+	otlpEndpoint *url.URL
+	tracer       tracing.Config
 }
 
 // config is the configuration for the server command.
@@ -51,7 +99,12 @@ type config struct {
 	http  httpConfig
 	db    dbConfig
 	auth  auth.ServiceConfig
+	audit audit.RetentionConfig
 	email emailConfig
+	trace traceConfig
+	// backup configures scheduled backups, they are disabled if Dir is empty.
+	backup backup.ScheduleConfig
+	jobs   jobs.Config
 }
 
 // defaultConfig returns a config with sane default values.
@@ -65,10 +118,17 @@ func defaultConfig() config {
 			writeTimeout:    time.Second * 10,
 			idleTimeout:     time.Second * 120,
 			shutdownTimeout: time.Second * 15,
+			adminAddr:       "localhost:8889",
 			server: web.ServerConfig{
-				SecureCookie: true,
+				// SecureCookie defaults to whether the site is served over HTTPS, see loadConfig.
+				SecureCookie: false,
+				CSP:          web.DefaultCSP,
+				HSTSMaxAge:   time.Hour * 24 * 365,
 			},
 			viewDir: "",
+			tls: tlsConfig{
+				mode: tlsModeOff,
+			},
 		},
 		db: dbConfig{
 			file:    "househunt.db",
@@ -78,6 +138,15 @@ func defaultConfig() config {
 			WorkerTimeout: time.Second * 30,
 			TokenExpiry:   time.Minute * 30,
 		},
+		audit: audit.RetentionConfig{
+			MaxAge:   time.Hour * 24 * 90,
+			Interval: time.Hour,
+		},
+		jobs: jobs.Config{
+			PollInterval: time.Second * 5,
+			BackoffBase:  time.Second * 10,
+			BackoffMax:   time.Hour,
+		},
 		email: emailConfig{
 			driver: "log",
 			service: email.ServiceConfig{
@@ -87,6 +156,28 @@ func defaultConfig() config {
 				APIURL:        must(url.Parse("https://api.postmarkapp.com/email")),
 				MessageStream: "outbound",
 			},
+			smtp: smtp.Settings{
+				Port:    587,
+				TLSMode: smtp.TLSModeStartTLS,
+				// Auth defaults to plain if there is a username, see loadConfig.
+				Auth:    smtp.AuthNone,
+				Timeout: time.Second * 10,
+			},
+		},
+		backup: backup.ScheduleConfig{
+			Dir:      "",
+			Interval: time.Hour * 24,
+			Retention: backup.RetentionPolicy{
+				KeepLast: 7,
+			},
+		},
+		trace: traceConfig{
+			exporter:     "none",
+			otlpEndpoint: must(url.Parse("http://localhost:4318/v1/traces")),
+			tracer: tracing.Config{
+				FlushInterval: time.Second * 5,
+				MaxQueueSize:  2048,
+			},
 		},
 	}
 }
@@ -96,6 +187,9 @@ type envVariable struct {
 	required bool
 	// mapFunc maps the env variable value to the config struct.
 	mapFunc func(v string, c *config) error
+	// value returns the value of the field in the config struct, it's used to
+	// report the effective config. Secrets are redacted when formatted.
+	value func(c *config) any
 }
 
 // envMap maps environment variable names to fields in the config struct.
@@ -104,142 +198,520 @@ var envMap = map[string]envVariable{
 		mapFunc: func(v string, c *config) error {
 			return confURL(v, c.email.service.BaseURL)
 		},
+		value: func(c *config) any { return c.email.service.BaseURL },
 	},
 	"HTTP_ADDR": {
 		mapFunc: func(v string, c *config) error {
 			c.http.addr = v
 			return nil
 		},
+		value: func(c *config) any { return c.http.addr },
 	},
 	"HTTP_READ_TIMEOUT": {
 		mapFunc: func(v string, c *config) error {
 			return confDuration(v, &c.http.readTimeout, 0, math.MaxInt64)
 		},
+		value: func(c *config) any { return c.http.readTimeout },
 	},
 	"HTTP_WRITE_TIMEOUT": {
 		mapFunc: func(v string, c *config) error {
 			return confDuration(v, &c.http.writeTimeout, 0, math.MaxInt64)
 		},
+		value: func(c *config) any { return c.http.writeTimeout },
 	},
 	"HTTP_IDLE_TIMEOUT": {
 		mapFunc: func(v string, c *config) error {
 			return confDuration(v, &c.http.idleTimeout, 0, math.MaxInt64)
 		},
+		value: func(c *config) any { return c.http.idleTimeout },
 	},
 	"HTTP_SHUTDOWN_TIMEOUT": {
 		mapFunc: func(v string, c *config) error {
 			return confDuration(v, &c.http.shutdownTimeout, 0, math.MaxInt64)
 		},
+		value: func(c *config) any { return c.http.shutdownTimeout },
+	},
+	"HTTP_DRAIN_DELAY": {
+		mapFunc: func(v string, c *config) error {
+			return confDuration(v, &c.http.drainDelay, 0, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.http.drainDelay },
 	},
 	"HTTP_COOKIE_KEYS": {
 		required: true,
 		mapFunc: func(v string, c *config) error {
 			return confSliceOf(v, &c.http.cookieKeys, krypto.ParseKey, 2, math.MaxInt64)
 		},
+		value: func(c *config) any { return c.http.cookieKeys },
 	},
 	"HTTP_SECURE_COOKIE": {
 		mapFunc: func(v string, c *config) error {
 			return confBool(v, &c.http.server.SecureCookie)
 		},
+		value: func(c *config) any { return c.http.server.SecureCookie },
+	},
+	"HTTP_CSP": {
+		mapFunc: func(v string, c *config) error {
+			return confString(v, &c.http.server.CSP, 0, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.http.server.CSP },
+	},
+	"HTTP_CSP_REPORT_ONLY": {
+		mapFunc: func(v string, c *config) error {
+			return confBool(v, &c.http.server.CSPReportOnly)
+		},
+		value: func(c *config) any { return c.http.server.CSPReportOnly },
+	},
+	"HTTP_HSTS_MAX_AGE": {
+		mapFunc: func(v string, c *config) error {
+			return confDuration(v, &c.http.server.HSTSMaxAge, 0, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.http.server.HSTSMaxAge },
 	},
 	"HTTP_CSRF_KEY": {
 		required: true,
 		mapFunc: func(v string, c *config) error {
 			return confCryptoKey(v, &c.http.server.CSRFKey)
 		},
+		value: func(c *config) any { return c.http.server.CSRFKey },
+	},
+	"HTTP_ADMIN_USER_IDS": {
+		mapFunc: func(v string, c *config) error {
+			return confSliceOf(v, &c.http.adminUserIDs, uuid.Parse, 1, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.http.adminUserIDs },
+	},
+	"HTTP_ADMIN_ADDR": {
+		mapFunc: func(v string, c *config) error {
+			c.http.adminAddr = v
+			return nil
+		},
+		value: func(c *config) any { return c.http.adminAddr },
+	},
+	"HTTP_TLS_MODE": {
+		mapFunc: func(v string, c *config) error {
+			return confOneOf(v, &c.http.tls.mode, tlsModeOff, tlsModeFiles, tlsModeSelfSigned, tlsModeACME)
+		},
+		value: func(c *config) any { return c.http.tls.mode },
+	},
+	"HTTP_TLS_CERT_PATH": {
+		mapFunc: func(v string, c *config) error {
+			return confString(v, &c.http.tls.certPath, 1, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.http.tls.certPath },
+	},
+	"HTTP_TLS_KEY_PATH": {
+		mapFunc: func(v string, c *config) error {
+			return confString(v, &c.http.tls.keyPath, 1, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.http.tls.keyPath },
+	},
+	"HTTP_TLS_REDIRECT_ADDR": {
+		mapFunc: func(v string, c *config) error {
+			c.http.tls.redirectAddr = v
+			return nil
+		},
+		value: func(c *config) any { return c.http.tls.redirectAddr },
+	},
+	"HTTP_ACME_DOMAINS": {
+		mapFunc: func(v string, c *config) error {
+			return confSliceOf(v, &c.http.tls.acmeDomains, func(s string) (string, error) {
+				if s == "" {
+					return "", errors.New("empty domain")
+				}
+				return s, nil
+			}, 1, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.http.tls.acmeDomains },
+	},
+	"HTTP_ACME_EMAIL": {
+		mapFunc: func(v string, c *config) error {
+			return confString(v, &c.http.tls.acmeEmail, 0, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.http.tls.acmeEmail },
+	},
+	"HTTP_ACME_CACHE_DIR": {
+		mapFunc: func(v string, c *config) error {
+			return confString(v, &c.http.tls.acmeCacheDir, 1, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.http.tls.acmeCacheDir },
 	},
 	"HTTP_VIEW_DIR": {
 		mapFunc: func(v string, c *config) error {
 			return confString(v, &c.http.viewDir, 0, math.MaxInt64)
 		},
+		value: func(c *config) any { return c.http.viewDir },
 	},
 	"DB_FILENAME": {
 		mapFunc: func(v string, c *config) error {
 			return confString(v, &c.db.file, 1, math.MaxInt64)
 		},
+		value: func(c *config) any { return c.db.file },
 	},
 	"DB_MIGRATE": {
 		mapFunc: func(v string, c *config) error {
 			return confBool(v, &c.db.migrate)
 		},
+		value: func(c *config) any { return c.db.migrate },
 	},
 	"DB_BLIND_INDEX_SALT": {
 		required: true,
 		mapFunc: func(v string, c *config) error {
 			return confCryptoKey(v, &c.db.blindIndexSalt)
 		},
+		value: func(c *config) any { return c.db.blindIndexSalt },
 	},
 	"DB_ENCRYPTION_KEYS": {
 		required: true,
 		mapFunc: func(v string, c *config) error {
 			return confSliceOf(v, &c.db.encryptionKeys, krypto.ParseKey, 2, math.MaxInt64)
 		},
+		value: func(c *config) any { return c.db.encryptionKeys },
 	},
 	"AUTH_WORKER_TIMEOUT": {
 		mapFunc: func(v string, c *config) error {
 			return confDuration(v, &c.auth.WorkerTimeout, 0, math.MaxInt64)
 		},
+		value: func(c *config) any { return c.auth.WorkerTimeout },
 	},
 	"AUTH_TOKEN_EXPIRY": {
 		mapFunc: func(v string, c *config) error {
 			return confDuration(v, &c.auth.TokenExpiry, 0, math.MaxInt64)
 		},
+		value: func(c *config) any { return c.auth.TokenExpiry },
+	},
+	"AUDIT_RETENTION": {
+		mapFunc: func(v string, c *config) error {
+			return confDuration(v, &c.audit.MaxAge, time.Hour, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.audit.MaxAge },
+	},
+	"AUDIT_PRUNE_INTERVAL": {
+		mapFunc: func(v string, c *config) error {
+			return confDuration(v, &c.audit.Interval, time.Second, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.audit.Interval },
+	},
+	"JOBS_POLL_INTERVAL": {
+		mapFunc: func(v string, c *config) error {
+			return confDuration(v, &c.jobs.PollInterval, time.Millisecond, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.jobs.PollInterval },
+	},
+	"JOBS_BACKOFF_BASE": {
+		mapFunc: func(v string, c *config) error {
+			return confDuration(v, &c.jobs.BackoffBase, 0, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.jobs.BackoffBase },
+	},
+	"JOBS_BACKOFF_MAX": {
+		mapFunc: func(v string, c *config) error {
+			return confDuration(v, &c.jobs.BackoffMax, 0, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.jobs.BackoffMax },
 	},
 	"EMAIL_DRIVER": {
 		mapFunc: func(v string, c *config) error {
-			c.email.driver = v // validated later on.
+			c.email.driver = v // validated with the driver settings in loadConfig.
 			return nil
 		},
+		value: func(c *config) any { return c.email.driver },
+	},
+	"EMAIL_VIEW_DIR": {
+		mapFunc: func(v string, c *config) error {
+			return confString(v, &c.email.viewDir, 0, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.email.viewDir },
 	},
 	"EMAIL_FROM": {
 		required: true,
 		mapFunc: func(v string, c *config) error {
 			return confEmailAddress(v, &c.email.service.From)
 		},
+		value: func(c *config) any { return c.email.service.From },
 	},
 	"POSTMARK_API_URL": {
 		mapFunc: func(v string, c *config) error {
 			return confURL(v, c.email.postmark.APIURL)
 		},
+		value: func(c *config) any { return c.email.postmark.APIURL },
 	},
 	"POSTMARK_MESSAGE_STREAM": {
 		mapFunc: func(v string, c *config) error {
 			c.email.postmark.MessageStream = v
 			return nil
 		},
+		value: func(c *config) any { return c.email.postmark.MessageStream },
 	},
 	"POSTMARK_SERVER_TOKEN": {
 		mapFunc: func(v string, c *config) error {
 			return confSecret(v, &c.email.postmark.ServerToken)
 		},
+		value: func(c *config) any { return c.email.postmark.ServerToken },
+	},
+	"POSTMARK_WEBHOOK_SECRET": {
+		mapFunc: func(v string, c *config) error {
+			return confSecret(v, &c.http.server.PostmarkWebhookSecret)
+		},
+		value: func(c *config) any { return c.http.server.PostmarkWebhookSecret },
+	},
+	"SMTP_HOST": {
+		mapFunc: func(v string, c *config) error {
+			return confString(v, &c.email.smtp.Host, 1, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.email.smtp.Host },
+	},
+	"SMTP_PORT": {
+		mapFunc: func(v string, c *config) error {
+			return confInt(v, &c.email.smtp.Port, 1, math.MaxUint16)
+		},
+		value: func(c *config) any { return c.email.smtp.Port },
+	},
+	"SMTP_USERNAME": {
+		mapFunc: func(v string, c *config) error {
+			return confSecret(v, &c.email.smtp.Username)
+		},
+		value: func(c *config) any { return c.email.smtp.Username },
+	},
+	"SMTP_PASSWORD": {
+		mapFunc: func(v string, c *config) error {
+			return confSecret(v, &c.email.smtp.Password)
+		},
+		value: func(c *config) any { return c.email.smtp.Password },
+	},
+	"SMTP_TLS_MODE": {
+		mapFunc: func(v string, c *config) error {
+			return confParsed(v, &c.email.smtp.TLSMode, smtp.ParseTLSMode)
+		},
+		value: func(c *config) any { return c.email.smtp.TLSMode },
+	},
+	"SMTP_AUTH": {
+		mapFunc: func(v string, c *config) error {
+			return confParsed(v, &c.email.smtp.Auth, smtp.ParseAuthMechanism)
+		},
+		value: func(c *config) any { return c.email.smtp.Auth },
+	},
+	"SMTP_TIMEOUT": {
+		mapFunc: func(v string, c *config) error {
+			return confDuration(v, &c.email.smtp.Timeout, 0, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.email.smtp.Timeout },
+	},
+	"BACKUP_DIR": {
+		mapFunc: func(v string, c *config) error {
+			c.backup.Dir = v
+			return nil
+		},
+		value: func(c *config) any { return c.backup.Dir },
+	},
+	"BACKUP_INTERVAL": {
+		mapFunc: func(v string, c *config) error {
+			return confDuration(v, &c.backup.Interval, 100*time.Millisecond, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.backup.Interval },
+	},
+	"BACKUP_KEEP_LAST": {
+		mapFunc: func(v string, c *config) error {
+			return confInt(v, &c.backup.Retention.KeepLast, 0, math.MaxInt32)
+		},
+		value: func(c *config) any { return c.backup.Retention.KeepLast },
+	},
+	"BACKUP_MAX_AGE": {
+		mapFunc: func(v string, c *config) error {
+			return confDuration(v, &c.backup.Retention.MaxAge, 0, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.backup.Retention.MaxAge },
+	},
+	"TRACE_EXPORTER": {
+		mapFunc: func(v string, c *config) error {
+			return confOneOf(v, &c.trace.exporter, "none", "stdout", "otlp")
+		},
+		value: func(c *config) any { return c.trace.exporter },
+	},
+	"TRACE_OTLP_ENDPOINT": {
+		mapFunc: func(v string, c *config) error {
+			return confURL(v, c.trace.otlpEndpoint)
+		},
+		value: func(c *config) any { return c.trace.otlpEndpoint },
+	},
+	"TRACE_FLUSH_INTERVAL": {
+		mapFunc: func(v string, c *config) error {
+			return confDuration(v, &c.trace.tracer.FlushInterval, 100*time.Millisecond, math.MaxInt64)
+		},
+		value: func(c *config) any { return c.trace.tracer.FlushInterval },
+	},
+	"TRACE_MAX_QUEUE_SIZE": {
+		mapFunc: func(v string, c *config) error {
+			return confInt(v, &c.trace.tracer.MaxQueueSize, 1, math.MaxInt32)
+		},
+		value: func(c *config) any { return c.trace.tracer.MaxQueueSize },
 	},
 }
 
-// configFromEnv returns a config with values from the environment. It falls
-// back to default values for any missing environment variables.
+// configFileEnv is the env variable with the path of the optional config file.
+const configFileEnv = "CONFIG_FILE"
+
+// fileSuffix is appended to the name of an env variable to read its value from
+// a file instead, like HTTP_CSRF_KEY_FILE=/run/secrets/csrf_key. This is how
+// secrets are provided to Docker containers.
+const fileSuffix = "_FILE"
+
+// setting is the raw value of an env variable and where it was found.
+type setting struct {
+	value string
+	// source describes where the value was found, it's used in error messages.
+	source string
+}
+
+// configReport describes how the config was loaded.
+type configReport struct {
+	// file is the path of the config file, it's empty if no file was used.
+	file string
+	// sources maps env variable names to the source of their value. Variables
+	// that are missing have their default value.
+	sources map[string]string
+	// warnings are problems that don't prevent the config from being used.
+	warnings []string
+}
+
+// loadConfig returns a config with values from the config file and the environment.
+// The config file is read from the path in CONFIG_FILE, if it's set. Env variables
+// take precedence over values in the config file, both fall back to default values.
 //
 // It does a best effort to validate provided values, so that mistakes are
 // caught ASAP. However, there is no guarantee that the returned config
-// is valid and will work.
-func configFromEnv() (config, error) {
+// is valid and will work. All validation errors are joined in the returned error.
+func loadConfig() (config, configReport, error) {
 	c := defaultConfig()
+	report := configReport{
+		sources: make(map[string]string),
+	}
 
-	var errSum error
-	for key, envVar := range envMap {
-		val, ok := os.LookupEnv(key)
+	settings := make(map[string]setting)
+
+	var errs []error
+	if path := os.Getenv(configFileEnv); path != "" {
+		report.file = path
+
+		fileSettings, warnings, err := readConfigFile(path)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		report.warnings = append(report.warnings, warnings...)
+		for key, s := range fileSettings {
+			settings[key] = s
+		}
+	}
+
+	envSettings, err := readEnv()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for key, s := range envSettings {
+		settings[key] = s
+	}
+
+	for _, key := range envKeys() {
+		envVar := envMap[key]
+
+		s, ok := settings[key]
 		if !ok {
 			if envVar.required {
-				errSum = errors.Join(errSum, fmt.Errorf("missing required env variable %s", key))
+				errs = append(errs, fmt.Errorf("missing required env variable %s", key))
 			}
 			continue
 		}
 
-		if err := envVar.mapFunc(val, &c); err != nil {
-			errSum = errors.Join(errSum, fmt.Errorf("invalid env variable %s: %w", key, err))
+		report.sources[key] = s.source
+		if err := envVar.mapFunc(s.value, &c); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", s.source, err))
 		}
 	}
 
-	return c, errSum
+	// Unless it's set explicitly, cookies are only secure if the site is served
+	// over HTTPS. Either by us, or by a proxy in front of us.
+	if _, ok := settings["HTTP_SECURE_COOKIE"]; !ok {
+		c.http.server.SecureCookie = c.http.tls.mode != tlsModeOff || c.email.service.BaseURL.Scheme == "https"
+	}
+
+	// Unless it's set explicitly, we only authenticate with the SMTP server if
+	// there is a username. Relays that don't support AUTH would reject the attempt.
+	if _, ok := settings["SMTP_AUTH"]; !ok && len(c.email.smtp.Username.SecretValue()) > 0 {
+		c.email.smtp.Auth = smtp.AuthPlain
+	}
+
+	if err := checkTLS(c.http.tls); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := checkEmailDriver(c.email); err != nil {
+		errs = append(errs, err)
+	}
+
+	return c, report, errors.Join(errs...)
+}
+
+// readEnv returns the settings provided via env variables, including the
+// ones that are read from files.
+func readEnv() (map[string]setting, error) {
+	settings := make(map[string]setting)
+
+	var errs []error
+	for _, key := range envKeys() {
+		val, ok := os.LookupEnv(key)
+		if ok {
+			settings[key] = setting{
+				value:  val,
+				source: "env variable " + key,
+			}
+		}
+
+		path, fileOK := os.LookupEnv(key + fileSuffix)
+		if !fileOK {
+			continue
+		}
+
+		if ok {
+			errs = append(errs, fmt.Errorf("env variable %s and %s%s are both set, only one is allowed", key, key, fileSuffix))
+			continue
+		}
+
+		s, err := readSettingFile(path, "env variable "+key+fileSuffix)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		settings[key] = s
+	}
+
+	return settings, errors.Join(errs...)
+}
+
+// readSettingFile reads the value of a setting from the file at path. A trailing
+// newline is removed, most editors add one.
+func readSettingFile(path, source string) (setting, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return setting{}, fmt.Errorf("failed to read file of %s: %w", source, err)
+	}
+
+	return setting{
+		value:  strings.TrimRight(string(data), "\r\n"),
+		source: fmt.Sprintf("%s (file %s)", source, path),
+	}, nil
+}
+
+// envKeys returns the names of all env variables in a sorted order.
+func envKeys() []string {
+	keys := make([]string, 0, len(envMap))
+	for key := range envMap {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
 }
 
 // confDuration attempts to parse v into tgt as an URL.
@@ -285,6 +757,34 @@ func confString(v string, tgt *string, minLen, maxLen int) error {
 	return nil
 }
 
+// confInt attempts to parse v into tgt and checks if the result is in
+// the provided range (inclusive).
+func confInt(v string, tgt *int, min, max int) error {
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+
+	if i < min || i > max {
+		return fmt.Errorf("int %d not in range [%d, %d] (inclusive)", i, min, max)
+	}
+
+	*tgt = i
+
+	return nil
+}
+
+// confOneOf sets tgt to v if it is one of the allowed values.
+func confOneOf(v string, tgt *string, allowed ...string) error {
+	if !slices.Contains(allowed, v) {
+		return fmt.Errorf("%q is not one of %s", v, strings.Join(allowed, ", "))
+	}
+
+	*tgt = v
+
+	return nil
+}
+
 // confDuration attempts to parse v into tgt as a bool.
 func confBool(v string, tgt *bool) error {
 	b, err := strconv.ParseBool(v)
@@ -327,6 +827,18 @@ func confEmailAddress(v string, tgt *email.Address) error {
 	return nil
 }
 
+// confParsed attempts to parse v into tgt using parseFunc.
+func confParsed[T any](v string, tgt *T, parseFunc func(string) (T, error)) error {
+	parsed, err := parseFunc(v)
+	if err != nil {
+		return err
+	}
+
+	*tgt = parsed
+
+	return nil
+}
+
 func confSliceOf[T any](v string, tgt *[]T, elemFunc func(string) (T, error), minLen, maxLen int) error {
 	for i, elem := range strings.Split(v, ",") {
 		parsed, err := elemFunc(elem)
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// readConfigFile reads the settings from the TOML or JSON file at path, the format
+// is based on the extension of the file.
+//
+// The keys in the file are the names of the env variables in lower case. They can
+// be grouped in tables/objects named after the prefix of the env variables, so the
+// following TOML file sets HTTP_ADDR and HTTP_READ_TIMEOUT:
+//
+//	[http]
+//	addr = ":8080"
+//	read_timeout = "5s"
+//
+// Lists are joined with commas, like the env variables expect them. Keys that end
+// in _file are read from the file with that path, like their env variable counterparts.
+//
+// Keys that don't belong to an env variable are reported as warnings, so typos
+// don't go unnoticed.
+func readConfigFile(path string) (map[string]setting, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	raw := make(map[string]any)
+	switch ext := filepath.Ext(path); ext {
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&raw)
+	default:
+		return nil, nil, fmt.Errorf("config file %s has unsupported extension %q, expected .toml or .json", path, ext)
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	err = flattenConfig(nil, raw, values)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	// Sort the keys, so warnings are reported in a consistent order.
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	settings := make(map[string]setting)
+
+	var warnings []string
+	for _, key := range keys {
+		envKey := strings.ToUpper(key)
+		source := fmt.Sprintf("config file key %s", key)
+
+		if _, ok := envMap[envKey]; ok {
+			settings[envKey] = setting{
+				value:  values[key],
+				source: source,
+			}
+			continue
+		}
+
+		envKey, isFile := strings.CutSuffix(envKey, fileSuffix)
+		if _, ok := envMap[envKey]; !isFile || !ok {
+			warnings = append(warnings, fmt.Sprintf("unknown key %s in config file %s", key, path))
+			continue
+		}
+
+		if _, ok := settings[envKey]; ok {
+			return nil, nil, fmt.Errorf("config file %s sets %s both directly and via a file", path, envKey)
+		}
+
+		s, err := readSettingFile(values[key], source)
+		if err != nil {
+			return nil, nil, err
+		}
+		settings[envKey] = s
+	}
+
+	return settings, warnings, nil
+}
+
+// flattenConfig adds the values in raw to out, the keys of nested tables/objects
+// are prefixed by the keys of their parents, joined with underscores.
+func flattenConfig(prefix []string, raw map[string]any, out map[string]string) error {
+	for key, val := range raw {
+		path := append(slices.Clone(prefix), key)
+		name := strings.Join(path, "_")
+
+		if nested, ok := val.(map[string]any); ok {
+			err := flattenConfig(path, nested, out)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if list, ok := val.([]any); ok {
+			elems := make([]string, 0, len(list))
+			for i, elem := range list {
+				s, err := configScalar(elem)
+				if err != nil {
+					return fmt.Errorf("element %d of %s: %w", i, name, err)
+				}
+				elems = append(elems, s)
+			}
+			val = strings.Join(elems, ",")
+		}
+
+		s, err := configScalar(val)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", name, err)
+		}
+
+		if _, ok := out[name]; ok {
+			return fmt.Errorf("key %s is set more than once", name)
+		}
+		out[name] = s
+	}
+
+	return nil
+}
+
+// configScalar formats a value from a config file like it would be provided
+// as an env variable.
+func configScalar(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case json.Number:
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported value of type %T", v)
+	}
+}
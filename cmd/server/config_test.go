@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/email/smtp"
 	"github.com/willemschots/househunt/internal/krypto"
 )
 
@@ -42,7 +45,7 @@ func newConfig(mf func(*config)) config {
 	return c
 }
 
-func TestConfigFromEnv(t *testing.T) {
+func TestLoadConfig(t *testing.T) {
 	t.Run("ok, uses defaults for non-required env variables", func(t *testing.T) {
 		// set the required env variables.
 		for key, val := range requiredEnv() {
@@ -50,7 +53,7 @@ func TestConfigFromEnv(t *testing.T) {
 		}
 
 		want := newConfig(nil)
-		got, err := configFromEnv()
+		got, _, err := loadConfig()
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -70,6 +73,8 @@ func TestConfigFromEnv(t *testing.T) {
 			val: "https://example.com:9999",
 			mf: func(c *config) {
 				c.email.service.BaseURL = must(url.Parse("https://example.com:9999"))
+				// Cookies are secure by default when the site is served over HTTPS.
+				c.http.server.SecureCookie = true
 			},
 		},
 		"ok, non-default HTTP_ADDR": {
@@ -87,6 +92,9 @@ func TestConfigFromEnv(t *testing.T) {
 		"ok, non-default HTTP_SHUTDOWN_TIMEOUT": {
 			key: "HTTP_SHUTDOWN_TIMEOUT", val: "404ms", mf: func(c *config) { c.http.shutdownTimeout = 404 * time.Millisecond },
 		},
+		"ok, non-default HTTP_DRAIN_DELAY": {
+			key: "HTTP_DRAIN_DELAY", val: "5s", mf: func(c *config) { c.http.drainDelay = 5 * time.Second },
+		},
 		"ok, other HTTP_COOKIE_KEYS": {
 			key: "HTTP_COOKIE_KEYS",
 			val: "04017690e77c6a19671178e1950c7519389b58f6ffb8dcf53b2acfcaca398778,ddadbbe8b69c757875b80b8522a40da8ed882a1a368160247ef769acad61f88a",
@@ -99,11 +107,49 @@ func TestConfigFromEnv(t *testing.T) {
 		},
 		"ok, non-default HTTP_SECURE_COOKIE": {
 			key: "HTTP_SECURE_COOKIE",
-			val: "false",
+			val: "true",
+			mf: func(c *config) {
+				c.http.server.SecureCookie = true
+			},
+		},
+		"ok, non-default HTTP_TLS_MODE": {
+			key: "HTTP_TLS_MODE",
+			val: "self-signed",
 			mf: func(c *config) {
-				c.http.server.SecureCookie = false
+				c.http.tls.mode = "self-signed"
+				// Cookies are secure by default when TLS is enabled.
+				c.http.server.SecureCookie = true
 			},
 		},
+		"ok, non-default HTTP_TLS_CERT_PATH": {
+			key: "HTTP_TLS_CERT_PATH", val: "/certs/cert.pem", mf: func(c *config) { c.http.tls.certPath = "/certs/cert.pem" },
+		},
+		"ok, non-default HTTP_TLS_KEY_PATH": {
+			key: "HTTP_TLS_KEY_PATH", val: "/certs/key.pem", mf: func(c *config) { c.http.tls.keyPath = "/certs/key.pem" },
+		},
+		"ok, non-default HTTP_TLS_REDIRECT_ADDR": {
+			key: "HTTP_TLS_REDIRECT_ADDR", val: ":80", mf: func(c *config) { c.http.tls.redirectAddr = ":80" },
+		},
+		"ok, non-default HTTP_ACME_DOMAINS": {
+			key: "HTTP_ACME_DOMAINS",
+			val: "example.com,www.example.com",
+			mf:  func(c *config) { c.http.tls.acmeDomains = []string{"example.com", "www.example.com"} },
+		},
+		"ok, non-default HTTP_ACME_EMAIL": {
+			key: "HTTP_ACME_EMAIL", val: "ops@example.com", mf: func(c *config) { c.http.tls.acmeEmail = "ops@example.com" },
+		},
+		"ok, non-default HTTP_ACME_CACHE_DIR": {
+			key: "HTTP_ACME_CACHE_DIR", val: "/data/acme", mf: func(c *config) { c.http.tls.acmeCacheDir = "/data/acme" },
+		},
+		"ok, other HTTP_CSP": {
+			key: "HTTP_CSP", val: "default-src 'none'", mf: func(c *config) { c.http.server.CSP = "default-src 'none'" },
+		},
+		"ok, non-default HTTP_CSP_REPORT_ONLY": {
+			key: "HTTP_CSP_REPORT_ONLY", val: "true", mf: func(c *config) { c.http.server.CSPReportOnly = true },
+		},
+		"ok, other HTTP_HSTS_MAX_AGE": {
+			key: "HTTP_HSTS_MAX_AGE", val: "0s", mf: func(c *config) { c.http.server.HSTSMaxAge = 0 },
+		},
 		"ok, other HTTP_CSRF_KEY": {
 			key: "HTTP_CSRF_KEY",
 			val: "218dbd640d2ae9bd7a81e45f1ad963ecea3027fea21b9c3b93ca3ad69915f733",
@@ -111,6 +157,22 @@ func TestConfigFromEnv(t *testing.T) {
 				c.http.server.CSRFKey = must(krypto.ParseKey("218dbd640d2ae9bd7a81e45f1ad963ecea3027fea21b9c3b93ca3ad69915f733"))
 			},
 		},
+		"ok, non-default HTTP_ADMIN_USER_IDS": {
+			key: "HTTP_ADMIN_USER_IDS",
+			val: "0e61a06e-bbf6-4b87-aaaa-75fee0f38cca,597228ee-afde-4991-b13c-0161325e3930",
+			mf: func(c *config) {
+				c.http.adminUserIDs = []uuid.UUID{
+					must(uuid.Parse("0e61a06e-bbf6-4b87-aaaa-75fee0f38cca")),
+					must(uuid.Parse("597228ee-afde-4991-b13c-0161325e3930")),
+				}
+			},
+		},
+		"ok, non-default HTTP_ADMIN_ADDR": {
+			key: "HTTP_ADMIN_ADDR", val: ":9090", mf: func(c *config) { c.http.adminAddr = ":9090" },
+		},
+		"ok, empty HTTP_ADMIN_ADDR": {
+			key: "HTTP_ADMIN_ADDR", val: "", mf: func(c *config) { c.http.adminAddr = "" },
+		},
 		"ok, non-default HTTP_VIEW_DIR": {
 			key: "HTTP_VIEW_DIR", val: "./test", mf: func(c *config) { c.http.viewDir = "./test" },
 		},
@@ -143,13 +205,31 @@ func TestConfigFromEnv(t *testing.T) {
 		"ok, non-default AUTH_TOKEN_EXPIRY": {
 			key: "AUTH_TOKEN_EXPIRY", val: "51m", mf: func(c *config) { c.auth.TokenExpiry = 51 * time.Minute },
 		},
-		"ok, non-default EMAIL_DRIVER": {
+		"ok, non-default AUDIT_RETENTION": {
+			key: "AUDIT_RETENTION", val: "720h", mf: func(c *config) { c.audit.MaxAge = 720 * time.Hour },
+		},
+		"ok, non-default AUDIT_PRUNE_INTERVAL": {
+			key: "AUDIT_PRUNE_INTERVAL", val: "10m", mf: func(c *config) { c.audit.Interval = 10 * time.Minute },
+		},
+		"ok, non-default JOBS_POLL_INTERVAL": {
+			key: "JOBS_POLL_INTERVAL", val: "1s", mf: func(c *config) { c.jobs.PollInterval = time.Second },
+		},
+		"ok, non-default JOBS_BACKOFF_BASE": {
+			key: "JOBS_BACKOFF_BASE", val: "1m", mf: func(c *config) { c.jobs.BackoffBase = time.Minute },
+		},
+		"ok, non-default JOBS_BACKOFF_MAX": {
+			key: "JOBS_BACKOFF_MAX", val: "24h", mf: func(c *config) { c.jobs.BackoffMax = 24 * time.Hour },
+		},
+		"ok, EMAIL_DRIVER log": {
 			key: "EMAIL_DRIVER",
-			val: "postmark",
+			val: "log",
 			mf: func(c *config) {
-				c.email.driver = "postmark"
+				c.email.driver = "log"
 			},
 		},
+		"ok, non-default EMAIL_VIEW_DIR": {
+			key: "EMAIL_VIEW_DIR", val: "./test", mf: func(c *config) { c.email.viewDir = "./test" },
+		},
 		"ok, other EMAIL_FROM": {
 			key: "EMAIL_FROM",
 			val: "test@example.com",
@@ -178,6 +258,68 @@ func TestConfigFromEnv(t *testing.T) {
 				c.email.postmark.ServerToken = krypto.NewSecret("testToken")
 			},
 		},
+		"ok, other POSTMARK_WEBHOOK_SECRET": {
+			key: "POSTMARK_WEBHOOK_SECRET",
+			val: "webhookSecret",
+			mf: func(c *config) {
+				c.http.server.PostmarkWebhookSecret = krypto.NewSecret("webhookSecret")
+			},
+		},
+		"ok, non-default SMTP_HOST": {
+			key: "SMTP_HOST", val: "mail.example.com", mf: func(c *config) { c.email.smtp.Host = "mail.example.com" },
+		},
+		"ok, non-default SMTP_PORT": {
+			key: "SMTP_PORT", val: "465", mf: func(c *config) { c.email.smtp.Port = 465 },
+		},
+		"ok, other SMTP_USERNAME": {
+			key: "SMTP_USERNAME",
+			val: "alice",
+			mf: func(c *config) {
+				c.email.smtp.Username = krypto.NewSecret("alice")
+				// Authenticating is the default when there is a username.
+				c.email.smtp.Auth = smtp.AuthPlain
+			},
+		},
+		"ok, other SMTP_PASSWORD": {
+			key: "SMTP_PASSWORD", val: "secret", mf: func(c *config) { c.email.smtp.Password = krypto.NewSecret("secret") },
+		},
+		"ok, non-default SMTP_TLS_MODE": {
+			key: "SMTP_TLS_MODE", val: "implicit", mf: func(c *config) { c.email.smtp.TLSMode = smtp.TLSModeImplicit },
+		},
+		"ok, non-default SMTP_AUTH": {
+			key: "SMTP_AUTH", val: "login", mf: func(c *config) { c.email.smtp.Auth = smtp.AuthLogin },
+		},
+		"ok, non-default SMTP_TIMEOUT": {
+			key: "SMTP_TIMEOUT", val: "3s", mf: func(c *config) { c.email.smtp.Timeout = 3 * time.Second },
+		},
+		"ok, non-default BACKUP_DIR": {
+			key: "BACKUP_DIR", val: "/backups", mf: func(c *config) { c.backup.Dir = "/backups" },
+		},
+		"ok, non-default BACKUP_INTERVAL": {
+			key: "BACKUP_INTERVAL", val: "6h", mf: func(c *config) { c.backup.Interval = 6 * time.Hour },
+		},
+		"ok, non-default BACKUP_KEEP_LAST": {
+			key: "BACKUP_KEEP_LAST", val: "0", mf: func(c *config) { c.backup.Retention.KeepLast = 0 },
+		},
+		"ok, non-default BACKUP_MAX_AGE": {
+			key: "BACKUP_MAX_AGE", val: "720h", mf: func(c *config) { c.backup.Retention.MaxAge = 720 * time.Hour },
+		},
+		"ok, non-default TRACE_EXPORTER": {
+			key: "TRACE_EXPORTER", val: "otlp", mf: func(c *config) { c.trace.exporter = "otlp" },
+		},
+		"ok, non-default TRACE_OTLP_ENDPOINT": {
+			key: "TRACE_OTLP_ENDPOINT",
+			val: "https://collector.example.com/v1/traces",
+			mf: func(c *config) {
+				c.trace.otlpEndpoint = must(url.Parse("https://collector.example.com/v1/traces"))
+			},
+		},
+		"ok, non-default TRACE_FLUSH_INTERVAL": {
+			key: "TRACE_FLUSH_INTERVAL", val: "1s", mf: func(c *config) { c.trace.tracer.FlushInterval = time.Second },
+		},
+		"ok, non-default TRACE_MAX_QUEUE_SIZE": {
+			key: "TRACE_MAX_QUEUE_SIZE", val: "10", mf: func(c *config) { c.trace.tracer.MaxQueueSize = 10 },
+		},
 	}
 
 	for name, tc := range valid {
@@ -191,7 +333,7 @@ func TestConfigFromEnv(t *testing.T) {
 			envForTest(t, tc.key, tc.val)
 
 			want := newConfig(tc.mf)
-			got, err := configFromEnv()
+			got, _, err := loadConfig()
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
@@ -206,23 +348,52 @@ func TestConfigFromEnv(t *testing.T) {
 		key string
 		val string
 	}{
-		"fail, no host in BASE_URL":            {"BASE_URL", "/just-a-path"},
-		"fail, negative HTTP_READ_TIMEOUT":     {"HTTP_READ_TIMEOUT", "-1ms"},
-		"fail, negative HTTP_WRITE_TIMEOUT":    {"HTTP_WRITE_TIMEOUT", "-1ms"},
-		"fail, negative HTTP_IDLE_TIMEOUT":     {"HTTP_IDLE_TIMEOUT", "-1ms"},
-		"fail, negative HTTP_SHUTDOWN_TIMEOUT": {"HTTP_SHUTDOWN_TIMEOUT", "-1ms"},
-		"fail, invalid HTTP_COOKIE_KEYS":       {"HTTP_COOKIE_KEYS", "abc"},
-		"fail, invalid HTTP_SECURE_COOKIE":     {"HTTP_SECURE_COOKIE", "abc"},
-		"fail, invalid HTTP_CSRF_KEY":          {"HTTP_CSRF_KEY", "abc"},
-		"fail, empty DB_FILENAME":              {"DB_FILENAME", ""},
-		"fail, invalid DB_MIGRATE":             {"DB_MIGRATE", "no!"},
-		"fail, invalid DB_BLIND_INDEX_SALT":    {"DB_BLIND_INDEX_SALT", "abc"},
-		"fail, empty DB_ENCRYPTION_KEYS":       {"DB_ENCRYPTION_KEYS", ""},
-		"fail, invalid DB_ENCRYPTION_KEYS":     {"DB_ENCRYPTION_KEYS", "abc"},
-		"fail, negative AUTH_WORKER_TIMEOUT":   {"AUTH_WORKER_TIMEOUT", "-1ms"},
-		"fail, negative AUTH_TOKEN_EXPIRY":     {"AUTH_TOKEN_EXPIRY", "-1ms"},
-		"fail, invalid EMAIL_FROM":             {"EMAIL_FROM", "@@"},
-		"fail, invalid POSTMARK_API_URL":       {"POSTMARK_API_URL", "not-a-url"},
+		"fail, no host in BASE_URL":             {"BASE_URL", "/just-a-path"},
+		"fail, negative HTTP_READ_TIMEOUT":      {"HTTP_READ_TIMEOUT", "-1ms"},
+		"fail, negative HTTP_WRITE_TIMEOUT":     {"HTTP_WRITE_TIMEOUT", "-1ms"},
+		"fail, negative HTTP_IDLE_TIMEOUT":      {"HTTP_IDLE_TIMEOUT", "-1ms"},
+		"fail, negative HTTP_SHUTDOWN_TIMEOUT":  {"HTTP_SHUTDOWN_TIMEOUT", "-1ms"},
+		"fail, negative HTTP_DRAIN_DELAY":       {"HTTP_DRAIN_DELAY", "-1ms"},
+		"fail, invalid HTTP_COOKIE_KEYS":        {"HTTP_COOKIE_KEYS", "abc"},
+		"fail, invalid HTTP_SECURE_COOKIE":      {"HTTP_SECURE_COOKIE", "abc"},
+		"fail, invalid HTTP_CSP_REPORT_ONLY":    {"HTTP_CSP_REPORT_ONLY", "abc"},
+		"fail, negative HTTP_HSTS_MAX_AGE":      {"HTTP_HSTS_MAX_AGE", "-1s"},
+		"fail, invalid HTTP_TLS_MODE":           {"HTTP_TLS_MODE", "on"},
+		"fail, files HTTP_TLS_MODE, no paths":   {"HTTP_TLS_MODE", "files"},
+		"fail, acme HTTP_TLS_MODE, no domains":  {"HTTP_TLS_MODE", "acme"},
+		"fail, empty HTTP_ACME_DOMAINS":         {"HTTP_ACME_DOMAINS", "example.com,"},
+		"fail, invalid HTTP_CSRF_KEY":           {"HTTP_CSRF_KEY", "abc"},
+		"fail, invalid HTTP_ADMIN_USER_IDS":     {"HTTP_ADMIN_USER_IDS", "abc"},
+		"fail, empty DB_FILENAME":               {"DB_FILENAME", ""},
+		"fail, invalid DB_MIGRATE":              {"DB_MIGRATE", "no!"},
+		"fail, invalid DB_BLIND_INDEX_SALT":     {"DB_BLIND_INDEX_SALT", "abc"},
+		"fail, empty DB_ENCRYPTION_KEYS":        {"DB_ENCRYPTION_KEYS", ""},
+		"fail, invalid DB_ENCRYPTION_KEYS":      {"DB_ENCRYPTION_KEYS", "abc"},
+		"fail, negative AUTH_WORKER_TIMEOUT":    {"AUTH_WORKER_TIMEOUT", "-1ms"},
+		"fail, negative AUTH_TOKEN_EXPIRY":      {"AUTH_TOKEN_EXPIRY", "-1ms"},
+		"fail, too short AUDIT_RETENTION":       {"AUDIT_RETENTION", "1m"},
+		"fail, zero AUDIT_PRUNE_INTERVAL":       {"AUDIT_PRUNE_INTERVAL", "0s"},
+		"fail, zero JOBS_POLL_INTERVAL":         {"JOBS_POLL_INTERVAL", "0s"},
+		"fail, negative JOBS_BACKOFF_BASE":      {"JOBS_BACKOFF_BASE", "-1s"},
+		"fail, negative JOBS_BACKOFF_MAX":       {"JOBS_BACKOFF_MAX", "-1s"},
+		"fail, unknown EMAIL_DRIVER":            {"EMAIL_DRIVER", "carrier-pigeon"},
+		"fail, postmark EMAIL_DRIVER, no token": {"EMAIL_DRIVER", "postmark"},
+		"fail, smtp EMAIL_DRIVER, no host":      {"EMAIL_DRIVER", "smtp"},
+		"fail, invalid EMAIL_FROM":              {"EMAIL_FROM", "@@"},
+		"fail, invalid POSTMARK_API_URL":        {"POSTMARK_API_URL", "not-a-url"},
+		"fail, empty SMTP_HOST":                 {"SMTP_HOST", ""},
+		"fail, invalid SMTP_PORT":               {"SMTP_PORT", "abc"},
+		"fail, out of range SMTP_PORT":          {"SMTP_PORT", "70000"},
+		"fail, invalid SMTP_TLS_MODE":           {"SMTP_TLS_MODE", "ssl"},
+		"fail, invalid SMTP_AUTH":               {"SMTP_AUTH", "cram-md5"},
+		"fail, negative SMTP_TIMEOUT":           {"SMTP_TIMEOUT", "-1ms"},
+		"fail, too short BACKUP_INTERVAL":       {"BACKUP_INTERVAL", "1ms"},
+		"fail, negative BACKUP_KEEP_LAST":       {"BACKUP_KEEP_LAST", "-1"},
+		"fail, negative BACKUP_MAX_AGE":         {"BACKUP_MAX_AGE", "-1h"},
+		"fail, unknown TRACE_EXPORTER":          {"TRACE_EXPORTER", "jaeger"},
+		"fail, invalid TRACE_OTLP_ENDPOINT":     {"TRACE_OTLP_ENDPOINT", "not-a-url"},
+		"fail, too short TRACE_FLUSH_INTERVAL":  {"TRACE_FLUSH_INTERVAL", "1ms"},
+		"fail, zero TRACE_MAX_QUEUE_SIZE":       {"TRACE_MAX_QUEUE_SIZE", "0"},
 	}
 
 	for name, tc := range invalid {
@@ -235,7 +406,7 @@ func TestConfigFromEnv(t *testing.T) {
 			// set the tested env variable.
 			envForTest(t, tc.key, tc.val)
 
-			_, err := configFromEnv()
+			_, _, err := loadConfig()
 			if err == nil {
 				t.Fatal("expected error, got <nil>")
 			}
@@ -258,7 +429,7 @@ func TestConfigFromEnv(t *testing.T) {
 				}
 			}
 
-			_, err := configFromEnv()
+			_, _, err := loadConfig()
 			if err == nil {
 				t.Fatal("expected error, got <nil>")
 			}
@@ -272,6 +443,24 @@ func TestConfigFromEnv(t *testing.T) {
 		})
 	}
 
+	t.Run("ok, SMTP_AUTH overrides the default for a username", func(t *testing.T) {
+		for key, val := range requiredEnv() {
+			envForTest(t, key, val)
+		}
+
+		envForTest(t, "SMTP_USERNAME", "alice")
+		envForTest(t, "SMTP_AUTH", "none")
+
+		got, _, err := loadConfig()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got.email.smtp.Auth != smtp.AuthNone {
+			t.Errorf("got SMTP auth %q, want %q", got.email.smtp.Auth, smtp.AuthNone)
+		}
+	})
+
 	t.Run("fail, multiple invalid env variables", func(t *testing.T) {
 		// set the required env variables.
 		for key, val := range requiredEnv() {
@@ -282,7 +471,7 @@ func TestConfigFromEnv(t *testing.T) {
 		envForTest(t, "HTTP_READ_TIMEOUT", "-1ms")
 		envForTest(t, "HTTP_WRITE_TIMEOUT", "-1ms")
 
-		_, err := configFromEnv()
+		_, _, err := loadConfig()
 		if err == nil {
 			t.Error("expected error, got <nil>")
 		}
@@ -312,3 +501,391 @@ func envForTest(t *testing.T, key, val string) {
 		t.Fatalf("failed to set env var %s: %v", key, err)
 	}
 }
+
+func TestLoadConfig_File(t *testing.T) {
+	const tomlFile = `
+base_url = "https://example.com"
+
+[http]
+addr = "localhost:8080"
+read_timeout = "101ms"
+cookie_keys = [
+  "568554094ec040ab8a6b3e6d7cc138b0dc855f39ba1aeb2ffc903f7260b3a452",
+  "d503685b5e0848dcd1026711a5d92e8a087dfaffa489fb563e0de73db2f2476c",
+]
+csrf_key = "dfab77e26917c6e37a173690443a0016808ef7b24e32424d45cd83454198a6ec"
+
+[db]
+blind_index_salt = "b61115eeb1bdf0847f1d7ea978c7da71e3b31361f7450bc8aa12566a16b7b03f"
+encryption_keys = ["2b671594b775f371eab4050b4d58326682df6b1a6cc2e886717b1a26b4d6c45d"]
+migrate = false
+
+[email]
+from = "househunt@example.com"
+
+[smtp]
+port = 465
+`
+
+	const jsonFile = `{
+	"base_url": "https://example.com",
+	"http": {
+		"addr": "localhost:8080",
+		"read_timeout": "101ms",
+		"cookie_keys": [
+			"568554094ec040ab8a6b3e6d7cc138b0dc855f39ba1aeb2ffc903f7260b3a452",
+			"d503685b5e0848dcd1026711a5d92e8a087dfaffa489fb563e0de73db2f2476c"
+		],
+		"csrf_key": "dfab77e26917c6e37a173690443a0016808ef7b24e32424d45cd83454198a6ec"
+	},
+	"db": {
+		"blind_index_salt": "b61115eeb1bdf0847f1d7ea978c7da71e3b31361f7450bc8aa12566a16b7b03f",
+		"encryption_keys": ["2b671594b775f371eab4050b4d58326682df6b1a6cc2e886717b1a26b4d6c45d"],
+		"migrate": false
+	},
+	"email": {
+		"from": "househunt@example.com"
+	},
+	"smtp": {
+		"port": 465
+	}
+}`
+
+	// wantFromFile is the config both files should result in.
+	wantFromFile := func(mf func(*config)) config {
+		return newConfig(func(c *config) {
+			c.email.service.BaseURL = must(url.Parse("https://example.com"))
+			c.http.server.SecureCookie = true
+			c.http.addr = "localhost:8080"
+			c.http.readTimeout = 101 * time.Millisecond
+			c.db.migrate = false
+			c.email.smtp.Port = 465
+			if mf != nil {
+				mf(c)
+			}
+		})
+	}
+
+	files := map[string]string{
+		"config.toml": tomlFile,
+		"config.json": jsonFile,
+	}
+
+	for name, content := range files {
+		t.Run("ok, all values from "+name, func(t *testing.T) {
+			envForTest(t, configFileEnv, fileForTest(t, name, content))
+
+			got, report, err := loadConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			want := wantFromFile(nil)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got\n%+v\nwant\n%+v", got, want)
+			}
+
+			if len(report.warnings) != 0 {
+				t.Errorf("expected no warnings, got %v", report.warnings)
+			}
+
+			if src := report.sources["HTTP_ADDR"]; src != "config file key http_addr" {
+				t.Errorf("unexpected source for HTTP_ADDR: %s", src)
+			}
+		})
+
+		t.Run("ok, env variables override "+name, func(t *testing.T) {
+			envForTest(t, configFileEnv, fileForTest(t, name, content))
+			envForTest(t, "HTTP_ADDR", ":9999")
+
+			got, _, err := loadConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			want := wantFromFile(func(c *config) {
+				c.http.addr = ":9999"
+			})
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got\n%+v\nwant\n%+v", got, want)
+			}
+		})
+	}
+
+	t.Run("ok, unknown keys are reported as warnings", func(t *testing.T) {
+		for key, val := range requiredEnv() {
+			envForTest(t, key, val)
+		}
+
+		envForTest(t, configFileEnv, fileForTest(t, "config.toml", `
+[http]
+adr = ":8080"
+
+[unknown]
+key = true
+`))
+
+		got, report, err := loadConfig()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := newConfig(nil)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got\n%+v\nwant\n%+v", got, want)
+		}
+
+		if len(report.warnings) != 2 {
+			t.Fatalf("expected 2 warnings, got %v", report.warnings)
+		}
+
+		for i, key := range []string{"http_adr", "unknown_key"} {
+			if !strings.Contains(report.warnings[i], key) {
+				t.Errorf("expected warning %d to mention %s, got %s", i, key, report.warnings[i])
+			}
+		}
+	})
+
+	t.Run("ok, secret from file referenced in config file", func(t *testing.T) {
+		for key, val := range requiredEnv() {
+			if key != "HTTP_CSRF_KEY" {
+				envForTest(t, key, val)
+			}
+		}
+
+		secret := fileForTest(t, "csrf_key", "218dbd640d2ae9bd7a81e45f1ad963ecea3027fea21b9c3b93ca3ad69915f733\n")
+		envForTest(t, configFileEnv, fileForTest(t, "config.json", fmt.Sprintf(`{"http": {"csrf_key_file": %q}}`, secret)))
+
+		got, _, err := loadConfig()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := newConfig(func(c *config) {
+			c.http.server.CSRFKey = must(krypto.ParseKey("218dbd640d2ae9bd7a81e45f1ad963ecea3027fea21b9c3b93ca3ad69915f733"))
+		})
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got\n%+v\nwant\n%+v", got, want)
+		}
+	})
+
+	invalid := map[string]struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		"fail, invalid value": {
+			name:    "config.toml",
+			content: "[http]\nread_timeout = \"-1ms\"",
+			wantErr: "config file key http_read_timeout",
+		},
+		"fail, invalid TOML": {
+			name:    "config.toml",
+			content: "[http",
+			wantErr: "failed to parse config file",
+		},
+		"fail, invalid JSON": {
+			name:    "config.json",
+			content: "{",
+			wantErr: "failed to parse config file",
+		},
+		"fail, unsupported extension": {
+			name:    "config.yaml",
+			content: "http:\n  addr: localhost",
+			wantErr: "unsupported extension",
+		},
+		"fail, unsupported value": {
+			name:    "config.json",
+			content: `{"http": {"addr": null}}`,
+			wantErr: "http_addr",
+		},
+		"fail, missing secret file": {
+			name:    "config.toml",
+			content: "[http]\ncsrf_key_file = \"/does/not/exist\"",
+			wantErr: "http_csrf_key_file",
+		},
+	}
+
+	for name, tc := range invalid {
+		t.Run(name, func(t *testing.T) {
+			for key, val := range requiredEnv() {
+				envForTest(t, key, val)
+			}
+
+			envForTest(t, configFileEnv, fileForTest(t, tc.name, tc.content))
+
+			_, _, err := loadConfig()
+			if err == nil {
+				t.Fatal("expected error, got <nil>")
+			}
+
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("expected error message to contain %q, got %s", tc.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("fail, missing config file", func(t *testing.T) {
+		for key, val := range requiredEnv() {
+			envForTest(t, key, val)
+		}
+
+		envForTest(t, configFileEnv, "/does/not/exist.toml")
+
+		_, _, err := loadConfig()
+		if err == nil {
+			t.Fatal("expected error, got <nil>")
+		}
+	})
+}
+
+func TestLoadConfig_EnvFile(t *testing.T) {
+	t.Run("ok, values from files", func(t *testing.T) {
+		for key, val := range requiredEnv() {
+			if key == "HTTP_CSRF_KEY" || key == "DB_ENCRYPTION_KEYS" {
+				envForTest(t, key+"_FILE", fileForTest(t, key, val+"\n"))
+				continue
+			}
+			envForTest(t, key, val)
+		}
+
+		got, report, err := loadConfig()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := newConfig(nil)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got\n%+v\nwant\n%+v", got, want)
+		}
+
+		if src := report.sources["HTTP_CSRF_KEY"]; !strings.Contains(src, "HTTP_CSRF_KEY_FILE") {
+			t.Errorf("expected source of HTTP_CSRF_KEY to mention HTTP_CSRF_KEY_FILE, got %s", src)
+		}
+	})
+
+	t.Run("ok, env file overrides config file", func(t *testing.T) {
+		for key, val := range requiredEnv() {
+			envForTest(t, key, val)
+		}
+
+		envForTest(t, configFileEnv, fileForTest(t, "config.toml", "[http]\naddr = \":8080\""))
+		envForTest(t, "HTTP_ADDR_FILE", fileForTest(t, "addr", ":9999"))
+
+		got, _, err := loadConfig()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := newConfig(func(c *config) {
+			c.http.addr = ":9999"
+		})
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got\n%+v\nwant\n%+v", got, want)
+		}
+	})
+
+	t.Run("fail, both variable and file set", func(t *testing.T) {
+		for key, val := range requiredEnv() {
+			envForTest(t, key, val)
+		}
+
+		envForTest(t, "HTTP_CSRF_KEY_FILE", fileForTest(t, "csrf_key", requiredEnv()["HTTP_CSRF_KEY"]))
+
+		_, _, err := loadConfig()
+		if err == nil || !strings.Contains(err.Error(), "HTTP_CSRF_KEY_FILE") {
+			t.Errorf("expected error mentioning HTTP_CSRF_KEY_FILE, got %v", err)
+		}
+	})
+
+	t.Run("fail, file does not exist", func(t *testing.T) {
+		for key, val := range requiredEnv() {
+			if key != "HTTP_CSRF_KEY" {
+				envForTest(t, key, val)
+			}
+		}
+
+		envForTest(t, "HTTP_CSRF_KEY_FILE", "/does/not/exist")
+
+		_, _, err := loadConfig()
+		if err == nil || !strings.Contains(err.Error(), "HTTP_CSRF_KEY_FILE") {
+			t.Errorf("expected error mentioning HTTP_CSRF_KEY_FILE, got %v", err)
+		}
+	})
+}
+
+func TestConfigCheck(t *testing.T) {
+	t.Run("ok, prints effective config with secrets redacted", func(t *testing.T) {
+		for key, val := range requiredEnv() {
+			envForTest(t, key, val)
+		}
+		envForTest(t, "SMTP_PASSWORD", "verySecretPassword")
+
+		out := &strings.Builder{}
+		code := configCheck(out)
+		if code != 0 {
+			t.Fatalf("expected exit code 0, got %d. output:\n%s", code, out)
+		}
+
+		got := out.String()
+		for _, want := range []string{
+			"HTTP_ADDR=:8888 (default)",
+			"HTTP_CSRF_KEY=" + krypto.SecretMarker + " (env variable HTTP_CSRF_KEY)",
+			"SMTP_PASSWORD=" + krypto.SecretMarker + " (env variable SMTP_PASSWORD)",
+			"OK",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("expected output to contain %q, got:\n%s", want, got)
+			}
+		}
+
+		secrets := []string{"verySecretPassword"}
+		for _, val := range requiredEnv() {
+			if !strings.Contains(val, "@") {
+				secrets = append(secrets, strings.Split(val, ",")...)
+			}
+		}
+
+		for _, secret := range secrets {
+			if strings.Contains(got, secret) {
+				t.Errorf("output contains secret %q:\n%s", secret, got)
+			}
+		}
+	})
+
+	t.Run("fail, lists all errors and warnings", func(t *testing.T) {
+		envForTest(t, "HTTP_READ_TIMEOUT", "-1ms")
+		envForTest(t, configFileEnv, fileForTest(t, "config.toml", "unknown = 1"))
+
+		out := &strings.Builder{}
+		code := configCheck(out)
+		if code != 1 {
+			t.Fatalf("expected exit code 1, got %d. output:\n%s", code, out)
+		}
+
+		got := out.String()
+		want := []string{"Warnings:", "unknown key unknown", "Errors:", "invalid env variable HTTP_READ_TIMEOUT"}
+		for key := range requiredEnv() {
+			want = append(want, "missing required env variable "+key)
+		}
+
+		for _, w := range want {
+			if !strings.Contains(got, w) {
+				t.Errorf("expected output to contain %q, got:\n%s", w, got)
+			}
+		}
+	})
+}
+
+// fileForTest writes content to a file in a temporary directory and returns its path.
+func fileForTest(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	return path
+}
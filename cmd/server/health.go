@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	healthStatusOK      = "ok"
+	healthStatusFailing = "failing"
+)
+
+var errShuttingDown = errors.New("server is shutting down")
+
+// healthCheck is a check that needs to pass for the app to be ready.
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+type healthCheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type healthResponse struct {
+	Status string                       `json:"status"`
+	Checks map[string]healthCheckResult `json:"checks,omitempty"`
+}
+
+// readiness reports whether the app is ready to receive traffic. It fails
+// as soon as shutdown begins, so load balancers stop sending us requests
+// before the server stops accepting them.
+type readiness struct {
+	logger       *slog.Logger
+	timeout      time.Duration
+	checks       []healthCheck
+	shuttingDown *atomic.Bool
+}
+
+func newReadiness(logger *slog.Logger, timeout time.Duration, checks ...healthCheck) *readiness {
+	rd := &readiness{
+		logger:       logger,
+		timeout:      timeout,
+		shuttingDown: &atomic.Bool{},
+	}
+
+	rd.checks = append([]healthCheck{{
+		name: "shutdown",
+		check: func(_ context.Context) error {
+			if rd.shuttingDown.Load() {
+				return errShuttingDown
+			}
+			return nil
+		},
+	}}, checks...)
+
+	return rd
+}
+
+// shutdown makes all following readiness checks fail.
+func (rd *readiness) shutdown() {
+	rd.shuttingDown.Store(true)
+}
+
+// ServeHTTP runs all checks and responds with the result of every check.
+func (rd *readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), rd.timeout)
+	defer cancel()
+
+	resp := healthResponse{
+		Status: healthStatusOK,
+		Checks: make(map[string]healthCheckResult, len(rd.checks)),
+	}
+
+	for _, c := range rd.checks {
+		start := time.Now()
+		err := c.check(ctx)
+
+		result := healthCheckResult{
+			Status:   healthStatusOK,
+			Duration: time.Since(start).String(),
+		}
+
+		if err != nil {
+			result.Status = healthStatusFailing
+			result.Error = err.Error()
+			resp.Status = healthStatusFailing
+			rd.logger.Warn("readiness check failed", "check", c.name, "error", err)
+		}
+
+		resp.Checks[c.name] = result
+	}
+
+	status := http.StatusOK
+	if resp.Status != healthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeHealth(w, status, resp)
+}
+
+// liveness reports that the process is alive and serving requests.
+func liveness(w http.ResponseWriter, _ *http.Request) {
+	writeHealth(w, http.StatusOK, healthResponse{Status: healthStatusOK})
+}
+
+func writeHealth(w http.ResponseWriter, status int, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	// Probes should always see the current state.
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// checkEmailDriver checks that the email driver is known and has the settings it needs.
+func checkEmailDriver(cfg emailConfig) error {
+	switch cfg.driver {
+	case "log":
+		return nil
+	case "postmark":
+		if len(cfg.postmark.ServerToken.SecretValue()) == 0 {
+			return errors.New("EMAIL_DRIVER postmark requires POSTMARK_SERVER_TOKEN")
+		}
+		return nil
+	case "smtp":
+		if cfg.smtp.Host == "" {
+			return errors.New("EMAIL_DRIVER smtp requires SMTP_HOST")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown EMAIL_DRIVER %q", cfg.driver)
+	}
+}
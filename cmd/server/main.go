@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -18,22 +19,42 @@ import (
 	gorillaSess "github.com/gorilla/sessions"
 	"github.com/willemschots/househunt/assets"
 	"github.com/willemschots/househunt/internal"
+	"github.com/willemschots/househunt/internal/audit"
+	auditdb "github.com/willemschots/househunt/internal/audit/db"
 	"github.com/willemschots/househunt/internal/auth"
 	authdb "github.com/willemschots/househunt/internal/auth/db"
 	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/db/backup"
 	"github.com/willemschots/househunt/internal/db/migrate"
 	"github.com/willemschots/househunt/internal/email"
+	emaildb "github.com/willemschots/househunt/internal/email/db"
 	"github.com/willemschots/househunt/internal/email/postmark"
+	"github.com/willemschots/househunt/internal/email/smtp"
 	emailview "github.com/willemschots/househunt/internal/email/view"
+	"github.com/willemschots/househunt/internal/i18n"
+	"github.com/willemschots/househunt/internal/jobs"
+	jobsdb "github.com/willemschots/househunt/internal/jobs/db"
 	"github.com/willemschots/househunt/internal/krypto"
+	"github.com/willemschots/househunt/internal/lifecycle"
+	"github.com/willemschots/househunt/internal/logz"
+	"github.com/willemschots/househunt/internal/metrics"
+	"github.com/willemschots/househunt/internal/tracing"
 	"github.com/willemschots/househunt/internal/web"
 	"github.com/willemschots/househunt/internal/web/sessions"
+	"github.com/willemschots/househunt/internal/web/static"
 	"github.com/willemschots/househunt/internal/web/view"
 	"github.com/willemschots/househunt/migrations"
 	"golang.org/x/sync/errgroup"
 )
 
+// viewWatchInterval is how often template directories on disk are checked for changes.
+const viewWatchInterval = 500 * time.Millisecond
+
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
@@ -44,12 +65,44 @@ func run(ctx context.Context, w io.Writer) int {
 	logger := slog.New(slog.NewTextHandler(w, nil))
 	logger = logger.With("revision", internal.BuildRevision, "revision_time", internal.BuildRevisionTime)
 
-	cfg, err := configFromEnv()
+	cfg, report, err := loadConfig()
+	for _, warning := range report.warnings {
+		logger.Warn("config warning", "warning", warning)
+	}
+
 	if err != nil {
-		logger.Error("failed to get config from environment", "error", err)
+		logger.Error("failed to load config", "error", err)
 		return 1
 	}
 
+	if report.file != "" {
+		logger.Info("loaded config file", "path", report.file)
+	}
+
+	// Create the tracer. Operations are only traced if their context carries
+	// it, so it's added to ctx for any work that is not done in a request.
+	tracer, err := newTracer(cfg.trace)
+	if err != nil {
+		logger.Error("failed to create tracer", "error", err)
+		return 1
+	}
+
+	if tracer != nil {
+		logger.Info("tracing enabled", "exporter", cfg.trace.exporter)
+		ctx = tracing.WithTracer(ctx, tracer)
+
+		// Export the spans that ended after the tracer stopped running.
+		defer func() {
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			err := tracer.Flush(flushCtx)
+			if err != nil {
+				logger.Error("failed to flush spans", "error", err)
+			}
+		}()
+	}
+
 	// Connect to the database.
 	dbh, err := connectDB(cfg)
 	if err != nil {
@@ -65,6 +118,25 @@ func run(ctx context.Context, w io.Writer) int {
 		}
 	}()
 
+	// Backups are taken with VACUUM INTO, Postgres databases are backed up with its own tools.
+	if cfg.backup.Dir != "" && db.DialectOf(dbh.write) != db.SQLite {
+		logger.Error("scheduled backups require a SQLite database, unset BACKUP_DIR")
+		return 1
+	}
+
+	// Create DB encryptor.
+	encryptor, err := krypto.NewEncryptor(cfg.db.encryptionKeys)
+	if err != nil {
+		logger.Error("failed to create encryptor", "error", err)
+		return 1
+	}
+
+	// Go migrations may need to decrypt and encrypt data, or rebuild blind indexes.
+	migrationsSrc := migrations.ForDialect(db.DialectOf(dbh.write), migrations.Deps{
+		Encryptor:     encryptor,
+		BlindIndexKey: cfg.db.blindIndexSalt,
+	})
+
 	// Run the migrations if desired.
 	if cfg.db.migrate {
 		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
@@ -72,7 +144,7 @@ func run(ctx context.Context, w io.Writer) int {
 
 		logger.Info("attempting to migrate database")
 
-		migrations, err := migrate.RunFS(ctx, dbh.write, migrations.FS, migrate.Metadata{
+		migrations, err := migrate.RunFS(ctx, dbh.write, migrationsSrc, migrate.Metadata{
 			Revision:          internal.BuildRevision,
 			RevisionTimestamp: internal.BuildRevisionTime,
 		})
@@ -91,20 +163,34 @@ func run(ctx context.Context, w io.Writer) int {
 		}
 	}
 
-	// Create DB encryptor.
-	encryptor, err := krypto.NewEncryptor(cfg.db.encryptionKeys)
+	// Load translations, these are used by both the emailer and the web views.
+	catalogue, err := i18n.LoadCatalogue(assets.LocaleFS)
 	if err != nil {
-		logger.Error("failed to create encryptor", "error", err)
+		logger.Error("failed to load translations", "error", err)
 		return 1
 	}
 
 	// Create emailer.
-	emailRenderer, err := emailview.NewMemRenderer(assets.EmailFS)
+	var emailRenderer email.Renderer
+
+	emailRenderer, err = emailview.NewMemRenderer(assets.EmailFS)
 	if err != nil {
 		logger.Error("failed to create email renderer", "error", err)
 		return 1
 	}
 
+	if cfg.email.viewDir != "" {
+		logger.Info("loading email templates from disk", "dir", cfg.email.viewDir)
+		r, err := emailview.NewWatchingRenderer(os.DirFS(cfg.email.viewDir), viewWatchInterval)
+		if err != nil {
+			logger.Error("failed to create watching email renderer", "error", err)
+			return 1
+		}
+		defer r.Close()
+
+		emailRenderer = r
+	}
+
 	var sender email.Sender
 	switch cfg.email.driver {
 	case "log":
@@ -114,24 +200,78 @@ func run(ctx context.Context, w io.Writer) int {
 			Timeout: 10 * time.Second,
 		}
 		sender = postmark.NewSender(httpClient, cfg.email.postmark)
+	case "smtp":
+		sender = smtp.NewSender(cfg.email.smtp)
 	default:
 		logger.Error("unknown email driver", "driver", cfg.email.driver)
+		return 1
 	}
-	emailer := email.NewService(emailRenderer, sender, cfg.email.service)
+	emailStore := emaildb.New(dbh.write, dbh.read, encryptor, cfg.db.blindIndexSalt)
+	emailer := email.NewService(emailRenderer, sender, emailStore, catalogue, cfg.email.service)
+
+	// Create the background job queue. Kinds of jobs are registered by the
+	// packages that enqueue them, before the queue is run.
+	jobErrHandler := func(ctx context.Context, err error) {
+		logz.FromContext(ctx, logger).Error("background job error", "error", err)
+	}
+	queue := jobs.NewQueue(jobsdb.New(dbh.write, dbh.read, encryptor), cfg.jobs, logger, jobErrHandler)
+
+	// Emails are sent in background jobs, so they survive restarts and failed
+	// sends are retried.
+	queuedEmailer := email.NewQueuedSender(queue, emailer, jobs.KindConfig{}, jobErrHandler)
+
+	// Create the recorder for security events.
+	auditor := audit.NewRecorder(auditdb.New(dbh.write, dbh.read, encryptor))
 
 	// Create authentication store and service.
 	authStore := authdb.New(dbh.write, dbh.read, encryptor, cfg.db.blindIndexSalt)
 
-	authErrHandler := func(err error) {
-		logger.Error("authentication service error", "error", err)
+	// Errors are logged with the logger of the request that caused them, so that
+	// failures in worker goroutines can be traced back using the request ID.
+	authErrHandler := func(ctx context.Context, err error) {
+		logz.FromContext(ctx, logger).Error("authentication service error", "error", err)
 	}
 
-	authSvc, err := auth.NewService(authStore, emailer, authErrHandler, cfg.auth)
+	authSvc, err := auth.NewService(authStore, queuedEmailer, auditor, authErrHandler, cfg.auth)
 	if err != nil {
 		logger.Error("failed to create auth service", "error", err)
 		return 1
 	}
 
+	// Background workers are shut down after the http servers, so that the
+	// work handed off by the last requests is finished before we exit.
+	workers := lifecycle.NewManager(func(name string, took time.Duration, err error) {
+		if err != nil {
+			logger.Error("worker did not stop", "worker", name, "took", took, "error", err)
+			return
+		}
+		logger.Info("worker stopped", "worker", name, "took", took)
+	})
+	workers.Add("auth", authSvc)
+	workers.Add("jobs", queue)
+	workers.Add("audit", auditor)
+
+	if tracer != nil {
+		workers.Add("tracer", tracer)
+	}
+
+	var backups *backup.Scheduler
+	if cfg.backup.Dir != "" {
+		// The read handle is enough to take a backup, so writes are not blocked.
+		backups = backup.NewScheduler(dbh.read, cfg.backup, func(b backup.Backup) {
+			logger.Info("database backup created", "path", b.Path, "size", b.Size, "sha256", b.Checksum)
+		}, func(err error) {
+			logger.Error("database backup error", "error", err)
+		})
+		workers.Add("backups", backups)
+	}
+
+	err = authSvc.BootstrapAdmins(ctx, cfg.http.adminUserIDs)
+	if err != nil {
+		logger.Error("failed to bootstrap admins", "error", err)
+		return 1
+	}
+
 	// Create cookie store to store sessions.
 	keysAsBytes := make([][]byte, len(cfg.http.cookieKeys))
 	for i, key := range cfg.http.cookieKeys {
@@ -155,55 +295,240 @@ func run(ctx context.Context, w io.Writer) int {
 
 	if cfg.http.viewDir != "" {
 		logger.Info("loading templates from disk", "dir", cfg.http.viewDir)
-		viewRenderer = view.NewFSRenderer(os.DirFS(cfg.http.viewDir))
+		r, err := view.NewWatchingRenderer(os.DirFS(cfg.http.viewDir), viewWatchInterval)
+		if err != nil {
+			logger.Error("failed to create watching view renderer", "error", err)
+			return 1
+		}
+		defer r.Close()
+
+		viewRenderer = r
+	}
+
+	// Check that every view and email template we use exists and renders, so
+	// a broken template stops the server now instead of failing a request later.
+	err = web.CheckViews(viewRenderer, catalogue)
+	if err != nil {
+		logger.Error("failed to check views", "error", err)
+		return 1
+	}
+
+	err = emailer.CheckTemplates(auth.EmailTemplates())
+	if err != nil {
+		logger.Error("failed to check email templates", "error", err)
+		return 1
 	}
 
+	// Static files are fingerprinted on startup, so they can be cached by browsers.
+	staticHandler, err := static.New(assets.DistFS)
+	if err != nil {
+		logger.Error("failed to create static file handler", "error", err)
+		return 1
+	}
+
+	// Metrics are collected in the registry and served by the admin listener.
+	metricsReg := metrics.NewRegistry()
+	registerMetrics(metricsReg, authSvc, emailer, dbh)
+
 	serverDeps := &web.ServerDeps{
 		Logger:       logger,
 		ViewRenderer: viewRenderer,
 		AuthService:  authSvc,
+		Jobs:         queue,
+		Auditor:      auditor,
+		EmailService: emailer,
+		Catalogue:    catalogue,
 		SessionStore: sessions.NewStore(sessionStore),
-		DistFS:       http.FS(assets.DistFS),
+		Static:       staticHandler,
+		Metrics:      metricsReg,
+		Tracer:       tracer,
 	}
 
+	// Probes are served next to the web server, not by it, so they
+	// skip the middlewares (and don't flood the request logs).
+	ready := newReadiness(logger, 5*time.Second,
+		healthCheck{name: "database", check: dbh.ping},
+		healthCheck{name: "migrations", check: func(ctx context.Context) error {
+			return migrate.CheckFS(ctx, dbh.read, migrationsSrc)
+		}},
+		healthCheck{name: "email", check: func(_ context.Context) error {
+			return checkEmailDriver(cfg.email)
+		}},
+	)
+
+	rootMux := http.NewServeMux()
+	rootMux.HandleFunc("GET /healthz", liveness)
+	rootMux.Handle("GET /readyz", ready)
+	rootMux.Handle("/", web.NewServer(serverDeps, cfg.http.server))
+
 	srv := &http.Server{
 		Addr:         cfg.http.addr,
 		ReadTimeout:  cfg.http.readTimeout,
 		WriteTimeout: cfg.http.writeTimeout,
 		IdleTimeout:  cfg.http.idleTimeout,
-		Handler:      web.NewServer(serverDeps, cfg.http.server),
+		Handler:      rootMux,
+	}
+
+	// Serve HTTPS if TLS is enabled, with an optional listener that redirects HTTP to HTTPS.
+	tlsSrv, err := newTLS(cfg.http.tls, cfg.http.addr, cfg.email.service.BaseURL, logger)
+	if err != nil {
+		logger.Error("failed to set up tls", "error", err)
+		return 1
+	}
+
+	var redirectSrv *http.Server
+	if tlsSrv != nil {
+		defer tlsSrv.close()
+
+		srv.TLSConfig = tlsSrv.config
+
+		if cfg.http.tls.redirectAddr != "" {
+			redirectSrv = &http.Server{
+				Addr:         cfg.http.tls.redirectAddr,
+				ReadTimeout:  cfg.http.readTimeout,
+				WriteTimeout: cfg.http.writeTimeout,
+				IdleTimeout:  cfg.http.idleTimeout,
+				Handler:      tlsSrv.redirect,
+			}
+		}
 	}
 
-	// We need to run two tasks concurrently:
+	var adminSrv *http.Server
+	if cfg.http.adminAddr != "" {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("GET /metrics", metricsReg)
+
+		adminSrv = &http.Server{
+			Addr:         cfg.http.adminAddr,
+			ReadTimeout:  cfg.http.readTimeout,
+			WriteTimeout: cfg.http.writeTimeout,
+			IdleTimeout:  cfg.http.idleTimeout,
+			Handler:      adminMux,
+		}
+	}
+
+	// We need to run the following tasks concurrently:
 	// - Listen and serving of the HTTP server.
-	// - Waiting for a signal to stop the server.
+	// - Listen and serving of the redirect HTTP server (if enabled).
+	// - Listen and serving of the admin HTTP server (if enabled).
+	// - Waiting for a signal to stop the servers and background workers.
+	// - Pruning old security events.
+	// - Running background jobs.
+	// - Exporting spans (if tracing is enabled).
+	// - Taking backups of the database (if enabled).
 
 	g, gCtx := errgroup.WithContext(ctx)
 
+	// The background loops are stopped by shutting down the workers, not by
+	// cancelling gCtx, so the work in progress can finish. Work that didn't
+	// finish before the shutdown deadline is cancelled.
+	loopCtx, cancelLoops := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelLoops()
+
+	// workersErr is set when the background workers are shut down.
+	var workersErr error
+
 	g.Go(func() error {
-		logger.Info("starting http server", "addr", cfg.http.addr)
+		logger.Info("starting http server", "addr", cfg.http.addr, "tls", cfg.http.tls.mode)
 		// ListenAndServe always returns a non-nil error,
 		// g will cancel gCtx when an error is returned, so
-		// this will also stop the other goroutine.
+		// this will also stop the other goroutines.
+		if tlsSrv != nil {
+			// The certificates are provided by the TLS config.
+			return srv.ListenAndServeTLS("", "")
+		}
+
 		return srv.ListenAndServe()
 	})
 
+	if redirectSrv != nil {
+		g.Go(func() error {
+			logger.Info("starting redirect http server", "addr", cfg.http.tls.redirectAddr)
+			return redirectSrv.ListenAndServe()
+		})
+	}
+
+	if adminSrv != nil {
+		g.Go(func() error {
+			logger.Info("starting admin http server", "addr", cfg.http.adminAddr)
+			return adminSrv.ListenAndServe()
+		})
+	}
+
 	g.Go(func() error {
 		<-gCtx.Done()
+
+		// Fail readiness first, and give load balancers time to notice.
+		ready.shutdown()
+		if cfg.http.drainDelay > 0 {
+			logger.Info("draining http server", "delay", cfg.http.drainDelay)
+			time.Sleep(cfg.http.drainDelay)
+		}
+
 		logger.Info("stopping http server")
 
 		shutCtx, cancel := context.WithTimeout(context.Background(), cfg.http.shutdownTimeout)
 		defer cancel()
 
-		return srv.Shutdown(shutCtx)
+		var errs []error
+		if adminSrv != nil {
+			errs = append(errs, adminSrv.Shutdown(shutCtx))
+		}
+
+		if redirectSrv != nil {
+			errs = append(errs, redirectSrv.Shutdown(shutCtx))
+		}
+
+		err := errors.Join(append(errs, srv.Shutdown(shutCtx))...)
+
+		// The workers share the deadline with the http servers.
+		logger.Info("stopping workers")
+		workersErr = workers.Shutdown(shutCtx)
+		cancelLoops()
+
+		return err
 	})
 
+	g.Go(func() error {
+		auditor.RunRetention(loopCtx, cfg.audit, func(err error) {
+			logger.Error("audit retention error", "error", err)
+		})
+		return nil
+	})
+
+	g.Go(func() error {
+		queue.Run(gCtx)
+		return nil
+	})
+
+	if backups != nil {
+		g.Go(func() error {
+			logger.Info("scheduling database backups", "dir", cfg.backup.Dir, "interval", cfg.backup.Interval)
+			backups.Run(loopCtx)
+			return nil
+		})
+	}
+
+	if tracer != nil {
+		g.Go(func() error {
+			tracer.Run(loopCtx, func(err error) {
+				logger.Error("tracing error", "error", err)
+			})
+			return nil
+		})
+	}
+
 	err = g.Wait()
 	if err != nil && err != http.ErrServerClosed {
 		logger.Error("http server stopped with error", "error", err)
 		return 1
 	}
 
+	if workersErr != nil {
+		logger.Error("workers did not stop in time", "error", workersErr)
+		return 1
+	}
+
 	logger.Info("http server stopped successfully")
 
 	return 0
@@ -216,6 +541,16 @@ type dbHandles struct {
 
 // connectDB connects to the database and returns the write and read handles.
 func connectDB(cfg config) (*dbHandles, error) {
+	if strings.HasPrefix(cfg.db.file, "postgres://") || strings.HasPrefix(cfg.db.file, "postgresql://") {
+		pgDB, err := db.OpenPostgres(cfg.db.file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
+
+		// Unlike SQLite, the same pool can be used for reading and writing.
+		return pingDB(&dbHandles{write: pgDB, read: pgDB})
+	}
+
 	writeDB, err := db.OpenSQLite(cfg.db.file, true)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database write handle: %w", err)
@@ -230,12 +565,16 @@ func connectDB(cfg config) (*dbHandles, error) {
 		return nil, fmt.Errorf("failed to open database read handle: %w", err)
 	}
 
-	handles := &dbHandles{write: writeDB, read: readDB}
+	return pingDB(&dbHandles{write: writeDB, read: readDB})
+}
+
+// pingDB checks that handles can connect, and closes them if they can't.
+func pingDB(handles *dbHandles) (*dbHandles, error) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err = handles.ping(ctx)
+	err := handles.ping(ctx)
 	if err != nil {
 		closeErr := handles.close()
 		if closeErr != nil {
@@ -253,6 +592,10 @@ func (h *dbHandles) ping(ctx context.Context) error {
 		return fmt.Errorf("failed to ping database write handle: %w", err)
 	}
 
+	if h.read == h.write {
+		return nil
+	}
+
 	err = h.read.PingContext(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to ping database read handle: %w", err)
@@ -267,6 +610,10 @@ func (h *dbHandles) close() error {
 		return fmt.Errorf("failed to close database write handle: %w", err)
 	}
 
+	if h.read == h.write {
+		return nil
+	}
+
 	err = h.read.Close()
 	if err != nil {
 		return fmt.Errorf("failed to close database read handle: %w", err)
@@ -3,14 +3,24 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/willemschots/househunt/internal/db/backup"
+	"github.com/willemschots/househunt/internal/email"
 )
 
 const (
@@ -18,6 +28,8 @@ const (
 	baseURL = "http://localhost:8888"
 	// publicURL is an unauthenticated URL that we check to see if the server is available.
 	publicURL = baseURL + "/static/.keep"
+	// metricsURL is the URL of the metrics endpoint on the admin listener.
+	metricsURL = "http://localhost:8889/metrics"
 
 	// httpClientTimeout is the timeout for the http client to wait for a response.
 	httpClientTimeout = 500 * time.Millisecond
@@ -41,10 +53,104 @@ func Test_Run(t *testing.T) {
 		assertLog(t, out.String(),
 			"starting http server",
 			"stopping http server",
+			"stopping workers",
+			"worker stopped",
 			"http server stopped successfully",
 		)
 	}))
 
+	t.Run("ok, stops the background loops as workers", testEnv(func(t *testing.T) {
+		envForTest(t, "BACKUP_DIR", t.TempDir())
+		envForTest(t, "TRACE_EXPORTER", "stdout")
+
+		out := newBuffer()
+
+		ctx := cancelOnceServed(t, publicURL)
+
+		got := run(ctx, out)
+		if got != 0 {
+			t.Fatalf("got exit code %d, want 0. logs:\n%s", got, out.String())
+		}
+
+		for _, name := range []string{"auth", "jobs", "audit", "tracer", "backups"} {
+			assertLogLine(t, out.String(), "worker stopped", "worker="+name)
+		}
+	}))
+
+	t.Run("fail, reports workers that did not stop before the shutdown deadline", testEnv(func(t *testing.T) {
+		// The SMTP server accepts connections but never responds, so the
+		// job sending the activation email hangs.
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+
+		accepted := make(chan net.Conn, 10)
+		t.Cleanup(func() {
+			ln.Close()
+			for {
+				select {
+				case conn := <-accepted:
+					conn.Close()
+				default:
+					return
+				}
+			}
+		})
+
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				accepted <- conn
+			}
+		}()
+
+		_, port, _ := net.SplitHostPort(ln.Addr().String())
+		envForTest(t, "EMAIL_DRIVER", "smtp")
+		envForTest(t, "SMTP_HOST", "127.0.0.1")
+		envForTest(t, "SMTP_PORT", port)
+		envForTest(t, "SMTP_TLS_MODE", "none")
+		envForTest(t, "SMTP_AUTH", "none")
+		envForTest(t, "HTTP_SHUTDOWN_TIMEOUT", "100ms")
+
+		out := newBuffer()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		code := make(chan int, 1)
+		go func() {
+			code <- run(ctx, out)
+		}()
+
+		waitCtx, waitCancel := context.WithTimeout(context.Background(), tryServingDuration)
+		defer waitCancel()
+
+		err = waitForStatusOK(waitCtx, publicURL)
+		if err != nil {
+			t.Fatalf("error waiting for status ok: %v", err)
+		}
+
+		newClient(t).mustRegister(t, "agent@example.com")
+
+		select {
+		case conn := <-accepted:
+			defer conn.Close()
+		case <-waitCtx.Done():
+			t.Fatalf("timed out waiting for the smtp connection, logs:\n%s", out.String())
+		}
+
+		cancel()
+		if got := <-code; got != 1 {
+			t.Fatalf("got exit code %d, want 1. logs:\n%s", got, out.String())
+		}
+
+		assertLog(t, out.String(), "stopping workers", "worker did not stop", "workers did not stop in time")
+		assertLogLine(t, out.String(), "worker did not stop", "worker=jobs", "1 jobs did not finish")
+	}))
+
 	t.Run("ok, says it ran migrations", testEnv(func(t *testing.T) {
 		out := newBuffer()
 
@@ -97,6 +203,160 @@ func Test_Run(t *testing.T) {
 		assertLog(t, out.String(), "loading templates from disk")
 	}))
 
+	t.Run("ok, says it loaded email templates from directory when EMAIL_VIEW_DIR is provided", testEnv(func(t *testing.T) {
+		envForTest(t, "EMAIL_VIEW_DIR", "../../assets/emails")
+
+		out := newBuffer()
+
+		ctx := cancelOnceServed(t, publicURL)
+
+		got := run(ctx, out)
+		want := 0
+		if got != want {
+			t.Fatalf("got exit code %d, want %d. logs:\n%s", got, want, out.String())
+		}
+
+		assertLog(t, out.String(), "loading email templates from disk")
+	}))
+
+	t.Run("ok, serves HTTPS and redirects HTTP when HTTP_TLS_MODE is self-signed", testEnv(func(t *testing.T) {
+		envForTest(t, "HTTP_TLS_MODE", "self-signed")
+		envForTest(t, "HTTP_TLS_REDIRECT_ADDR", "localhost:8890")
+
+		out := newBuffer()
+
+		ctx, cancel := context.WithTimeout(context.Background(), tryServingDuration)
+		defer cancel()
+
+		code := make(chan int, 1)
+		go func() {
+			code <- run(ctx, out)
+		}()
+
+		httpClient := &http.Client{
+			Timeout: httpClientTimeout,
+			Transport: &http.Transport{
+				// The certificate is self-signed.
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+
+		for {
+			res, err := httpClient.Get("https://localhost:8888/static/.keep")
+			if err == nil {
+				res.Body.Close()
+				if res.StatusCode == http.StatusOK {
+					break
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				t.Fatalf("timed out waiting for https server, logs:\n%s", out.String())
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+
+		res, err := httpClient.Get("http://localhost:8890/login?next=%2Fdashboard")
+		if err != nil {
+			t.Fatalf("unexpected error during request: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusMovedPermanently {
+			t.Errorf("got status %d, want %d", res.StatusCode, http.StatusMovedPermanently)
+		}
+
+		wantLocation := "https://localhost:8888/login?next=%2Fdashboard"
+		if got := res.Header.Get("Location"); got != wantLocation {
+			t.Errorf("got location %q, want %q", got, wantLocation)
+		}
+
+		cancel()
+		if got := <-code; got != 0 {
+			t.Fatalf("got exit code %d, want 0. logs:\n%s", got, out.String())
+		}
+
+		assertLog(t, out.String(), "starting redirect http server")
+	}))
+
+	t.Run("ok, serves metrics on the admin listener", testEnv(func(t *testing.T) {
+		runAppForTest(t)
+
+		body := newClient(t).mustGetBody(t, metricsURL, assertStatusCode(t, http.StatusOK))
+
+		for _, want := range []string{
+			`househunt_http_requests_total{pattern="/static/",code="200"}`,
+			`househunt_http_request_duration_seconds_count{pattern="/static/"}`,
+			"househunt_auth_workers 0",
+			`househunt_email_sends_total{outcome="sent"} 0`,
+			`househunt_db_wait_count_total{handle="write"}`,
+			`househunt_db_open_connections{handle="write"}`,
+			`househunt_db_open_connections{handle="read"}`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("expected metrics to contain %q, got:\n%s", want, body)
+			}
+		}
+	}))
+
+	t.Run("ok, no admin listener when HTTP_ADMIN_ADDR is empty", testEnv(func(t *testing.T) {
+		envForTest(t, "HTTP_ADMIN_ADDR", "")
+
+		out := newBuffer()
+
+		ctx := cancelOnceServed(t, publicURL)
+
+		got := run(ctx, out)
+		want := 0
+		if got != want {
+			t.Fatalf("got exit code %d, want %d. logs:\n%s", got, want, out.String())
+		}
+
+		if strings.Contains(out.String(), "starting admin http server") {
+			t.Errorf("expected admin listener to be disabled, but it was started")
+		}
+	}))
+
+	t.Run("ok, takes scheduled backups when BACKUP_DIR is provided", testEnv(func(t *testing.T) {
+		dir := t.TempDir()
+		envForTest(t, "BACKUP_DIR", dir)
+		envForTest(t, "BACKUP_INTERVAL", "100ms")
+		envForTest(t, "BACKUP_KEEP_LAST", "2")
+
+		logs := runAppForTest(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		for strings.Count(logs.String(), "database backup created") < 3 {
+			select {
+			case <-ctx.Done():
+				t.Fatalf("timed out waiting for backups, logs:\n%s", logs.String())
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+
+		backups, err := backup.List(dir)
+		if err != nil {
+			t.Fatalf("unexpected error listing backups: %v", err)
+		}
+
+		// Old backups are pruned, but a backup might be in progress.
+		if len(backups) < 1 || len(backups) > 3 {
+			t.Fatalf("expected 1 to 3 backups, got %d", len(backups))
+		}
+
+		// The newest backup is never pruned.
+		err = backup.Verify(backups[0].Path)
+		if err != nil {
+			t.Errorf("unexpected error verifying backup: %v", err)
+		}
+	}))
+
 	t.Run("fail, invalid environment", testEnv(func(t *testing.T) {
 		envForTest(t, "HTTP_READ_TIMEOUT", "-1ms")
 
@@ -112,8 +372,386 @@ func Test_Run(t *testing.T) {
 			t.Fatalf("got exit code %d, want %d. logs:\n%s", got, want, out.String())
 		}
 
-		assertLog(t, out.String(), "failed to get config from environment")
+		assertLog(t, out.String(), "failed to load config")
+	}))
+
+	t.Run("fail, email driver without its settings", testEnv(func(t *testing.T) {
+		envForTest(t, "EMAIL_DRIVER", "smtp")
+
+		out := newBuffer()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		got := run(ctx, out)
+		want := 1
+		if got != want {
+			t.Fatalf("got exit code %d, want %d. logs:\n%s", got, want, out.String())
+		}
+
+		assertLog(t, out.String(), "failed to load config")
+		if !strings.Contains(out.String(), "EMAIL_DRIVER smtp requires SMTP_HOST") {
+			t.Errorf("expected logs to mention the missing SMTP_HOST, got:\n%s", out.String())
+		}
+	}))
+}
+
+func Test_Health(t *testing.T) {
+	t.Run("ok, alive", testEnv(func(t *testing.T) {
+		runAppForTest(t)
+
+		got := mustGetHealth(t, "/healthz", http.StatusOK)
+		if got.Status != healthStatusOK {
+			t.Errorf("got status %q, want %q", got.Status, healthStatusOK)
+		}
+	}))
+
+	t.Run("ok, ready", testEnv(func(t *testing.T) {
+		runAppForTest(t)
+
+		got := mustGetHealth(t, "/readyz", http.StatusOK)
+		assertHealthChecks(t, got, map[string]string{
+			"shutdown":   healthStatusOK,
+			"database":   healthStatusOK,
+			"migrations": healthStatusOK,
+			"email":      healthStatusOK,
+		})
+	}))
+
+	t.Run("fail, not ready with pending migrations", testEnv(func(t *testing.T) {
+		envForTest(t, "DB_MIGRATE", "false")
+		runAppForTest(t)
+
+		got := mustGetHealth(t, "/readyz", http.StatusServiceUnavailable)
+		assertHealthChecks(t, got, map[string]string{
+			"shutdown":   healthStatusOK,
+			"database":   healthStatusOK,
+			"migrations": healthStatusFailing,
+			"email":      healthStatusOK,
+		})
+	}))
+
+	t.Run("ok, not ready once shutdown begins", testEnv(func(t *testing.T) {
+		envForTest(t, "HTTP_DRAIN_DELAY", "500ms")
+
+		out := newBuffer()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		done := make(chan int)
+		go func() {
+			done <- run(ctx, out)
+		}()
+
+		waitCtx, waitCancel := context.WithTimeout(context.Background(), tryServingDuration)
+		defer waitCancel()
+
+		err := waitForStatusOK(waitCtx, publicURL)
+		if err != nil {
+			t.Fatalf("error waiting for status ok: %v", err)
+		}
+
+		_ = mustGetHealth(t, "/readyz", http.StatusOK)
+
+		// Begin shutdown, the server keeps serving during the drain delay.
+		cancel()
+
+		var got healthResponse
+		for {
+			got = mustGetHealth(t, "/readyz", 0)
+			if got.Status == healthStatusFailing {
+				break
+			}
+
+			select {
+			case <-waitCtx.Done():
+				t.Fatalf("readiness did not fail during shutdown")
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+
+		if got.Checks["shutdown"].Error != errShuttingDown.Error() {
+			t.Errorf("unexpected shutdown check %+v", got.Checks["shutdown"])
+		}
+
+		if code := <-done; code != 0 {
+			t.Fatalf("got exit code %d, want 0. logs:\n%s", code, out.String())
+		}
+
+		assertLog(t, out.String(), "draining http server", "stopping http server")
+	}))
+}
+
+// mustGetHealth gets a health endpoint and decodes the response. If wantStatus
+// is not 0, the response status code is checked.
+func mustGetHealth(t *testing.T, path string, wantStatus int) healthResponse {
+	t.Helper()
+
+	var body string
+	if wantStatus == 0 {
+		body = newClient(t).mustGetBody(t, path, nil)
+	} else {
+		body = newClient(t).mustGetBody(t, path, assertStatusCode(t, wantStatus))
+	}
+
+	var got healthResponse
+	err := json.Unmarshal([]byte(body), &got)
+	if err != nil {
+		t.Fatalf("failed to decode health response %q: %v", body, err)
+	}
+
+	return got
+}
+
+func assertHealthChecks(t *testing.T, got healthResponse, want map[string]string) {
+	t.Helper()
+
+	if len(got.Checks) != len(want) {
+		t.Errorf("got checks %+v, want %v", got.Checks, want)
+	}
+
+	for name, status := range want {
+		if got.Checks[name].Status != status {
+			t.Errorf("got check %s %+v, want status %q", name, got.Checks[name], status)
+		}
+	}
+}
+
+func Test_RequestLogging(t *testing.T) {
+	t.Run("ok, request ID is logged and flows into worker goroutines", testEnv(func(t *testing.T) {
+		logs := runAppForTest(t)
+
+		c := newClient(t)
+		body := c.mustGetBody(t, "/register", assertStatusCode(t, http.StatusOK))
+
+		form := parseHTMLFormWithID(t, strings.NewReader(body), "register-user")
+		form.values.Set("email", "agent@example.com")
+		form.values.Set("password", "reallyStrongPassword1")
+
+		req, err := http.NewRequest(form.method, baseURL+form.action, strings.NewReader(form.values.Encode()))
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Request-ID", "trace-42")
+
+		res, err := c.http.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error during request: %v", err)
+		}
+		defer res.Body.Close()
+
+		if got := res.Header.Get("X-Request-ID"); got != "trace-42" {
+			t.Errorf("got X-Request-ID %q, want %q", got, "trace-42")
+		}
+
+		// The activation email is sent by a worker goroutine, it should be
+		// logged with the ID of the request that triggered it.
+		_ = waitAndCaptureURL(t, logs, "agent@example.com", "/user-activations")
+
+		assertLogLine(t, logs.String(), `msg="send email"`, "request_id=trace-42")
+		assertLogLine(t, logs.String(), `msg="http request"`, "request_id=trace-42", "method=POST", `pattern="POST /register"`, "status=302", "bytes=", "duration=")
+	}))
+
+	t.Run("ok, invalid request ID is replaced", testEnv(func(t *testing.T) {
+		runAppForTest(t)
+
+		req, err := http.NewRequest(http.MethodGet, publicURL, nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+
+		req.Header.Set("X-Request-ID", `bad id="injected"`)
+
+		res, err := newClient(t).http.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error during request: %v", err)
+		}
+		defer res.Body.Close()
+
+		got := res.Header.Get("X-Request-ID")
+		if got == "" || got == `bad id="injected"` {
+			t.Errorf("expected a generated request ID, got %q", got)
+		}
+	}))
+}
+
+func Test_Tracing(t *testing.T) {
+	t.Run("ok, registration is traced across the worker goroutine", testEnv(func(t *testing.T) {
+		collector := newTestCollector(t)
+		envForTest(t, "TRACE_EXPORTER", "otlp")
+		envForTest(t, "TRACE_OTLP_ENDPOINT", collector.srv.URL+"/v1/traces")
+		envForTest(t, "TRACE_FLUSH_INTERVAL", "100ms")
+
+		logs := runAppForTest(t)
+
+		c := newClient(t)
+		body := c.mustGetBody(t, "/register", assertStatusCode(t, http.StatusOK))
+
+		form := parseHTMLFormWithID(t, strings.NewReader(body), "register-user")
+		form.values.Set("email", "agent@example.com")
+		form.values.Set("password", "reallyStrongPassword1")
+
+		req, err := http.NewRequest(form.method, baseURL+form.action, strings.NewReader(form.values.Encode()))
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+
+		const (
+			remoteTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+			remoteSpanID  = "00f067aa0ba902b7"
+		)
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("traceparent", "00-"+remoteTraceID+"-"+remoteSpanID+"-01")
+
+		res, err := c.http.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error during request: %v", err)
+		}
+		defer res.Body.Close()
+
+		_ = waitAndCaptureURL(t, logs, "agent@example.com", "/user-activations")
+
+		spans := collector.waitForSpans(t, "email.Sender.Send")
+
+		server := spans.mustFind(t, "POST /register")
+		if server.TraceID != remoteTraceID || server.ParentSpanID != remoteSpanID {
+			t.Errorf("expected server span to continue the remote trace, got %+v", server)
+		}
+
+		register := spans.mustFindChild(t, server, "auth.Service.RegisterUser")
+		activation := spans.mustFindChild(t, register, "auth.Service.startActivation")
+		tx := spans.mustFindChild(t, activation, "auth.Service.inTx")
+		_ = spans.mustFindChild(t, tx, "db.exec")
+		job := spans.mustFindChild(t, activation, "jobs."+email.SendKind)
+		sendEmail := spans.mustFindChild(t, job, "email.Service.Send")
+		_ = spans.mustFindChild(t, sendEmail, "email.Sender.Send")
+
+		assertLogLine(t, logs.String(), `msg="http request"`, "trace_id="+remoteTraceID)
+	}))
+}
+
+type testSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+}
+
+type testSpans []testSpan
+
+// mustFind returns the first span with the provided name.
+func (s testSpans) mustFind(t *testing.T, name string) testSpan {
+	t.Helper()
+
+	for _, span := range s {
+		if span.Name == name {
+			return span
+		}
+	}
+
+	t.Fatalf("no span named %q in %+v", name, s)
+	return testSpan{}
+}
+
+// mustFindChild returns the first span with the provided name that is a child of parent.
+func (s testSpans) mustFindChild(t *testing.T, parent testSpan, name string) testSpan {
+	t.Helper()
+
+	for _, span := range s {
+		if span.Name == name && span.TraceID == parent.TraceID && span.ParentSpanID == parent.SpanID {
+			return span
+		}
+	}
+
+	t.Fatalf("no span named %q that is a child of %+v in %+v", name, parent, s)
+	return testSpan{}
+}
+
+// testCollector is a fake OpenTelemetry collector that records all received spans.
+type testCollector struct {
+	srv   *httptest.Server
+	mu    *sync.Mutex
+	spans testSpans
+}
+
+func newTestCollector(t *testing.T) *testCollector {
+	t.Helper()
+
+	c := &testCollector{
+		mu: &sync.Mutex{},
+	}
+
+	c.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans testSpans `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				c.spans = append(c.spans, ss.Spans...)
+			}
+		}
 	}))
+	t.Cleanup(c.srv.Close)
+
+	return c
+}
+
+// waitForSpans waits until a span with the provided name was received and returns all spans.
+func (c *testCollector) waitForSpans(t *testing.T, name string) testSpans {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	for {
+		c.mu.Lock()
+		spans := slices.Clone(c.spans)
+		c.mu.Unlock()
+
+		if slices.ContainsFunc(spans, func(s testSpan) bool { return s.Name == name }) {
+			return spans
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for span %q, got %+v", name, spans)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// assertLogLine checks that the log contains a line that contains all wanted strings.
+func assertLogLine(t *testing.T, log string, want ...string) {
+	t.Helper()
+
+OUTER:
+	for _, line := range strings.Split(log, "\n") {
+		for _, w := range want {
+			if !strings.Contains(line, w) {
+				continue OUTER
+			}
+		}
+		return
+	}
+
+	t.Errorf("log does not contain a line with all of %q", want)
 }
 
 // safeBuffer is a buffer that is safe for concurrent use.
@@ -255,3 +893,92 @@ func testEnv(testFunc func(t *testing.T)) func(t *testing.T) {
 		testFunc(t)
 	}
 }
+
+func Test_SecurityHeaders(t *testing.T) {
+	getHome := func(t *testing.T) (*http.Response, string) {
+		t.Helper()
+
+		res, err := newClient(t).http.Get(baseURL + "/")
+		if err != nil {
+			t.Fatalf("unexpected error during request: %v", err)
+		}
+		defer res.Body.Close()
+
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("unexpected error reading body: %v", err)
+		}
+
+		return res, string(body)
+	}
+
+	t.Run("ok, sets security headers and a CSP nonce per request", testEnv(func(t *testing.T) {
+		runAppForTest(t)
+
+		res, body := getHome(t)
+
+		for key, want := range map[string]string{
+			"X-Content-Type-Options":    "nosniff",
+			"X-Frame-Options":           "DENY",
+			"Referrer-Policy":           "strict-origin-when-cross-origin",
+			"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+		} {
+			if got := res.Header.Get(key); got != want {
+				t.Errorf("got %s %q, want %q", key, got, want)
+			}
+		}
+
+		if res.Header.Get("Permissions-Policy") == "" {
+			t.Errorf("expected Permissions-Policy header")
+		}
+
+		csp := res.Header.Get("Content-Security-Policy")
+		nonce := regexp.MustCompile(`'nonce-([^']+)'`).FindStringSubmatch(csp)
+		if nonce == nil {
+			t.Fatalf("expected CSP with nonce, got %q", csp)
+		}
+
+		if !strings.Contains(body, `nonce="`+nonce[1]+`"`) {
+			t.Errorf("expected nonce %q in body, got:\n%s", nonce[1], body)
+		}
+
+		res, _ = getHome(t)
+		if res.Header.Get("Content-Security-Policy") == csp {
+			t.Errorf("expected a new nonce for every request")
+		}
+	}))
+
+	t.Run("ok, only reports CSP violations in report-only mode", testEnv(func(t *testing.T) {
+		envForTest(t, "HTTP_CSP_REPORT_ONLY", "true")
+
+		runAppForTest(t)
+
+		res, _ := getHome(t)
+
+		if res.Header.Get("Content-Security-Policy") != "" {
+			t.Errorf("expected no enforced CSP")
+		}
+
+		if res.Header.Get("Content-Security-Policy-Report-Only") == "" {
+			t.Errorf("expected report-only CSP")
+		}
+	}))
+
+	t.Run("ok, logs CSP violation reports", testEnv(func(t *testing.T) {
+		logs := runAppForTest(t)
+
+		report := `{"csp-report":{"document-uri":"http://localhost:8888/","violated-directive":"script-src-elem","blocked-uri":"https://evil.example.com/x.js"}}`
+		res, err := newClient(t).http.Post(baseURL+"/csp-report", "application/csp-report", strings.NewReader(report))
+		if err != nil {
+			t.Fatalf("unexpected error during request: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusNoContent {
+			t.Fatalf("got status %d, want %d", res.StatusCode, http.StatusNoContent)
+		}
+
+		waitForLog(t, logs, "content security policy violation")
+		assertLogLine(t, logs.String(), `msg="content security policy violation"`, "violated_directive=script-src-elem", "blocked_uri=https://evil.example.com/x.js")
+	}))
+}
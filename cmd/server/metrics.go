@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/willemschots/househunt/internal/auth"
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/metrics"
+)
+
+// registerMetrics registers metrics for the state of the services and database
+// handles. They are updated every time the metrics are collected.
+func registerMetrics(reg *metrics.Registry, authSvc *auth.Service, emailer *email.Service, dbh *dbHandles) {
+	workers := reg.NewGaugeVec("househunt_auth_workers", "Number of running auth service worker goroutines.")
+	emails := reg.NewCounterVec("househunt_email_sends_total", "Total number of attempts to send an email, by outcome.", "outcome")
+
+	dbGauges := []struct {
+		gauge *metrics.GaugeVec
+		value func(st sql.DBStats) float64
+	}{
+		{
+			gauge: reg.NewGaugeVec("househunt_db_max_open_connections", "Maximum number of open connections to the database.", "handle"),
+			value: func(st sql.DBStats) float64 { return float64(st.MaxOpenConnections) },
+		},
+		{
+			gauge: reg.NewGaugeVec("househunt_db_open_connections", "Number of established connections, both in use and idle.", "handle"),
+			value: func(st sql.DBStats) float64 { return float64(st.OpenConnections) },
+		},
+		{
+			gauge: reg.NewGaugeVec("househunt_db_in_use_connections", "Number of connections currently in use.", "handle"),
+			value: func(st sql.DBStats) float64 { return float64(st.InUse) },
+		},
+		{
+			gauge: reg.NewGaugeVec("househunt_db_idle_connections", "Number of idle connections.", "handle"),
+			value: func(st sql.DBStats) float64 { return float64(st.Idle) },
+		},
+	}
+
+	// The totals in sql.DBStats only go up, so they're exposed as counters.
+	dbCounters := []struct {
+		counter *metrics.CounterVec
+		value   func(st sql.DBStats) float64
+	}{
+		{
+			counter: reg.NewCounterVec("househunt_db_wait_count_total", "Total number of connections waited for.", "handle"),
+			value:   func(st sql.DBStats) float64 { return float64(st.WaitCount) },
+		},
+		{
+			counter: reg.NewCounterVec("househunt_db_wait_duration_seconds_total", "Total time blocked waiting for a new connection.", "handle"),
+			value:   func(st sql.DBStats) float64 { return st.WaitDuration.Seconds() },
+		},
+		{
+			counter: reg.NewCounterVec("househunt_db_max_idle_closed_total", "Total number of connections closed due to SetMaxIdleConns.", "handle"),
+			value:   func(st sql.DBStats) float64 { return float64(st.MaxIdleClosed) },
+		},
+		{
+			counter: reg.NewCounterVec("househunt_db_max_lifetime_closed_total", "Total number of connections closed due to SetConnMaxLifetime.", "handle"),
+			value:   func(st sql.DBStats) float64 { return float64(st.MaxLifetimeClosed) },
+		},
+	}
+
+	handles := map[string]*sql.DB{
+		"write": dbh.write,
+	}
+	// Postgres uses a single pool for reading and writing.
+	if dbh.read != dbh.write {
+		handles["read"] = dbh.read
+	}
+
+	reg.OnCollect(func() {
+		workers.With().Set(float64(authSvc.Workers()))
+
+		stats := emailer.Stats()
+		for _, outcome := range []email.Outcome{email.OutcomeSent, email.OutcomeSuppressed, email.OutcomeFailed} {
+			emails.With(string(outcome)).SetTotal(float64(stats[outcome]))
+		}
+
+		for name, h := range handles {
+			st := h.Stats()
+			for _, g := range dbGauges {
+				g.gauge.With(name).Set(g.value(st))
+			}
+			for _, c := range dbCounters {
+				c.counter.With(name).SetTotal(c.value(st))
+			}
+		}
+	})
+}
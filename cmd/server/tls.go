@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/willemschots/househunt/internal/certs"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// The TLS modes determine how certificates for serving HTTPS are obtained.
+const (
+	tlsModeOff        = "off"
+	tlsModeFiles      = "files"
+	tlsModeSelfSigned = "self-signed"
+	tlsModeACME       = "acme"
+)
+
+// certReloadInterval is how often certificate files are checked for changes.
+const certReloadInterval = 10 * time.Second
+
+// tlsServing contains what is needed to serve HTTPS.
+type tlsServing struct {
+	config *tls.Config
+	// redirect handles the requests to the redirect listener.
+	redirect http.Handler
+	// close releases the resources used to provide certificates.
+	close func() error
+}
+
+// checkTLS checks that the TLS mode has the settings it needs.
+func checkTLS(cfg tlsConfig) error {
+	switch cfg.mode {
+	case tlsModeOff, tlsModeSelfSigned:
+		return nil
+	case tlsModeFiles:
+		if cfg.certPath == "" || cfg.keyPath == "" {
+			return errors.New("HTTP_TLS_MODE files requires HTTP_TLS_CERT_PATH and HTTP_TLS_KEY_PATH")
+		}
+		return nil
+	case tlsModeACME:
+		if len(cfg.acmeDomains) == 0 {
+			return errors.New("HTTP_TLS_MODE acme requires HTTP_ACME_DOMAINS")
+		}
+		if cfg.acmeCacheDir == "" {
+			return errors.New("HTTP_TLS_MODE acme requires HTTP_ACME_CACHE_DIR")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown TLS mode %q", cfg.mode)
+	}
+}
+
+// newTLS prepares serving HTTPS on addr for the configured TLS mode. It
+// returns nil if TLS is disabled. Errors reloading certificates are
+// logged to logger.
+func newTLS(cfg tlsConfig, addr string, baseURL *url.URL, logger *slog.Logger) (*tlsServing, error) {
+	err := checkTLS(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	redirect := redirectToHTTPS(addr)
+
+	switch cfg.mode {
+	case tlsModeFiles:
+		r, err := certs.NewReloader(cfg.certPath, cfg.keyPath, certReloadInterval, func(err error) {
+			logger.Error("failed to reload certificate", "error", err)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &tlsServing{
+			config:   &tls.Config{GetCertificate: r.GetCertificate},
+			redirect: redirect,
+			close:    r.Close,
+		}, nil
+	case tlsModeSelfSigned:
+		hosts := []string{"localhost", "127.0.0.1", "::1"}
+		if h := baseURL.Hostname(); h != "" && h != "localhost" {
+			hosts = append(hosts, h)
+		}
+
+		certPEM, keyPEM, err := certs.SelfSigned(hosts, time.Hour*24*30)
+		if err != nil {
+			return nil, err
+		}
+
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, err
+		}
+
+		return &tlsServing{
+			config:   &tls.Config{Certificates: []tls.Certificate{cert}},
+			redirect: redirect,
+			close:    func() error { return nil },
+		}, nil
+	case tlsModeACME:
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.acmeDomains...),
+			Cache:      autocert.DirCache(cfg.acmeCacheDir),
+			Email:      cfg.acmeEmail,
+		}
+
+		return &tlsServing{
+			config: m.TLSConfig(),
+			// The redirect listener also answers the HTTP-01 challenges of
+			// the ACME server, so it should listen on port 80.
+			redirect: m.HTTPHandler(redirect),
+			close:    func() error { return nil },
+		}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// redirectToHTTPS returns a handler that redirects requests to the same URL
+// served over HTTPS on the port of addr.
+func redirectToHTTPS(addr string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		target := url.URL{
+			Scheme:   "https",
+			Host:     host,
+			Path:     r.URL.Path,
+			RawQuery: r.URL.RawQuery,
+		}
+
+		http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/willemschots/househunt/internal/tracing"
+)
+
+// newTracer creates a tracer for the configured exporter. It returns
+// nil if tracing is disabled.
+func newTracer(cfg traceConfig) (*tracing.Tracer, error) {
+	var exporter tracing.Exporter
+	switch cfg.exporter {
+	case "none":
+		return nil, nil
+	case "stdout":
+		exporter = tracing.NewWriterExporter(os.Stdout)
+	case "otlp":
+		httpClient := &http.Client{
+			Timeout: 10 * time.Second,
+		}
+		exporter = tracing.NewOTLPExporter(httpClient, cfg.otlpEndpoint, "househunt")
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.exporter)
+	}
+
+	return tracing.NewTracer(exporter, cfg.tracer), nil
+}
@@ -221,6 +221,223 @@ func Test_UserStories(t *testing.T) {
 	}))
 }
 
+func Test_UserStories_Operator(t *testing.T) {
+	t.Run("as an operator, I want to", testEnv(func(t *testing.T) {
+		envForTest(t, "POSTMARK_WEBHOOK_SECRET", "webhookSecret")
+
+		logs := runAppForTest(t)
+
+		c := newClient(t)
+
+		bounce := `{"RecordType":"Bounce","Type":"HardBounce","Email":"bounced@example.com","BouncedAt":"2024-05-01T12:00:00Z"}`
+
+		t.Run("only accept webhooks with the shared secret", func(t *testing.T) {
+			c.mustPostWebhook(t, "/webhooks/postmark", "wrongSecret", bounce, assertStatusCode(t, http.StatusUnauthorized))
+		})
+
+		t.Run("suppress addresses that bounced", func(t *testing.T) {
+			c.mustPostWebhook(t, "/webhooks/postmark", "webhookSecret", bounce, assertStatusCode(t, http.StatusOK))
+		})
+
+		t.Run("not send emails to suppressed addresses", func(t *testing.T) {
+			body := c.mustGetBody(t, "/register", assertStatusCode(t, http.StatusOK))
+
+			form := parseHTMLFormWithID(t, strings.NewReader(body), "register-user")
+			form.values.Set("email", "bounced@example.com")
+			form.values.Set("password", "reallyStrongPassword1")
+
+			c.mustSubmitForm(t, form, assertRedirectsTo(t, "/register", http.StatusFound))
+
+			waitForLog(t, logs, "recipient is suppressed: hard_bounce")
+		})
+	}))
+}
+
+func Test_UserStories_Admin(t *testing.T) {
+	t.Run("as an admin, I want to", testEnv(func(t *testing.T) {
+		logs := runAppForTest(t)
+
+		admin := newClient(t)
+
+		t.Run("be appointed as admin", func(t *testing.T) {
+			admin.mustRegisterAndActivate(t, logs, "admin@example.com")
+
+			// The first admins are appointed on startup using their IDs, since
+			// the app is already running we update the database directly.
+			cfg, _, err := loadConfig()
+			if err != nil {
+				t.Fatalf("failed to load config: %v", err)
+			}
+
+			dbh, err := connectDB(cfg)
+			if err != nil {
+				t.Fatalf("failed to connect to database: %v", err)
+			}
+			defer dbh.close()
+
+			_, err = dbh.write.Exec(`UPDATE users SET role = 'admin'`)
+			if err != nil {
+				t.Fatalf("failed to update role: %v", err)
+			}
+
+			admin.mustLogin(t, "admin@example.com")
+		})
+
+		t.Run("keep the admin pages hidden from others", func(t *testing.T) {
+			newClient(t).mustGetBody(t, "/admin", assertStatusCode(t, http.StatusNotFound))
+		})
+
+		var userURL string
+
+		t.Run("find a user by email", func(t *testing.T) {
+			agent := newClient(t)
+			agent.mustRegister(t, "agent@example.com")
+
+			// Registration happens in the background, wait for it to finish.
+			_ = waitAndCaptureURL(t, logs, "agent@example.com", "/user-activations")
+
+			body := admin.mustGetBody(t, "/admin/users?email=agent@example.com", assertStatusCode(t, http.StatusOK))
+
+			match := regexp.MustCompile(`/admin/users/[0-9a-f-]{36}`).FindString(body)
+			if match == "" {
+				t.Fatalf("expected a link to the user, got:\n%s", body)
+			}
+
+			userURL = match
+		})
+
+		t.Run("resend the activation email", func(t *testing.T) {
+			body := admin.mustGetBody(t, userURL, assertStatusCode(t, http.StatusOK))
+
+			form := parseHTMLFormWithID(t, strings.NewReader(body), "resend-activation")
+			admin.mustSubmitForm(t, form, assertRedirectsTo(t, userURL, http.StatusFound))
+
+			body = admin.mustGetBody(t, userURL, assertStatusCode(t, http.StatusOK))
+			if strings.Count(body, "<td>Activation</td>") != 2 {
+				t.Fatalf("expected two activation tokens in the history, got:\n%s", body)
+			}
+		})
+
+		t.Run("activate and deactivate the user", func(t *testing.T) {
+			body := admin.mustGetBody(t, userURL, assertStatusCode(t, http.StatusOK))
+
+			form := parseHTMLFormWithID(t, strings.NewReader(body), "reactivate-user")
+			admin.mustSubmitForm(t, form, assertRedirectsTo(t, userURL, http.StatusFound))
+
+			body = admin.mustGetBody(t, userURL, assertStatusCode(t, http.StatusOK))
+
+			form = parseHTMLFormWithID(t, strings.NewReader(body), "deactivate-user")
+			admin.mustSubmitForm(t, form, assertRedirectsTo(t, userURL, http.StatusFound))
+		})
+
+		t.Run("see my actions in the audit log", func(t *testing.T) {
+			body := admin.mustGetBody(t, "/admin/audit-log", assertStatusCode(t, http.StatusOK))
+
+			for _, want := range []string{"Resent activation email", "Activated user", "Deactivated user"} {
+				if !strings.Contains(body, want) {
+					t.Errorf("expected audit log to contain %q, got:\n%s", want, body)
+				}
+			}
+		})
+
+		t.Run("see the status of background jobs", func(t *testing.T) {
+			body := admin.mustGetBody(t, "/admin/jobs", assertStatusCode(t, http.StatusOK))
+
+			if !strings.Contains(body, "There are no failed jobs.") {
+				t.Errorf("expected no failed jobs, got:\n%s", body)
+			}
+		})
+	}))
+}
+
+func Test_UserStories_SecurityEvents(t *testing.T) {
+	t.Run("as an agent, I want to see my recent security events", testEnv(func(t *testing.T) {
+		logs := runAppForTest(t)
+
+		c := newClient(t)
+		c.mustRegisterAndActivate(t, logs, "agent@example.com")
+		c.mustLogin(t, "agent@example.com")
+
+		body := c.mustGetBody(t, "/settings", assertStatusCode(t, http.StatusOK))
+
+		for _, want := range []string{"Registered", "Activated account", "Logged in"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("expected settings page to contain %q, got:\n%s", want, body)
+			}
+		}
+	}))
+}
+
+func Test_UserStories_Locale(t *testing.T) {
+	t.Run("as a Dutch speaking visitor, I want to", testEnv(func(t *testing.T) {
+		runAppForTest(t)
+
+		c := newClient(t)
+
+		t.Run("see the site in English by default", func(t *testing.T) {
+			body := c.mustGetBody(t, "/", assertStatusCode(t, http.StatusOK))
+			if !strings.Contains(body, "This is Househunt.") {
+				t.Fatalf("expected English body, got:\n%s", body)
+			}
+		})
+
+		t.Run("switch to Dutch", func(t *testing.T) {
+			body := c.mustGetBody(t, "/", assertStatusCode(t, http.StatusOK))
+
+			form := parseHTMLFormWithID(t, strings.NewReader(body), "switch-locale")
+			form.values.Set("locale", "nl")
+
+			c.mustSubmitForm(t, form, assertRedirectsTo(t, "/", http.StatusFound))
+		})
+
+		t.Run("see the site in Dutch", func(t *testing.T) {
+			body := c.mustGetBody(t, "/", assertStatusCode(t, http.StatusOK))
+			if !strings.Contains(body, "Dit is Househunt.") {
+				t.Fatalf("expected Dutch body, got:\n%s", body)
+			}
+		})
+	}))
+}
+
+// mustRegister registers a new account with addr as email address.
+func (c *client) mustRegister(t *testing.T, addr string) {
+	t.Helper()
+
+	body := c.mustGetBody(t, "/register", assertStatusCode(t, http.StatusOK))
+
+	form := parseHTMLFormWithID(t, strings.NewReader(body), "register-user")
+	form.values.Set("email", addr)
+	form.values.Set("password", "reallyStrongPassword1")
+
+	c.mustSubmitForm(t, form, assertRedirectsTo(t, "/register", http.StatusFound))
+}
+
+// mustRegisterAndActivate registers and activates a new account with addr as email address.
+func (c *client) mustRegisterAndActivate(t *testing.T, logs *safeBuffer, addr string) {
+	t.Helper()
+
+	c.mustRegister(t, addr)
+
+	activationURL := waitAndCaptureURL(t, logs, addr, "/user-activations")
+	body := c.mustGetBody(t, activationURL.String(), assertStatusCode(t, http.StatusOK))
+
+	form := parseHTMLFormWithID(t, strings.NewReader(body), "activate-user")
+	c.mustSubmitForm(t, form, assertRedirectsTo(t, "/login", http.StatusFound))
+}
+
+// mustLogin logs in with addr as email address.
+func (c *client) mustLogin(t *testing.T, addr string) {
+	t.Helper()
+
+	body := c.mustGetBody(t, "/login", assertStatusCode(t, http.StatusOK))
+
+	form := parseHTMLFormWithID(t, strings.NewReader(body), "login-user")
+	form.values.Set("email", addr)
+	form.values.Set("password", "reallyStrongPassword1")
+
+	c.mustSubmitForm(t, form, assertRedirectsTo(t, "/dashboard", http.StatusFound))
+}
+
 // runAppForTest runs the app while the test is running.
 // This function returns after the app is confirmed to be up and stops
 // the app when the test is cleaned up.
@@ -238,10 +455,15 @@ func runAppForTest(t *testing.T) *safeBuffer {
 
 	// we will stop the server after a timeout or when the test is cleaned up.
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	done := make(chan struct{})
 	t.Cleanup(func() {
 		// stop both tasks if it's still in progress.
 		cancel()
 
+		// wait for the app to stop, so its listeners and files are released
+		// before the next test (or the cleanup of temporary directories) runs.
+		<-done
+
 		if t.Failed() {
 			t.Logf("app output:\n%s", buf.String())
 		}
@@ -249,6 +471,8 @@ func runAppForTest(t *testing.T) *safeBuffer {
 
 	// Task 1: Run the app.
 	go func() {
+		defer close(done)
+
 		code := run(ctx, buf)
 		if code != 0 {
 			t.Errorf("run exited with code %d", code)
@@ -356,6 +580,34 @@ func (c *client) mustSubmitForm(t *testing.T, form htmlForm, responseFunc func(*
 	}
 }
 
+func (c *client) mustPostWebhook(t *testing.T, url, secret, payload string, responseFunc func(*http.Response)) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, baseURL+url, strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("unexpected error creating post request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth("postmark", secret)
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error during post request: %v", err)
+	}
+
+	defer func() {
+		err := res.Body.Close()
+		if err != nil {
+			t.Fatalf("unexpected error closing response body: %v", err)
+		}
+	}()
+
+	if responseFunc != nil {
+		responseFunc(res)
+	}
+}
+
 func assertStatusCode(t *testing.T, status int) func(*http.Response) {
 	return func(res *http.Response) {
 		t.Helper()
@@ -475,6 +727,28 @@ func addFormValues(t *testing.T, n *html.Node, vals *url.Values) {
 	}
 }
 
+// waitForLog waits until the logs contain want.
+func waitForLog(t *testing.T, logs *safeBuffer, want string) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if strings.Contains(logs.String(), want) {
+				return
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for log line %q", want)
+		}
+	}
+}
+
 func waitAndCaptureURL(t *testing.T, logs *safeBuffer, addr, urlPath string) *url.URL {
 	t.Helper()
 
@@ -0,0 +1,25 @@
+package audit
+
+import "context"
+
+// Client describes who made the request that caused an event.
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+type ctxKey string
+
+const clientCtxKey ctxKey = "_client"
+
+// WithClient returns a copy of ctx that carries c.
+func WithClient(ctx context.Context, c Client) context.Context {
+	return context.WithValue(ctx, clientCtxKey, c)
+}
+
+// ClientFromContext returns the client stored in ctx. An empty Client is
+// returned if there is none, for example for events caused by a background job.
+func ClientFromContext(ctx context.Context) Client {
+	c, _ := ctx.Value(clientCtxKey).(Client)
+	return c
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/audit"
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/errorz"
+)
+
+type execFunc func(query string, params ...any) (sql.Result, error)
+type queryFunc func(query string, params ...any) (*sql.Rows, error)
+
+func insertEvent(q db.Query, ef execFunc, e audit.Event) error {
+	if e.ID == uuid.Nil {
+		return fmt.Errorf("zero uuid provided: %w", errorz.ErrConstraintViolated)
+	}
+
+	q.Unsafe(`INSERT INTO audit_events (id, user_id, type, detail, ip_encrypted, user_agent_encrypted, created_at) VALUES (`)
+	q.Params(e.ID, uuid.NullUUID{UUID: e.UserID, Valid: e.UserID != uuid.Nil}, e.Type, e.Detail)
+	q.Unsafe(`, `)
+	paramEncryptedOrNull(&q, e.IP)
+	q.Unsafe(`, `)
+	paramEncryptedOrNull(&q, e.UserAgent)
+	q.Unsafe(`, `)
+	q.Param(e.CreatedAt)
+	q.Unsafe(`)`)
+
+	s, params, err := q.Get()
+	if err != nil {
+		return err
+	}
+
+	_, err = ef(s, params...)
+	if err != nil {
+		return errorz.MapDBErr(err)
+	}
+
+	return nil
+}
+
+// paramEncryptedOrNull adds v as an encrypted parameter, empty values are stored as NULL.
+func paramEncryptedOrNull(q *db.Query, v string) {
+	if v == "" {
+		q.Param(nil)
+		return
+	}
+
+	q.ParamEncrypted([]byte(v))
+}
+
+func selectEvents(q db.Query, qf queryFunc, f audit.EventFilter) ([]audit.Event, error) {
+	q.Unsafe(`SELECT id, user_id, type, detail, ip_encrypted, user_agent_encrypted, created_at FROM audit_events WHERE 1=1 `)
+
+	if len(f.UserIDs) > 0 {
+		q.Unsafe(`AND user_id IN (`)
+		for i, id := range f.UserIDs {
+			if i > 0 {
+				q.Unsafe(`, `)
+			}
+			q.Param(id)
+		}
+		q.Unsafe(`) `)
+	}
+
+	q.Unsafe(`ORDER BY created_at DESC, id ASC`)
+
+	if f.Limit > 0 {
+		q.Unsafe(` LIMIT `)
+		q.Param(f.Limit)
+	}
+
+	s, params, err := q.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := qf(s, params...)
+	if err != nil {
+		return nil, errorz.MapDBErr(err)
+	}
+
+	defer rows.Close()
+
+	out := make([]audit.Event, 0)
+	for rows.Next() {
+		var (
+			e      audit.Event
+			userID uuid.NullUUID
+		)
+		ipBytes := q.DecryptionTarget()
+		userAgentBytes := q.DecryptionTarget()
+		err := rows.Scan(&e.ID, &userID, &e.Type, &e.Detail, ipBytes, userAgentBytes, &e.CreatedAt)
+		if err != nil {
+			return nil, errorz.MapDBErr(err)
+		}
+
+		e.UserID = userID.UUID
+		e.IP = string(ipBytes.Data)
+		e.UserAgent = string(userAgentBytes.Data)
+
+		out = append(out, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errorz.MapDBErr(err)
+	}
+
+	return out, nil
+}
+
+func deleteEventsBefore(q db.Query, ef execFunc, t time.Time) (int64, error) {
+	q.Unsafe(`DELETE FROM audit_events WHERE created_at < `)
+	q.Param(t)
+
+	s, params, err := q.Get()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := ef(s, params...)
+	if err != nil {
+		return 0, errorz.MapDBErr(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, errorz.MapDBErr(err)
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/willemschots/househunt/internal/audit"
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/krypto"
+)
+
+// Store is responsible for storing audit events in a database.
+type Store struct {
+	writeDB   *sql.DB
+	readDB    *sql.DB
+	dialect   db.Dialect
+	encryptor *krypto.Encryptor
+}
+
+// New creates a new Store. The dialect is based on the driver of writeDB.
+func New(writeDB, readDB *sql.DB, encryptor *krypto.Encryptor) *Store {
+	return &Store{
+		writeDB:   writeDB,
+		readDB:    readDB,
+		dialect:   db.DialectOf(writeDB),
+		encryptor: encryptor,
+	}
+}
+
+func (s *Store) newQuery() db.Query {
+	return db.Query{
+		Encryptor: s.encryptor,
+		Dialect:   s.dialect,
+	}
+}
+
+// CreateEvent appends an event to the audit log.
+func (s *Store) CreateEvent(ctx context.Context, e audit.Event) error {
+	return insertEvent(s.newQuery(), db.TracedExec(ctx, s.writeDB), e)
+}
+
+// FindEvents queries for events based on the provided filter, most recent first.
+// It returns an empty slice if no events are found.
+func (s *Store) FindEvents(ctx context.Context, filter audit.EventFilter) ([]audit.Event, error) {
+	return selectEvents(s.newQuery(), db.TracedQuery(ctx, s.readDB), filter)
+}
+
+// DeleteEventsBefore deletes all events created before t.
+func (s *Store) DeleteEventsBefore(ctx context.Context, t time.Time) (int64, error) {
+	return deleteEventsBefore(s.newQuery(), db.TracedExec(ctx, s.writeDB), t)
+}
@@ -0,0 +1,181 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/audit"
+	"github.com/willemschots/househunt/internal/audit/db"
+	dbpkg "github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/db/testdb"
+	"github.com/willemschots/househunt/internal/errorz"
+	"github.com/willemschots/househunt/internal/krypto"
+)
+
+func Test_Store_Events(t *testing.T) {
+	for _, b := range testdb.Backends {
+		t.Run(b.Name, func(t *testing.T) {
+			testEvents(t, b.Open)
+		})
+	}
+}
+
+func testEvents(t *testing.T, openDB func(t *testing.T) *sql.DB) {
+	t.Run("ok, create and find", func(t *testing.T) {
+		store, testDB := storeForTest(t, openDB(t))
+		userID := createUser(t, testDB)
+
+		events := []audit.Event{
+			newEvent(t, userID, audit.EventLoginSucceeded, 1),
+			newEvent(t, userID, audit.EventLoginFailed, 2),
+			newEvent(t, uuid.Nil, audit.EventLoginFailed, 3),
+		}
+
+		// Empty client values are allowed.
+		events[1].IP = ""
+		events[1].UserAgent = ""
+
+		for _, e := range events {
+			err := store.CreateEvent(context.Background(), e)
+			if err != nil {
+				t.Fatalf("failed to create event: %v", err)
+			}
+		}
+
+		assertEvents(t, store, audit.EventFilter{}, []audit.Event{events[2], events[1], events[0]})
+		assertEvents(t, store, audit.EventFilter{UserIDs: []uuid.UUID{userID}}, []audit.Event{events[1], events[0]})
+		assertEvents(t, store, audit.EventFilter{UserIDs: []uuid.UUID{userID}, Limit: 1}, []audit.Event{events[1]})
+		assertEvents(t, store, audit.EventFilter{UserIDs: []uuid.UUID{uuid.New()}}, []audit.Event{})
+	})
+
+	t.Run("fail, zero uuid", func(t *testing.T) {
+		store, _ := storeForTest(t, openDB(t))
+
+		e := newEvent(t, uuid.Nil, audit.EventLoginFailed, 1)
+		e.ID = uuid.Nil
+
+		err := store.CreateEvent(context.Background(), e)
+		if !errors.Is(err, errorz.ErrConstraintViolated) {
+			t.Fatalf("expected error %v, got %v (via errors.Is)", errorz.ErrConstraintViolated, err)
+		}
+	})
+
+	t.Run("fail, unknown user", func(t *testing.T) {
+		store, _ := storeForTest(t, openDB(t))
+
+		err := store.CreateEvent(context.Background(), newEvent(t, uuid.New(), audit.EventLoginFailed, 1))
+		if !errors.Is(err, errorz.ErrConstraintViolated) {
+			t.Fatalf("expected error %v, got %v (via errors.Is)", errorz.ErrConstraintViolated, err)
+		}
+	})
+
+	t.Run("fail, events are append-only", func(t *testing.T) {
+		store, testDB := storeForTest(t, openDB(t))
+
+		e := newEvent(t, uuid.Nil, audit.EventLoginFailed, 1)
+		err := store.CreateEvent(context.Background(), e)
+		if err != nil {
+			t.Fatalf("failed to create event: %v", err)
+		}
+
+		_, err = testDB.Exec(`UPDATE audit_events SET type = 'login_succeeded'`)
+		if err == nil {
+			t.Fatalf("expected an error when updating an event")
+		}
+	})
+
+	t.Run("ok, delete events before", func(t *testing.T) {
+		store, _ := storeForTest(t, openDB(t))
+
+		events := []audit.Event{
+			newEvent(t, uuid.Nil, audit.EventLoginFailed, 1),
+			newEvent(t, uuid.Nil, audit.EventLoginFailed, 2),
+			newEvent(t, uuid.Nil, audit.EventLoginFailed, 3),
+		}
+
+		for _, e := range events {
+			err := store.CreateEvent(context.Background(), e)
+			if err != nil {
+				t.Fatalf("failed to create event: %v", err)
+			}
+		}
+
+		n, err := store.DeleteEventsBefore(context.Background(), events[2].CreatedAt)
+		if err != nil {
+			t.Fatalf("failed to delete events: %v", err)
+		}
+
+		if n != 2 {
+			t.Errorf("expected 2 deleted events, got %d", n)
+		}
+
+		assertEvents(t, store, audit.EventFilter{}, []audit.Event{events[2]})
+	})
+}
+
+func storeForTest(t *testing.T, testDB *sql.DB) (*db.Store, *sql.DB) {
+	t.Helper()
+
+	encryptor := must(krypto.NewEncryptor([]krypto.Key{
+		must(krypto.ParseKey("2b671594b775f371eab4050b4d58326682df6b1a6cc2e886717b1a26b4d6c45d")),
+	}))
+
+	return db.New(testDB, testDB, encryptor), testDB
+}
+
+// createUser inserts a bare user row, audit events reference users by ID.
+func createUser(t *testing.T, testDB *sql.DB) uuid.UUID {
+	t.Helper()
+
+	d := dbpkg.DialectOf(testDB)
+
+	id := uuid.New()
+	_, err := testDB.Exec(fmt.Sprintf(`INSERT INTO users (id, email_encrypted, email_blind_index, password_hash, is_active, created_at, updated_at) VALUES (%s, 'x', %s, 'x', %s, %s, %s)`,
+		d.Placeholder(1), d.Placeholder(2), d.Placeholder(3), d.Placeholder(4), d.Placeholder(5)),
+		id, id.String(), true, time.Now(), time.Now())
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	return id
+}
+
+func newEvent(t *testing.T, userID uuid.UUID, typ audit.EventType, sec int) audit.Event {
+	t.Helper()
+
+	return audit.Event{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Type:      typ,
+		IP:        "192.0.2.1",
+		UserAgent: "Mozilla/5.0",
+		CreatedAt: time.Date(2021, 1, 1, 0, 0, sec, 0, time.UTC),
+	}
+}
+
+func assertEvents(t *testing.T, store *db.Store, filter audit.EventFilter, want []audit.Event) {
+	t.Helper()
+
+	got, err := store.FindEvents(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("failed to find events: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%#v\nwant\n%#v\n", got, want)
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
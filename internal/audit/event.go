@@ -0,0 +1,56 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventType is the type of a security event.
+type EventType string
+
+const (
+	EventRegistration           EventType = "registration"
+	EventActivation             EventType = "activation"
+	EventLoginSucceeded         EventType = "login_succeeded"
+	EventLoginFailed            EventType = "login_failed"
+	EventPasswordResetRequested EventType = "password_reset_requested"
+	EventPasswordReset          EventType = "password_reset"
+	// EventTokenConsumed is recorded when a user uses an email token, the
+	// detail contains the purpose of the token.
+	EventTokenConsumed EventType = "token_consumed"
+)
+
+// Event is a security relevant event. Events are append-only, once recorded
+// they are only removed by the retention job.
+type Event struct {
+	ID uuid.UUID
+	// UserID is the user the event is about. It's uuid.Nil if no user is
+	// known, for example when someone fails to login with an unknown address.
+	UserID    uuid.UUID
+	Type      EventType
+	Detail    string
+	IP        string
+	UserAgent string
+	CreatedAt time.Time
+}
+
+// EventFilter is used to filter events.
+// Returned events must match all the provided fields.
+// If a field is empty or nil, it's ignored.
+type EventFilter struct {
+	UserIDs []uuid.UUID
+	// Limit is the max number of events returned, 0 means no limit.
+	Limit int
+}
+
+// Store stores security events.
+type Store interface {
+	CreateEvent(ctx context.Context, e Event) error
+	// FindEvents returns the events matching the filter, most recent first.
+	FindEvents(ctx context.Context, filter EventFilter) ([]Event, error)
+	// DeleteEventsBefore deletes all events created before t and returns
+	// the number of deleted events.
+	DeleteEventsBefore(ctx context.Context, t time.Time) (int64, error)
+}
@@ -0,0 +1,67 @@
+package audit
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps events in memory.
+type MemoryStore struct {
+	mu     *sync.Mutex
+	events []Event
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mu:     &sync.Mutex{},
+		events: make([]Event, 0),
+	}
+}
+
+func (s *MemoryStore) CreateEvent(_ context.Context, e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *MemoryStore) FindEvents(_ context.Context, filter EventFilter) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Iterate backwards, so events with the same timestamp are also most recent first.
+	out := make([]Event, 0)
+	for i := len(s.events) - 1; i >= 0; i-- {
+		e := s.events[i]
+		if len(filter.UserIDs) > 0 && !slices.Contains(filter.UserIDs, e.UserID) {
+			continue
+		}
+		out = append(out, e)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+
+	if filter.Limit > 0 && len(out) > filter.Limit {
+		out = out[:filter.Limit]
+	}
+
+	return out, nil
+}
+
+func (s *MemoryStore) DeleteEventsBefore(_ context.Context, t time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := len(s.events)
+	s.events = slices.DeleteFunc(s.events, func(e Event) bool {
+		return e.CreatedAt.Before(t)
+	})
+
+	return int64(before - len(s.events)), nil
+}
@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RetentionConfig configures how long events are kept.
+type RetentionConfig struct {
+	// MaxAge is the max age of an event before it's pruned.
+	MaxAge time.Duration
+	// Interval is the time between two runs of the retention job.
+	Interval time.Duration
+}
+
+// Recorder records security events.
+type Recorder struct {
+	store Store
+
+	mu      *sync.Mutex
+	closed  bool
+	stop    chan struct{}
+	running *sync.WaitGroup
+
+	// NowFunc is used to get the current time.
+	// Exposed for testing purposes.
+	NowFunc func() time.Time
+}
+
+// NewRecorder creates a new Recorder.
+func NewRecorder(store Store) *Recorder {
+	return &Recorder{
+		store:   store,
+		mu:      &sync.Mutex{},
+		stop:    make(chan struct{}),
+		running: &sync.WaitGroup{},
+		NowFunc: time.Now,
+	}
+}
+
+// Record records an event of type typ for the user with userID, which can be uuid.Nil.
+// The IP address and user agent are taken from the client in ctx.
+func (r *Recorder) Record(ctx context.Context, userID uuid.UUID, typ EventType, detail string) error {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	client := ClientFromContext(ctx)
+
+	err = r.store.CreateEvent(ctx, Event{
+		ID:        id,
+		UserID:    userID,
+		Type:      typ,
+		Detail:    detail,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		CreatedAt: r.NowFunc(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record %s event: %w", typ, err)
+	}
+
+	return nil
+}
+
+// Events returns the most recent events for the user, at most limit.
+func (r *Recorder) Events(ctx context.Context, userID uuid.UUID, limit int) ([]Event, error) {
+	return r.store.FindEvents(ctx, EventFilter{
+		UserIDs: []uuid.UUID{userID},
+		Limit:   limit,
+	})
+}
+
+// Prune deletes all events older than maxAge and returns the number of deleted events.
+func (r *Recorder) Prune(ctx context.Context, maxAge time.Duration) (int64, error) {
+	return r.store.DeleteEventsBefore(ctx, r.NowFunc().Add(-maxAge))
+}
+
+// RunRetention prunes events on every interval until ctx is cancelled or the
+// recorder is shut down. Errors are passed to errFunc, a failed run is retried
+// on the next interval.
+func (r *Recorder) RunRetention(ctx context.Context, cfg RetentionConfig, errFunc func(error)) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.running.Add(1)
+	r.mu.Unlock()
+
+	defer r.running.Done()
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := r.Prune(ctx, cfg.MaxAge)
+		if err != nil {
+			errFunc(fmt.Errorf("failed to prune audit events: %w", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown stops RunRetention and waits for a prune in progress to finish. If
+// ctx is done before that, an error is returned.
+func (r *Recorder) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.stop)
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("pruning audit events did not finish: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,117 @@
+package audit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/audit"
+)
+
+func Test_Recorder_Record(t *testing.T) {
+	tests := map[string]struct {
+		ctx  context.Context
+		want audit.Client
+	}{
+		"ok, client from context": {
+			ctx:  audit.WithClient(context.Background(), audit.Client{IP: "192.0.2.1", UserAgent: "Mozilla/5.0"}),
+			want: audit.Client{IP: "192.0.2.1", UserAgent: "Mozilla/5.0"},
+		},
+		"ok, no client in context": {
+			ctx:  context.Background(),
+			want: audit.Client{},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+			rec := audit.NewRecorder(audit.NewMemoryStore())
+			rec.NowFunc = func() time.Time { return now }
+
+			userID := uuid.New()
+			err := rec.Record(tc.ctx, userID, audit.EventLoginSucceeded, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			events, err := rec.Events(context.Background(), userID, 10)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(events) != 1 {
+				t.Fatalf("expected 1 event, got %d", len(events))
+			}
+
+			got := events[0]
+			if got.ID == uuid.Nil || got.UserID != userID || got.Type != audit.EventLoginSucceeded || !got.CreatedAt.Equal(now) {
+				t.Errorf("unexpected event: %#v", got)
+			}
+
+			if got.IP != tc.want.IP || got.UserAgent != tc.want.UserAgent {
+				t.Errorf("got client %q/%q, want %q/%q", got.IP, got.UserAgent, tc.want.IP, tc.want.UserAgent)
+			}
+		})
+	}
+}
+
+func Test_Recorder_Prune(t *testing.T) {
+	now := time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)
+	rec := audit.NewRecorder(audit.NewMemoryStore())
+	userID := uuid.New()
+
+	for _, age := range []time.Duration{72 * time.Hour, 48 * time.Hour, time.Hour} {
+		rec.NowFunc = func() time.Time { return now.Add(-age) }
+		err := rec.Record(context.Background(), userID, audit.EventLoginFailed, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	rec.NowFunc = func() time.Time { return now }
+	n, err := rec.Prune(context.Background(), 24*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if n != 2 {
+		t.Errorf("expected 2 pruned events, got %d", n)
+	}
+
+	events, err := rec.Events(context.Background(), userID, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(events) != 1 || !events[0].CreatedAt.Equal(now.Add(-time.Hour)) {
+		t.Errorf("unexpected events after pruning: %#v", events)
+	}
+}
+
+func Test_Recorder_Shutdown(t *testing.T) {
+	rec := audit.NewRecorder(audit.NewMemoryStore())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rec.RunRetention(context.Background(), audit.RetentionConfig{MaxAge: time.Hour, Interval: time.Hour}, func(err error) {
+			t.Errorf("unexpected error: %v", err)
+		})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := rec.Shutdown(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatalf("retention did not stop after shutdown")
+	}
+}
@@ -0,0 +1,421 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/errorz"
+	"github.com/willemschots/househunt/internal/krypto"
+	"github.com/willemschots/househunt/internal/tracing"
+)
+
+var (
+	ErrSelfModeration       = errors.New("admins can not moderate themselves")
+	ErrNotPendingActivation = errors.New("user is not pending activation")
+)
+
+// ActiveUser returns the active user with the provided ID. If no such user
+// exists errorz.ErrNotFound is returned.
+func (s *Service) ActiveUser(ctx context.Context, id uuid.UUID) (_ User, err error) {
+	ctx, span := tracing.Start(ctx, "auth.Service.ActiveUser")
+	defer func() { span.EndErr(err) }()
+
+	users, err := s.store.FindUsers(ctx, UserFilter{
+		IDs:      []uuid.UUID{id},
+		IsActive: ptr(true),
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	if len(users) != 1 {
+		return User{}, errorz.ErrNotFound
+	}
+
+	return users[0], nil
+}
+
+// FindUsers returns the users matching the filter. Searching by email
+// address is done using the blind index, so only exact matches are found.
+func (s *Service) FindUsers(ctx context.Context, filter UserFilter) (_ []User, err error) {
+	ctx, span := tracing.Start(ctx, "auth.Service.FindUsers")
+	defer func() { span.EndErr(err) }()
+
+	return s.store.FindUsers(ctx, filter)
+}
+
+// EmailTokens returns all email tokens that were ever created for the user,
+// oldest first.
+func (s *Service) EmailTokens(ctx context.Context, userID uuid.UUID) (_ []EmailToken, err error) {
+	ctx, span := tracing.Start(ctx, "auth.Service.EmailTokens")
+	defer func() { span.EndErr(err) }()
+
+	return s.store.FindEmailTokens(ctx, EmailTokenFilter{
+		UserIDs: []uuid.UUID{userID},
+	})
+}
+
+// AdminActions returns the entries of the admin audit log matching the filter,
+// most recent first.
+func (s *Service) AdminActions(ctx context.Context, filter AdminActionFilter) (_ []AdminAction, err error) {
+	ctx, span := tracing.Start(ctx, "auth.Service.AdminActions")
+	defer func() { span.EndErr(err) }()
+
+	return s.store.FindAdminActions(ctx, filter)
+}
+
+// DeactivateUser deactivates the user on behalf of the admin with actorID.
+// Deactivated users can't log in, and all their outstanding email tokens are
+// consumed. They can only be reactivated by an admin.
+func (s *Service) DeactivateUser(ctx context.Context, actorID, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.Service.DeactivateUser")
+	defer func() { span.EndErr(err) }()
+
+	if actorID == userID {
+		return errorz.InvalidInput{ErrSelfModeration}
+	}
+
+	now := s.NowFunc()
+
+	return s.inTx(ctx, func(tx Tx) error {
+		user, err := findUser(tx, UserFilter{
+			IDs: []uuid.UUID{userID},
+		})
+		if err != nil {
+			return err
+		}
+
+		user.IsActive = false
+		user.DeactivatedAt = ptr(now)
+		user.UpdatedAt = now
+
+		err = tx.UpdateUser(user)
+		if err != nil {
+			return err
+		}
+
+		for _, purpose := range []TokenPurpose{TokenPurposeActivate, TokenPurposePasswordReset} {
+			err = consumeAllTokensForUserID(tx, userID, purpose, now)
+			if err != nil {
+				return err
+			}
+		}
+
+		return s.recordAdminAction(tx, actorID, AdminActionDeactivateUser, userID, "")
+	})
+}
+
+// ReactivateUser activates the user on behalf of the admin with actorID. This
+// works both for deactivated users and users that never finished activation.
+func (s *Service) ReactivateUser(ctx context.Context, actorID, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.Service.ReactivateUser")
+	defer func() { span.EndErr(err) }()
+
+	now := s.NowFunc()
+
+	return s.inTx(ctx, func(tx Tx) error {
+		user, err := findUser(tx, UserFilter{
+			IDs:      []uuid.UUID{userID},
+			IsActive: ptr(false),
+		})
+		if err != nil {
+			return err
+		}
+
+		user.IsActive = true
+		user.DeactivatedAt = nil
+		user.UpdatedAt = now
+
+		err = tx.UpdateUser(user)
+		if err != nil {
+			return err
+		}
+
+		err = consumeAllTokensForUserID(tx, userID, TokenPurposeActivate, now)
+		if err != nil {
+			return err
+		}
+
+		return s.recordAdminAction(tx, actorID, AdminActionReactivateUser, userID, "")
+	})
+}
+
+// ResendActivation sends a new activation email to a user that has not
+// finished activation yet, on behalf of the admin with actorID.
+func (s *Service) ResendActivation(ctx context.Context, actorID, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.Service.ResendActivation")
+	defer func() { span.EndErr(err) }()
+
+	now := s.NowFunc()
+
+	var raw EmailTokenRaw
+	var user User
+
+	err = s.inTx(ctx, func(tx Tx) error {
+		var err error
+		user, err = findUser(tx, UserFilter{
+			IDs: []uuid.UUID{userID},
+		})
+		if err != nil {
+			return err
+		}
+
+		if user.IsActive || user.DeactivatedAt != nil {
+			return errorz.InvalidInput{ErrNotPendingActivation}
+		}
+
+		emailToken, token, err := newEmailToken(user.ID, user.Email, TokenPurposeActivate, now)
+		if err != nil {
+			return err
+		}
+
+		err = tx.CreateEmailToken(emailToken)
+		if err != nil {
+			return err
+		}
+
+		raw = EmailTokenRaw{
+			ID:    emailToken.ID,
+			Token: token,
+		}
+
+		return s.recordAdminAction(tx, actorID, AdminActionResendActivation, userID, "")
+	})
+	if err != nil {
+		return err
+	}
+
+	// Unlike RegisterUser, we send the email synchronously so the admin
+	// knows whether it was sent.
+	return s.emailer.Send(ctx, TemplateUserActivation, user.Email, raw)
+}
+
+// ForcePasswordReset forces the user to reset their password, on behalf of the
+// admin with actorID. The current password stops working, outstanding password
+// reset tokens are consumed and a password reset email is sent to the user.
+func (s *Service) ForcePasswordReset(ctx context.Context, actorID, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.Service.ForcePasswordReset")
+	defer func() { span.EndErr(err) }()
+
+	// The password is replaced by the hash of a random token nobody knows,
+	// so the user can only login again after resetting their password.
+	tok, err := krypto.GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	pwdHash, err := krypto.HashArgon2(tok[:])
+	if err != nil {
+		return err
+	}
+
+	now := s.NowFunc()
+
+	var raw EmailTokenRaw
+	var user User
+
+	err = s.inTx(ctx, func(tx Tx) error {
+		var err error
+		user, err = findUser(tx, UserFilter{
+			IDs:      []uuid.UUID{userID},
+			IsActive: ptr(true),
+		})
+		if err != nil {
+			return err
+		}
+
+		user.PasswordHash = pwdHash
+		user.UpdatedAt = now
+
+		err = tx.UpdateUser(user)
+		if err != nil {
+			return err
+		}
+
+		err = consumeAllTokensForUserID(tx, userID, TokenPurposePasswordReset, now)
+		if err != nil {
+			return err
+		}
+
+		emailToken, token, err := newEmailToken(user.ID, user.Email, TokenPurposePasswordReset, now)
+		if err != nil {
+			return err
+		}
+
+		err = tx.CreateEmailToken(emailToken)
+		if err != nil {
+			return err
+		}
+
+		raw = EmailTokenRaw{
+			ID:    emailToken.ID,
+			Token: token,
+		}
+
+		return s.recordAdminAction(tx, actorID, AdminActionForceReset, userID, "")
+	})
+	if err != nil {
+		return err
+	}
+
+	// Like ResendActivation, the email is sent synchronously so the admin
+	// knows whether it was sent.
+	return s.emailer.Send(ctx, TemplatePasswordResetRequest, user.Email, raw)
+}
+
+// ExpireTokens consumes all outstanding email tokens of the user, on behalf of
+// the admin with actorID. It returns the number of tokens that were expired.
+func (s *Service) ExpireTokens(ctx context.Context, actorID, userID uuid.UUID) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "auth.Service.ExpireTokens")
+	defer func() { span.EndErr(err) }()
+
+	now := s.NowFunc()
+
+	var expired int
+	err = s.inTx(ctx, func(tx Tx) error {
+		_, err := findUser(tx, UserFilter{
+			IDs: []uuid.UUID{userID},
+		})
+		if err != nil {
+			return err
+		}
+
+		tokens, err := tx.FindEmailTokens(EmailTokenFilter{
+			UserIDs:    []uuid.UUID{userID},
+			IsConsumed: ptr(false),
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, t := range tokens {
+			t.ConsumedAt = ptr(now)
+			err = tx.UpdateEmailToken(t)
+			if err != nil {
+				return err
+			}
+		}
+
+		expired = len(tokens)
+
+		return s.recordAdminAction(tx, actorID, AdminActionExpireTokens, userID, "")
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return expired, nil
+}
+
+// ChangeRole changes the role of the user on behalf of the admin with actorID.
+func (s *Service) ChangeRole(ctx context.Context, actorID, userID uuid.UUID, role Role) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.Service.ChangeRole")
+	defer func() { span.EndErr(err) }()
+
+	if actorID == userID {
+		return errorz.InvalidInput{ErrSelfModeration}
+	}
+
+	if _, err := ParseRole(string(role)); err != nil {
+		return errorz.InvalidInput{err}
+	}
+
+	now := s.NowFunc()
+
+	return s.inTx(ctx, func(tx Tx) error {
+		user, err := findUser(tx, UserFilter{
+			IDs: []uuid.UUID{userID},
+		})
+		if err != nil {
+			return err
+		}
+
+		user.Role = role
+		user.UpdatedAt = now
+
+		err = tx.UpdateUser(user)
+		if err != nil {
+			return err
+		}
+
+		return s.recordAdminAction(tx, actorID, AdminActionChangeRole, userID, string(role))
+	})
+}
+
+// RecordAdminAction adds an entry to the admin audit log. Use it for admin
+// actions that are not handled by this service. targetUserID can be uuid.Nil.
+func (s *Service) RecordAdminAction(ctx context.Context, actorID uuid.UUID, action AdminActionType, targetUserID uuid.UUID, detail string) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.Service.RecordAdminAction")
+	defer func() { span.EndErr(err) }()
+
+	return s.inTx(ctx, func(tx Tx) error {
+		return s.recordAdminAction(tx, actorID, action, targetUserID, detail)
+	})
+}
+
+// BootstrapAdmins grants the admin role to the users with the provided IDs.
+// This is used to appoint the first admins, after that roles can be managed
+// via the back-office. Unknown IDs are ignored.
+func (s *Service) BootstrapAdmins(ctx context.Context, userIDs []uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.Service.BootstrapAdmins")
+	defer func() { span.EndErr(err) }()
+
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	now := s.NowFunc()
+
+	return s.inTx(ctx, func(tx Tx) error {
+		users, err := tx.FindUsers(UserFilter{
+			IDs: userIDs,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			if user.Role == RoleAdmin {
+				continue
+			}
+
+			user.Role = RoleAdmin
+			user.UpdatedAt = now
+
+			err = tx.UpdateUser(user)
+			if err != nil {
+				return err
+			}
+
+			err = s.recordAdminAction(tx, uuid.Nil, AdminActionBootstrapAdmin, user.ID, string(RoleAdmin))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *Service) recordAdminAction(tx Tx, actorID uuid.UUID, action AdminActionType, targetUserID uuid.UUID, detail string) error {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	err = tx.CreateAdminAction(AdminAction{
+		ID:           id,
+		ActorID:      actorID,
+		Action:       action,
+		TargetUserID: targetUserID,
+		Detail:       detail,
+		CreatedAt:    s.NowFunc(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record admin action: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AdminActionType identifies what an admin did.
+type AdminActionType string
+
+const (
+	AdminActionDeactivateUser   AdminActionType = "deactivate_user"
+	AdminActionReactivateUser   AdminActionType = "reactivate_user"
+	AdminActionResendActivation AdminActionType = "resend_activation"
+	AdminActionChangeRole       AdminActionType = "change_role"
+	AdminActionLiftSuppression  AdminActionType = "lift_suppression"
+	AdminActionBootstrapAdmin   AdminActionType = "bootstrap_admin"
+	AdminActionForceReset       AdminActionType = "force_password_reset"
+	AdminActionExpireTokens     AdminActionType = "expire_tokens"
+)
+
+// AdminAction is an entry in the audit log of actions taken by admins.
+type AdminAction struct {
+	ID uuid.UUID `db:"id,pk"`
+	// ActorID is the ID of the admin that took the action. It's uuid.Nil
+	// if the action was taken by the system itself.
+	ActorID uuid.UUID       `db:"actor_id,nullzero"`
+	Action  AdminActionType `db:"action"`
+	// TargetUserID is the ID of the user the action was taken against. It's
+	// uuid.Nil if the action did not target a user.
+	TargetUserID uuid.UUID `db:"target_user_id,nullzero"`
+	// Detail contains additional information about the action, like the new
+	// role of a user. It can contain personal data and is stored encrypted.
+	// It's empty if there are no details.
+	Detail    string    `db:"detail_encrypted,encrypted,nullzero"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// BySystem reports whether the action was taken by the system instead of an admin.
+func (a AdminAction) BySystem() bool {
+	return a.ActorID == uuid.Nil
+}
+
+// HasTarget reports whether the action targeted a user.
+func (a AdminAction) HasTarget() bool {
+	return a.TargetUserID != uuid.Nil
+}
@@ -0,0 +1,426 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/auth"
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/errorz"
+)
+
+func Test_Service_DeactivateUser(t *testing.T) {
+	t.Run("ok, deactivated user can't login or activate again", func(t *testing.T) {
+		st := newServiceTest(t)
+		admin := st.createUser("admin@example.com", true)
+		credentials, _ := st.registerUser()
+		user := st.findUser(credentials.Email)
+		st.activateUserByAdmin(admin.ID, user.ID)
+
+		err := st.svc.DeactivateUser(context.Background(), admin.ID, user.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if st.authenticate(credentials) {
+			t.Fatalf("expected deactivated user to not be able to login")
+		}
+
+		// Registering again should not send a new activation email.
+		st.emailer.clearEmails()
+		err = st.svc.RegisterUser(context.Background(), credentials)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		st.svc.Wait()
+		st.errList.assertErrorIs(t, auth.ErrDeactivatedUser)
+		st.emailer.assertNoEmails(t)
+
+		st.assertAdminActions(t, user.ID, auth.AdminActionDeactivateUser, auth.AdminActionReactivateUser)
+	})
+
+	t.Run("ok, outstanding tokens are consumed", func(t *testing.T) {
+		st := newServiceTest(t)
+		admin := st.createUser("admin@example.com", true)
+		credentials, raw := st.registerUser()
+		user := st.findUser(credentials.Email)
+
+		err := st.svc.DeactivateUser(context.Background(), admin.ID, user.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		err = st.svc.ActivateUser(context.Background(), raw)
+		if !errors.Is(err, errorz.ErrNotFound) {
+			t.Fatalf("expected error %v, got %v via errors.Is()", errorz.ErrNotFound, err)
+		}
+	})
+
+	t.Run("fail, deactivate self", func(t *testing.T) {
+		st := newServiceTest(t)
+		admin := st.createUser("admin@example.com", true)
+
+		err := st.svc.DeactivateUser(context.Background(), admin.ID, admin.ID)
+		if !errors.Is(err, auth.ErrSelfModeration) {
+			t.Fatalf("expected error %v, got %v via errors.Is()", auth.ErrSelfModeration, err)
+		}
+	})
+
+	t.Run("fail, unknown user", func(t *testing.T) {
+		st := newServiceTest(t)
+		admin := st.createUser("admin@example.com", true)
+
+		err := st.svc.DeactivateUser(context.Background(), admin.ID, uuid.New())
+		if !errors.Is(err, errorz.ErrNotFound) {
+			t.Fatalf("expected error %v, got %v via errors.Is()", errorz.ErrNotFound, err)
+		}
+	})
+}
+
+func Test_Service_ReactivateUser(t *testing.T) {
+	t.Run("ok, reactivated user can login", func(t *testing.T) {
+		st := newServiceTest(t)
+		admin := st.createUser("admin@example.com", true)
+		credentials, _ := st.registerUser()
+		user := st.findUser(credentials.Email)
+
+		// Users that never finished activation can be activated by an admin.
+		st.activateUserByAdmin(admin.ID, user.ID)
+
+		err := st.svc.DeactivateUser(context.Background(), admin.ID, user.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		st.activateUserByAdmin(admin.ID, user.ID)
+
+		if !st.authenticate(credentials) {
+			t.Fatalf("expected reactivated user to be able to login")
+		}
+
+		got := st.findUser(credentials.Email)
+		if got.DeactivatedAt != nil {
+			t.Errorf("expected DeactivatedAt to be reset, got %v", got.DeactivatedAt)
+		}
+	})
+
+	t.Run("fail, user already active", func(t *testing.T) {
+		st := newServiceTest(t)
+		admin := st.createUser("admin@example.com", true)
+		user := st.createUser("jacob@example.com", true)
+
+		err := st.svc.ReactivateUser(context.Background(), admin.ID, user.ID)
+		if !errors.Is(err, errorz.ErrNotFound) {
+			t.Fatalf("expected error %v, got %v via errors.Is()", errorz.ErrNotFound, err)
+		}
+	})
+}
+
+func Test_Service_ResendActivation(t *testing.T) {
+	t.Run("ok, resend activation", func(t *testing.T) {
+		st := newServiceTest(t)
+		admin := st.createUser("admin@example.com", true)
+		credentials, _ := st.registerUser()
+		user := st.findUser(credentials.Email)
+		st.emailer.clearEmails()
+
+		err := st.svc.ResendActivation(context.Background(), admin.ID, user.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var raw auth.EmailTokenRaw
+		st.emailer.assertLastEmail(t, "user-activation", credentials.Email, func(t *testing.T, data any) {
+			var ok bool
+			raw, ok = data.(auth.EmailTokenRaw)
+			if !ok {
+				t.Fatalf("unexpected data type: %T", data)
+			}
+		})
+
+		// The new token can be used to activate the user.
+		st.activateUser(raw)
+
+		if !st.authenticate(credentials) {
+			t.Fatalf("expected activated user to be able to login")
+		}
+
+		tokens, err := st.svc.EmailTokens(context.Background(), user.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(tokens) != 2 {
+			t.Fatalf("expected 2 tokens in the history, got %d", len(tokens))
+		}
+
+		st.assertAdminActions(t, user.ID, auth.AdminActionResendActivation)
+	})
+
+	t.Run("fail, user already active", func(t *testing.T) {
+		st := newServiceTest(t)
+		admin := st.createUser("admin@example.com", true)
+		user := st.createUser("jacob@example.com", true)
+
+		err := st.svc.ResendActivation(context.Background(), admin.ID, user.ID)
+		if !errors.Is(err, auth.ErrNotPendingActivation) {
+			t.Fatalf("expected error %v, got %v via errors.Is()", auth.ErrNotPendingActivation, err)
+		}
+	})
+}
+
+func Test_Service_ForcePasswordReset(t *testing.T) {
+	t.Run("ok, password only works after reset", func(t *testing.T) {
+		st := newServiceTest(t)
+		admin := st.createUser("admin@example.com", true)
+		credentials, raw := st.registerUser()
+		st.activateUser(raw)
+		user := st.findUser(credentials.Email)
+
+		// A reset token requested before the forced reset can't be used anymore.
+		oldRaw := st.requestPasswordReset(credentials.Email)
+
+		err := st.svc.ForcePasswordReset(context.Background(), admin.ID, user.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if st.authenticate(credentials) {
+			t.Fatalf("expected user to not be able to login with old password")
+		}
+
+		err = st.svc.ResetPassword(context.Background(), auth.NewPassword{
+			RawToken: oldRaw,
+			Password: credentials.Password,
+		})
+		if !errors.Is(err, errorz.ErrNotFound) {
+			t.Fatalf("expected error %v, got %v via errors.Is()", errorz.ErrNotFound, err)
+		}
+
+		var newRaw auth.EmailTokenRaw
+		st.emailer.assertLastEmail(t, "password-reset-request", credentials.Email, func(t *testing.T, data any) {
+			var ok bool
+			newRaw, ok = data.(auth.EmailTokenRaw)
+			if !ok {
+				t.Fatalf("unexpected data type: %T", data)
+			}
+		})
+
+		st.resetPassword(auth.NewPassword{
+			RawToken: newRaw,
+			Password: credentials.Password,
+		})
+
+		if !st.authenticate(credentials) {
+			t.Fatalf("expected user to be able to login after reset")
+		}
+
+		st.assertAdminActions(t, user.ID, auth.AdminActionForceReset)
+	})
+
+	t.Run("fail, inactive user", func(t *testing.T) {
+		st := newServiceTest(t)
+		admin := st.createUser("admin@example.com", true)
+		user := st.createUser("jacob@example.com", false)
+
+		err := st.svc.ForcePasswordReset(context.Background(), admin.ID, user.ID)
+		if !errors.Is(err, errorz.ErrNotFound) {
+			t.Fatalf("expected error %v, got %v via errors.Is()", errorz.ErrNotFound, err)
+		}
+	})
+}
+
+func Test_Service_ExpireTokens(t *testing.T) {
+	t.Run("ok, outstanding tokens are expired", func(t *testing.T) {
+		st := newServiceTest(t)
+		admin := st.createUser("admin@example.com", true)
+		credentials, raw := st.registerUser()
+		user := st.findUser(credentials.Email)
+
+		got, err := st.svc.ExpireTokens(context.Background(), admin.ID, user.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got != 1 {
+			t.Errorf("expected 1 expired token, got %d", got)
+		}
+
+		err = st.svc.ActivateUser(context.Background(), raw)
+		if !errors.Is(err, errorz.ErrNotFound) {
+			t.Fatalf("expected error %v, got %v via errors.Is()", errorz.ErrNotFound, err)
+		}
+
+		// Consumed tokens are not expired again.
+		got, err = st.svc.ExpireTokens(context.Background(), admin.ID, user.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got != 0 {
+			t.Errorf("expected 0 expired tokens, got %d", got)
+		}
+
+		st.assertAdminActions(t, user.ID, auth.AdminActionExpireTokens, auth.AdminActionExpireTokens)
+	})
+
+	t.Run("fail, unknown user", func(t *testing.T) {
+		st := newServiceTest(t)
+		admin := st.createUser("admin@example.com", true)
+
+		_, err := st.svc.ExpireTokens(context.Background(), admin.ID, uuid.New())
+		if !errors.Is(err, errorz.ErrNotFound) {
+			t.Fatalf("expected error %v, got %v via errors.Is()", errorz.ErrNotFound, err)
+		}
+	})
+}
+
+func Test_Service_ChangeRole(t *testing.T) {
+	t.Run("ok, make admin", func(t *testing.T) {
+		st := newServiceTest(t)
+		admin := st.createUser("admin@example.com", true)
+		user := st.createUser("jacob@example.com", true)
+
+		err := st.svc.ChangeRole(context.Background(), admin.ID, user.ID, auth.RoleAdmin)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got := st.findUser(user.Email)
+		if got.Role != auth.RoleAdmin {
+			t.Errorf("got role %q, want %q", got.Role, auth.RoleAdmin)
+		}
+
+		actions := st.assertAdminActions(t, user.ID, auth.AdminActionChangeRole)
+		if actions[0].ActorID != admin.ID || actions[0].Detail != string(auth.RoleAdmin) {
+			t.Errorf("unexpected admin action: %#v", actions[0])
+		}
+	})
+
+	t.Run("fail, invalid role", func(t *testing.T) {
+		st := newServiceTest(t)
+		admin := st.createUser("admin@example.com", true)
+		user := st.createUser("jacob@example.com", true)
+
+		err := st.svc.ChangeRole(context.Background(), admin.ID, user.ID, auth.Role("superuser"))
+		if !errors.Is(err, auth.ErrInvalidRole) {
+			t.Fatalf("expected error %v, got %v via errors.Is()", auth.ErrInvalidRole, err)
+		}
+	})
+
+	t.Run("fail, change own role", func(t *testing.T) {
+		st := newServiceTest(t)
+		admin := st.createUser("admin@example.com", true)
+
+		err := st.svc.ChangeRole(context.Background(), admin.ID, admin.ID, auth.RoleUser)
+		if !errors.Is(err, auth.ErrSelfModeration) {
+			t.Fatalf("expected error %v, got %v via errors.Is()", auth.ErrSelfModeration, err)
+		}
+	})
+}
+
+func Test_Service_BootstrapAdmins(t *testing.T) {
+	st := newServiceTest(t)
+	user := st.createUser("jacob@example.com", true)
+
+	// Unknown IDs are ignored and bootstrapping twice is a no-op.
+	for i := 0; i < 2; i++ {
+		err := st.svc.BootstrapAdmins(context.Background(), []uuid.UUID{user.ID, uuid.New()})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	got := st.findUser(user.Email)
+	if got.Role != auth.RoleAdmin {
+		t.Errorf("got role %q, want %q", got.Role, auth.RoleAdmin)
+	}
+
+	actions := st.assertAdminActions(t, user.ID, auth.AdminActionBootstrapAdmin)
+	if !actions[0].BySystem() {
+		t.Errorf("expected bootstrap action to be taken by the system, got %v", actions[0].ActorID)
+	}
+}
+
+// createUser creates a user with the provided email address via the public
+// service methods.
+func (st *svcTest) createUser(addr string, activate bool) auth.User {
+	st.t.Helper()
+
+	credentials := auth.Credentials{
+		Email:    must(email.ParseAddress(addr)),
+		Password: must(auth.ParsePassword("reallyStrongPassword1")),
+	}
+
+	err := st.svc.RegisterUser(context.Background(), credentials)
+	if err != nil {
+		st.t.Fatalf("failed to register user: %v", err)
+	}
+
+	st.svc.Wait()
+	st.errList.assertNoError(st.t)
+
+	if activate {
+		raw, ok := st.emailer.emails[len(st.emailer.emails)-1].data.(auth.EmailTokenRaw)
+		if !ok {
+			st.t.Fatalf("unexpected data type: %T", st.emailer.emails[len(st.emailer.emails)-1].data)
+		}
+
+		st.activateUser(raw)
+	}
+
+	return st.findUser(credentials.Email)
+}
+
+func (st *svcTest) findUser(addr email.Address) auth.User {
+	st.t.Helper()
+
+	users, err := st.svc.FindUsers(context.Background(), auth.UserFilter{
+		Emails: []email.Address{addr},
+	})
+	if err != nil {
+		st.t.Fatalf("failed to find user: %v", err)
+	}
+
+	if len(users) != 1 {
+		st.t.Fatalf("expected 1 user, got %d", len(users))
+	}
+
+	return users[0]
+}
+
+func (st *svcTest) activateUserByAdmin(actorID, userID uuid.UUID) {
+	st.t.Helper()
+
+	err := st.svc.ReactivateUser(context.Background(), actorID, userID)
+	if err != nil {
+		st.t.Fatalf("failed to activate user: %v", err)
+	}
+}
+
+// assertAdminActions asserts the admin actions targeting userID, most recent first.
+func (st *svcTest) assertAdminActions(t *testing.T, userID uuid.UUID, want ...auth.AdminActionType) []auth.AdminAction {
+	t.Helper()
+
+	actions, err := st.svc.AdminActions(context.Background(), auth.AdminActionFilter{
+		TargetUserIDs: []uuid.UUID{userID},
+	})
+	if err != nil {
+		t.Fatalf("failed to find admin actions: %v", err)
+	}
+
+	if len(actions) != len(want) {
+		t.Fatalf("expected %d admin actions, got %d: %#v", len(want), len(actions), actions)
+	}
+
+	for i := range want {
+		if actions[i].Action != want[i] {
+			t.Errorf("action %d: got %q, want %q", i, actions[i].Action, want[i])
+		}
+	}
+
+	return actions
+}
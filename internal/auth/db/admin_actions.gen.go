@@ -0,0 +1,108 @@
+// Code generated by querygen. DO NOT EDIT.
+
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/auth"
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/errorz"
+)
+
+func insertAdminAction(q db.Query, ef execFunc, v auth.AdminAction) error {
+	if db.IsZero(v.ID) {
+		return fmt.Errorf("zero id provided: %w", errorz.ErrConstraintViolated)
+	}
+
+	q.Unsafe(`INSERT INTO admin_actions (id, actor_id, action, target_user_id, detail_encrypted, created_at) VALUES (`)
+	q.Param(v.ID)
+	q.Unsafe(`, `)
+	q.Param(db.NullIfZero(v.ActorID))
+	q.Unsafe(`, `)
+	q.Param(v.Action)
+	q.Unsafe(`, `)
+	q.Param(db.NullIfZero(v.TargetUserID))
+	q.Unsafe(`, `)
+	if db.IsZero(v.Detail) {
+		q.Param(nil)
+	} else {
+		q.ParamEncrypted([]byte(v.Detail))
+	}
+	q.Unsafe(`, `)
+	q.Param(v.CreatedAt)
+	q.Unsafe(`)`)
+
+	s, params, err := q.Get()
+	if err != nil {
+		return err
+	}
+
+	_, err = ef(s, params...)
+	if err != nil {
+		return errorz.MapDBErr(err)
+	}
+
+	return nil
+}
+
+func selectAdminActions(q db.Query, qf queryFunc, f auth.AdminActionFilter) ([]auth.AdminAction, error) {
+	q.Unsafe(`SELECT id, actor_id, action, target_user_id, detail_encrypted, created_at FROM admin_actions WHERE 1=1 `)
+
+	if len(f.ActorIDs) > 0 {
+		q.Unsafe(`AND actor_id IN (`)
+		q.Params(db.AnySlice(f.ActorIDs)...)
+		q.Unsafe(`) `)
+	}
+
+	if len(f.TargetUserIDs) > 0 {
+		q.Unsafe(`AND target_user_id IN (`)
+		q.Params(db.AnySlice(f.TargetUserIDs)...)
+		q.Unsafe(`) `)
+	}
+
+	q.Unsafe(`ORDER BY created_at DESC, id ASC`)
+
+	if f.Limit > 0 {
+		q.Unsafe(` LIMIT `)
+		q.Param(f.Limit)
+	}
+
+	s, params, err := q.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := qf(s, params...)
+	if err != nil {
+		return nil, errorz.MapDBErr(err)
+	}
+
+	defer rows.Close()
+
+	out := make([]auth.AdminAction, 0)
+	for rows.Next() {
+		var v auth.AdminAction
+		var actorIDNull sql.Null[uuid.UUID]
+		var targetUserIDNull sql.Null[uuid.UUID]
+		detailData := q.DecryptionTarget()
+		err := rows.Scan(&v.ID, &actorIDNull, &v.Action, &targetUserIDNull, detailData, &v.CreatedAt)
+		if err != nil {
+			return nil, errorz.MapDBErr(err)
+		}
+
+		v.ActorID = actorIDNull.V
+		v.TargetUserID = targetUserIDNull.V
+		v.Detail = string(detailData.Data)
+
+		out = append(out, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errorz.MapDBErr(err)
+	}
+
+	return out, nil
+}
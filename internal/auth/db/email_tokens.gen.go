@@ -0,0 +1,156 @@
+// Code generated by querygen. DO NOT EDIT.
+
+package db
+
+import (
+	"fmt"
+
+	"github.com/willemschots/househunt/internal/auth"
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/errorz"
+)
+
+func insertEmailToken(q db.Query, ef execFunc, v auth.EmailToken) error {
+	if db.IsZero(v.ID) {
+		return fmt.Errorf("zero id provided: %w", errorz.ErrConstraintViolated)
+	}
+
+	q.Unsafe(`INSERT INTO email_tokens (id, token_hash, user_id, email_encrypted, purpose, created_at, consumed_at) VALUES (`)
+	q.Param(v.ID)
+	q.Unsafe(`, `)
+	q.Param(v.TokenHash.String())
+	q.Unsafe(`, `)
+	q.Param(v.UserID)
+	q.Unsafe(`, `)
+	q.ParamEncrypted([]byte(v.Email))
+	q.Unsafe(`, `)
+	q.Param(v.Purpose)
+	q.Unsafe(`, `)
+	q.Param(v.CreatedAt)
+	q.Unsafe(`, `)
+	q.Param(v.ConsumedAt)
+	q.Unsafe(`)`)
+
+	s, params, err := q.Get()
+	if err != nil {
+		return err
+	}
+
+	_, err = ef(s, params...)
+	if err != nil {
+		return errorz.MapDBErr(err)
+	}
+
+	return nil
+}
+
+func updateEmailToken(q db.Query, ef execFunc, v auth.EmailToken) error {
+	q.Unsafe(`UPDATE email_tokens SET `)
+
+	q.Unsafe(`token_hash = `)
+	q.Param(v.TokenHash.String())
+
+	q.Unsafe(`, user_id = `)
+	q.Param(v.UserID)
+
+	q.Unsafe(`, email_encrypted = `)
+	q.ParamEncrypted([]byte(v.Email))
+
+	q.Unsafe(`, purpose = `)
+	q.Param(v.Purpose)
+
+	q.Unsafe(`, created_at = `)
+	q.Param(v.CreatedAt)
+
+	q.Unsafe(`, consumed_at = `)
+	q.Param(v.ConsumedAt)
+
+	q.Unsafe(` WHERE id = `)
+	q.Param(v.ID)
+
+	s, params, err := q.Get()
+	if err != nil {
+		return err
+	}
+
+	result, err := ef(s, params...)
+	if err != nil {
+		return errorz.MapDBErr(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return errorz.MapDBErr(err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("email token not found: %w", errorz.ErrNotFound)
+	}
+
+	return nil
+}
+
+func selectEmailTokens(q db.Query, qf queryFunc, f auth.EmailTokenFilter) ([]auth.EmailToken, error) {
+	q.Unsafe(`SELECT id, token_hash, user_id, email_encrypted, purpose, created_at, consumed_at FROM email_tokens WHERE 1=1 `)
+
+	if len(f.IDs) > 0 {
+		q.Unsafe(`AND id IN (`)
+		q.Params(db.AnySlice(f.IDs)...)
+		q.Unsafe(`) `)
+	}
+
+	if len(f.UserIDs) > 0 {
+		q.Unsafe(`AND user_id IN (`)
+		q.Params(db.AnySlice(f.UserIDs)...)
+		q.Unsafe(`) `)
+	}
+
+	if len(f.Purposes) > 0 {
+		q.Unsafe(`AND purpose IN (`)
+		q.Params(db.AnySlice(f.Purposes)...)
+		q.Unsafe(`) `)
+	}
+
+	if f.IsConsumed != nil {
+		q.Unsafe(`AND consumed_at IS `)
+		if *f.IsConsumed {
+			q.Unsafe(`NOT `)
+		}
+		q.Unsafe(`NULL `)
+	}
+
+	q.Unsafe(`ORDER BY created_at ASC, id ASC`)
+
+	s, params, err := q.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := qf(s, params...)
+	if err != nil {
+		return nil, errorz.MapDBErr(err)
+	}
+
+	defer rows.Close()
+
+	out := make([]auth.EmailToken, 0)
+	for rows.Next() {
+		var v auth.EmailToken
+		emailData := q.DecryptionTarget()
+		err := rows.Scan(&v.ID, &v.TokenHash, &v.UserID, emailData, &v.Purpose, &v.CreatedAt, &v.ConsumedAt)
+		if err != nil {
+			return nil, errorz.MapDBErr(err)
+		}
+
+		v.Email = email.Address(emailData.Data)
+
+		out = append(out, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errorz.MapDBErr(err)
+	}
+
+	return out, nil
+}
@@ -17,15 +17,17 @@ type NowFunc func() time.Time
 type Store struct {
 	writeDB       *sql.DB
 	readDB        *sql.DB
+	dialect       db.Dialect
 	encryptor     *krypto.Encryptor
 	blindIndexKey krypto.Key
 }
 
-// New creates a new Store.
+// New creates a new Store. The dialect is based on the driver of writeDB.
 func New(writeDB, readDB *sql.DB, encryptor *krypto.Encryptor, blindIndexKey krypto.Key) *Store {
 	return &Store{
 		writeDB:       writeDB,
 		readDB:        readDB,
+		dialect:       db.DialectOf(writeDB),
 		encryptor:     encryptor,
 		blindIndexKey: blindIndexKey,
 	}
@@ -35,6 +37,7 @@ func (s *Store) newQuery() db.Query {
 	return db.Query{
 		Encryptor:     s.encryptor,
 		BlindIndexKey: s.blindIndexKey,
+		Dialect:       s.dialect,
 	}
 }
 
@@ -44,14 +47,28 @@ func (s *Store) BeginTx(ctx context.Context) (auth.Tx, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	var e db.Execer = tx
+	if s.dialect == db.Postgres {
+		e = savepointExecer{tx: tx}
+	}
+
 	return &Tx{
+		ctx:   ctx,
 		tx:    tx,
+		exec:  e,
 		store: s,
 	}, nil
 }
 
 func (s *Store) FindUsers(ctx context.Context, filter auth.UserFilter) ([]auth.User, error) {
-	return selectUsers(s.newQuery(), func(query string, params ...any) (*sql.Rows, error) {
-		return s.readDB.QueryContext(ctx, query, params...)
-	}, filter)
+	return selectUsers(s.newQuery(), db.TracedQuery(ctx, s.readDB), filter)
+}
+
+func (s *Store) FindEmailTokens(ctx context.Context, filter auth.EmailTokenFilter) ([]auth.EmailToken, error) {
+	return selectEmailTokens(s.newQuery(), db.TracedQuery(ctx, s.readDB), filter)
+}
+
+func (s *Store) FindAdminActions(ctx context.Context, filter auth.AdminActionFilter) ([]auth.AdminAction, error) {
+	return selectAdminActions(s.newQuery(), db.TracedQuery(ctx, s.readDB), filter)
 }
@@ -1,13 +1,21 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 
 	"github.com/willemschots/househunt/internal/auth"
+	"github.com/willemschots/househunt/internal/db"
 )
 
 type Tx struct {
-	tx    *sql.Tx
+	// ctx is the context the transaction was started with, the
+	// transaction is bound to it, so statements use it as well.
+	ctx context.Context
+	tx  *sql.Tx
+	// exec executes the statements that modify data.
+	exec  db.Execer
 	store *Store
 }
 
@@ -22,26 +30,26 @@ func (t *Tx) Rollback() error {
 // CreateUser creates a user in the database.
 // It updates the users ID, CreatedAt and UpdatedAt fields when successful.
 func (t *Tx) CreateUser(u auth.User) error {
-	return insertUser(t.store.newQuery(), t.tx.Exec, u)
+	return insertUser(t.store.newQuery(), db.TracedExec(t.ctx, t.exec), u)
 }
 
 // UpdateUser updates a user in the database.
 // It updates the users UpdatedAt field when successful.
 // It returns errorz.ErrNotFound if no user is found.
 func (t *Tx) UpdateUser(u auth.User) error {
-	return updateUser(t.store.newQuery(), t.tx.Exec, u)
+	return updateUser(t.store.newQuery(), db.TracedExec(t.ctx, t.exec), u)
 }
 
 // FindUsers queries for users based on the provided filter.
 // It returns an empty slice if no users are found.
 func (t *Tx) FindUsers(filter auth.UserFilter) ([]auth.User, error) {
-	return selectUsers(t.store.newQuery(), t.tx.Query, filter)
+	return selectUsers(t.store.newQuery(), db.TracedQuery(t.ctx, t.tx), filter)
 }
 
 // CreateEmailToken creates an email token in the database.
 // It updates the token ID and CreatedAt when successful.
 func (t *Tx) CreateEmailToken(tok auth.EmailToken) error {
-	return insertEmailToken(t.store.newQuery(), t.tx.Exec, tok)
+	return insertEmailToken(t.store.newQuery(), db.TracedExec(t.ctx, t.exec), tok)
 }
 
 // UpdateEmailToken updates an email token in the database.
@@ -49,10 +57,42 @@ func (t *Tx) CreateEmailToken(tok auth.EmailToken) error {
 // It only allows updating the ConsumedAt field, attempting to
 // update any other field will return errorz.ErrConstraintViolated.
 func (t *Tx) UpdateEmailToken(tok auth.EmailToken) error {
-	return updateEmailToken(t.store.newQuery(), t.tx.Exec, tok)
+	return updateEmailToken(t.store.newQuery(), db.TracedExec(t.ctx, t.exec), tok)
 }
 
 // FindEmailTokens queries for email tokens based on the provided filter.
 func (t *Tx) FindEmailTokens(filter auth.EmailTokenFilter) ([]auth.EmailToken, error) {
-	return selectEmailTokens(t.store.newQuery(), t.tx.Query, filter)
+	return selectEmailTokens(t.store.newQuery(), db.TracedQuery(t.ctx, t.tx), filter)
+}
+
+// CreateAdminAction adds an action to the admin audit log.
+func (t *Tx) CreateAdminAction(a auth.AdminAction) error {
+	return insertAdminAction(t.store.newQuery(), db.TracedExec(t.ctx, t.exec), a)
+}
+
+// savepointExecer executes every statement in its own savepoint. Postgres aborts the
+// whole transaction when a statement fails, while SQLite only fails the statement. The
+// savepoint is rolled back on failure, so the transaction behaves the same in both.
+type savepointExecer struct {
+	tx *sql.Tx
+}
+
+func (e savepointExecer) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	_, err := e.tx.ExecContext(ctx, "SAVEPOINT stmt")
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := e.tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		_, rErr := e.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT stmt")
+		return nil, errors.Join(err, rErr)
+	}
+
+	_, err = e.tx.ExecContext(ctx, "RELEASE SAVEPOINT stmt")
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
 }
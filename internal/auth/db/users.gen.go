@@ -0,0 +1,163 @@
+// Code generated by querygen. DO NOT EDIT.
+
+package db
+
+import (
+	"fmt"
+
+	"github.com/willemschots/househunt/internal/auth"
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/errorz"
+)
+
+func insertUser(q db.Query, ef execFunc, v auth.User) error {
+	if db.IsZero(v.ID) {
+		return fmt.Errorf("zero id provided: %w", errorz.ErrConstraintViolated)
+	}
+
+	q.Unsafe(`INSERT INTO users (id, email_encrypted, email_blind_index, password_hash, is_active, role, deactivated_at, created_at, updated_at) VALUES (`)
+	q.Param(v.ID)
+	q.Unsafe(`, `)
+	q.ParamEncrypted([]byte(v.Email))
+	q.Unsafe(`, `)
+	q.ParamBlindIndex([]byte(v.Email))
+	q.Unsafe(`, `)
+	q.Param(v.PasswordHash.String())
+	q.Unsafe(`, `)
+	q.Param(v.IsActive)
+	q.Unsafe(`, `)
+	q.Param(v.Role)
+	q.Unsafe(`, `)
+	q.Param(v.DeactivatedAt)
+	q.Unsafe(`, `)
+	q.Param(v.CreatedAt)
+	q.Unsafe(`, `)
+	q.Param(v.UpdatedAt)
+	q.Unsafe(`)`)
+
+	s, params, err := q.Get()
+	if err != nil {
+		return err
+	}
+
+	_, err = ef(s, params...)
+	if err != nil {
+		return errorz.MapDBErr(err)
+	}
+
+	return nil
+}
+
+func updateUser(q db.Query, ef execFunc, v auth.User) error {
+	q.Unsafe(`UPDATE users SET `)
+
+	q.Unsafe(`email_encrypted = `)
+	q.ParamEncrypted([]byte(v.Email))
+
+	q.Unsafe(`, email_blind_index = `)
+	q.ParamBlindIndex([]byte(v.Email))
+
+	q.Unsafe(`, password_hash = `)
+	q.Param(v.PasswordHash.String())
+
+	q.Unsafe(`, is_active = `)
+	q.Param(v.IsActive)
+
+	q.Unsafe(`, role = `)
+	q.Param(v.Role)
+
+	q.Unsafe(`, deactivated_at = `)
+	q.Param(v.DeactivatedAt)
+
+	q.Unsafe(`, created_at = `)
+	q.Param(v.CreatedAt)
+
+	q.Unsafe(`, updated_at = `)
+	q.Param(v.UpdatedAt)
+
+	q.Unsafe(` WHERE id = `)
+	q.Param(v.ID)
+
+	s, params, err := q.Get()
+	if err != nil {
+		return err
+	}
+
+	result, err := ef(s, params...)
+	if err != nil {
+		return errorz.MapDBErr(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return errorz.MapDBErr(err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("user not found: %w", errorz.ErrNotFound)
+	}
+
+	return nil
+}
+
+func selectUsers(q db.Query, qf queryFunc, f auth.UserFilter) ([]auth.User, error) {
+	q.Unsafe(`SELECT id, email_encrypted, password_hash, is_active, role, deactivated_at, created_at, updated_at FROM users WHERE 1=1 `)
+
+	if len(f.IDs) > 0 {
+		q.Unsafe(`AND id IN (`)
+		q.Params(db.AnySlice(f.IDs)...)
+		q.Unsafe(`) `)
+	}
+
+	if len(f.Emails) > 0 {
+		q.Unsafe(`AND email_blind_index IN (`)
+		for i, v := range f.Emails {
+			if i > 0 {
+				q.Unsafe(`, `)
+			}
+			q.ParamBlindIndex([]byte(v))
+		}
+		q.Unsafe(`) `)
+	}
+
+	if f.IsActive != nil {
+		q.Unsafe(`AND is_active = `)
+		q.Param(*f.IsActive)
+		q.Unsafe(` `)
+	}
+
+	q.Unsafe(`ORDER BY id ASC`)
+
+	s, params, err := q.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := qf(s, params...)
+	if err != nil {
+		return nil, errorz.MapDBErr(err)
+	}
+
+	defer rows.Close()
+
+	out := make([]auth.User, 0)
+	for rows.Next() {
+		var v auth.User
+		emailData := q.DecryptionTarget()
+		err := rows.Scan(&v.ID, emailData, &v.PasswordHash, &v.IsActive, &v.Role, &v.DeactivatedAt, &v.CreatedAt, &v.UpdatedAt)
+		if err != nil {
+			return nil, errorz.MapDBErr(err)
+		}
+
+		v.Email = email.Address(emailData.Data)
+
+		out = append(out, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errorz.MapDBErr(err)
+	}
+
+	return out, nil
+}
@@ -11,15 +11,15 @@ import (
 // EmailToken contains the state of a token that was sent via email.
 // Such tokens should be only used once and have a limited lifetime.
 type EmailToken struct {
-	ID uuid.UUID
+	ID uuid.UUID `db:"id,pk"`
 	// TokenHash is the hash of the token. We hash the token to prevent someone with
 	// access to the database from mis-using the tokens.
-	TokenHash  krypto.Argon2Hash
-	UserID     uuid.UUID
-	Email      email.Address
-	Purpose    TokenPurpose
-	CreatedAt  time.Time
-	ConsumedAt *time.Time
+	TokenHash  krypto.Argon2Hash `db:"token_hash,stringer"`
+	UserID     uuid.UUID         `db:"user_id"`
+	Email      email.Address     `db:"email_encrypted,encrypted"`
+	Purpose    TokenPurpose      `db:"purpose"`
+	CreatedAt  time.Time         `db:"created_at"`
+	ConsumedAt *time.Time        `db:"consumed_at"`
 }
 
 // TokenPurpose is the purpose of an email token.
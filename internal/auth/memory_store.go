@@ -0,0 +1,374 @@
+package auth
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/errorz"
+)
+
+var errTxDone = errors.New("transaction has already been committed or rolled back")
+
+// MemoryStore is a Store that keeps its data in memory. It behaves like the
+// database store, see the storetest package, so it can be used in tests.
+//
+// Like the SQLite store, transactions are serialized: BeginTx blocks until
+// the previous transaction has been committed or rolled back.
+type MemoryStore struct {
+	// txMu is locked for as long as a transaction is in progress.
+	txMu *sync.Mutex
+	mu   *sync.Mutex
+	data memoryData
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		txMu: &sync.Mutex{},
+		mu:   &sync.Mutex{},
+	}
+}
+
+func (s *MemoryStore) BeginTx(ctx context.Context) (Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.txMu.Lock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &memoryTx{
+		store: s,
+		data:  s.data.clone(),
+	}, nil
+}
+
+func (s *MemoryStore) FindUsers(_ context.Context, filter UserFilter) ([]User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data.findUsers(filter), nil
+}
+
+func (s *MemoryStore) FindEmailTokens(_ context.Context, filter EmailTokenFilter) ([]EmailToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data.findEmailTokens(filter), nil
+}
+
+func (s *MemoryStore) FindAdminActions(_ context.Context, filter AdminActionFilter) ([]AdminAction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data.findAdminActions(filter), nil
+}
+
+// memoryTx works on a copy of the data of the store, which
+// replaces the data of the store when it's committed.
+type memoryTx struct {
+	store *MemoryStore
+	data  memoryData
+	done  bool
+}
+
+func (t *memoryTx) Commit() error {
+	if t.done {
+		return errTxDone
+	}
+
+	t.store.mu.Lock()
+	t.store.data = t.data
+	t.store.mu.Unlock()
+
+	t.finish()
+	return nil
+}
+
+func (t *memoryTx) Rollback() error {
+	if t.done {
+		return errTxDone
+	}
+
+	t.finish()
+	return nil
+}
+
+func (t *memoryTx) finish() {
+	t.done = true
+	t.data = memoryData{}
+	t.store.txMu.Unlock()
+}
+
+func (t *memoryTx) CreateUser(u User) error {
+	if t.done {
+		return errTxDone
+	}
+
+	return t.data.createUser(u)
+}
+
+func (t *memoryTx) UpdateUser(u User) error {
+	if t.done {
+		return errTxDone
+	}
+
+	return t.data.updateUser(u)
+}
+
+func (t *memoryTx) FindUsers(filter UserFilter) ([]User, error) {
+	if t.done {
+		return nil, errTxDone
+	}
+
+	return t.data.findUsers(filter), nil
+}
+
+func (t *memoryTx) CreateEmailToken(tok EmailToken) error {
+	if t.done {
+		return errTxDone
+	}
+
+	return t.data.createEmailToken(tok)
+}
+
+func (t *memoryTx) UpdateEmailToken(tok EmailToken) error {
+	if t.done {
+		return errTxDone
+	}
+
+	return t.data.updateEmailToken(tok)
+}
+
+func (t *memoryTx) FindEmailTokens(filter EmailTokenFilter) ([]EmailToken, error) {
+	if t.done {
+		return nil, errTxDone
+	}
+
+	return t.data.findEmailTokens(filter), nil
+}
+
+func (t *memoryTx) CreateAdminAction(a AdminAction) error {
+	if t.done {
+		return errTxDone
+	}
+
+	return t.data.createAdminAction(a)
+}
+
+// memoryData contains the data of a MemoryStore. It enforces the same
+// constraints as the database schema.
+type memoryData struct {
+	users   []User
+	tokens  []EmailToken
+	actions []AdminAction
+}
+
+// clone returns a copy of d. The elements themselves are not copied,
+// they are never modified in place.
+func (d memoryData) clone() memoryData {
+	return memoryData{
+		users:   slices.Clone(d.users),
+		tokens:  slices.Clone(d.tokens),
+		actions: slices.Clone(d.actions),
+	}
+}
+
+func (d *memoryData) userExists(id uuid.UUID) bool {
+	return slices.ContainsFunc(d.users, func(u User) bool {
+		return u.ID == id
+	})
+}
+
+func (d *memoryData) createUser(u User) error {
+	if u.ID == uuid.Nil || d.userExists(u.ID) {
+		return fmt.Errorf("invalid user id %s: %w", u.ID, errorz.ErrConstraintViolated)
+	}
+
+	if d.emailTaken(u) {
+		return fmt.Errorf("email already in use: %w", errorz.ErrConstraintViolated)
+	}
+
+	d.users = append(d.users, copyUser(u))
+	return nil
+}
+
+func (d *memoryData) updateUser(u User) error {
+	i := slices.IndexFunc(d.users, func(existing User) bool {
+		return existing.ID == u.ID
+	})
+	if i == -1 {
+		return fmt.Errorf("user not found: %w", errorz.ErrNotFound)
+	}
+
+	if d.emailTaken(u) {
+		return fmt.Errorf("email already in use: %w", errorz.ErrConstraintViolated)
+	}
+
+	d.users[i] = copyUser(u)
+	return nil
+}
+
+// emailTaken reports whether another user than u uses the email of u.
+func (d *memoryData) emailTaken(u User) bool {
+	return slices.ContainsFunc(d.users, func(existing User) bool {
+		return existing.ID != u.ID && existing.Email == u.Email
+	})
+}
+
+func (d *memoryData) findUsers(filter UserFilter) []User {
+	out := make([]User, 0)
+	for _, u := range d.users {
+		if len(filter.IDs) > 0 && !slices.Contains(filter.IDs, u.ID) {
+			continue
+		}
+		if len(filter.Emails) > 0 && !slices.Contains(filter.Emails, u.Email) {
+			continue
+		}
+		if filter.IsActive != nil && *filter.IsActive != u.IsActive {
+			continue
+		}
+		out = append(out, copyUser(u))
+	}
+
+	slices.SortFunc(out, func(a, b User) int {
+		return compareIDs(a.ID, b.ID)
+	})
+
+	return out
+}
+
+func (d *memoryData) createEmailToken(tok EmailToken) error {
+	exists := slices.ContainsFunc(d.tokens, func(existing EmailToken) bool {
+		return existing.ID == tok.ID
+	})
+	if tok.ID == uuid.Nil || exists {
+		return fmt.Errorf("invalid email token id %s: %w", tok.ID, errorz.ErrConstraintViolated)
+	}
+
+	if !d.userExists(tok.UserID) {
+		return fmt.Errorf("user %s does not exist: %w", tok.UserID, errorz.ErrConstraintViolated)
+	}
+
+	d.tokens = append(d.tokens, copyEmailToken(tok))
+	return nil
+}
+
+func (d *memoryData) updateEmailToken(tok EmailToken) error {
+	i := slices.IndexFunc(d.tokens, func(existing EmailToken) bool {
+		return existing.ID == tok.ID
+	})
+	if i == -1 {
+		return fmt.Errorf("email token not found: %w", errorz.ErrNotFound)
+	}
+
+	if !d.userExists(tok.UserID) {
+		return fmt.Errorf("user %s does not exist: %w", tok.UserID, errorz.ErrConstraintViolated)
+	}
+
+	d.tokens[i] = copyEmailToken(tok)
+	return nil
+}
+
+func (d *memoryData) findEmailTokens(filter EmailTokenFilter) []EmailToken {
+	out := make([]EmailToken, 0)
+	for _, tok := range d.tokens {
+		if len(filter.IDs) > 0 && !slices.Contains(filter.IDs, tok.ID) {
+			continue
+		}
+		if len(filter.UserIDs) > 0 && !slices.Contains(filter.UserIDs, tok.UserID) {
+			continue
+		}
+		if len(filter.Purposes) > 0 && !slices.Contains(filter.Purposes, tok.Purpose) {
+			continue
+		}
+		if filter.IsConsumed != nil && *filter.IsConsumed != (tok.ConsumedAt != nil) {
+			continue
+		}
+		out = append(out, copyEmailToken(tok))
+	}
+
+	slices.SortFunc(out, func(a, b EmailToken) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), compareIDs(a.ID, b.ID))
+	})
+
+	return out
+}
+
+func (d *memoryData) createAdminAction(a AdminAction) error {
+	exists := slices.ContainsFunc(d.actions, func(existing AdminAction) bool {
+		return existing.ID == a.ID
+	})
+	if a.ID == uuid.Nil || exists {
+		return fmt.Errorf("invalid admin action id %s: %w", a.ID, errorz.ErrConstraintViolated)
+	}
+
+	if a.ActorID != uuid.Nil && !d.userExists(a.ActorID) {
+		return fmt.Errorf("actor %s does not exist: %w", a.ActorID, errorz.ErrConstraintViolated)
+	}
+
+	if a.TargetUserID != uuid.Nil && !d.userExists(a.TargetUserID) {
+		return fmt.Errorf("target user %s does not exist: %w", a.TargetUserID, errorz.ErrConstraintViolated)
+	}
+
+	d.actions = append(d.actions, a)
+	return nil
+}
+
+func (d *memoryData) findAdminActions(filter AdminActionFilter) []AdminAction {
+	out := make([]AdminAction, 0)
+	for _, a := range d.actions {
+		// uuid.Nil is stored as NULL, which never matches.
+		if len(filter.ActorIDs) > 0 && (a.BySystem() || !slices.Contains(filter.ActorIDs, a.ActorID)) {
+			continue
+		}
+		if len(filter.TargetUserIDs) > 0 && (!a.HasTarget() || !slices.Contains(filter.TargetUserIDs, a.TargetUserID)) {
+			continue
+		}
+		out = append(out, a)
+	}
+
+	// Most recent first.
+	slices.SortFunc(out, func(a, b AdminAction) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), compareIDs(a.ID, b.ID))
+	})
+
+	if filter.Limit > 0 && len(out) > filter.Limit {
+		out = out[:filter.Limit]
+	}
+
+	return out
+}
+
+func compareIDs(a, b uuid.UUID) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+// copyUser returns a copy of u that doesn't share memory with u.
+func copyUser(u User) User {
+	u.DeactivatedAt = copyTime(u.DeactivatedAt)
+	return u
+}
+
+// copyEmailToken returns a copy of tok that doesn't share memory with tok.
+func copyEmailToken(tok EmailToken) EmailToken {
+	tok.ConsumedAt = copyTime(tok.ConsumedAt)
+	return tok
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := *t
+	return &v
+}
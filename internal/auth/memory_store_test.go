@@ -0,0 +1,14 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/willemschots/househunt/internal/auth"
+	"github.com/willemschots/househunt/internal/auth/storetest"
+)
+
+func Test_MemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) auth.Store {
+		return auth.NewMemoryStore()
+	})
+}
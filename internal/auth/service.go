@@ -3,18 +3,24 @@ package auth
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/audit"
 	"github.com/willemschots/househunt/internal/email"
 	"github.com/willemschots/househunt/internal/errorz"
 	"github.com/willemschots/househunt/internal/krypto"
+	"github.com/willemschots/househunt/internal/tracing"
 )
 
 var (
 	ErrDuplicateUser      = errors.New("duplicate user")
+	ErrDeactivatedUser    = errors.New("deactivated user")
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrShuttingDown       = errors.New("service is shutting down")
 )
 
 // Emailer is used to send templated emails.
@@ -22,12 +28,35 @@ type Emailer interface {
 	Send(ctx context.Context, template string, to email.Address, data interface{}) error
 }
 
-// ErrFunc is a function that handles errors.
-type ErrFunc func(error)
+// Names of the email templates sent by the service.
+const (
+	TemplateUserActivation       = "user-activation"
+	TemplatePasswordResetRequest = "password-reset-request"
+	TemplatePasswordResetSuccess = "password-reset-success"
+)
+
+// EmailTemplates returns the names of the email templates sent by the service,
+// mapped to sample data of the kind they're rendered with.
+func EmailTemplates() map[string]any {
+	return map[string]any{
+		TemplateUserActivation:       EmailTokenRaw{ID: uuid.New()},
+		TemplatePasswordResetRequest: EmailTokenRaw{ID: uuid.New()},
+		TemplatePasswordResetSuccess: nil,
+	}
+}
+
+// Auditor records security events.
+type Auditor interface {
+	Record(ctx context.Context, userID uuid.UUID, typ audit.EventType, detail string) error
+}
+
+// ErrFunc is a function that handles errors. ctx is the context of the call that
+// caused the error, it carries the values of the original request (like the request ID).
+type ErrFunc func(ctx context.Context, err error)
 
 // ServiceConfig is the configuration for the Service. Some methods run in seperate goroutines,
 // it is up to the caller to wait for these methods to finish. This can be done by calling the
-// Wait method.
+// Wait or Shutdown method.
 type ServiceConfig struct {
 	// WorkerTimeout is the max duration worker goroutines are allowed
 	// to take befor they are cancelled.
@@ -41,7 +70,11 @@ type ServiceConfig struct {
 type Service struct {
 	store      Store
 	emailer    Emailer
+	auditor    Auditor
 	wg         *sync.WaitGroup
+	workers    *atomic.Int64
+	mu         *sync.Mutex
+	closed     bool
 	errHandler ErrFunc
 	cfg        ServiceConfig
 
@@ -54,7 +87,7 @@ type Service struct {
 }
 
 // NewService creates a new Service.
-func NewService(s Store, emailer Emailer, errHandler ErrFunc, cfg ServiceConfig) (*Service, error) {
+func NewService(s Store, emailer Emailer, auditor Auditor, errHandler ErrFunc, cfg ServiceConfig) (*Service, error) {
 	tok, err := krypto.GenerateToken()
 	if err != nil {
 		return nil, err
@@ -68,7 +101,10 @@ func NewService(s Store, emailer Emailer, errHandler ErrFunc, cfg ServiceConfig)
 	svc := &Service{
 		store:          s,
 		emailer:        emailer,
+		auditor:        auditor,
 		wg:             &sync.WaitGroup{},
+		workers:        &atomic.Int64{},
+		mu:             &sync.Mutex{},
 		errHandler:     errHandler,
 		cfg:            cfg,
 		comparisonHash: hash,
@@ -83,11 +119,87 @@ func (s *Service) Wait() {
 	s.wg.Wait()
 }
 
+// Shutdown stops the service from starting new workers and waits for the open
+// workers to finish. If ctx is done before that, an error is returned that
+// reports how many workers are still running. Work that is offered after
+// Shutdown was called is refused with ErrShuttingDown.
+func (s *Service) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d workers did not finish: %w", s.workers.Load(), ctx.Err())
+	}
+}
+
+// Workers returns the number of worker goroutines that are currently running.
+func (s *Service) Workers() int64 {
+	return s.workers.Load()
+}
+
+// startWorker runs f in a separate goroutine, errors are passed to the error handler.
+//
+// The context for the worker is derived from the context of the call that
+// started it. Values (like the locale of the user) are kept, but cancellation
+// is not: workers should not stop once a response has been sent. The work is
+// traced in a span called name, a child of the span of the starting call.
+//
+// Once the service is shutting down no workers are started, ErrShuttingDown is
+// passed to the error handler instead.
+func (s *Service) startWorker(ctx context.Context, name string, f func(ctx context.Context) error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		s.errHandler(ctx, fmt.Errorf("failed to start %s: %w", name, ErrShuttingDown))
+		return
+	}
+	s.wg.Add(1)
+	s.workers.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		defer s.workers.Add(-1)
+
+		wCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.cfg.WorkerTimeout)
+		defer cancel()
+
+		wCtx, span := tracing.Start(wCtx, "auth.Service."+name)
+		err := f(wCtx)
+		span.EndErr(err)
+		if err != nil {
+			s.errHandler(wCtx, err)
+		}
+	}()
+}
+
+// audit records a security event. Failing to record an event should not
+// fail the action that caused it, so errors are passed to the error handler.
+func (s *Service) audit(ctx context.Context, userID uuid.UUID, typ audit.EventType, detail string) {
+	err := s.auditor.Record(ctx, userID, typ, detail)
+	if err != nil {
+		s.errHandler(ctx, err)
+	}
+}
+
 // RegisterUser registers a new user with the provided credentials.
 // The main work of this method is done in a separate goroutine. The returned
 // error does not indicate whether a user was actually registered or not. This
 // is by design to prevent information leakage.
-func (s *Service) RegisterUser(_ context.Context, c Credentials) error {
+func (s *Service) RegisterUser(ctx context.Context, c Credentials) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.Service.RegisterUser")
+	defer func() { span.EndErr(err) }()
+
 	// Hash the password.
 	pwdHash, err := c.Password.Hash()
 	if err != nil {
@@ -98,19 +210,9 @@ func (s *Service) RegisterUser(_ context.Context, c Credentials) error {
 	// - Waiting for the email to be send might slow down sending a response.
 	// - Information leakage. Timing difference between existing/non-existing
 	//   user could lead to user enumeration attacks.
-	s.wg.Add(1)
-	go func() {
-		defer s.wg.Done()
-
-		wCtx, cancel := context.WithTimeout(context.Background(), s.cfg.WorkerTimeout)
-		defer cancel()
-
-		err := s.startActivation(wCtx, c.Email, pwdHash)
-		if err != nil {
-			s.errHandler(err)
-			return
-		}
-	}()
+	s.startWorker(ctx, "startActivation", func(ctx context.Context) error {
+		return s.startActivation(ctx, c.Email, pwdHash)
+	})
 
 	// Note that we don't let the caller know if the user was created or not.
 	// This is by design, again to prevent information leakage.
@@ -126,31 +228,12 @@ func (s *Service) RegisterUser(_ context.Context, c Credentials) error {
 func (s *Service) startActivation(ctx context.Context, addr email.Address, pwdHash krypto.Argon2Hash) error {
 	now := s.NowFunc()
 
-	token, err := krypto.GenerateToken()
-	if err != nil {
-		return err
-	}
-
-	tokenHash, err := krypto.HashArgon2(token[:])
-	if err != nil {
-		return err
-	}
-
-	tokenID, err := uuid.NewRandom()
+	// The user ID is set after inserting the user.
+	emailToken, token, err := newEmailToken(uuid.Nil, addr, TokenPurposeActivate, now)
 	if err != nil {
 		return err
 	}
 
-	emailToken := EmailToken{
-		ID:         tokenID,
-		TokenHash:  tokenHash,
-		UserID:     uuid.Nil, // set after inserting the user.
-		Email:      addr,
-		Purpose:    TokenPurposeActivate,
-		CreatedAt:  now,
-		ConsumedAt: nil,
-	}
-
 	err = s.inTx(ctx, func(tx Tx) error {
 		// TODO: Limit nr of tokens per user.
 
@@ -173,6 +256,7 @@ func (s *Service) startActivation(ctx context.Context, addr email.Address, pwdHa
 				Email:        addr,
 				PasswordHash: pwdHash,
 				IsActive:     false,
+				Role:         RoleUser,
 				CreatedAt:    now,
 				UpdatedAt:    now,
 			}
@@ -188,6 +272,11 @@ func (s *Service) startActivation(ctx context.Context, addr email.Address, pwdHa
 				return ErrDuplicateUser
 			}
 
+			// Users deactivated by an admin should not be able to activate themselves again.
+			if users[0].DeactivatedAt != nil {
+				return ErrDeactivatedUser
+			}
+
 			// Re-use the existing user for this email token.
 			emailToken.UserID = users[0].ID
 		}
@@ -205,12 +294,14 @@ func (s *Service) startActivation(ctx context.Context, addr email.Address, pwdHa
 		return err
 	}
 
+	s.audit(ctx, emailToken.UserID, audit.EventRegistration, "")
+
 	// Send the email.
 	// This could fail independently of the transaction. This is an acceptable
 	// risk for now. If the user has not received the email, they can always try to register again.
 	//
 	// If at some point this becomes unacceptable, we need to consider some kind of outbox pattern.
-	err = s.emailer.Send(ctx, "user-activation", addr, EmailTokenRaw{
+	err = s.emailer.Send(ctx, TemplateUserActivation, addr, EmailTokenRaw{
 		ID:    emailToken.ID,
 		Token: token,
 	})
@@ -222,10 +313,15 @@ func (s *Service) startActivation(ctx context.Context, addr email.Address, pwdHa
 }
 
 // ActivateUser attempts to activate the user for the provided token.
-func (s *Service) ActivateUser(ctx context.Context, req EmailTokenRaw) error {
+func (s *Service) ActivateUser(ctx context.Context, req EmailTokenRaw) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.Service.ActivateUser")
+	defer func() { span.EndErr(err) }()
+
 	now := s.NowFunc()
 
-	return s.inTx(ctx, func(tx Tx) error {
+	var userID uuid.UUID
+
+	err = s.inTx(ctx, func(tx Tx) error {
 		// Find an unconsumed activation token with the provided ID.
 		token, err := findConsumableEmailToken(tx, req, TokenPurposeActivate, now, s.cfg.TokenExpiry)
 		if err != nil {
@@ -241,6 +337,10 @@ func (s *Service) ActivateUser(ctx context.Context, req EmailTokenRaw) error {
 			return err
 		}
 
+		if user.DeactivatedAt != nil {
+			return errorz.ErrNotFound
+		}
+
 		user.IsActive = true
 		user.UpdatedAt = now
 
@@ -249,13 +349,26 @@ func (s *Service) ActivateUser(ctx context.Context, req EmailTokenRaw) error {
 			return err
 		}
 
+		userID = user.ID
+
 		// Consume all unconsumed activation tokens for this user.
 		return consumeAllTokensForUserID(tx, token.UserID, TokenPurposeActivate, now)
 	})
+	if err != nil {
+		return err
+	}
+
+	s.audit(ctx, userID, audit.EventTokenConsumed, string(TokenPurposeActivate))
+	s.audit(ctx, userID, audit.EventActivation, "")
+
+	return nil
 }
 
 // Authenticate checks if the provided credentials are valid.
-func (s *Service) Authenticate(ctx context.Context, c Credentials) (User, error) {
+func (s *Service) Authenticate(ctx context.Context, c Credentials) (_ User, err error) {
+	ctx, span := tracing.Start(ctx, "auth.Service.Authenticate")
+	defer func() { span.EndErr(err) }()
+
 	users, err := s.store.FindUsers(ctx, UserFilter{
 		Emails:   []email.Address{c.Email},
 		IsActive: ptr(true),
@@ -268,14 +381,18 @@ func (s *Service) Authenticate(ctx context.Context, c Credentials) (User, error)
 		// Even if no user is found we compare to a hash to prevent timing differences
 		// that could result in user enumeration attacks.
 		_ = c.Password.Match(s.comparisonHash)
+		s.audit(ctx, uuid.Nil, audit.EventLoginFailed, "")
 		return User{}, errorz.InvalidInput{ErrInvalidCredentials}
 	}
 
 	match := c.Password.Match(users[0].PasswordHash)
 	if !match {
+		s.audit(ctx, users[0].ID, audit.EventLoginFailed, "")
 		return User{}, errorz.InvalidInput{ErrInvalidCredentials}
 	}
 
+	s.audit(ctx, users[0].ID, audit.EventLoginSucceeded, "")
+
 	return users[0], nil
 }
 
@@ -283,53 +400,27 @@ func (s *Service) Authenticate(ctx context.Context, c Credentials) (User, error)
 // Similary to RegisterUser, the main work is done in a separate goroutine and no output is
 // returned to indicate if the request was successful.
 func (s *Service) RequestPasswordReset(ctx context.Context, addr email.Address) {
+	ctx, span := tracing.Start(ctx, "auth.Service.RequestPasswordReset")
+	defer span.End()
+
 	// The actual work is done in a separate goroutine to prevent:
 	// - Waiting for the email to be send might slow down sending a response.
 	// - Information leakage. Timing difference between existing/non-existing
 	//   user could lead to user enumeration attacks.
-	s.wg.Add(1)
-	go func() {
-		defer s.wg.Done()
-
-		wCtx, cancel := context.WithTimeout(context.Background(), s.cfg.WorkerTimeout)
-		defer cancel()
-
-		err := s.startPasswordReset(wCtx, addr)
-		if err != nil {
-			s.errHandler(err)
-			return
-		}
-	}()
+	s.startWorker(ctx, "startPasswordReset", func(ctx context.Context) error {
+		return s.startPasswordReset(ctx, addr)
+	})
 }
 
 func (s *Service) startPasswordReset(ctx context.Context, addr email.Address) error {
 	now := s.NowFunc()
 
-	token, err := krypto.GenerateToken()
-	if err != nil {
-		return err
-	}
-
-	tokenHash, err := krypto.HashArgon2(token[:])
-	if err != nil {
-		return err
-	}
-
-	tokenID, err := uuid.NewRandom()
+	// The user ID is set after the user is found.
+	emailToken, token, err := newEmailToken(uuid.Nil, addr, TokenPurposePasswordReset, now)
 	if err != nil {
 		return err
 	}
 
-	emailToken := EmailToken{
-		ID:         tokenID,
-		TokenHash:  tokenHash,
-		UserID:     uuid.Nil, // set after the user is found.
-		Email:      addr,
-		Purpose:    TokenPurposePasswordReset,
-		CreatedAt:  now,
-		ConsumedAt: nil,
-	}
-
 	err = s.inTx(ctx, func(tx Tx) error {
 		// Find the user with the provided email address.
 		user, txErr := findUser(tx, UserFilter{
@@ -355,12 +446,14 @@ func (s *Service) startPasswordReset(ctx context.Context, addr email.Address) er
 		return err
 	}
 
+	s.audit(ctx, emailToken.UserID, audit.EventPasswordResetRequested, "")
+
 	// Send the email.
 	// This could fail independently of the transaction. This is an acceptable
 	// risk for now. If the user has not received the email, they can always try to request a new password again.
 	//
 	// If at some point this becomes unacceptable, we need to consider some kind of outbox pattern.
-	err = s.emailer.Send(ctx, "password-reset-request", addr, EmailTokenRaw{
+	err = s.emailer.Send(ctx, TemplatePasswordResetRequest, addr, EmailTokenRaw{
 		ID:    emailToken.ID,
 		Token: token,
 	})
@@ -377,7 +470,10 @@ type NewPassword struct {
 	Password Password
 }
 
-func (s *Service) ResetPassword(ctx context.Context, np NewPassword) error {
+func (s *Service) ResetPassword(ctx context.Context, np NewPassword) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.Service.ResetPassword")
+	defer func() { span.EndErr(err) }()
+
 	now := s.NowFunc()
 
 	// Hash the password.
@@ -386,7 +482,10 @@ func (s *Service) ResetPassword(ctx context.Context, np NewPassword) error {
 		return err
 	}
 
-	var recipient email.Address
+	var (
+		userID    uuid.UUID
+		recipient email.Address
+	)
 
 	// finish the password reset:
 	// - Find the token.
@@ -412,6 +511,7 @@ func (s *Service) ResetPassword(ctx context.Context, np NewPassword) error {
 		user.UpdatedAt = now
 
 		// We will send a confirmation email to the user after the transaction is done.
+		userID = user.ID
 		recipient = user.Email
 
 		txErr = tx.UpdateUser(user)
@@ -426,23 +526,46 @@ func (s *Service) ResetPassword(ctx context.Context, np NewPassword) error {
 		return err
 	}
 
-	// Send the confirmation email asynchronously.
-	s.wg.Add(1)
-	go func() {
-		defer s.wg.Done()
+	s.audit(ctx, userID, audit.EventTokenConsumed, string(TokenPurposePasswordReset))
+	s.audit(ctx, userID, audit.EventPasswordReset, "")
 
-		emailCtx, cancel := context.WithTimeout(context.Background(), s.cfg.WorkerTimeout)
-		defer cancel()
-		err = s.emailer.Send(emailCtx, "password-reset-success", recipient, nil)
-		if err != nil {
-			s.errHandler(err)
-			return
-		}
-	}()
+	// Send the confirmation email asynchronously.
+	s.startWorker(ctx, "sendPasswordResetSuccess", func(ctx context.Context) error {
+		return s.emailer.Send(ctx, TemplatePasswordResetSuccess, recipient, nil)
+	})
 
 	return nil
 }
 
+// newEmailToken generates a new token and returns both the EmailToken to store
+// and the raw token to send to the user.
+func newEmailToken(userID uuid.UUID, addr email.Address, purpose TokenPurpose, now time.Time) (EmailToken, krypto.Token, error) {
+	token, err := krypto.GenerateToken()
+	if err != nil {
+		return EmailToken{}, krypto.Token{}, err
+	}
+
+	tokenHash, err := krypto.HashArgon2(token[:])
+	if err != nil {
+		return EmailToken{}, krypto.Token{}, err
+	}
+
+	tokenID, err := uuid.NewRandom()
+	if err != nil {
+		return EmailToken{}, krypto.Token{}, err
+	}
+
+	return EmailToken{
+		ID:         tokenID,
+		TokenHash:  tokenHash,
+		UserID:     userID,
+		Email:      addr,
+		Purpose:    purpose,
+		CreatedAt:  now,
+		ConsumedAt: nil,
+	}, token, nil
+}
+
 func findConsumableEmailToken(tx Tx, raw EmailTokenRaw, purpose TokenPurpose, now time.Time, maxAge time.Duration) (EmailToken, error) {
 	tokens, err := tx.FindEmailTokens(EmailTokenFilter{
 		IDs:        []uuid.UUID{raw.ID},
@@ -505,7 +628,10 @@ func consumeAllTokensForUserID(tx Tx, userID uuid.UUID, purpose TokenPurpose, co
 	return nil
 }
 
-func (s *Service) inTx(ctx context.Context, f func(tx Tx) error) error {
+func (s *Service) inTx(ctx context.Context, f func(tx Tx) error) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.Service.inTx")
+	defer func() { span.EndErr(err) }()
+
 	tx, err := s.store.BeginTx(ctx)
 	if err != nil {
 		return err
@@ -3,17 +3,20 @@ package auth_test
 import (
 	"context"
 	"errors"
+	"net/url"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/willemschots/househunt/assets"
+	"github.com/willemschots/househunt/internal/audit"
 	"github.com/willemschots/househunt/internal/auth"
-	"github.com/willemschots/househunt/internal/auth/db"
-	"github.com/willemschots/househunt/internal/db/testdb"
 	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/email/view"
 	"github.com/willemschots/househunt/internal/errorz"
 	"github.com/willemschots/househunt/internal/errorz/testerr"
+	"github.com/willemschots/househunt/internal/i18n"
 	"github.com/willemschots/househunt/internal/krypto"
 )
 
@@ -739,27 +742,176 @@ func Test_Service_ResetPassword(t *testing.T) {
 	})
 }
 
+func Test_Service_AuditEvents(t *testing.T) {
+	st := newServiceTest(t)
+	ctx := audit.WithClient(context.Background(), audit.Client{IP: "192.0.2.1", UserAgent: "Mozilla/5.0"})
+
+	credentials := auth.Credentials{
+		Email:    must(email.ParseAddress("info@example.com")),
+		Password: must(auth.ParsePassword("reallyStrongPassword1")),
+	}
+
+	err := st.svc.RegisterUser(ctx, credentials)
+	if err != nil {
+		t.Fatalf("failed to register user: %v", err)
+	}
+
+	st.svc.Wait()
+	st.activateUser(st.emailer.emails[0].data.(auth.EmailTokenRaw))
+
+	wrong := credentials
+	wrong.Password = must(auth.ParsePassword("wrongPassword"))
+	_, _ = st.svc.Authenticate(ctx, wrong)
+
+	user, err := st.svc.Authenticate(ctx, credentials)
+	if err != nil {
+		t.Fatalf("failed to authenticate: %v", err)
+	}
+
+	resetTok := st.requestPasswordReset(credentials.Email)
+	st.resetPassword(auth.NewPassword{
+		RawToken: resetTok,
+		Password: must(auth.ParsePassword("otherPassword")),
+	})
+
+	// Unknown addresses are recorded without a user.
+	unknown := credentials
+	unknown.Email = must(email.ParseAddress("unknown@example.com"))
+	_, _ = st.svc.Authenticate(ctx, unknown)
+
+	st.svc.Wait()
+	st.errList.assertNoError(t)
+
+	want := []audit.EventType{
+		audit.EventPasswordReset,
+		audit.EventTokenConsumed,
+		audit.EventPasswordResetRequested,
+		audit.EventLoginSucceeded,
+		audit.EventLoginFailed,
+		audit.EventActivation,
+		audit.EventTokenConsumed,
+		audit.EventRegistration,
+	}
+
+	events, err := st.auditor.Events(context.Background(), user.ID, 0)
+	if err != nil {
+		t.Fatalf("failed to find events: %v", err)
+	}
+
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %d: %#v", len(want), len(events), events)
+	}
+
+	for i := range want {
+		if events[i].Type != want[i] {
+			t.Errorf("event %d: got %q, want %q", i, events[i].Type, want[i])
+		}
+	}
+
+	// The registration and logins happened in the context of the client.
+	for _, e := range []audit.Event{events[3], events[4], events[7]} {
+		if e.IP != "192.0.2.1" || e.UserAgent != "Mozilla/5.0" {
+			t.Errorf("expected client info on %q event, got %q/%q", e.Type, e.IP, e.UserAgent)
+		}
+	}
+
+	if events[1].Detail != string(auth.TokenPurposePasswordReset) || events[6].Detail != string(auth.TokenPurposeActivate) {
+		t.Errorf("expected token purposes as detail, got %q and %q", events[1].Detail, events[6].Detail)
+	}
+
+	anonymous, err := st.auditor.Events(context.Background(), uuid.Nil, 0)
+	if err != nil {
+		t.Fatalf("failed to find events: %v", err)
+	}
+
+	if len(anonymous) != 1 || anonymous[0].Type != audit.EventLoginFailed {
+		t.Errorf("expected a single failed login without user, got %#v", anonymous)
+	}
+}
+
 type svcTest struct {
 	t       *testing.T
 	svc     *auth.Service
 	store   *testStore
 	emailer *testEmailer
+	auditor *audit.Recorder
 	errList *errList
 	nowFunc func() time.Time
 }
 
-func newServiceTest(t *testing.T) *svcTest {
-	encryptor := must(krypto.NewEncryptor([]krypto.Key{
-		must(krypto.ParseKey("2b671594b775f371eab4050b4d58326682df6b1a6cc2e886717b1a26b4d6c45d")),
-	}))
+func Test_Service_Shutdown(t *testing.T) {
+	credentials := auth.Credentials{
+		Email:    must(email.ParseAddress("info@example.com")),
+		Password: must(auth.ParsePassword("reallyStrongPassword1")),
+	}
+
+	t.Run("ok, waits for open workers", func(t *testing.T) {
+		st := newServiceTest(t)
+
+		err := st.svc.RegisterUser(context.Background(), credentials)
+		if err != nil {
+			t.Fatalf("failed to register user: %v", err)
+		}
+
+		err = st.svc.Shutdown(context.Background())
+		if err != nil {
+			t.Fatalf("failed to shutdown: %v", err)
+		}
+
+		st.errList.assertNoError(t)
+		st.emailer.assertLastEmail(t, "user-activation", credentials.Email, nil)
+	})
+
+	t.Run("ok, no workers are started after shutdown", func(t *testing.T) {
+		st := newServiceTest(t)
+
+		err := st.svc.Shutdown(context.Background())
+		if err != nil {
+			t.Fatalf("failed to shutdown: %v", err)
+		}
+
+		err = st.svc.RegisterUser(context.Background(), credentials)
+		if err != nil {
+			t.Fatalf("failed to register user: %v", err)
+		}
+
+		st.svc.Wait()
+		st.errList.assertErrorIs(t, auth.ErrShuttingDown)
+		st.emailer.assertNoEmails(t)
+	})
+
+	t.Run("fail, workers don't finish before the deadline", func(t *testing.T) {
+		st := newServiceTest(t)
+		st.emailer.block = make(chan struct{})
+
+		err := st.svc.RegisterUser(context.Background(), credentials)
+		if err != nil {
+			t.Fatalf("failed to register user: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err = st.svc.Shutdown(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v, got %v via errors.Is()", context.DeadlineExceeded, err)
+		}
 
-	indexKey := must(krypto.ParseKey("90303dfed7994260ea4817a5ca8a392915cd401115b2f97495dadfcbcd14adbf"))
+		if got := st.svc.Workers(); got != 1 {
+			t.Errorf("expected 1 running worker, got %d", got)
+		}
+
+		close(st.emailer.block)
+		st.svc.Wait()
+	})
+}
 
-	testDB := testdb.RunWhile(t, true)
+func newServiceTest(t *testing.T) *svcTest {
 	test := &svcTest{
 		t: t,
 		store: &testStore{
-			store:   db.New(testDB, testDB, encryptor, indexKey),
+			// The database stores behave the same, see the storetest package.
+			store:   auth.NewMemoryStore(),
 			tracker: &testerr.Calltracker{}, // empty call trackers never fail.
 		},
 		errList: &errList{
@@ -767,6 +919,7 @@ func newServiceTest(t *testing.T) *svcTest {
 			errs:  make([]error, 0),
 		},
 		emailer: &testEmailer{},
+		auditor: audit.NewRecorder(audit.NewMemoryStore()),
 		nowFunc: func() time.Time {
 			return time.Now().Round(0)
 		},
@@ -777,7 +930,7 @@ func newServiceTest(t *testing.T) *svcTest {
 		TokenExpiry:   time.Hour,
 	}
 
-	svc, err := auth.NewService(test.store, test.emailer, test.errList.AppendErr, cfg)
+	svc, err := auth.NewService(test.store, test.emailer, test.auditor, test.errList.AppendErr, cfg)
 	if err != nil {
 		t.Fatalf("failed to create service: %v", err)
 	}
@@ -867,7 +1020,7 @@ type errList struct {
 	errs  []error
 }
 
-func (e *errList) AppendErr(err error) {
+func (e *errList) AppendErr(_ context.Context, err error) {
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 
@@ -922,6 +1075,18 @@ func (f *testStore) FindUsers(ctx context.Context, filter auth.UserFilter) ([]au
 	})
 }
 
+func (f *testStore) FindEmailTokens(ctx context.Context, filter auth.EmailTokenFilter) ([]auth.EmailToken, error) {
+	return testerr.MaybeFail(f.tracker, func() ([]auth.EmailToken, error) {
+		return f.store.FindEmailTokens(ctx, filter)
+	})
+}
+
+func (f *testStore) FindAdminActions(ctx context.Context, filter auth.AdminActionFilter) ([]auth.AdminAction, error) {
+	return testerr.MaybeFail(f.tracker, func() ([]auth.AdminAction, error) {
+		return f.store.FindAdminActions(ctx, filter)
+	})
+}
+
 type testTx struct {
 	store *testStore
 	tx    auth.Tx
@@ -975,6 +1140,12 @@ func (tx *testTx) FindEmailTokens(filter auth.EmailTokenFilter) ([]auth.EmailTok
 	})
 }
 
+func (tx *testTx) CreateAdminAction(a auth.AdminAction) error {
+	return testerr.MaybeFailErrFunc(tx.store.tracker, func() error {
+		return tx.tx.CreateAdminAction(a)
+	})
+}
+
 type sendEmail struct {
 	template  string
 	recipient email.Address
@@ -984,6 +1155,8 @@ type sendEmail struct {
 type testEmailer struct {
 	emails  []sendEmail
 	testErr error
+	// block makes Send wait until it's closed, if set.
+	block chan struct{}
 }
 
 func (e *testEmailer) clearEmails() {
@@ -991,6 +1164,10 @@ func (e *testEmailer) clearEmails() {
 }
 
 func (e *testEmailer) Send(_ context.Context, template string, to email.Address, data interface{}) error {
+	if e.block != nil {
+		<-e.block
+	}
+
 	e.emails = append(e.emails, sendEmail{
 		template:  template,
 		recipient: to,
@@ -1028,3 +1205,27 @@ func (e *testEmailer) assertNoEmails(t *testing.T) {
 		t.Fatalf("expected no emails, got %d", len(e.emails))
 	}
 }
+
+func Test_EmailTemplates(t *testing.T) {
+	t.Run("ok, embedded email templates render", func(t *testing.T) {
+		catalogue, err := i18n.LoadCatalogue(assets.LocaleFS)
+		if err != nil {
+			t.Fatalf("failed to load catalogue: %v", err)
+		}
+
+		renderer, err := view.NewMemRenderer(assets.EmailFS)
+		if err != nil {
+			t.Fatalf("failed to create renderer: %v", err)
+		}
+
+		svc := email.NewService(renderer, email.NewMemorySender(), email.NewMemorySuppressionStore(), catalogue, email.ServiceConfig{
+			From:    must(email.ParseAddress("info@example.com")),
+			BaseURL: must(url.Parse("http://example.com")),
+		})
+
+		err = svc.CheckTemplates(auth.EmailTemplates())
+		if err != nil {
+			t.Fatalf("expected email templates to be ok, got:\n%v", err)
+		}
+	})
+}
@@ -11,19 +11,29 @@ import (
 // Returned users must match all the provided fields.
 // If a field is empty or nil, it's ignored.
 type UserFilter struct {
-	IDs      []uuid.UUID
-	Emails   []email.Address
-	IsActive *bool
+	IDs      []uuid.UUID     `db:"id,in"`
+	Emails   []email.Address `db:"email_blind_index,in,blindindex"`
+	IsActive *bool           `db:"is_active,eq"`
 }
 
 // EmailTokenFilter is used to filter email tokens.
 // Returned tokens must match all the provided fields.
 // If a field is empty or nil, it's ignored.
 type EmailTokenFilter struct {
-	IDs        []uuid.UUID
-	UserIDs    []uuid.UUID
-	Purposes   []TokenPurpose
-	IsConsumed *bool
+	IDs        []uuid.UUID    `db:"id,in"`
+	UserIDs    []uuid.UUID    `db:"user_id,in"`
+	Purposes   []TokenPurpose `db:"purpose,in"`
+	IsConsumed *bool          `db:"consumed_at,notnull"`
+}
+
+// AdminActionFilter is used to filter admin actions.
+// Returned actions must match all the provided fields.
+// If a field is empty or zero, it's ignored.
+type AdminActionFilter struct {
+	ActorIDs      []uuid.UUID `db:"actor_id,in"`
+	TargetUserIDs []uuid.UUID `db:"target_user_id,in"`
+	// Limit limits the number of returned actions.
+	Limit int `db:",limit"`
 }
 
 // Store provides access to the user store.
@@ -31,6 +41,10 @@ type Store interface {
 	BeginTx(ctx context.Context) (Tx, error)
 
 	FindUsers(ctx context.Context, filter UserFilter) ([]User, error)
+	FindEmailTokens(ctx context.Context, filter EmailTokenFilter) ([]EmailToken, error)
+	// FindAdminActions returns the admin actions matching the filter,
+	// the most recent actions are returned first.
+	FindAdminActions(ctx context.Context, filter AdminActionFilter) ([]AdminAction, error)
 }
 
 // Tx is a transaction. If an error occurs on any of the Create/Update/Find methods,
@@ -47,4 +61,6 @@ type Tx interface {
 	CreateEmailToken(t EmailToken) error
 	UpdateEmailToken(t EmailToken) error
 	FindEmailTokens(filter EmailTokenFilter) ([]EmailToken, error)
+
+	CreateAdminAction(a AdminAction) error
 }
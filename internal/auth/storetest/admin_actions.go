@@ -0,0 +1,204 @@
+package storetest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/auth"
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/errorz"
+)
+
+func (s suite) testCreateAdminAction(t *testing.T) {
+	setup := func(t *testing.T, tx auth.Tx) {
+		createUsers(t, tx,
+			newUser(t, nil),
+			newUser(t, func(u *auth.User) {
+				u.ID = must(uuid.Parse("597228ee-afde-4991-b13c-0161325e3930"))
+				u.Email = must(email.ParseAddress("jacob@example.com"))
+			}),
+		)
+	}
+
+	t.Run("ok, create admin action", s.inTx(func(t *testing.T, tx auth.Tx) {
+		setup(t, tx)
+
+		err := tx.CreateAdminAction(newAdminAction(t, nil))
+		if err != nil {
+			t.Fatalf("failed to save admin action: %v", err)
+		}
+	}))
+
+	t.Run("ok, without actor and target", s.inTx(func(t *testing.T, tx auth.Tx) {
+		setup(t, tx)
+
+		action := newAdminAction(t, func(a *auth.AdminAction) {
+			a.ActorID = uuid.Nil
+			a.TargetUserID = uuid.Nil
+			a.Detail = ""
+		})
+
+		err := tx.CreateAdminAction(action)
+		if err != nil {
+			t.Fatalf("failed to save admin action: %v", err)
+		}
+	}))
+
+	t.Run("fail, actor foreign key does not exist", s.inTx(func(t *testing.T, tx auth.Tx) {
+		setup(t, tx)
+
+		action := newAdminAction(t, func(a *auth.AdminAction) {
+			a.ActorID = must(uuid.Parse("d622d0b0-465c-4c4d-b084-028c9787e1de"))
+		})
+
+		err := tx.CreateAdminAction(action)
+		assertErrorIs(t, err, errorz.ErrConstraintViolated)
+	}))
+
+	t.Run("fail, target foreign key does not exist", s.inTx(func(t *testing.T, tx auth.Tx) {
+		setup(t, tx)
+
+		action := newAdminAction(t, func(a *auth.AdminAction) {
+			a.TargetUserID = must(uuid.Parse("d622d0b0-465c-4c4d-b084-028c9787e1de"))
+		})
+
+		err := tx.CreateAdminAction(action)
+		assertErrorIs(t, err, errorz.ErrConstraintViolated)
+	}))
+
+	t.Run("fail, id constraint violated", s.inTx(func(t *testing.T, tx auth.Tx) {
+		setup(t, tx)
+
+		err := tx.CreateAdminAction(newAdminAction(t, nil))
+		if err != nil {
+			t.Fatalf("failed to save admin action: %v", err)
+		}
+
+		err = tx.CreateAdminAction(newAdminAction(t, nil))
+		assertErrorIs(t, err, errorz.ErrConstraintViolated)
+	}))
+
+	t.Run("fail, zero ID", s.inTx(func(t *testing.T, tx auth.Tx) {
+		setup(t, tx)
+
+		action := newAdminAction(t, func(a *auth.AdminAction) {
+			a.ID = uuid.Nil
+		})
+
+		err := tx.CreateAdminAction(action)
+		assertErrorIs(t, err, errorz.ErrConstraintViolated)
+	}))
+}
+
+func (s suite) testFindAdminActions(t *testing.T) {
+	setupAdminActions := func(t *testing.T, tx auth.Tx) []auth.AdminAction {
+		users := []auth.User{
+			newUser(t, nil),
+			newUser(t, func(u *auth.User) {
+				u.ID = must(uuid.Parse("597228ee-afde-4991-b13c-0161325e3930"))
+				u.Email = must(email.ParseAddress("jacob@example.com"))
+			}),
+		}
+		createUsers(t, tx, users...)
+
+		// Actions are ordered most recent first.
+		actions := []auth.AdminAction{
+			newAdminAction(t, func(a *auth.AdminAction) {
+				a.ID = must(uuid.Parse("4516a1c0-efc3-4561-9e97-e749e008aa3f"))
+				a.CreatedAt = now(t, 3)
+			}),
+			newAdminAction(t, func(a *auth.AdminAction) {
+				a.CreatedAt = now(t, 2)
+			}),
+			newAdminAction(t, func(a *auth.AdminAction) {
+				a.ID = must(uuid.Parse("b7d2b72f-e20b-4f6d-abae-ec90ff36553a"))
+				a.ActorID = uuid.Nil
+				a.TargetUserID = users[0].ID
+				a.Action = auth.AdminActionBootstrapAdmin
+				a.Detail = ""
+				a.CreatedAt = now(t, 1)
+			}),
+		}
+
+		for i := range actions {
+			err := tx.CreateAdminAction(actions[i])
+			if err != nil {
+				t.Fatalf("failed to save admin action: %v", err)
+			}
+		}
+
+		return actions
+	}
+
+	tests := map[string]struct {
+		filter   auth.AdminActionFilter
+		wantFunc func([]auth.AdminAction) []auth.AdminAction
+	}{
+		"ok, all admin actions, empty slices": {
+			filter: auth.AdminActionFilter{
+				ActorIDs:      []uuid.UUID{},
+				TargetUserIDs: []uuid.UUID{},
+			},
+			wantFunc: func(actions []auth.AdminAction) []auth.AdminAction {
+				return actions
+			},
+		},
+		"ok, by actor": {
+			filter: auth.AdminActionFilter{
+				ActorIDs: []uuid.UUID{must(uuid.Parse("0e61a06e-bbf6-4b87-aaaa-75fee0f38cca"))},
+			},
+			wantFunc: func(actions []auth.AdminAction) []auth.AdminAction {
+				return actions[0:2]
+			},
+		},
+		"ok, by target user": {
+			filter: auth.AdminActionFilter{
+				TargetUserIDs: []uuid.UUID{must(uuid.Parse("0e61a06e-bbf6-4b87-aaaa-75fee0f38cca"))},
+			},
+			wantFunc: func(actions []auth.AdminAction) []auth.AdminAction {
+				return actions[2:3]
+			},
+		},
+		"ok, limit": {
+			filter: auth.AdminActionFilter{
+				Limit: 1,
+			},
+			wantFunc: func(actions []auth.AdminAction) []auth.AdminAction {
+				return actions[0:1]
+			},
+		},
+		"ok, no results": {
+			filter: auth.AdminActionFilter{
+				ActorIDs: []uuid.UUID{uuid.Nil},
+			},
+			wantFunc: func(actions []auth.AdminAction) []auth.AdminAction {
+				return []auth.AdminAction{}
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, s.withStore(func(t *testing.T, store auth.Store) {
+			tx := beginTx(t, store)
+
+			actions := setupAdminActions(t, tx)
+			want := tc.wantFunc(actions)
+
+			err := tx.Commit()
+			if err != nil {
+				t.Fatalf("failed to commit tx: %v", err)
+			}
+
+			got, err := store.FindAdminActions(context.Background(), tc.filter)
+			if err != nil {
+				t.Fatalf("failed to find admin actions: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got\n%#v\nwant\n%#v\n", got, want)
+			}
+		}))
+	}
+}
@@ -0,0 +1,397 @@
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/auth"
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/errorz"
+)
+
+func (s suite) testCreateEmailToken(t *testing.T) {
+	setup := func(t *testing.T, tx auth.Tx) {
+		createUsers(t, tx, newUser(t, nil))
+	}
+
+	t.Run("ok, create email token", s.inTx(func(t *testing.T, tx auth.Tx) {
+		setup(t, tx)
+
+		token := newEmailToken(t, nil)
+
+		err := tx.CreateEmailToken(token)
+		if err != nil {
+			t.Fatalf("failed to save email token: %v", err)
+		}
+
+		assertFindEmailToken(t, tx, token)
+	}))
+
+	t.Run("fail, user foreign key does not exist", s.inTx(func(t *testing.T, tx auth.Tx) {
+		setup(t, tx)
+
+		token := newEmailToken(t, func(tok *auth.EmailToken) {
+			tok.UserID = must(uuid.Parse("597228ee-afde-4991-b13c-0161325e3930"))
+		})
+
+		err := tx.CreateEmailToken(token)
+		assertErrorIs(t, err, errorz.ErrConstraintViolated)
+	}))
+
+	t.Run("fail, id constraint violated", s.inTx(func(t *testing.T, tx auth.Tx) {
+		setup(t, tx)
+
+		err := tx.CreateEmailToken(newEmailToken(t, nil))
+		if err != nil {
+			t.Fatalf("failed to save email token: %v", err)
+		}
+
+		err = tx.CreateEmailToken(newEmailToken(t, nil))
+		assertErrorIs(t, err, errorz.ErrConstraintViolated)
+	}))
+
+	t.Run("fail, zero ID", s.inTx(func(t *testing.T, tx auth.Tx) {
+		setup(t, tx)
+
+		token := newEmailToken(t, func(tok *auth.EmailToken) {
+			tok.ID = uuid.Nil
+		})
+
+		err := tx.CreateEmailToken(token)
+		assertErrorIs(t, err, errorz.ErrConstraintViolated)
+	}))
+}
+
+func (s suite) testUpdateEmailToken(t *testing.T) {
+	setup := func(t *testing.T, tx auth.Tx) auth.EmailToken {
+		createUsers(t, tx, newUser(t, nil))
+
+		token := newEmailToken(t, nil)
+		err := tx.CreateEmailToken(token)
+		if err != nil {
+			t.Fatalf("failed to save email token: %v", err)
+		}
+
+		return token
+	}
+
+	t.Run("ok, update email token", s.inTx(func(t *testing.T, tx auth.Tx) {
+		token := setup(t, tx)
+
+		// TODO: Change other fields.
+		consumedAt := now(t, 9)
+		token.ConsumedAt = &consumedAt
+
+		err := tx.UpdateEmailToken(token)
+		if err != nil {
+			t.Fatalf("failed to save email token: %v", err)
+		}
+
+		assertFindEmailToken(t, tx, token)
+	}))
+
+	t.Run("fail, not found", s.inTx(func(t *testing.T, tx auth.Tx) {
+		token := setup(t, tx)
+
+		token.ID = must(uuid.Parse("597228ee-afde-4991-b13c-0161325e3930"))
+		err := tx.UpdateEmailToken(token)
+		assertErrorIs(t, err, errorz.ErrNotFound)
+	}))
+
+	t.Run("fail, user foreign key does not exist", s.inTx(func(t *testing.T, tx auth.Tx) {
+		token := setup(t, tx)
+
+		token.UserID = must(uuid.Parse("597228ee-afde-4991-b13c-0161325e3930"))
+		err := tx.UpdateEmailToken(token)
+		assertErrorIs(t, err, errorz.ErrConstraintViolated)
+	}))
+}
+
+// testEmailTokens creates the users and returns the email tokens that are used to
+// test the email token filters. The tokens are ordered like the store orders them.
+func testEmailTokens(t *testing.T, tx auth.Tx) []auth.EmailToken {
+	users := []auth.User{
+		newUser(t, nil),
+		newUser(t, func(u *auth.User) {
+			u.ID = must(uuid.Parse("597228ee-afde-4991-b13c-0161325e3930"))
+			u.Email = must(email.ParseAddress("jacob@example.com"))
+		}),
+	}
+	createUsers(t, tx, users...)
+
+	return []auth.EmailToken{
+		newEmailToken(t, nil),
+		newEmailToken(t, func(tok *auth.EmailToken) {
+			tok.ID = must(uuid.Parse("4516a1c0-efc3-4561-9e97-e749e008aa3f"))
+		}),
+		newEmailToken(t, func(tok *auth.EmailToken) {
+			tok.ID = must(uuid.Parse("b7d2b72f-e20b-4f6d-abae-ec90ff36553a"))
+			tok.UserID = users[1].ID
+			tok.Purpose = auth.TokenPurposePasswordReset
+			now := now(t, 9)
+			tok.ConsumedAt = &now
+		}),
+	}
+}
+
+func createEmailTokens(t *testing.T, tx auth.Tx, tokens ...auth.EmailToken) {
+	t.Helper()
+
+	for i := range tokens {
+		err := tx.CreateEmailToken(tokens[i])
+		if err != nil {
+			t.Fatalf("failed to save email token: %v", err)
+		}
+	}
+}
+
+func (s suite) testFindEmailTokens(t *testing.T) {
+	tests := map[string]struct {
+		filter   auth.EmailTokenFilter
+		wantFunc func([]auth.EmailToken) []auth.EmailToken
+	}{
+		"ok, all email tokens, empty slices": {
+			filter: auth.EmailTokenFilter{
+				IDs:        []uuid.UUID{},
+				UserIDs:    []uuid.UUID{},
+				Purposes:   []auth.TokenPurpose{},
+				IsConsumed: nil,
+			},
+			wantFunc: func(tokens []auth.EmailToken) []auth.EmailToken {
+				return tokens
+			},
+		},
+		"ok, unconsumed": {
+			filter: auth.EmailTokenFilter{
+				IsConsumed: ptr(false),
+			},
+			wantFunc: func(tokens []auth.EmailToken) []auth.EmailToken {
+				return tokens[0:2]
+			},
+		},
+		"ok, consumed": {
+			filter: auth.EmailTokenFilter{
+				IsConsumed: ptr(true),
+			},
+			wantFunc: func(tokens []auth.EmailToken) []auth.EmailToken {
+				return tokens[2:3]
+			},
+		},
+		"ok, one by id": {
+			filter: auth.EmailTokenFilter{
+				IDs: []uuid.UUID{must(uuid.Parse("4516a1c0-efc3-4561-9e97-e749e008aa3f"))},
+			},
+			wantFunc: func(tokens []auth.EmailToken) []auth.EmailToken {
+				return []auth.EmailToken{tokens[1]}
+			},
+		},
+		"ok, several by id": {
+			filter: auth.EmailTokenFilter{
+				IDs: []uuid.UUID{
+					must(uuid.Parse("42bf8943-2ffc-43d9-8682-ca8fc4d7cb8e")),
+					must(uuid.Parse("b7d2b72f-e20b-4f6d-abae-ec90ff36553a")),
+				},
+			},
+			wantFunc: func(tokens []auth.EmailToken) []auth.EmailToken {
+				return []auth.EmailToken{
+					tokens[0], tokens[2],
+				}
+			},
+		},
+		"ok, one by user id": {
+			filter: auth.EmailTokenFilter{
+				UserIDs: []uuid.UUID{
+					must(uuid.Parse("597228ee-afde-4991-b13c-0161325e3930")),
+				},
+			},
+			wantFunc: func(tokens []auth.EmailToken) []auth.EmailToken {
+				return tokens[2:3]
+			},
+		},
+		"ok, several by user id": {
+			filter: auth.EmailTokenFilter{
+				UserIDs: []uuid.UUID{
+					must(uuid.Parse("0e61a06e-bbf6-4b87-aaaa-75fee0f38cca")),
+				},
+			},
+			wantFunc: func(tokens []auth.EmailToken) []auth.EmailToken {
+				return tokens[0:2]
+			},
+		},
+		"ok, one by purpose": {
+			filter: auth.EmailTokenFilter{
+				Purposes: []auth.TokenPurpose{auth.TokenPurposePasswordReset},
+			},
+			wantFunc: func(tokens []auth.EmailToken) []auth.EmailToken {
+				return tokens[2:3]
+			},
+		},
+		"ok, several by purpose": {
+			filter: auth.EmailTokenFilter{
+				Purposes: []auth.TokenPurpose{auth.TokenPurposeActivate},
+			},
+			wantFunc: func(tokens []auth.EmailToken) []auth.EmailToken {
+				return tokens[0:2]
+			},
+		},
+		"ok, combine filters": {
+			filter: auth.EmailTokenFilter{
+				IDs: []uuid.UUID{
+					must(uuid.Parse("4516a1c0-efc3-4561-9e97-e749e008aa3f")),
+					must(uuid.Parse("b7d2b72f-e20b-4f6d-abae-ec90ff36553a")),
+				},
+				UserIDs: []uuid.UUID{
+					must(uuid.Parse("0e61a06e-bbf6-4b87-aaaa-75fee0f38cca")),
+				},
+				Purposes: []auth.TokenPurpose{auth.TokenPurposeActivate},
+			},
+			wantFunc: func(tokens []auth.EmailToken) []auth.EmailToken {
+				return tokens[1:2]
+			},
+		},
+		"ok, no results": {
+			filter: auth.EmailTokenFilter{
+				IDs: []uuid.UUID{uuid.Nil},
+			},
+			wantFunc: func(tokens []auth.EmailToken) []auth.EmailToken {
+				return []auth.EmailToken{}
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, s.withStore(func(t *testing.T, store auth.Store) {
+			tx := beginTx(t, store)
+
+			tokens := testEmailTokens(t, tx)
+			createEmailTokens(t, tx, tokens...)
+			want := tc.wantFunc(tokens)
+
+			got, err := tx.FindEmailTokens(tc.filter)
+			if err != nil {
+				t.Fatalf("failed to find email tokens: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got\n%#v\nwant\n%#v\n", got, want)
+			}
+
+			err = tx.Commit()
+			if err != nil {
+				t.Fatalf("failed to commit tx: %v", err)
+			}
+
+			got, err = store.FindEmailTokens(context.Background(), tc.filter)
+			if err != nil {
+				t.Fatalf("failed to find email tokens: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got\n%#v\nwant\n%#v\n", got, want)
+			}
+		}))
+	}
+}
+
+// testFindEmailTokensCombinations tests every combination of the fields of the filter,
+// the expected tokens are determined by matchEmailToken.
+func (s suite) testFindEmailTokensCombinations(t *testing.T) {
+	ids := []option[[]uuid.UUID]{
+		{"none", nil},
+		{"empty", []uuid.UUID{}},
+		{"one", []uuid.UUID{must(uuid.Parse("4516a1c0-efc3-4561-9e97-e749e008aa3f"))}},
+		{"several", []uuid.UUID{
+			must(uuid.Parse("42bf8943-2ffc-43d9-8682-ca8fc4d7cb8e")),
+			must(uuid.Parse("b7d2b72f-e20b-4f6d-abae-ec90ff36553a")),
+		}},
+		{"unknown", []uuid.UUID{uuid.Nil}},
+	}
+
+	userIDs := []option[[]uuid.UUID]{
+		{"none", nil},
+		{"empty", []uuid.UUID{}},
+		{"one", []uuid.UUID{must(uuid.Parse("0e61a06e-bbf6-4b87-aaaa-75fee0f38cca"))}},
+		{"several", []uuid.UUID{
+			must(uuid.Parse("0e61a06e-bbf6-4b87-aaaa-75fee0f38cca")),
+			must(uuid.Parse("597228ee-afde-4991-b13c-0161325e3930")),
+		}},
+		{"unknown", []uuid.UUID{uuid.Nil}},
+	}
+
+	purposes := []option[[]auth.TokenPurpose]{
+		{"none", nil},
+		{"empty", []auth.TokenPurpose{}},
+		{"one", []auth.TokenPurpose{auth.TokenPurposePasswordReset}},
+		{"several", []auth.TokenPurpose{auth.TokenPurposeActivate, auth.TokenPurposePasswordReset}},
+	}
+
+	isConsumed := []option[*bool]{
+		{"none", nil},
+		{"true", ptr(true)},
+		{"false", ptr(false)},
+	}
+
+	store := s.newStore(t)
+
+	tx := beginTx(t, store)
+	tokens := testEmailTokens(t, tx)
+	createEmailTokens(t, tx, tokens...)
+	err := tx.Commit()
+	if err != nil {
+		t.Fatalf("failed to commit tx: %v", err)
+	}
+
+	for _, id := range ids {
+		for _, userID := range userIDs {
+			for _, purpose := range purposes {
+				for _, consumed := range isConsumed {
+					filter := auth.EmailTokenFilter{
+						IDs:        id.value,
+						UserIDs:    userID.value,
+						Purposes:   purpose.value,
+						IsConsumed: consumed.value,
+					}
+
+					name := fmt.Sprintf("IDs=%s,UserIDs=%s,Purposes=%s,IsConsumed=%s", id.name, userID.name, purpose.name, consumed.name)
+					t.Run(name, func(t *testing.T) {
+						want := make([]auth.EmailToken, 0)
+						for _, tok := range tokens {
+							if matchEmailToken(tok, filter) {
+								want = append(want, tok)
+							}
+						}
+
+						got, err := store.FindEmailTokens(context.Background(), filter)
+						if err != nil {
+							t.Fatalf("failed to find email tokens: %v", err)
+						}
+
+						if !reflect.DeepEqual(got, want) {
+							t.Errorf("got\n%#v\nwant\n%#v\n", got, want)
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+func matchEmailToken(tok auth.EmailToken, f auth.EmailTokenFilter) bool {
+	if len(f.IDs) > 0 && !slices.Contains(f.IDs, tok.ID) {
+		return false
+	}
+
+	if len(f.UserIDs) > 0 && !slices.Contains(f.UserIDs, tok.UserID) {
+		return false
+	}
+
+	if len(f.Purposes) > 0 && !slices.Contains(f.Purposes, tok.Purpose) {
+		return false
+	}
+
+	return f.IsConsumed == nil || *f.IsConsumed == (tok.ConsumedAt != nil)
+}
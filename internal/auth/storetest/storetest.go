@@ -0,0 +1,221 @@
+// Package storetest contains a conformance test suite for implementations of auth.Store.
+//
+// Every implementation should pass it, so the auth.Service can rely on the same behavior
+// no matter which store it uses:
+//
+//	func Test_Store(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) auth.Store {
+//			return newStore(t)
+//		})
+//	}
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/auth"
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/krypto"
+)
+
+// NewStoreFunc returns a new and empty store. It's called once for every test case.
+type NewStoreFunc func(t *testing.T) auth.Store
+
+// Run runs the conformance tests as subtests of t, against the stores returned by newStore.
+func Run(t *testing.T, newStore NewStoreFunc) {
+	s := suite{newStore: newStore}
+
+	t.Run("Tx_CreateUser", s.testCreateUser)
+	t.Run("Tx_UpdateUser", s.testUpdateUser)
+	t.Run("Tx_FindUsers", s.testFindUsers)
+	t.Run("FindUsers_FilterCombinations", s.testFindUsersCombinations)
+	t.Run("Tx_CreateEmailToken", s.testCreateEmailToken)
+	t.Run("Tx_UpdateEmailToken", s.testUpdateEmailToken)
+	t.Run("Tx_FindEmailTokens", s.testFindEmailTokens)
+	t.Run("FindEmailTokens_FilterCombinations", s.testFindEmailTokensCombinations)
+	t.Run("Tx_CreateAdminAction", s.testCreateAdminAction)
+	t.Run("FindAdminActions", s.testFindAdminActions)
+	t.Run("Tx_Rollback", s.testRollback)
+	t.Run("Tx_Done", s.testTxDone)
+	t.Run("Tx_Concurrent", s.testConcurrentTx)
+}
+
+type suite struct {
+	newStore NewStoreFunc
+}
+
+// withStore returns a test function that calls f with a new store.
+func (s suite) withStore(f func(*testing.T, auth.Store)) func(*testing.T) {
+	return func(t *testing.T) {
+		f(t, s.newStore(t))
+	}
+}
+
+// inTx returns a test function that calls f with a transaction of a new store.
+// The transaction is committed after f returns.
+func (s suite) inTx(f func(*testing.T, auth.Tx)) func(*testing.T) {
+	return s.withStore(func(t *testing.T, store auth.Store) {
+		tx := beginTx(t, store)
+
+		f(t, tx)
+
+		err := tx.Commit()
+		if err != nil {
+			t.Fatalf("failed to commit tx: %v", err)
+		}
+	})
+}
+
+func beginTx(t *testing.T, store auth.Store) auth.Tx {
+	t.Helper()
+
+	tx, err := store.BeginTx(context.Background())
+	if err != nil {
+		t.Fatalf("failed to begin tx: %v", err)
+	}
+
+	return tx
+}
+
+func createUsers(t *testing.T, tx auth.Tx, users ...auth.User) {
+	t.Helper()
+
+	for i := range users {
+		err := tx.CreateUser(users[i])
+		if err != nil {
+			t.Fatalf("failed to save user: %v", err)
+		}
+	}
+}
+
+func now(t *testing.T, i int) time.Time {
+	t.Helper()
+
+	if i > 9 {
+		t.Fatalf("invalid time index: %d", i)
+	}
+
+	ts, err := time.Parse(time.RFC3339, fmt.Sprintf("2021-01-01T00:00:0%dZ", i))
+	if err != nil {
+		t.Fatalf("failed to parse time: %v", err)
+	}
+
+	return ts
+}
+
+func newUser(t *testing.T, modFunc func(*auth.User)) auth.User {
+	t.Helper()
+
+	u := auth.User{
+		ID:           must(uuid.Parse("0e61a06e-bbf6-4b87-aaaa-75fee0f38cca")),
+		Email:        must(email.ParseAddress("alice@example.com")),
+		PasswordHash: must(krypto.ParseArgon2Hash("$argon2id$v=19$m=47104,t=1,p=1$vP9U4C5jsOzFQLj0gvUkYw$YLrSb2dGfcVohlm8syynqHs6/NHxXS9rt/t6TjL7pi0")),
+		Role:         auth.RoleUser,
+		CreatedAt:    now(t, 0),
+		UpdatedAt:    now(t, 0),
+	}
+
+	if modFunc != nil {
+		modFunc(&u)
+	}
+
+	return u
+}
+
+func newEmailToken(t *testing.T, modFunc func(*auth.EmailToken)) auth.EmailToken {
+	t.Helper()
+
+	tok := auth.EmailToken{
+		ID:         must(uuid.Parse("42bf8943-2ffc-43d9-8682-ca8fc4d7cb8e")),
+		TokenHash:  must(krypto.ParseArgon2Hash("$argon2id$v=19$m=47104,t=1,p=1$CkX5zzYLJMWm0y/17eScyw$Qfah+NewdsdeF0+iV72mShZhRO93Qwzdj17TUZCH6ZU")),
+		UserID:     must(uuid.Parse("0e61a06e-bbf6-4b87-aaaa-75fee0f38cca")),
+		Email:      must(email.ParseAddress("alice@example.com")),
+		Purpose:    auth.TokenPurposeActivate,
+		CreatedAt:  now(t, 1),
+		ConsumedAt: nil,
+	}
+
+	if modFunc != nil {
+		modFunc(&tok)
+	}
+
+	return tok
+}
+
+func newAdminAction(t *testing.T, modFunc func(*auth.AdminAction)) auth.AdminAction {
+	t.Helper()
+
+	a := auth.AdminAction{
+		ID:           must(uuid.Parse("42bf8943-2ffc-43d9-8682-ca8fc4d7cb8e")),
+		ActorID:      must(uuid.Parse("0e61a06e-bbf6-4b87-aaaa-75fee0f38cca")),
+		Action:       auth.AdminActionChangeRole,
+		TargetUserID: must(uuid.Parse("597228ee-afde-4991-b13c-0161325e3930")),
+		Detail:       "admin",
+		CreatedAt:    now(t, 1),
+	}
+
+	if modFunc != nil {
+		modFunc(&a)
+	}
+
+	return a
+}
+
+func assertFindUser(t *testing.T, tx auth.Tx, want auth.User) {
+	t.Helper()
+
+	got, err := tx.FindUsers(auth.UserFilter{IDs: []uuid.UUID{want.ID}})
+	if err != nil {
+		t.Fatalf("failed to find user: %v", err)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("expected 1 user, got %d", len(got))
+	}
+
+	if !reflect.DeepEqual(got[0], want) {
+		t.Errorf("got\n%#v\nwant\n%#v\n", got[0], want)
+	}
+}
+
+func assertFindEmailToken(t *testing.T, tx auth.Tx, want auth.EmailToken) {
+	t.Helper()
+
+	got, err := tx.FindEmailTokens(auth.EmailTokenFilter{IDs: []uuid.UUID{want.ID}})
+	if err != nil {
+		t.Fatalf("failed to find email token: %v", err)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("expected 1 email token, got %d", len(got))
+	}
+
+	if !reflect.DeepEqual(got[0], want) {
+		t.Errorf("got\n%#v\nwant\n%#v\n", got[0], want)
+	}
+}
+
+func assertErrorIs(t *testing.T, got, want error) {
+	t.Helper()
+
+	if !errors.Is(got, want) {
+		t.Fatalf("expected errors to be %v got %v (via errors.Is)", want, got)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
@@ -0,0 +1,240 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/auth"
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/errorz"
+)
+
+func (s suite) testRollback(t *testing.T) {
+	t.Run("ok, rollback discards changes", s.withStore(func(t *testing.T, store auth.Store) {
+		tx := beginTx(t, store)
+
+		createUsers(t, tx, newUser(t, nil))
+		createEmailTokens(t, tx, newEmailToken(t, nil))
+
+		err := tx.Rollback()
+		if err != nil {
+			t.Fatalf("failed to rollback tx: %v", err)
+		}
+
+		assertStoreCounts(t, store, 0, 0)
+	}))
+
+	t.Run("ok, rollback after failed statement", s.withStore(func(t *testing.T, store auth.Store) {
+		tx := beginTx(t, store)
+
+		createUsers(t, tx, newUser(t, nil))
+
+		err := tx.CreateUser(newUser(t, nil))
+		assertErrorIs(t, err, errorz.ErrConstraintViolated)
+
+		err = tx.Rollback()
+		if err != nil {
+			t.Fatalf("failed to rollback tx: %v", err)
+		}
+
+		assertStoreCounts(t, store, 0, 0)
+	}))
+
+	t.Run("ok, failed statement does not change data", s.inTx(func(t *testing.T, tx auth.Tx) {
+		user1 := newUser(t, nil)
+		user2 := newUser(t, func(u *auth.User) {
+			u.ID = must(uuid.Parse("597228ee-afde-4991-b13c-0161325e3930"))
+			u.Email = must(email.ParseAddress("jacob@example.com"))
+		})
+		createUsers(t, tx, user1, user2)
+
+		changed := user1
+		changed.Email = user2.Email
+		changed.IsActive = true
+		err := tx.UpdateUser(changed)
+		assertErrorIs(t, err, errorz.ErrConstraintViolated)
+
+		assertFindUser(t, tx, user1)
+	}))
+
+	t.Run("ok, commit makes changes visible", s.withStore(func(t *testing.T, store auth.Store) {
+		tx := beginTx(t, store)
+
+		createUsers(t, tx, newUser(t, nil))
+		createEmailTokens(t, tx, newEmailToken(t, nil))
+
+		err := tx.Commit()
+		if err != nil {
+			t.Fatalf("failed to commit tx: %v", err)
+		}
+
+		assertStoreCounts(t, store, 1, 1)
+
+		// A new transaction should see the changes as well.
+		tx = beginTx(t, store)
+		assertFindUser(t, tx, newUser(t, nil))
+		assertFindEmailToken(t, tx, newEmailToken(t, nil))
+
+		err = tx.Rollback()
+		if err != nil {
+			t.Fatalf("failed to rollback tx: %v", err)
+		}
+	}))
+}
+
+func (s suite) testTxDone(t *testing.T) {
+	t.Run("fail, use after commit", s.withStore(func(t *testing.T, store auth.Store) {
+		tx := beginTx(t, store)
+
+		err := tx.Commit()
+		if err != nil {
+			t.Fatalf("failed to commit tx: %v", err)
+		}
+
+		assertTxDone(t, tx)
+	}))
+
+	t.Run("fail, use after rollback", s.withStore(func(t *testing.T, store auth.Store) {
+		tx := beginTx(t, store)
+
+		err := tx.Rollback()
+		if err != nil {
+			t.Fatalf("failed to rollback tx: %v", err)
+		}
+
+		assertTxDone(t, tx)
+		assertStoreCounts(t, store, 0, 0)
+	}))
+}
+
+func assertTxDone(t *testing.T, tx auth.Tx) {
+	t.Helper()
+
+	if err := tx.CreateUser(newUser(t, nil)); err == nil {
+		t.Errorf("expected an error when creating a user, got nil")
+	}
+
+	if err := tx.Commit(); err == nil {
+		t.Errorf("expected an error when committing, got nil")
+	}
+
+	if err := tx.Rollback(); err == nil {
+		t.Errorf("expected an error when rolling back, got nil")
+	}
+}
+
+func (s suite) testConcurrentTx(t *testing.T) {
+	const n = 10
+
+	t.Run("ok, concurrent transactions", s.withStore(func(t *testing.T, store auth.Store) {
+		var wg sync.WaitGroup
+		errs := make(chan error, n)
+
+		for i := 0; i < n; i++ {
+			user := newUser(t, func(u *auth.User) {
+				u.ID = uuid.New()
+				u.Email = must(email.ParseAddress(fmt.Sprintf("user%d@example.com", i)))
+			})
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- inTxConcurrently(store, func(tx auth.Tx) error {
+					return tx.CreateUser(user)
+				})
+			}()
+		}
+
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Errorf("failed to run transaction: %v", err)
+			}
+		}
+
+		assertStoreCounts(t, store, n, 0)
+	}))
+
+	t.Run("ok, conflicting transactions", s.withStore(func(t *testing.T, store auth.Store) {
+		var wg sync.WaitGroup
+		errs := make(chan error, n)
+
+		for i := 0; i < n; i++ {
+			// All users have the same email, only one of them can be created.
+			user := newUser(t, func(u *auth.User) {
+				u.ID = uuid.New()
+			})
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- inTxConcurrently(store, func(tx auth.Tx) error {
+					return tx.CreateUser(user)
+				})
+			}()
+		}
+
+		wg.Wait()
+		close(errs)
+
+		succeeded := 0
+		for err := range errs {
+			switch {
+			case err == nil:
+				succeeded++
+			case !errors.Is(err, errorz.ErrConstraintViolated):
+				t.Errorf("expected errors to be %v got %v (via errors.Is)", errorz.ErrConstraintViolated, err)
+			}
+		}
+
+		if succeeded != 1 {
+			t.Errorf("expected 1 transaction to succeed, got %d", succeeded)
+		}
+
+		assertStoreCounts(t, store, 1, 0)
+	}))
+}
+
+// inTxConcurrently runs f in a transaction. Unlike inTx, it can be called from
+// other goroutines than the one running the test.
+func inTxConcurrently(store auth.Store, f func(tx auth.Tx) error) error {
+	tx, err := store.BeginTx(context.Background())
+	if err != nil {
+		return err
+	}
+
+	err = f(tx)
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+func assertStoreCounts(t *testing.T, store auth.Store, users, tokens int) {
+	t.Helper()
+
+	gotUsers, err := store.FindUsers(context.Background(), auth.UserFilter{})
+	if err != nil {
+		t.Fatalf("failed to find users: %v", err)
+	}
+
+	if len(gotUsers) != users {
+		t.Errorf("expected %d users, got %d", users, len(gotUsers))
+	}
+
+	gotTokens, err := store.FindEmailTokens(context.Background(), auth.EmailTokenFilter{})
+	if err != nil {
+		t.Fatalf("failed to find email tokens: %v", err)
+	}
+
+	if len(gotTokens) != tokens {
+		t.Errorf("expected %d email tokens, got %d", tokens, len(gotTokens))
+	}
+}
@@ -0,0 +1,346 @@
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/auth"
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/errorz"
+	"github.com/willemschots/househunt/internal/krypto"
+)
+
+func (s suite) testCreateUser(t *testing.T) {
+	t.Run("ok, create user", s.inTx(func(t *testing.T, tx auth.Tx) {
+		user := newUser(t, nil)
+
+		err := tx.CreateUser(user)
+		if err != nil {
+			t.Fatalf("failed to save user: %v", err)
+		}
+
+		assertFindUser(t, tx, user)
+	}))
+
+	t.Run("fail, email constraint violated", s.inTx(func(t *testing.T, tx auth.Tx) {
+		createUsers(t, tx, newUser(t, nil))
+
+		user2 := newUser(t, func(u *auth.User) {
+			u.ID = must(uuid.Parse("597228ee-afde-4991-b13c-0161325e3930"))
+		})
+		err := tx.CreateUser(user2)
+		assertErrorIs(t, err, errorz.ErrConstraintViolated)
+	}))
+
+	t.Run("fail, id constraint violated", s.inTx(func(t *testing.T, tx auth.Tx) {
+		createUsers(t, tx, newUser(t, nil))
+
+		user2 := newUser(t, func(u *auth.User) {
+			u.Email = must(email.ParseAddress("jacob@example.com"))
+		})
+		err := tx.CreateUser(user2)
+		assertErrorIs(t, err, errorz.ErrConstraintViolated)
+	}))
+
+	t.Run("fail, zero ID", s.inTx(func(t *testing.T, tx auth.Tx) {
+		user := newUser(t, func(u *auth.User) {
+			u.ID = uuid.Nil
+		})
+
+		err := tx.CreateUser(user)
+		assertErrorIs(t, err, errorz.ErrConstraintViolated)
+	}))
+}
+
+func (s suite) testUpdateUser(t *testing.T) {
+	setup := func(t *testing.T, tx auth.Tx) auth.User {
+		user := newUser(t, nil)
+		createUsers(t, tx, user)
+		return user
+	}
+
+	t.Run("ok, update user", s.inTx(func(t *testing.T, tx auth.Tx) {
+		user := setup(t, tx)
+
+		// Update all fields that can be modified.
+		user.Email = must(email.ParseAddress("jacob@example.com"))
+		user.PasswordHash = must(krypto.ParseArgon2Hash("$argon2id$v=19$m=47104,t=1,p=1$CkX5zzYLJMWm0y/17eScyw$Qfah+NewdsdeF0+iV72mShZhRO93Qwzdj17TUZCH6ZU"))
+		user.IsActive = true
+		user.Role = auth.RoleAdmin
+		user.DeactivatedAt = ptr(now(t, 3))
+		user.CreatedAt = now(t, 1)
+		user.UpdatedAt = now(t, 2)
+
+		err := tx.UpdateUser(user)
+		if err != nil {
+			t.Fatalf("failed to save user: %v", err)
+		}
+
+		assertFindUser(t, tx, user)
+	}))
+
+	t.Run("fail, not found", s.inTx(func(t *testing.T, tx auth.Tx) {
+		setup(t, tx)
+
+		user2 := newUser(t, func(u *auth.User) {
+			u.ID = must(uuid.Parse("597228ee-afde-4991-b13c-0161325e3930"))
+		})
+
+		err := tx.UpdateUser(user2)
+		assertErrorIs(t, err, errorz.ErrNotFound)
+	}))
+
+	t.Run("fail, change email to an existing email", s.inTx(func(t *testing.T, tx auth.Tx) {
+		user1 := setup(t, tx)
+
+		user2 := newUser(t, func(u *auth.User) {
+			u.ID = must(uuid.Parse("597228ee-afde-4991-b13c-0161325e3930"))
+			u.Email = must(email.ParseAddress("jacob@example.com"))
+		})
+		createUsers(t, tx, user2)
+
+		// Attempt to change user1's email to user2's email.
+		user1.Email = user2.Email
+		err := tx.UpdateUser(user1)
+		assertErrorIs(t, err, errorz.ErrConstraintViolated)
+	}))
+}
+
+// testUsers returns the users that are used to test the user filters.
+func testUsers(t *testing.T) []auth.User {
+	return []auth.User{
+		newUser(t, nil),
+		newUser(t, func(u *auth.User) {
+			u.ID = must(uuid.Parse("597228ee-afde-4991-b13c-0161325e3930"))
+			u.Email = must(email.ParseAddress("jacob@example.com"))
+			u.IsActive = true
+		}),
+		newUser(t, func(u *auth.User) {
+			u.ID = must(uuid.Parse("d622d0b0-465c-4c4d-b084-028c9787e1de"))
+			u.Email = must(email.ParseAddress("eva@example.com"))
+		}),
+	}
+}
+
+func (s suite) testFindUsers(t *testing.T) {
+	tests := map[string]struct {
+		filter   auth.UserFilter
+		wantFunc func([]auth.User) []auth.User
+	}{
+		"ok, all users, empty slices": {
+			filter: auth.UserFilter{
+				IDs:      []uuid.UUID{},
+				Emails:   []email.Address{},
+				IsActive: nil,
+			},
+			wantFunc: func(users []auth.User) []auth.User {
+				return users
+			},
+		},
+		"ok, active users": {
+			filter: auth.UserFilter{
+				IsActive: ptr(true),
+			},
+			wantFunc: func(users []auth.User) []auth.User {
+				return users[1:2]
+			},
+		},
+		"ok, one by id": {
+			filter: auth.UserFilter{
+				IDs: []uuid.UUID{must(uuid.Parse("597228ee-afde-4991-b13c-0161325e3930"))},
+			},
+			wantFunc: func(users []auth.User) []auth.User {
+				return []auth.User{users[1]}
+			},
+		},
+		"ok, several by id": {
+			filter: auth.UserFilter{
+				IDs: []uuid.UUID{
+					must(uuid.Parse("0e61a06e-bbf6-4b87-aaaa-75fee0f38cca")),
+					must(uuid.Parse("d622d0b0-465c-4c4d-b084-028c9787e1de")),
+				},
+			},
+			wantFunc: func(users []auth.User) []auth.User {
+				return []auth.User{
+					users[0], users[2],
+				}
+			},
+		},
+		"ok, one by email": {
+			filter: auth.UserFilter{
+				Emails: []email.Address{
+					must(email.ParseAddress("jacob@example.com")),
+				},
+			},
+			wantFunc: func(users []auth.User) []auth.User {
+				return []auth.User{users[1]}
+			},
+		},
+		"ok, several by email": {
+			filter: auth.UserFilter{
+				Emails: []email.Address{
+					must(email.ParseAddress("jacob@example.com")),
+					must(email.ParseAddress("eva@example.com")),
+				},
+			},
+			wantFunc: func(users []auth.User) []auth.User {
+				return []auth.User{
+					users[1], users[2],
+				}
+			},
+		},
+		"ok, combine filters": {
+			filter: auth.UserFilter{
+				IDs: []uuid.UUID{
+					must(uuid.Parse("0e61a06e-bbf6-4b87-aaaa-75fee0f38cca")),
+					must(uuid.Parse("d622d0b0-465c-4c4d-b084-028c9787e1de")),
+				},
+				Emails: []email.Address{
+					must(email.ParseAddress("alice@example.com")),
+				},
+				IsActive: ptr(false),
+			},
+			wantFunc: func(users []auth.User) []auth.User {
+				return users[0:1]
+			},
+		},
+		"ok, no results": {
+			filter: auth.UserFilter{
+				IDs: []uuid.UUID{uuid.Nil},
+			},
+			wantFunc: func(users []auth.User) []auth.User {
+				return []auth.User{}
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, s.withStore(func(t *testing.T, store auth.Store) {
+			tx := beginTx(t, store)
+
+			users := testUsers(t)
+			createUsers(t, tx, users...)
+			want := tc.wantFunc(users)
+
+			// first check if FindUsers works on the tx
+			got, err := tx.FindUsers(tc.filter)
+			if err != nil {
+				t.Fatalf("failed to find users: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got\n%#v\nwant\n%#v\n", got, want)
+			}
+
+			err = tx.Commit()
+			if err != nil {
+				t.Fatalf("failed to commit tx: %v", err)
+			}
+
+			// then, check if FindUsers works on the store itself.
+			got, err = store.FindUsers(context.Background(), tc.filter)
+			if err != nil {
+				t.Fatalf("failed to find users: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got\n%#v\nwant\n%#v\n", got, want)
+			}
+		}))
+	}
+}
+
+// testFindUsersCombinations tests every combination of the fields of the filter,
+// the expected users are determined by matchUser.
+func (s suite) testFindUsersCombinations(t *testing.T) {
+	ids := []option[[]uuid.UUID]{
+		{"none", nil},
+		{"empty", []uuid.UUID{}},
+		{"one", []uuid.UUID{must(uuid.Parse("597228ee-afde-4991-b13c-0161325e3930"))}},
+		{"several", []uuid.UUID{
+			must(uuid.Parse("0e61a06e-bbf6-4b87-aaaa-75fee0f38cca")),
+			must(uuid.Parse("d622d0b0-465c-4c4d-b084-028c9787e1de")),
+		}},
+		{"unknown", []uuid.UUID{uuid.Nil}},
+	}
+
+	emails := []option[[]email.Address]{
+		{"none", nil},
+		{"empty", []email.Address{}},
+		{"one", []email.Address{must(email.ParseAddress("alice@example.com"))}},
+		{"several", []email.Address{
+			must(email.ParseAddress("jacob@example.com")),
+			must(email.ParseAddress("eva@example.com")),
+		}},
+		{"unknown", []email.Address{must(email.ParseAddress("unknown@example.com"))}},
+	}
+
+	isActive := []option[*bool]{
+		{"none", nil},
+		{"true", ptr(true)},
+		{"false", ptr(false)},
+	}
+
+	store := s.newStore(t)
+	users := testUsers(t)
+
+	tx := beginTx(t, store)
+	createUsers(t, tx, users...)
+	err := tx.Commit()
+	if err != nil {
+		t.Fatalf("failed to commit tx: %v", err)
+	}
+
+	for _, id := range ids {
+		for _, em := range emails {
+			for _, active := range isActive {
+				filter := auth.UserFilter{
+					IDs:      id.value,
+					Emails:   em.value,
+					IsActive: active.value,
+				}
+
+				name := fmt.Sprintf("IDs=%s,Emails=%s,IsActive=%s", id.name, em.name, active.name)
+				t.Run(name, func(t *testing.T) {
+					want := make([]auth.User, 0)
+					for _, u := range users {
+						if matchUser(u, filter) {
+							want = append(want, u)
+						}
+					}
+
+					got, err := store.FindUsers(context.Background(), filter)
+					if err != nil {
+						t.Fatalf("failed to find users: %v", err)
+					}
+
+					if !reflect.DeepEqual(got, want) {
+						t.Errorf("got\n%#v\nwant\n%#v\n", got, want)
+					}
+				})
+			}
+		}
+	}
+}
+
+// option is a named value of a filter field.
+type option[T any] struct {
+	name  string
+	value T
+}
+
+func matchUser(u auth.User, f auth.UserFilter) bool {
+	if len(f.IDs) > 0 && !slices.Contains(f.IDs, u.ID) {
+		return false
+	}
+
+	if len(f.Emails) > 0 && !slices.Contains(f.Emails, u.Email) {
+		return false
+	}
+
+	return f.IsActive == nil || *f.IsActive == u.IsActive
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"time"
 
 	"github.com/willemschots/househunt/internal/email"
@@ -9,14 +10,52 @@ import (
 	"github.com/google/uuid"
 )
 
+var ErrInvalidRole = errors.New("invalid role")
+
+// Role determines what a user is allowed to do.
+type Role string
+
+const (
+	// RoleUser is the role of regular users.
+	RoleUser Role = "user"
+	// RoleAdmin gives access to the admin back-office.
+	RoleAdmin Role = "admin"
+)
+
+// ParseRole parses raw as a Role.
+func ParseRole(raw string) (Role, error) {
+	switch r := Role(raw); r {
+	case RoleUser, RoleAdmin:
+		return r, nil
+	default:
+		return "", ErrInvalidRole
+	}
+}
+
+func (r *Role) UnmarshalText(text []byte) error {
+	role, err := ParseRole(string(text))
+	if err != nil {
+		return err
+	}
+
+	*r = role
+
+	return nil
+}
+
 // User contains the data for a user.
+// The db tags are used to generate the queries, see cmd/querygen.
 type User struct {
-	ID           uuid.UUID
-	Email        email.Address
-	PasswordHash krypto.Argon2Hash
-	IsActive     bool
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	ID           uuid.UUID         `db:"id,pk"`
+	Email        email.Address     `db:"email_encrypted,encrypted,blindindex=email_blind_index"`
+	PasswordHash krypto.Argon2Hash `db:"password_hash,stringer"`
+	IsActive     bool              `db:"is_active"`
+	Role         Role              `db:"role"`
+	// DeactivatedAt is set when an admin deactivated the user. Deactivated
+	// users can't (re-)activate themselves.
+	DeactivatedAt *time.Time `db:"deactivated_at"`
+	CreatedAt     time.Time  `db:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at"`
 }
 
 // Credentials are used to authenticate users.
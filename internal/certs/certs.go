@@ -0,0 +1,161 @@
+// Package certs provides TLS certificates for serving HTTPS.
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/willemschots/househunt/internal/fswatch"
+)
+
+// Reloader loads a certificate and key pair from files, and reloads them when
+// the files change. This way renewed certificates are picked up without
+// restarting the server.
+type Reloader struct {
+	certPath string
+	keyPath  string
+	errFunc  func(error)
+
+	mu   *sync.RWMutex
+	cert *tls.Certificate
+
+	watchers []*fswatch.Watcher
+}
+
+// NewReloader loads the certificate and key pair from the PEM encoded files at
+// certPath and keyPath. The directories of both files are checked for changes
+// every interval. If reloading fails, errFunc is called and the previously
+// loaded pair is kept. Call Close to stop watching.
+func NewReloader(certPath, keyPath string, interval time.Duration, errFunc func(error)) (*Reloader, error) {
+	r := &Reloader{
+		certPath: certPath,
+		keyPath:  keyPath,
+		errFunc:  errFunc,
+		mu:       &sync.RWMutex{},
+	}
+
+	err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := []string{filepath.Dir(certPath)}
+	if keyDir := filepath.Dir(keyPath); keyDir != dirs[0] {
+		dirs = append(dirs, keyDir)
+	}
+
+	for _, dir := range dirs {
+		w, err := fswatch.Watch(os.DirFS(dir), interval, r.reload)
+		if err != nil {
+			_ = r.Close()
+			return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+
+		r.watchers = append(r.watchers, w)
+	}
+
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, it can be used as
+// tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// Close stops watching the files.
+func (r *Reloader) Close() error {
+	for _, w := range r.watchers {
+		_ = w.Close()
+	}
+
+	return nil
+}
+
+func (r *Reloader) reload() {
+	err := r.load()
+	if err != nil {
+		r.errFunc(err)
+	}
+}
+
+func (r *Reloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+
+	return nil
+}
+
+// SelfSigned generates a self-signed certificate for hosts that is valid
+// for the given duration. Hosts can be both names and IP addresses. The
+// certificate and key are returned PEM encoded.
+//
+// Browsers don't trust self-signed certificates, they're meant for local
+// development and testing.
+func SelfSigned(hosts []string, validFor time.Duration) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Househunt self-signed"}},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,165 @@
+package certs_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/willemschots/househunt/internal/certs"
+)
+
+func TestSelfSigned(t *testing.T) {
+	t.Run("ok, certificate is valid for hosts", func(t *testing.T) {
+		certPEM, keyPEM, err := certs.SelfSigned([]string{"localhost", "127.0.0.1"}, time.Hour)
+		if err != nil {
+			t.Fatalf("failed to generate certificate: %v", err)
+		}
+
+		pair, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatalf("failed to parse key pair: %v", err)
+		}
+
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			t.Fatalf("failed to parse certificate: %v", err)
+		}
+
+		for _, host := range []string{"localhost", "127.0.0.1"} {
+			err = cert.VerifyHostname(host)
+			if err != nil {
+				t.Errorf("expected certificate to be valid for %s: %v", host, err)
+			}
+		}
+
+		if time.Until(cert.NotAfter) > time.Hour {
+			t.Errorf("expected certificate to expire within an hour, expires at %v", cert.NotAfter)
+		}
+	})
+}
+
+func TestReloader(t *testing.T) {
+	t.Run("ok, certificate is reloaded when files change", func(t *testing.T) {
+		dir := t.TempDir()
+		certPath := filepath.Join(dir, "cert.pem")
+		keyPath := filepath.Join(dir, "key.pem")
+
+		first := writePair(t, certPath, keyPath, time.Now().Add(-time.Hour))
+
+		errs := make(chan error, 10)
+		r, err := certs.NewReloader(certPath, keyPath, 5*time.Millisecond, func(err error) {
+			errs <- err
+		})
+		if err != nil {
+			t.Fatalf("failed to create reloader: %v", err)
+		}
+		defer r.Close()
+
+		assertCertificate(t, r, first)
+
+		second := writePair(t, certPath, keyPath, time.Now())
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			got, err := r.GetCertificate(nil)
+			if err != nil {
+				t.Fatalf("failed to get certificate: %v", err)
+			}
+
+			if string(got.Certificate[0]) == string(second.Certificate[0]) {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatalf("expected certificate to be reloaded")
+			}
+
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+
+	t.Run("ok, previous certificate is kept if reloading fails", func(t *testing.T) {
+		dir := t.TempDir()
+		certPath := filepath.Join(dir, "cert.pem")
+		keyPath := filepath.Join(dir, "key.pem")
+
+		first := writePair(t, certPath, keyPath, time.Now().Add(-time.Hour))
+
+		errs := make(chan error, 10)
+		r, err := certs.NewReloader(certPath, keyPath, 5*time.Millisecond, func(err error) {
+			errs <- err
+		})
+		if err != nil {
+			t.Fatalf("failed to create reloader: %v", err)
+		}
+		defer r.Close()
+
+		err = os.WriteFile(certPath, []byte("invalid"), 0o600)
+		if err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+
+		select {
+		case <-errs:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected reload error to be reported")
+		}
+
+		assertCertificate(t, r, first)
+	})
+
+	t.Run("fail, files don't exist", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := certs.NewReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), time.Hour, func(error) {})
+		if err == nil {
+			t.Fatalf("expected error, got <nil>")
+		}
+	})
+}
+
+// writePair writes a new self-signed certificate and key to the paths, the
+// modification time is set so that changes are noticed on file systems with a
+// coarse resolution.
+func writePair(t *testing.T, certPath, keyPath string, modTime time.Time) tls.Certificate {
+	t.Helper()
+
+	certPEM, keyPEM, err := certs.SelfSigned([]string{"localhost"}, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to generate certificate: %v", err)
+	}
+
+	for path, data := range map[string][]byte{certPath: certPEM, keyPath: keyPEM} {
+		err = os.WriteFile(path, data, 0o600)
+		if err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+
+		err = os.Chtimes(path, modTime, modTime)
+		if err != nil {
+			t.Fatalf("failed to change times: %v", err)
+		}
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("failed to parse key pair: %v", err)
+	}
+
+	return pair
+}
+
+func assertCertificate(t *testing.T, r *certs.Reloader, want tls.Certificate) {
+	t.Helper()
+
+	got, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("failed to get certificate: %v", err)
+	}
+
+	if string(got.Certificate[0]) != string(want.Certificate[0]) {
+		t.Errorf("got a different certificate than expected")
+	}
+}
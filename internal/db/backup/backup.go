@@ -0,0 +1,240 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	filePrefix     = "backup-"
+	fileSuffix     = ".sqlite.gz"
+	checksumSuffix = ".sha256"
+	// timeLayout has millisecond precision, so backups taken in quick
+	// succession don't overwrite each other.
+	timeLayout = "20060102T150405.000Z"
+)
+
+var (
+	// ErrChecksumMismatch indicates the contents of a backup don't match its checksum.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// Backup is a compressed snapshot of a database.
+type Backup struct {
+	Path      string
+	CreatedAt time.Time
+	// Size is the size of the compressed backup in bytes.
+	Size int64
+	// Checksum is the hex encoded SHA-256 checksum of the compressed backup.
+	Checksum string
+}
+
+// Create takes a consistent snapshot of db and stores it compressed in dir, next to a file
+// with its checksum. The snapshot is taken with VACUUM INTO, which only needs a read
+// transaction, so other connections can keep writing while the backup is taken.
+func Create(ctx context.Context, db *sql.DB, dir string, now time.Time) (Backup, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return Backup{}, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	now = now.UTC()
+	name := filePrefix + now.Format(timeLayout) + fileSuffix
+
+	// VACUUM INTO refuses to overwrite files, so remove leftovers of an earlier failed attempt.
+	snapshot := filepath.Join(dir, "."+name+".snapshot")
+	err = removeIfExists(snapshot)
+	if err != nil {
+		return Backup{}, err
+	}
+	defer os.Remove(snapshot)
+
+	_, err = db.ExecContext(ctx, "VACUUM INTO ?", snapshot)
+	if err != nil {
+		return Backup{}, fmt.Errorf("failed to snapshot database: %w", err)
+	}
+
+	b := Backup{
+		Path:      filepath.Join(dir, name),
+		CreatedAt: now,
+	}
+
+	// Write to a temporary file first, so a backup that exists is always complete.
+	partial := b.Path + ".partial"
+	b.Size, b.Checksum, err = compress(snapshot, partial)
+	if err != nil {
+		return Backup{}, errors.Join(err, removeIfExists(partial))
+	}
+
+	// Use the sha256sum format, so backups can also be verified with standard tools.
+	line := fmt.Sprintf("%s  %s\n", b.Checksum, name)
+	err = os.WriteFile(b.Path+checksumSuffix, []byte(line), 0o600)
+	if err != nil {
+		return Backup{}, errors.Join(fmt.Errorf("failed to write checksum: %w", err), removeIfExists(partial))
+	}
+
+	err = os.Rename(partial, b.Path)
+	if err != nil {
+		return Backup{}, fmt.Errorf("failed to rename backup: %w", err)
+	}
+
+	return b, nil
+}
+
+// compress gzips src into dst and returns the size and checksum of dst.
+func compress(src, dst string) (int64, string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create backup: %w", err)
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	gw := gzip.NewWriter(io.MultiWriter(out, hash, counter))
+
+	_, err = io.Copy(gw, in)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to compress snapshot: %w", err)
+	}
+
+	err = gw.Close()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to compress snapshot: %w", err)
+	}
+
+	err = out.Sync()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to sync backup: %w", err)
+	}
+
+	return counter.n, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// List returns all backups in dir, newest first.
+func List(dir string) ([]Backup, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	backups := make([]Backup, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+
+		createdAt, err := time.Parse(timeLayout, strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix))
+		if err != nil {
+			// Not one of our backups.
+			continue
+		}
+
+		// Backups that disappear while listing are being pruned.
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat backup %s: %w", name, err)
+		}
+
+		path := filepath.Join(dir, name)
+		checksum, err := readChecksum(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		backups = append(backups, Backup{
+			Path:      path,
+			CreatedAt: createdAt,
+			Size:      info.Size(),
+			Checksum:  checksum,
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+
+	return backups, nil
+}
+
+// Verify checks that the backup at path matches its checksum.
+func Verify(path string) error {
+	want, err := readChecksum(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	got := hex.EncodeToString(hash.Sum(nil))
+	if got != want {
+		return fmt.Errorf("backup %s has checksum %s, want %s: %w", filepath.Base(path), got, want, ErrChecksumMismatch)
+	}
+
+	return nil
+}
+
+func readChecksum(path string) (string, error) {
+	data, err := os.ReadFile(path + checksumSuffix)
+	if err != nil {
+		return "", fmt.Errorf("failed to read checksum: %w", err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("checksum file of %s is empty", filepath.Base(path))
+	}
+
+	return fields[0], nil
+}
+
+func removeIfExists(path string) error {
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
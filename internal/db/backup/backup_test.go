@@ -0,0 +1,350 @@
+package backup_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/db/backup"
+	"github.com/willemschots/househunt/internal/db/migrate"
+	"github.com/willemschots/househunt/internal/db/testdb"
+	"github.com/willemschots/househunt/migrations"
+)
+
+var testTime = time.Date(2024, 3, 20, 14, 56, 0, 0, time.UTC)
+
+func Test_Create(t *testing.T) {
+	t.Run("ok, create, list and verify", func(t *testing.T) {
+		sqlDB := testdb.RunWhile(t, true)
+		dir := filepath.Join(t.TempDir(), "backups")
+
+		b, err := backup.Create(context.Background(), sqlDB, dir, testTime)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if b.Path != filepath.Join(dir, "backup-20240320T145600.000Z.sqlite.gz") {
+			t.Errorf("unexpected path %s", b.Path)
+		}
+
+		if b.Size == 0 || len(b.Checksum) != 64 {
+			t.Errorf("unexpected size %d or checksum %q", b.Size, b.Checksum)
+		}
+
+		backups, err := backup.List(dir)
+		if err != nil {
+			t.Fatalf("unexpected error listing: %v", err)
+		}
+
+		if len(backups) != 1 || backups[0] != b {
+			t.Errorf("got backups %+v, want [%+v]", backups, b)
+		}
+
+		err = backup.Verify(b.Path)
+		if err != nil {
+			t.Errorf("unexpected error verifying: %v", err)
+		}
+
+		// Only the backup and its checksum should remain.
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("unexpected error reading dir: %v", err)
+		}
+
+		if len(entries) != 2 {
+			t.Errorf("expected 2 files, got %v", entries)
+		}
+	})
+
+	t.Run("fail, tampered backup", func(t *testing.T) {
+		sqlDB := testdb.RunWhile(t, true)
+		dir := t.TempDir()
+
+		b, err := backup.Create(context.Background(), sqlDB, dir, testTime)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		f, err := os.OpenFile(b.Path, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatalf("unexpected error opening backup: %v", err)
+		}
+		_, err = f.Write([]byte("tampered"))
+		if err != nil {
+			t.Fatalf("unexpected error writing backup: %v", err)
+		}
+		f.Close()
+
+		err = backup.Verify(b.Path)
+		if !errors.Is(err, backup.ErrChecksumMismatch) {
+			t.Errorf("got %v, want %v (via errors.Is)", err, backup.ErrChecksumMismatch)
+		}
+	})
+}
+
+func Test_Prune(t *testing.T) {
+	tests := map[string]struct {
+		policy backup.RetentionPolicy
+		// ages of the backups, relative to testTime.
+		ages        []time.Duration
+		wantDeleted int
+	}{
+		"ok, no policy keeps everything": {
+			policy:      backup.RetentionPolicy{},
+			ages:        []time.Duration{0, time.Hour, 48 * time.Hour},
+			wantDeleted: 0,
+		},
+		"ok, keep last": {
+			policy:      backup.RetentionPolicy{KeepLast: 2},
+			ages:        []time.Duration{0, time.Hour, 2 * time.Hour, 3 * time.Hour},
+			wantDeleted: 2,
+		},
+		"ok, max age": {
+			policy:      backup.RetentionPolicy{MaxAge: 24 * time.Hour},
+			ages:        []time.Duration{0, time.Hour, 25 * time.Hour, 48 * time.Hour},
+			wantDeleted: 2,
+		},
+		"ok, newest is always kept": {
+			policy:      backup.RetentionPolicy{MaxAge: time.Hour},
+			ages:        []time.Duration{48 * time.Hour, 72 * time.Hour},
+			wantDeleted: 1,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sqlDB := testdb.RunWhile(t, true)
+			dir := t.TempDir()
+
+			for _, age := range tc.ages {
+				_, err := backup.Create(context.Background(), sqlDB, dir, testTime.Add(-age))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			deleted, err := backup.Prune(dir, tc.policy, testTime)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(deleted) != tc.wantDeleted {
+				t.Fatalf("deleted %d backups, want %d", len(deleted), tc.wantDeleted)
+			}
+
+			remaining, err := backup.List(dir)
+			if err != nil {
+				t.Fatalf("unexpected error listing: %v", err)
+			}
+
+			if len(remaining) != len(tc.ages)-tc.wantDeleted {
+				t.Fatalf("got %d remaining backups, want %d", len(remaining), len(tc.ages)-tc.wantDeleted)
+			}
+
+			// the oldest backups should be deleted.
+			for _, d := range deleted {
+				if !d.CreatedAt.Before(remaining[len(remaining)-1].CreatedAt) {
+					t.Errorf("deleted backup %s is newer than a remaining one", d.Path)
+				}
+
+				if _, err := os.Stat(d.Path + ".sha256"); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("expected checksum of %s to be deleted", d.Path)
+				}
+			}
+		})
+	}
+}
+
+func Test_Restore(t *testing.T) {
+	t.Run("ok, restore replaces existing database", func(t *testing.T) {
+		src := testdb.RunWhile(t, true)
+		_, err := src.Exec("CREATE TABLE restore_test (v TEXT); INSERT INTO restore_test VALUES ('restored')")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		b, err := backup.Create(context.Background(), src, t.TempDir(), testTime)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		dbFile := filepath.Join(t.TempDir(), "househunt.db")
+		err = os.WriteFile(dbFile, []byte("current"), 0o600)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		previous, err := backup.Restore(context.Background(), b.Path, dbFile, migrations.SQLite(migrations.Deps{}), testTime)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		data, err := os.ReadFile(previous)
+		if err != nil || string(data) != "current" {
+			t.Errorf("expected previous database at %s, got %q (%v)", previous, data, err)
+		}
+
+		restored := openForTest(t, dbFile)
+
+		var got string
+		err = restored.QueryRow("SELECT v FROM restore_test").Scan(&got)
+		if err != nil || got != "restored" {
+			t.Errorf("got %q (%v), want restored row", got, err)
+		}
+
+		err = migrate.CheckFS(context.Background(), restored, migrations.SQLite(migrations.Deps{}))
+		if err != nil {
+			t.Errorf("unexpected error checking migrations: %v", err)
+		}
+	})
+
+	t.Run("ok, restore without existing database", func(t *testing.T) {
+		b, err := backup.Create(context.Background(), testdb.RunWhile(t, true), t.TempDir(), testTime)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		dbFile := filepath.Join(t.TempDir(), "househunt.db")
+
+		previous, err := backup.Restore(context.Background(), b.Path, dbFile, migrations.SQLite(migrations.Deps{}), testTime)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if previous != "" {
+			t.Errorf("expected no previous database, got %s", previous)
+		}
+
+		if _, err := os.Stat(dbFile); err != nil {
+			t.Errorf("expected restored database: %v", err)
+		}
+	})
+
+	t.Run("fail, migrations don't match", func(t *testing.T) {
+		src := testdb.RunUnmigratedWhile(t, true)
+		_, err := migrate.RunFS(context.Background(), src, fstest.MapFS{
+			"0001_unknown.sql": {Data: []byte("CREATE TABLE unknown (v TEXT);")},
+		}, migrate.Metadata{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		b, err := backup.Create(context.Background(), src, t.TempDir(), testTime)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		dbFile := filepath.Join(t.TempDir(), "househunt.db")
+		err = os.WriteFile(dbFile, []byte("current"), 0o600)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, err = backup.Restore(context.Background(), b.Path, dbFile, migrations.SQLite(migrations.Deps{}), testTime)
+		if !errors.Is(err, migrate.ErrMigrationsMismatch) {
+			t.Fatalf("got %v, want %v (via errors.Is)", err, migrate.ErrMigrationsMismatch)
+		}
+
+		assertOnlyFile(t, dbFile, "current")
+	})
+
+	t.Run("fail, database in use", func(t *testing.T) {
+		b, err := backup.Create(context.Background(), testdb.RunWhile(t, true), t.TempDir(), testTime)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		dbFile := filepath.Join(t.TempDir(), "househunt.db")
+		for _, f := range []string{dbFile, dbFile + "-wal"} {
+			err = os.WriteFile(f, []byte("current"), 0o600)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		_, err = backup.Restore(context.Background(), b.Path, dbFile, migrations.SQLite(migrations.Deps{}), testTime)
+		if !errors.Is(err, backup.ErrDatabaseInUse) {
+			t.Fatalf("got %v, want %v (via errors.Is)", err, backup.ErrDatabaseInUse)
+		}
+	})
+}
+
+func openForTest(t *testing.T, file string) *sql.DB {
+	t.Helper()
+
+	sqlDB, err := db.OpenSQLite(file, false)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		sqlDB.Close()
+	})
+
+	return sqlDB
+}
+
+// assertOnlyFile checks that file has the wanted content and no other files were left behind.
+func assertOnlyFile(t *testing.T, file, want string) {
+	t.Helper()
+
+	data, err := os.ReadFile(file)
+	if err != nil || string(data) != want {
+		t.Errorf("got %q (%v), want %q", data, err, want)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(file))
+	if err != nil {
+		t.Fatalf("unexpected error reading dir: %v", err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("expected only %s, got %v", filepath.Base(file), entries)
+	}
+}
+
+func Test_Scheduler(t *testing.T) {
+	t.Run("ok, takes backups until shut down", func(t *testing.T) {
+		sqlDB := testdb.RunWhile(t, true)
+		dir := filepath.Join(t.TempDir(), "backups")
+
+		created := make(chan backup.Backup, 10)
+		s := backup.NewScheduler(sqlDB, backup.ScheduleConfig{Dir: dir, Interval: 10 * time.Millisecond}, func(b backup.Backup) {
+			created <- b
+		}, func(err error) {
+			t.Errorf("unexpected error: %v", err)
+		})
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.Run(context.Background())
+		}()
+
+		select {
+		case <-created:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no backup was created")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := s.Shutdown(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			t.Fatalf("scheduler did not stop after shutdown")
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/db/migrate"
+)
+
+// ErrDatabaseInUse indicates the database that is to be replaced is still in use.
+var ErrDatabaseInUse = errors.New("database is in use")
+
+// Restore replaces the database at dbFile with the backup at path, the database must not be
+// in use. Before anything is replaced, the backup is verified against its checksum, and its
+// migrations table is checked against migrationsFS. A backup may be missing migrations (they
+// run on the next start of the server), but it can't have migrations that are unknown.
+//
+// The replaced database is kept next to dbFile, its path is returned. If there was no
+// database to replace, an empty path is returned.
+func Restore(ctx context.Context, path, dbFile string, migrationsFS fs.FS, now time.Time) (string, error) {
+	err := Verify(path)
+	if err != nil {
+		return "", err
+	}
+
+	// SQLite removes the WAL files when the last connection closes, if they
+	// exist the database is either still open or was not closed cleanly.
+	for _, suffix := range []string{"-wal", "-shm"} {
+		inUse, err := exists(dbFile + suffix)
+		if err != nil {
+			return "", err
+		}
+		if inUse {
+			return "", fmt.Errorf("found %s%s, stop the server before restoring: %w", filepath.Base(dbFile), suffix, ErrDatabaseInUse)
+		}
+	}
+
+	restored := dbFile + ".restore"
+	err = decompress(path, restored)
+	if err != nil {
+		return "", errors.Join(err, removeIfExists(restored))
+	}
+
+	err = check(ctx, restored, migrationsFS)
+	if err != nil {
+		return "", errors.Join(err, removeIfExists(restored))
+	}
+
+	var previous string
+	ok, err := exists(dbFile)
+	if err != nil {
+		return "", err
+	}
+
+	if ok {
+		previous = dbFile + ".pre-restore-" + now.UTC().Format(timeLayout)
+		err = os.Rename(dbFile, previous)
+		if err != nil {
+			return "", fmt.Errorf("failed to move current database: %w", err)
+		}
+	}
+
+	err = os.Rename(restored, dbFile)
+	if err != nil {
+		return previous, fmt.Errorf("failed to move restored database: %w", err)
+	}
+
+	return previous, nil
+}
+
+func decompress(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer in.Close()
+
+	gr, err := gzip.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("failed to decompress backup: %w", err)
+	}
+	defer gr.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, gr)
+	if err != nil {
+		return fmt.Errorf("failed to decompress backup: %w", err)
+	}
+
+	return out.Sync()
+}
+
+// check checks the integrity and the migrations of the database in dbFile.
+func check(ctx context.Context, dbFile string, migrationsFS fs.FS) (err error) {
+	sqlDB, err := db.OpenSQLite(dbFile, true)
+	if err != nil {
+		return fmt.Errorf("failed to open restored database: %w", err)
+	}
+	defer func() {
+		err = errors.Join(err, sqlDB.Close())
+	}()
+
+	var result string
+	err = sqlDB.QueryRowContext(ctx, "PRAGMA integrity_check").Scan(&result)
+	if err != nil {
+		return fmt.Errorf("failed to check integrity: %w", err)
+	}
+
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+
+	err = migrate.CheckFS(ctx, sqlDB, migrationsFS)
+	if err != nil && !errors.Is(err, migrate.ErrPending) {
+		return fmt.Errorf("backup does not match the migrations of this binary: %w", err)
+	}
+
+	return nil
+}
+
+func exists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,152 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RetentionPolicy decides which backups are kept. The newest backup is always kept.
+type RetentionPolicy struct {
+	// KeepLast is the max number of backups to keep. If 0, there is no max.
+	KeepLast int
+	// MaxAge is the max age of a backup before it's deleted. If 0, there is no max.
+	MaxAge time.Duration
+}
+
+// Prune deletes the backups in dir that should not be kept according to the
+// policy. It returns the deleted backups.
+func Prune(dir string, policy RetentionPolicy, now time.Time) ([]Backup, error) {
+	backups, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := make([]Backup, 0)
+	for i, b := range backups {
+		// Backups are sorted newest first.
+		if i == 0 {
+			continue
+		}
+
+		tooMany := policy.KeepLast > 0 && i >= policy.KeepLast
+		tooOld := policy.MaxAge > 0 && now.Sub(b.CreatedAt) > policy.MaxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+
+		err = errors.Join(removeIfExists(b.Path), removeIfExists(b.Path+checksumSuffix))
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete backup: %w", err)
+		}
+
+		deleted = append(deleted, b)
+	}
+
+	return deleted, nil
+}
+
+// ScheduleConfig configures scheduled backups.
+type ScheduleConfig struct {
+	// Dir is the directory backups are stored in.
+	Dir string
+	// Interval is the time between two backups.
+	Interval  time.Duration
+	Retention RetentionPolicy
+}
+
+// Scheduler takes backups on a schedule.
+type Scheduler struct {
+	db       *sql.DB
+	cfg      ScheduleConfig
+	doneFunc func(Backup)
+	errFunc  func(error)
+
+	mu      *sync.Mutex
+	closed  bool
+	stop    chan struct{}
+	running *sync.WaitGroup
+}
+
+// NewScheduler creates a new Scheduler that backs up db. Every backup is passed
+// to doneFunc, errors are passed to errFunc.
+func NewScheduler(db *sql.DB, cfg ScheduleConfig, doneFunc func(Backup), errFunc func(error)) *Scheduler {
+	return &Scheduler{
+		db:       db,
+		cfg:      cfg,
+		doneFunc: doneFunc,
+		errFunc:  errFunc,
+		mu:       &sync.Mutex{},
+		stop:     make(chan struct{}),
+		running:  &sync.WaitGroup{},
+	}
+}
+
+// Run takes a backup and prunes old backups on every interval until ctx is
+// cancelled or the scheduler is shut down. A failed backup is retried on the
+// next interval.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.running.Add(1)
+	s.mu.Unlock()
+
+	defer s.running.Done()
+
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		b, err := Create(ctx, s.db, s.cfg.Dir, now)
+		if err != nil {
+			s.errFunc(fmt.Errorf("failed to create backup: %w", err))
+			continue
+		}
+
+		s.doneFunc(b)
+
+		_, err = Prune(s.cfg.Dir, s.cfg.Retention, now)
+		if err != nil {
+			s.errFunc(fmt.Errorf("failed to prune backups: %w", err))
+		}
+	}
+}
+
+// Shutdown stops Run and waits for a backup in progress to finish. If ctx is
+// done before that, an error is returned.
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.stop)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("backup did not finish: %w", ctx.Err())
+	}
+}
@@ -3,6 +3,8 @@ package db
 import (
 	"database/sql"
 
+	// Register the pgx driver with database/sql.
+	_ "github.com/jackc/pgx/v5/stdlib"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -48,3 +50,9 @@ func OpenSQLite(dbFile string, write bool) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// OpenPostgres opens a pool of Postgres connections. Unlike SQLite, the same pool
+// can be used for both reading and writing.
+func OpenPostgres(dsn string) (*sql.DB, error) {
+	return sql.Open("pgx", dsn)
+}
@@ -0,0 +1,33 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Dialect is the SQL dialect of a database.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// Placeholder returns the placeholder of the n-th bind parameter, starting at 1.
+// The zero value uses the SQLite style.
+func (d Dialect) Placeholder(n int) string {
+	if d == Postgres {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// DialectOf returns the dialect of the database, based on its driver.
+func DialectOf(sqlDB *sql.DB) Dialect {
+	if _, ok := sqlDB.Driver().(*stdlib.Driver); ok {
+		return Postgres
+	}
+	return SQLite
+}
@@ -2,12 +2,17 @@ package migrate
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/fs"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/willemschots/househunt/internal/db"
 )
 
 // Migration is a migration that was ran.
@@ -16,6 +21,9 @@ type Migration struct {
 	Sequence int
 	Filename string
 	Metadata Metadata
+	// Checksum is the hex encoded SHA-256 checksum of the migration file. It is
+	// empty for migrations that ran before checksums were recorded.
+	Checksum string
 }
 
 // Equal checks if two migrations are equal.
@@ -33,11 +41,24 @@ type Metadata struct {
 	RevisionTimestamp time.Time
 }
 
+// File is a migration file, or a migration written in Go.
+type File struct {
+	// Sequence is the number the migration will have once it ran.
+	Sequence int
+	Filename string
+	Checksum string
+	// SQL is the contents of a SQL migration file.
+	SQL string
+	// Func is set for migrations written in Go.
+	Func Func
+}
+
 const migrationsTableQuery = `CREATE TABLE IF NOT EXISTS migrations (
 	sequence           INTEGER PRIMARY KEY,
 	filename           TEXT NOT NULL,
 	revision           TEXT NOT NULL,
-	revision_timestamp TIMESTAMP NOT NULL
+	revision_timestamp TIMESTAMP NOT NULL,
+	checksum           TEXT NOT NULL DEFAULT ''
 )
 `
 
@@ -46,6 +67,14 @@ var (
 	ErrNoTable = errors.New("migrations table does not exist")
 	// ErrMigrationsMismatch indicates a mismatch between migrations that ran before and the ones available now.
 	ErrMigrationsMismatch = errors.New("migrations mismatch")
+	// ErrChecksumMismatch indicates a migration file was changed after it ran.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrNoChecksum indicates a migration ran before checksums were recorded.
+	ErrNoChecksum = errors.New("no checksum recorded")
+	// ErrPending indicates there are migrations that did not run yet.
+	ErrPending = errors.New("pending migrations")
+	// ErrNotEmpty indicates migrations already ran, so the database can't be baselined.
+	ErrNotEmpty = errors.New("migrations already ran")
 )
 
 // MigrationError is an error that occurred while running a migration.
@@ -59,11 +88,29 @@ func (m MigrationError) Error() string {
 	return fmt.Sprintf("migration [%d] %q failed: %v", m.Sequence, m.Filename, m.Err)
 }
 
+func (m MigrationError) Unwrap() error {
+	return m.Err
+}
+
 // RunFS runs migrations from the provided fs.FS. It returns a slice of migrations that were
 // run, if no migrations were run it returns an empty slice. RunFS assumes all migration files
 // can be loaded into memory. RunFS only considers files with the .sql extension in the
-// root of the FS.
-func RunFS(ctx context.Context, db *sql.DB, fileSys fs.FS, meta Metadata) ([]Migration, error) {
+// root of the FS, and the Go migrations if the FS is a Source.
+//
+// Migrations that ran before checksums were recorded get the checksum of their
+// current file, after that any change to the file is reported as ErrChecksumMismatch.
+func RunFS(ctx context.Context, sqlDB *sql.DB, fileSys fs.FS, meta Metadata) ([]Migration, error) {
+	return runFS(ctx, sqlDB, fileSys, meta, true)
+}
+
+// DryRunFS runs migrations like RunFS, but rolls back the transaction instead of committing
+// it. It returns the migrations that would have run. Note that SQLite supports transactional
+// DDL, so this also checks that the schema changes can be applied.
+func DryRunFS(ctx context.Context, sqlDB *sql.DB, fileSys fs.FS, meta Metadata) ([]Migration, error) {
+	return runFS(ctx, sqlDB, fileSys, meta, false)
+}
+
+func runFS(ctx context.Context, sqlDB *sql.DB, fileSys fs.FS, meta Metadata, commit bool) ([]Migration, error) {
 	// Load all migration files from the filesystem.
 	files, err := loadFiles(fileSys)
 	if err != nil {
@@ -71,15 +118,16 @@ func RunFS(ctx context.Context, db *sql.DB, fileSys fs.FS, meta Metadata) ([]Mig
 	}
 
 	// Begin a transaction.
-	tx, err := db.BeginTx(ctx, nil)
+	tx, err := sqlDB.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 
-	// Create migrations table if it does not exist.
-	_, err = tx.Exec(migrationsTableQuery)
+	dialect := db.DialectOf(sqlDB)
+
+	err = ensureTable(tx, dialect)
 	if err != nil {
-		return nil, rollback(tx, fmt.Errorf("failed to create migrations table: %w", err))
+		return nil, rollback(tx, err)
 	}
 
 	// Query migrations that ran before.
@@ -90,11 +138,15 @@ func RunFS(ctx context.Context, db *sql.DB, fileSys fs.FS, meta Metadata) ([]Mig
 		return nil, rollback(tx, err)
 	}
 
-	result, err := migrate(tx, before, files, meta)
+	result, err := migrate(ctx, tx, dialect, before, files, meta)
 	if err != nil {
 		return nil, rollback(tx, err)
 	}
 
+	if !commit {
+		return result, rollback(tx, nil)
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
@@ -103,10 +155,129 @@ func RunFS(ctx context.Context, db *sql.DB, fileSys fs.FS, meta Metadata) ([]Mig
 	return result, nil
 }
 
-func migrate(tx *sql.Tx, ranBefore []Migration, files []file, meta Metadata) ([]Migration, error) {
+// ensureTable creates the migrations table, or adds the checksum column
+// if the table was created before checksums were recorded.
+func ensureTable(tx *sql.Tx, dialect db.Dialect) error {
+	_, err := tx.Exec(migrationsTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	q := `SELECT COUNT(*) FROM pragma_table_info('migrations') WHERE name = 'checksum'`
+	if dialect == db.Postgres {
+		q = `SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'migrations' AND column_name = 'checksum'`
+	}
+
+	var n int
+	err = tx.QueryRow(q).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("failed to inspect migrations table: %w", err)
+	}
+
+	if n == 0 {
+		_, err = tx.Exec(`ALTER TABLE migrations ADD COLUMN checksum TEXT NOT NULL DEFAULT ''`)
+		if err != nil {
+			return fmt.Errorf("failed to add checksum column: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func migrate(ctx context.Context, tx *sql.Tx, dialect db.Dialect, ranBefore []Migration, files []File, meta Metadata) ([]Migration, error) {
+	err := verify(ranBefore, files)
+	if err != nil {
+		return nil, err
+	}
+
+	// Record checksums of migrations that ran before checksums were recorded.
+	for _, before := range ranBefore {
+		if before.Checksum != "" {
+			continue
+		}
+
+		q := fmt.Sprintf(`UPDATE migrations SET checksum = %s WHERE sequence = %s`, dialect.Placeholder(1), dialect.Placeholder(2))
+		_, err := tx.Exec(q, files[before.Sequence].Checksum, before.Sequence)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record checksum: %w", err)
+		}
+	}
+
+	// prepare the insert statement.
+	stmt, err := prepareInsert(tx, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	// files now only contains the migrations that need to be ran.
+	files = files[len(ranBefore):]
+
+	ranNow := make([]Migration, 0)
+	for _, f := range files {
+		err := runFile(ctx, tx, f)
+		if err != nil {
+			return nil, MigrationError{
+				Sequence: f.Sequence,
+				Filename: f.Filename,
+				Err:      err,
+			}
+		}
+
+		m := Migration{
+			Sequence: f.Sequence,
+			Filename: f.Filename,
+			Metadata: meta,
+			Checksum: f.Checksum,
+		}
+
+		ranNow = append(ranNow, m)
+
+		err = insertMigration(stmt, m)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ranNow, nil
+}
+
+func runFile(ctx context.Context, tx *sql.Tx, f File) error {
+	if f.Func != nil {
+		return f.Func(ctx, tx)
+	}
+
+	_, err := tx.ExecContext(ctx, f.SQL)
+	return err
+}
+
+func prepareInsert(tx *sql.Tx, dialect db.Dialect) (*sql.Stmt, error) {
+	placeholders := make([]string, 5)
+	for i := range placeholders {
+		placeholders[i] = dialect.Placeholder(i + 1)
+	}
+
+	q := `INSERT INTO migrations (sequence, filename, revision, revision_timestamp, checksum) VALUES (` + strings.Join(placeholders, ", ") + `)`
+	stmt, err := tx.Prepare(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare insert statement: %w", err)
+	}
+	return stmt, nil
+}
+
+func insertMigration(stmt *sql.Stmt, m Migration) error {
+	// Use UTC, Postgres stores timestamps without their time zone.
+	_, err := stmt.Exec(m.Sequence, m.Filename, m.Metadata.Revision, m.Metadata.RevisionTimestamp.UTC(), m.Checksum)
+	if err != nil {
+		return fmt.Errorf("failed to insert migration: %w", err)
+	}
+	return nil
+}
+
+// verify checks that the migrations that ran before match the files.
+func verify(ranBefore []Migration, files []File) error {
 	// Check if no files were removed.
 	if len(ranBefore) > len(files) {
-		return nil, fmt.Errorf(
+		return fmt.Errorf(
 			"found %d existing migrations but only have %d files: %w",
 			len(ranBefore), len(files), ErrMigrationsMismatch,
 		)
@@ -116,72 +287,197 @@ func migrate(tx *sql.Tx, ranBefore []Migration, files []file, meta Metadata) ([]
 	for i, before := range ranBefore {
 		// Sanity check that sequence is as expected.
 		if i != before.Sequence {
-			return nil, fmt.Errorf(
+			return fmt.Errorf(
 				"migration sequence mismatch, wanted %d got %d", i, before.Sequence,
 			)
 		}
 
 		// Check if the filename matches what we expect.
-		if before.Filename != files[i].name {
-			return nil, fmt.Errorf(
+		if before.Filename != files[i].Filename {
+			return fmt.Errorf(
 				"migration %d had filename %s, but now encountering %s: %w",
-				i, before.Filename, files[i].name, ErrMigrationsMismatch,
+				i, before.Filename, files[i].Filename, ErrMigrationsMismatch,
+			)
+		}
+
+		// Check if the contents match, if we know the checksum.
+		if before.Checksum != "" && before.Checksum != files[i].Checksum {
+			return fmt.Errorf(
+				"migration %d (%s) was changed after it ran: %w",
+				i, before.Filename, ErrChecksumMismatch,
 			)
 		}
 	}
 
-	// prepare the insert statement.
-	stmt, err := tx.Prepare(`INSERT INTO migrations (sequence, filename, revision, revision_timestamp) VALUES (?, ?, ?, ?)`)
+	return nil
+}
+
+// CheckFS checks if all migrations from the provided fs.FS ran on db, without running
+// any. It returns ErrPending if some migrations did not run yet, and ErrMigrationsMismatch
+// if the migrations that ran don't match the files. Like RunFS, it only considers files
+// with the .sql extension in the root of the FS.
+func CheckFS(ctx context.Context, sqlDB *sql.DB, fileSys fs.FS) error {
+	pending, err := PendingFS(ctx, sqlDB, fileSys)
 	if err != nil {
-		return nil, fmt.Errorf("failed to prepare insert statement: %w", err)
+		return err
 	}
 
-	// files now only contains the migrations that need to be ran.
-	files = files[len(ranBefore):]
+	if len(pending) > 0 {
+		return fmt.Errorf("%d migrations did not run yet: %w", len(pending), ErrPending)
+	}
 
-	ranNow := make([]Migration, 0)
-	for i, f := range files {
-		sequence := len(ranBefore) + i
+	return nil
+}
 
-		_, err := tx.Exec(f.content)
-		if err != nil {
-			return nil, MigrationError{
-				Sequence: sequence,
-				Filename: f.name,
-				Err:      err,
-			}
+// PendingFS returns the migrations from the provided fs.FS that did not run on db yet.
+// It returns an error if the migrations that ran don't match the files, or ErrNoTable
+// if no migrations ran at all.
+func PendingFS(ctx context.Context, sqlDB *sql.DB, fileSys fs.FS) ([]File, error) {
+	files, err := loadFiles(fileSys)
+	if err != nil {
+		return nil, err
+	}
+
+	ranBefore, err := QueryMigrations(ctx, sqlDB)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verify(ranBefore, files)
+	if err != nil {
+		return nil, err
+	}
+
+	return files[len(ranBefore):], nil
+}
+
+// VerifyFS checks that every migration that ran on db has a recorded checksum that
+// matches its file. Unlike CheckFS, it reports all problems instead of the first one.
+// Pending migrations are not reported.
+func VerifyFS(ctx context.Context, sqlDB *sql.DB, fileSys fs.FS) error {
+	files, err := loadFiles(fileSys)
+	if err != nil {
+		return err
+	}
+
+	ranBefore, err := QueryMigrations(ctx, sqlDB)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i, before := range ranBefore {
+		if i >= len(files) {
+			errs = append(errs, fmt.Errorf("migration %d (%s) has no file: %w", i, before.Filename, ErrMigrationsMismatch))
+			continue
+		}
+
+		f := files[i]
+		switch {
+		case before.Sequence != i || before.Filename != f.Filename:
+			errs = append(errs, fmt.Errorf("migration %d (%s) does not match file %s: %w", before.Sequence, before.Filename, f.Filename, ErrMigrationsMismatch))
+		case before.Checksum == "":
+			errs = append(errs, fmt.Errorf("migration %d (%s): %w", i, before.Filename, ErrNoChecksum))
+		case before.Checksum != f.Checksum:
+			errs = append(errs, fmt.Errorf("migration %d (%s) was changed after it ran: %w", i, before.Filename, ErrChecksumMismatch))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// BaselineFS records the migrations from the provided fs.FS up to and including the one
+// named upTo as ran, without running them. This is used to adopt a database of which the
+// schema was created by other means. If upTo is empty, all migrations are recorded.
+// It returns ErrNotEmpty if any migrations ran before.
+func BaselineFS(ctx context.Context, sqlDB *sql.DB, fileSys fs.FS, meta Metadata, upTo string) ([]Migration, error) {
+	files, err := loadFiles(fileSys)
+	if err != nil {
+		return nil, err
+	}
+
+	if upTo != "" {
+		i := indexOfFile(files, upTo)
+		if i < 0 {
+			return nil, fmt.Errorf("migration %s does not exist", upTo)
 		}
+		files = files[:i+1]
+	}
 
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	dialect := db.DialectOf(sqlDB)
+
+	err = ensureTable(tx, dialect)
+	if err != nil {
+		return nil, rollback(tx, err)
+	}
+
+	before, err := queryWith(func(q string) (*sql.Rows, error) {
+		return tx.Query(q)
+	})
+	if err != nil {
+		return nil, rollback(tx, err)
+	}
+
+	if len(before) > 0 {
+		return nil, rollback(tx, fmt.Errorf("found %d existing migrations: %w", len(before), ErrNotEmpty))
+	}
+
+	stmt, err := prepareInsert(tx, dialect)
+	if err != nil {
+		return nil, rollback(tx, err)
+	}
+
+	result := make([]Migration, 0, len(files))
+	for _, f := range files {
 		m := Migration{
-			Sequence: sequence,
-			Filename: f.name,
+			Sequence: f.Sequence,
+			Filename: f.Filename,
 			Metadata: meta,
+			Checksum: f.Checksum,
 		}
 
-		ranNow = append(ranNow, m)
-
-		_, err = stmt.Exec(m.Sequence, m.Filename, m.Metadata.Revision, m.Metadata.RevisionTimestamp)
+		err = insertMigration(stmt, m)
 		if err != nil {
-			return nil, fmt.Errorf("failed to insert migration: %w", err)
+			return nil, rollback(tx, err)
 		}
+
+		result = append(result, m)
 	}
 
-	return ranNow, nil
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return result, nil
 }
 
 // QueryMigrations queries the given db for all migrations that ran.
 // If the migration table does not exist yet, it returns the ErrNoTable error.
-func QueryMigrations(ctx context.Context, db *sql.DB) ([]Migration, error) {
+func QueryMigrations(ctx context.Context, sqlDB *sql.DB) ([]Migration, error) {
 	return queryWith(func(q string) (*sql.Rows, error) {
-		return db.QueryContext(ctx, q)
+		return sqlDB.QueryContext(ctx, q)
 	})
 }
 
 func queryWith(rowsFunc func(q string) (*sql.Rows, error)) ([]Migration, error) {
-	const q = `SELECT sequence, filename, revision, revision_timestamp FROM migrations ORDER BY sequence`
+	const (
+		q = `SELECT sequence, filename, revision, revision_timestamp, checksum FROM migrations ORDER BY sequence`
+		// legacyQ is used for tables that were created before checksums were recorded.
+		legacyQ = `SELECT sequence, filename, revision, revision_timestamp, '' FROM migrations ORDER BY sequence`
+	)
+
 	rows, err := rowsFunc(q)
+	if isMissing(err, "column", "checksum") {
+		rows, err = rowsFunc(legacyQ)
+	}
 	if err != nil {
-		if strings.Contains(err.Error(), "no such table") {
+		if isMissing(err, "table", "migrations") {
 			return nil, ErrNoTable
 		}
 		return nil, fmt.Errorf("failed to query migrations: %w", err)
@@ -191,7 +487,7 @@ func queryWith(rowsFunc func(q string) (*sql.Rows, error)) ([]Migration, error)
 	migrations := make([]Migration, 0)
 	for rows.Next() {
 		var m Migration
-		err := rows.Scan(&m.Sequence, &m.Filename, &m.Metadata.Revision, &m.Metadata.RevisionTimestamp)
+		err := rows.Scan(&m.Sequence, &m.Filename, &m.Metadata.Revision, &m.Metadata.RevisionTimestamp, &m.Checksum)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan migration: %w", err)
 		}
@@ -206,18 +502,18 @@ func queryWith(rowsFunc func(q string) (*sql.Rows, error)) ([]Migration, error)
 	return migrations, nil
 }
 
-type file struct {
-	name    string
-	content string
+// LoadFS loads all migrations from the provided fs.FS, in the order they run.
+func LoadFS(fileSys fs.FS) ([]File, error) {
+	return loadFiles(fileSys)
 }
 
-func loadFiles(fileSys fs.FS) ([]file, error) {
+func loadFiles(fileSys fs.FS) ([]File, error) {
 	entries, err := fs.ReadDir(fileSys, ".")
 	if err != nil {
 		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
 	}
 
-	files := make([]file, 0, len(entries))
+	files := make([]File, 0, len(entries))
 	for _, entry := range entries {
 		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
 			continue
@@ -228,15 +524,57 @@ func loadFiles(fileSys fs.FS) ([]file, error) {
 			return nil, fmt.Errorf("failed to read migration %q: %w", entry.Name(), err)
 		}
 
-		files = append(files, file{
-			name:    entry.Name(),
-			content: string(content),
+		sum := sha256.Sum256(content)
+		files = append(files, File{
+			Filename: entry.Name(),
+			Checksum: hex.EncodeToString(sum[:]),
+			SQL:      string(content),
 		})
 	}
 
+	funcs, err := funcFiles(fileSys)
+	if err != nil {
+		return nil, err
+	}
+
+	// Go migrations are interleaved with the SQL files by name.
+	files = append(files, funcs...)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Filename < files[j].Filename
+	})
+
+	for i := range files {
+		files[i].Sequence = i
+	}
+
 	return files, nil
 }
 
+// isMissing reports whether err indicates the table or column with the given name does not exist.
+func isMissing(err error, kind, name string) bool {
+	if err == nil {
+		return false
+	}
+
+	msg := err.Error()
+	// SQLite reports "no such table: migrations", Postgres reports `relation "migrations" does not exist`.
+	if kind == "table" && strings.Contains(msg, `relation "`+name+`" does not exist`) {
+		return true
+	}
+
+	return strings.Contains(msg, "no such "+kind+": "+name) ||
+		strings.Contains(msg, kind+` "`+name+`" does not exist`)
+}
+
+func indexOfFile(files []File, name string) int {
+	for i, f := range files {
+		if f.Filename == name {
+			return i
+		}
+	}
+	return -1
+}
+
 func rollback(tx *sql.Tx, err error) error {
 	rErr := tx.Rollback()
 	if rErr != nil {
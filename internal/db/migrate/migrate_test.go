@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"os"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/willemschots/househunt/internal/db/migrate"
@@ -225,6 +227,378 @@ func Test_QueryMigrations(t *testing.T) {
 	})
 }
 
+func Test_CheckFS(t *testing.T) {
+	meta := migrate.Metadata{
+		"v1.0.0", timeRFC3339(t, "2024-03-20T14:56:00Z"),
+	}
+
+	tests := map[string]struct {
+		ranDir   string
+		checkDir string
+		wantErr  error
+	}{
+		"ok, all migrations ran": {
+			ranDir:   "./testdata/progression/run_2",
+			checkDir: "./testdata/progression/run_2",
+			wantErr:  nil,
+		},
+		"fail, pending migrations": {
+			ranDir:   "./testdata/progression/run_1",
+			checkDir: "./testdata/progression/run_2",
+			wantErr:  migrate.ErrPending,
+		},
+		"fail, renamed migration": {
+			ranDir:   "./testdata/rename_mismatch/run_1",
+			checkDir: "./testdata/rename_mismatch/run_2",
+			wantErr:  migrate.ErrMigrationsMismatch,
+		},
+		"fail, removed migration": {
+			ranDir:   "./testdata/removal_mismatch/run_1",
+			checkDir: "./testdata/removal_mismatch/run_2",
+			wantErr:  migrate.ErrMigrationsMismatch,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := testdb.RunUnmigratedWhile(t, true)
+
+			_, err := migrate.RunFS(context.Background(), db, os.DirFS(tc.ranDir), meta)
+			if err != nil {
+				t.Fatalf("unexpected error running migrations: %v", err)
+			}
+
+			err = migrate.CheckFS(context.Background(), db, os.DirFS(tc.checkDir))
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got %v, want %v (via errors.Is)", err, tc.wantErr)
+			}
+		})
+	}
+
+	t.Run("fail, no table", func(t *testing.T) {
+		db := testdb.RunUnmigratedWhile(t, true)
+
+		err := migrate.CheckFS(context.Background(), db, os.DirFS("./testdata/progression/run_1"))
+		if !errors.Is(err, migrate.ErrNoTable) {
+			t.Fatalf("got %v, want %v (via errors.Is)", err, migrate.ErrNoTable)
+		}
+	})
+}
+
+func Test_VerifyFS(t *testing.T) {
+	meta := migrate.Metadata{
+		"v1.0.0", timeRFC3339(t, "2024-03-20T14:56:00Z"),
+	}
+
+	t.Run("ok, unchanged migrations", func(t *testing.T) {
+		db := testdb.RunUnmigratedWhile(t, true)
+		fileSys := testFS("CREATE TABLE a (v TEXT);", "CREATE TABLE b (v TEXT);")
+
+		_, err := migrate.RunFS(context.Background(), db, fileSys, meta)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		err = migrate.VerifyFS(context.Background(), db, fileSys)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("fail, edited migration", func(t *testing.T) {
+		db := testdb.RunUnmigratedWhile(t, true)
+
+		_, err := migrate.RunFS(context.Background(), db, testFS("CREATE TABLE a (v TEXT);"), meta)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		edited := testFS("CREATE TABLE a (v TEXT, w TEXT);", "CREATE TABLE b (v TEXT);")
+
+		err = migrate.VerifyFS(context.Background(), db, edited)
+		if !errors.Is(err, migrate.ErrChecksumMismatch) {
+			t.Fatalf("got %v, want %v (via errors.Is)", err, migrate.ErrChecksumMismatch)
+		}
+
+		// RunFS should refuse to run the pending migration as well.
+		_, err = migrate.RunFS(context.Background(), db, edited, meta)
+		if !errors.Is(err, migrate.ErrChecksumMismatch) {
+			t.Fatalf("got %v, want %v (via errors.Is)", err, migrate.ErrChecksumMismatch)
+		}
+	})
+
+	t.Run("ok, checksums of legacy table are recorded on run", func(t *testing.T) {
+		db := testdb.RunUnmigratedWhile(t, true)
+		fileSys := testFS("CREATE TABLE a (v TEXT);")
+
+		_, err := db.Exec(`CREATE TABLE migrations (
+			sequence           INTEGER PRIMARY KEY,
+			filename           TEXT NOT NULL,
+			revision           TEXT NOT NULL,
+			revision_timestamp TIMESTAMP NOT NULL
+		);
+		INSERT INTO migrations VALUES (0, '0001.sql', 'v0.1.0', '2024-03-20T14:56:00Z');
+		CREATE TABLE a (v TEXT);`)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		err = migrate.VerifyFS(context.Background(), db, fileSys)
+		if !errors.Is(err, migrate.ErrNoChecksum) {
+			t.Fatalf("got %v, want %v (via errors.Is)", err, migrate.ErrNoChecksum)
+		}
+
+		_, err = migrate.RunFS(context.Background(), db, fileSys, meta)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		err = migrate.VerifyFS(context.Background(), db, fileSys)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func Test_DryRunFS(t *testing.T) {
+	meta := migrate.Metadata{
+		"v1.0.0", timeRFC3339(t, "2024-03-20T14:56:00Z"),
+	}
+
+	t.Run("ok, nothing is committed", func(t *testing.T) {
+		db := testdb.RunUnmigratedWhile(t, true)
+		fileSys := testFS("CREATE TABLE a (v TEXT);")
+
+		got, err := migrate.DryRunFS(context.Background(), db, fileSys, meta)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		assertMigrations(t, got, []migrate.Migration{
+			{Sequence: 0, Filename: "0001.sql", Metadata: meta},
+		})
+
+		_, err = migrate.QueryMigrations(context.Background(), db)
+		if !errors.Is(err, migrate.ErrNoTable) {
+			t.Fatalf("got %v, want %v (via errors.Is)", err, migrate.ErrNoTable)
+		}
+	})
+
+	t.Run("fail, invalid migration", func(t *testing.T) {
+		db := testdb.RunUnmigratedWhile(t, true)
+
+		_, err := migrate.DryRunFS(context.Background(), db, testFS("CREATE TABLE a (v TEXT);", "NOT SQL;"), meta)
+		var mErr migrate.MigrationError
+		if !errors.As(err, &mErr) || mErr.Sequence != 1 {
+			t.Fatalf("got %v, want migration error for sequence 1", err)
+		}
+	})
+}
+
+func Test_PendingFS(t *testing.T) {
+	db := testdb.RunUnmigratedWhile(t, true)
+	meta := migrate.Metadata{
+		"v1.0.0", timeRFC3339(t, "2024-03-20T14:56:00Z"),
+	}
+
+	_, err := migrate.RunFS(context.Background(), db, testFS("CREATE TABLE a (v TEXT);"), meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := migrate.PendingFS(context.Background(), db, testFS("CREATE TABLE a (v TEXT);", "CREATE TABLE b (v TEXT);"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(got) != 1 || got[0].Sequence != 1 || got[0].Filename != "0002.sql" || got[0].SQL != "CREATE TABLE b (v TEXT);" {
+		t.Fatalf("unexpected pending migrations %+v", got)
+	}
+}
+
+func Test_BaselineFS(t *testing.T) {
+	meta := migrate.Metadata{
+		"v1.0.0", timeRFC3339(t, "2024-03-20T14:56:00Z"),
+	}
+	fileSys := testFS(
+		"CREATE TABLE a (v TEXT);",
+		"CREATE TABLE b (v TEXT);",
+		"CREATE TABLE c (v TEXT);",
+	)
+
+	t.Run("ok, baseline up to a migration", func(t *testing.T) {
+		db := testdb.RunUnmigratedWhile(t, true)
+
+		// The schema was created by other means.
+		_, err := db.Exec("CREATE TABLE a (v TEXT); CREATE TABLE b (v TEXT);")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got, err := migrate.BaselineFS(context.Background(), db, fileSys, meta, "0002.sql")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := []migrate.Migration{
+			{Sequence: 0, Filename: "0001.sql", Metadata: meta},
+			{Sequence: 1, Filename: "0002.sql", Metadata: meta},
+		}
+		assertMigrations(t, got, want)
+		assertTable(t, db, want)
+
+		// Only the last migration should run.
+		ran, err := migrate.RunFS(context.Background(), db, fileSys, meta)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		assertMigrations(t, ran, []migrate.Migration{
+			{Sequence: 2, Filename: "0003.sql", Metadata: meta},
+		})
+	})
+
+	t.Run("fail, unknown migration", func(t *testing.T) {
+		db := testdb.RunUnmigratedWhile(t, true)
+
+		_, err := migrate.BaselineFS(context.Background(), db, fileSys, meta, "0004.sql")
+		if err == nil {
+			t.Fatalf("expected error, got nil")
+		}
+	})
+
+	t.Run("fail, migrations already ran", func(t *testing.T) {
+		db := testdb.RunUnmigratedWhile(t, true)
+
+		_, err := migrate.RunFS(context.Background(), db, fileSys, meta)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, err = migrate.BaselineFS(context.Background(), db, fileSys, meta, "")
+		if !errors.Is(err, migrate.ErrNotEmpty) {
+			t.Fatalf("got %v, want %v (via errors.Is)", err, migrate.ErrNotEmpty)
+		}
+	})
+}
+
+func Test_RunFS_GoMigrations(t *testing.T) {
+	meta := migrate.Metadata{
+		"v1.0.0", timeRFC3339(t, "2024-03-20T14:56:00Z"),
+	}
+
+	insertFunc := func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO a (v) VALUES ('from go')")
+		return err
+	}
+
+	t.Run("ok, interleaved with sql files", func(t *testing.T) {
+		db := testdb.RunUnmigratedWhile(t, true)
+
+		src := migrate.Source{
+			FS: testFS("CREATE TABLE a (v TEXT);", "UPDATE a SET v = v || ' and sql';"),
+			Funcs: map[string]migrate.Func{
+				"0001_insert.go": insertFunc,
+			},
+		}
+
+		got, err := migrate.RunFS(context.Background(), db, src, meta)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := []migrate.Migration{
+			{Sequence: 0, Filename: "0001.sql", Metadata: meta},
+			{Sequence: 1, Filename: "0001_insert.go", Metadata: meta},
+			{Sequence: 2, Filename: "0002.sql", Metadata: meta},
+		}
+		assertMigrations(t, got, want)
+		assertTable(t, db, want)
+
+		var v string
+		err = db.QueryRow("SELECT v FROM a").Scan(&v)
+		if err != nil || v != "from go and sql" {
+			t.Errorf("got %q (%v), want %q", v, err, "from go and sql")
+		}
+
+		err = migrate.VerifyFS(context.Background(), db, src)
+		if err != nil {
+			t.Errorf("unexpected error verifying: %v", err)
+		}
+	})
+
+	t.Run("fail, go migration error rolls back", func(t *testing.T) {
+		db := testdb.RunUnmigratedWhile(t, true)
+
+		src := migrate.Source{
+			FS: testFS("CREATE TABLE a (v TEXT);"),
+			Funcs: map[string]migrate.Func{
+				"0002_fail.go": func(ctx context.Context, tx *sql.Tx) error {
+					return errors.New("test error")
+				},
+			},
+		}
+
+		_, err := migrate.RunFS(context.Background(), db, src, meta)
+		var mErr migrate.MigrationError
+		if !errors.As(err, &mErr) || mErr.Filename != "0002_fail.go" {
+			t.Fatalf("got %v, want migration error for 0002_fail.go", err)
+		}
+
+		_, err = migrate.QueryMigrations(context.Background(), db)
+		if !errors.Is(err, migrate.ErrNoTable) {
+			t.Fatalf("got %v, want %v (via errors.Is)", err, migrate.ErrNoTable)
+		}
+	})
+
+	t.Run("fail, removed go migration", func(t *testing.T) {
+		db := testdb.RunUnmigratedWhile(t, true)
+
+		src := migrate.Source{
+			FS: testFS("CREATE TABLE a (v TEXT);"),
+			Funcs: map[string]migrate.Func{
+				"0001_insert.go": insertFunc,
+			},
+		}
+
+		_, err := migrate.RunFS(context.Background(), db, src, meta)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, err = migrate.RunFS(context.Background(), db, src.FS, meta)
+		if !errors.Is(err, migrate.ErrMigrationsMismatch) {
+			t.Fatalf("got %v, want %v (via errors.Is)", err, migrate.ErrMigrationsMismatch)
+		}
+	})
+
+	t.Run("fail, invalid name", func(t *testing.T) {
+		db := testdb.RunUnmigratedWhile(t, true)
+
+		src := migrate.Source{
+			FS: testFS(),
+			Funcs: map[string]migrate.Func{
+				"0001_insert.sql": insertFunc,
+			},
+		}
+
+		_, err := migrate.RunFS(context.Background(), db, src, meta)
+		if err == nil {
+			t.Fatalf("expected error, got nil")
+		}
+	})
+}
+
+// testFS creates a filesystem with a migration file for each query,
+// named 0001.sql, 0002.sql and so on.
+func testFS(queries ...string) fstest.MapFS {
+	fileSys := fstest.MapFS{}
+	for i, q := range queries {
+		fileSys[fmt.Sprintf("%04d.sql", i+1)] = &fstest.MapFile{Data: []byte(q)}
+	}
+	return fileSys
+}
+
 func assertTable(t *testing.T, db *sql.DB, want []migrate.Migration) {
 	t.Helper()
 
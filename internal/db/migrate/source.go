@@ -0,0 +1,55 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// funcChecksum is recorded as the checksum of Go migrations. Their code can't be
+// checksummed, so only their name and position in the sequence are verified.
+const funcChecksum = "go"
+
+// Func is a migration written in Go. It runs in the same transaction as the other
+// migrations, so it should only use tx to access the database.
+type Func func(ctx context.Context, tx *sql.Tx) error
+
+// Source is a fs.FS with SQL migration files, together with migrations written in Go.
+// It can be passed to all functions in this package that accept a fs.FS.
+//
+// Go migrations are named like SQL migrations, but with the .go extension. They are
+// sorted by name together with the SQL files, so the name decides when a Go migration
+// runs. For example, 0005_reencrypt_emails.go runs after 0004_audit_events.sql.
+type Source struct {
+	fs.FS
+	Funcs map[string]Func
+}
+
+// funcFiles returns the Go migrations of fileSys as files, if it's a Source.
+func funcFiles(fileSys fs.FS) ([]File, error) {
+	src, ok := fileSys.(Source)
+	if !ok {
+		return nil, nil
+	}
+
+	files := make([]File, 0, len(src.Funcs))
+	for name, f := range src.Funcs {
+		if !strings.HasSuffix(name, ".go") || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid name for Go migration %q, expected a name like 0001_name.go", name)
+		}
+
+		if f == nil {
+			return nil, fmt.Errorf("go migration %q has no function", name)
+		}
+
+		files = append(files, File{
+			Filename: name,
+			Checksum: funcChecksum,
+			Func:     f,
+		})
+	}
+
+	return files, nil
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/willemschots/househunt/internal/krypto"
 )
@@ -11,13 +12,15 @@ import (
 // Use Query to construct parts of a query and use Param to add bind parameters.
 // The final query and parameters can be retrieved using the Get method.
 //
-// The zero value is ready to use.
+// The zero value is ready to use, and writes placeholders in the SQLite style.
 type Query struct {
 	Encryptor     *krypto.Encryptor
 	BlindIndexKey krypto.Key
-	b             strings.Builder
-	params        []any
-	err           error
+	// Dialect decides the style of the placeholders.
+	Dialect Dialect
+	b       strings.Builder
+	params  []any
+	err     error
 }
 
 // Unsafe writes a non-parameterized part of a query.
@@ -27,8 +30,28 @@ func (q *Query) Unsafe(s string) {
 
 // Param writes a parameterized part of a query.
 func (q *Query) Param(v any) {
-	q.b.WriteString("?")
-	q.params = append(q.params, v)
+	q.params = append(q.params, q.convert(v))
+	q.b.WriteString(q.Dialect.Placeholder(len(q.params)))
+}
+
+// convert converts v so it's stored the same way in every dialect.
+func (q *Query) convert(v any) any {
+	if q.Dialect != Postgres {
+		return v
+	}
+
+	// Postgres stores timestamps without their time zone, so always use UTC.
+	switch t := v.(type) {
+	case time.Time:
+		return t.UTC()
+	case *time.Time:
+		if t == nil {
+			return t
+		}
+		return t.UTC()
+	}
+
+	return v
 }
 
 // Param writes a parameterized part of a query and encrypts the value before adding it to the query.
@@ -67,8 +90,7 @@ func (q *Query) Params(v ...any) {
 		if i > 0 {
 			q.b.WriteString(", ")
 		}
-		q.b.WriteString("?")
-		q.params = append(q.params, p)
+		q.Param(p)
 	}
 }
 
@@ -89,7 +111,13 @@ type Decryptable struct {
 	Data      []byte
 }
 
+// Scan implements sql.Scanner. A NULL value results in nil Data.
 func (d *Decryptable) Scan(src any) error {
+	if src == nil {
+		d.Data = nil
+		return nil
+	}
+
 	b, ok := src.([]byte)
 	if !ok {
 		return errors.New("invalid type")
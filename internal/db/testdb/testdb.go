@@ -3,9 +3,13 @@ package testdb
 import (
 	"context"
 	"database/sql"
+	"net/url"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/willemschots/househunt/internal/db"
 	"github.com/willemschots/househunt/internal/db/migrate"
 	"github.com/willemschots/househunt/migrations"
@@ -21,7 +25,7 @@ func RunWhile(t *testing.T, write bool) *sql.DB {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	_, err := migrate.RunFS(ctx, db, migrations.FS, migrate.Metadata{})
+	_, err := migrate.RunFS(ctx, db, migrations.SQLite(migrations.Deps{}), migrate.Metadata{})
 	if err != nil {
 		t.Fatalf("failed to run migrations: %v", err)
 	}
@@ -48,3 +52,109 @@ func RunUnmigratedWhile(t *testing.T, write bool) *sql.DB {
 
 	return db
 }
+
+// PostgresDSNEnv is the environment variable with the DSN of a Postgres database
+// used by tests. Tests that need Postgres are skipped if it's not set.
+const PostgresDSNEnv = "HOUSEHUNT_TEST_POSTGRES_DSN"
+
+// RunPostgresWhile returns a Postgres database with all migrations applied while
+// the provided test is executing. Every call uses its own schema, which is dropped
+// when the test completes. The test is skipped if PostgresDSNEnv is not set.
+func RunPostgresWhile(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv(PostgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("set %s to run tests against Postgres", PostgresDSNEnv)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	admin, err := db.OpenPostgres(dsn)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer admin.Close()
+
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	_, err = admin.ExecContext(ctx, "CREATE SCHEMA "+schema)
+	if err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+
+	pgDB, err := db.OpenPostgres(withSearchPath(t, dsn, schema))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		err := pgDB.Close()
+		if err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+
+		admin, err := db.OpenPostgres(dsn)
+		if err != nil {
+			t.Errorf("failed to open database: %v", err)
+			return
+		}
+		defer admin.Close()
+
+		_, err = admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if err != nil {
+			t.Errorf("failed to drop schema: %v", err)
+		}
+	})
+
+	_, err = migrate.RunFS(ctx, pgDB, migrations.Postgres(migrations.Deps{}), migrate.Metadata{})
+	if err != nil {
+		t.Fatalf("failed to run migrations: %v", err)
+	}
+
+	return pgDB
+}
+
+// Backend is a database that stores are tested against.
+type Backend struct {
+	Name string
+	// Open returns a database with all migrations applied while the provided
+	// test is executing.
+	Open func(t *testing.T) *sql.DB
+}
+
+// Backends are the databases that stores are tested against. Postgres is
+// skipped unless PostgresDSNEnv is set.
+var Backends = []Backend{
+	{
+		Name: "sqlite",
+		Open: func(t *testing.T) *sql.DB {
+			return RunWhile(t, true)
+		},
+	},
+	{
+		Name: "postgres",
+		Open: RunPostgresWhile,
+	},
+}
+
+// withSearchPath sets the search_path of all connections made with dsn to schema.
+func withSearchPath(t *testing.T, dsn, schema string) string {
+	t.Helper()
+
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		// keyword/value format.
+		return dsn + " search_path=" + schema
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", PostgresDSNEnv, err)
+	}
+
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/willemschots/househunt/internal/tracing"
+)
+
+// Execer is implemented by *sql.DB and *sql.Tx.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Querier is implemented by *sql.DB and *sql.Tx.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// TracedExec returns a function that executes queries on e with ctx, every
+// statement is recorded in its own span. The signature matches the exec
+// functions the stores pass to their query helpers.
+func TracedExec(ctx context.Context, e Execer) func(query string, params ...any) (sql.Result, error) {
+	return func(query string, params ...any) (sql.Result, error) {
+		ctx, span := tracing.Start(ctx, "db.exec", tracing.String("db.statement", query))
+		res, err := e.ExecContext(ctx, query, params...)
+		span.EndErr(err)
+		return res, err
+	}
+}
+
+// TracedQuery is like TracedExec, but for queries that return rows. The span
+// ends when the query returns, it does not include reading the rows.
+func TracedQuery(ctx context.Context, q Querier) func(query string, params ...any) (*sql.Rows, error) {
+	return func(query string, params ...any) (*sql.Rows, error) {
+		ctx, span := tracing.Start(ctx, "db.query", tracing.String("db.statement", query))
+		rows, err := q.QueryContext(ctx, query, params...)
+		span.EndErr(err)
+		return rows, err
+	}
+}
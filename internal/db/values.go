@@ -0,0 +1,25 @@
+package db
+
+// IsZero reports whether v is the zero value of its type.
+func IsZero[T comparable](v T) bool {
+	var zero T
+	return v == zero
+}
+
+// NullIfZero returns nil if v is the zero value of its type, so it's stored as NULL.
+// Otherwise it returns v.
+func NullIfZero[T comparable](v T) any {
+	if IsZero(v) {
+		return nil
+	}
+	return v
+}
+
+// AnySlice converts s to a slice of any, so it can be passed to Query.Params.
+func AnySlice[T any](s []T) []any {
+	out := make([]any, 0, len(s))
+	for _, v := range s {
+		out = append(out, v)
+	}
+	return out
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/errorz"
+)
+
+type execFunc func(query string, params ...any) (sql.Result, error)
+type queryFunc func(query string, params ...any) (*sql.Rows, error)
+
+func upsertSuppression(q db.Query, ef execFunc, sup email.Suppression) error {
+	q.Unsafe(`INSERT INTO email_suppressions (email_encrypted, email_blind_index, reason, created_at) VALUES (`)
+	q.ParamEncrypted([]byte(sup.Email))
+	q.Unsafe(`, `)
+	q.ParamBlindIndex([]byte(sup.Email))
+	q.Unsafe(`, `)
+	q.Params(sup.Reason, sup.CreatedAt)
+	q.Unsafe(`) ON CONFLICT (email_blind_index) DO UPDATE SET reason = excluded.reason, created_at = excluded.created_at`)
+
+	s, params, err := q.Get()
+	if err != nil {
+		return err
+	}
+
+	_, err = ef(s, params...)
+	if err != nil {
+		return errorz.MapDBErr(err)
+	}
+
+	return nil
+}
+
+func deleteSuppression(q db.Query, ef execFunc, addr email.Address) error {
+	q.Unsafe(`DELETE FROM email_suppressions WHERE email_blind_index = `)
+	q.ParamBlindIndex([]byte(addr))
+
+	s, params, err := q.Get()
+	if err != nil {
+		return err
+	}
+
+	result, err := ef(s, params...)
+	if err != nil {
+		return errorz.MapDBErr(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return errorz.MapDBErr(err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("suppression not found: %w", errorz.ErrNotFound)
+	}
+
+	return nil
+}
+
+func selectSuppressions(q db.Query, qf queryFunc, f email.SuppressionFilter) ([]email.Suppression, error) {
+	q.Unsafe(`SELECT email_encrypted, reason, created_at FROM email_suppressions WHERE 1=1 `)
+
+	if len(f.Emails) > 0 {
+		q.Unsafe(`AND email_blind_index IN (`)
+		for i, addr := range f.Emails {
+			if i > 0 {
+				q.Unsafe(`, `)
+			}
+			q.ParamBlindIndex([]byte(addr))
+		}
+		q.Unsafe(`) `)
+	}
+
+	q.Unsafe(`ORDER BY created_at DESC`)
+
+	s, params, err := q.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := qf(s, params...)
+	if err != nil {
+		return nil, errorz.MapDBErr(err)
+	}
+
+	defer rows.Close()
+
+	out := make([]email.Suppression, 0)
+	for rows.Next() {
+		var sup email.Suppression
+		emailBytes := q.DecryptionTarget()
+		err := rows.Scan(emailBytes, &sup.Reason, &sup.CreatedAt)
+		if err != nil {
+			return nil, errorz.MapDBErr(err)
+		}
+
+		sup.Email, err = email.ParseAddress(string(emailBytes.Data))
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, sup)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errorz.MapDBErr(err)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/krypto"
+)
+
+// Store is responsible for storing email related data in a database.
+type Store struct {
+	writeDB       *sql.DB
+	readDB        *sql.DB
+	dialect       db.Dialect
+	encryptor     *krypto.Encryptor
+	blindIndexKey krypto.Key
+}
+
+// New creates a new Store. The dialect is based on the driver of writeDB.
+func New(writeDB, readDB *sql.DB, encryptor *krypto.Encryptor, blindIndexKey krypto.Key) *Store {
+	return &Store{
+		writeDB:       writeDB,
+		readDB:        readDB,
+		dialect:       db.DialectOf(writeDB),
+		encryptor:     encryptor,
+		blindIndexKey: blindIndexKey,
+	}
+}
+
+func (s *Store) newQuery() db.Query {
+	return db.Query{
+		Encryptor:     s.encryptor,
+		BlindIndexKey: s.blindIndexKey,
+		Dialect:       s.dialect,
+	}
+}
+
+// SaveSuppression creates a suppression, or replaces the existing
+// suppression for the same email address.
+func (s *Store) SaveSuppression(ctx context.Context, sup email.Suppression) error {
+	return upsertSuppression(s.newQuery(), db.TracedExec(ctx, s.writeDB), sup)
+}
+
+// DeleteSuppression deletes the suppression for the email address.
+// It returns errorz.ErrNotFound if no suppression is found.
+func (s *Store) DeleteSuppression(ctx context.Context, addr email.Address) error {
+	return deleteSuppression(s.newQuery(), db.TracedExec(ctx, s.writeDB), addr)
+}
+
+// FindSuppressions queries for suppressions based on the provided filter.
+// It returns an empty slice if no suppressions are found.
+func (s *Store) FindSuppressions(ctx context.Context, filter email.SuppressionFilter) ([]email.Suppression, error) {
+	return selectSuppressions(s.newQuery(), db.TracedQuery(ctx, s.readDB), filter)
+}
@@ -0,0 +1,137 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/willemschots/househunt/internal/db/testdb"
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/email/db"
+	"github.com/willemschots/househunt/internal/errorz"
+	"github.com/willemschots/househunt/internal/krypto"
+)
+
+func Test_Store_Suppressions(t *testing.T) {
+	for _, b := range testdb.Backends {
+		t.Run(b.Name, func(t *testing.T) {
+			testSuppressions(t, b.Open)
+		})
+	}
+}
+
+func testSuppressions(t *testing.T, openDB func(t *testing.T) *sql.DB) {
+	t.Run("ok, save and find", func(t *testing.T) {
+		store := storeForTest(t, openDB(t))
+
+		sups := []email.Suppression{
+			newSuppression(t, "alice@example.com", email.SuppressionReasonHardBounce, 1),
+			newSuppression(t, "jacob@example.com", email.SuppressionReasonSpamComplaint, 2),
+		}
+
+		for _, sup := range sups {
+			err := store.SaveSuppression(context.Background(), sup)
+			if err != nil {
+				t.Fatalf("failed to save suppression: %v", err)
+			}
+		}
+
+		// Most recent first.
+		assertSuppressions(t, store, email.SuppressionFilter{}, []email.Suppression{sups[1], sups[0]})
+
+		assertSuppressions(t, store, email.SuppressionFilter{
+			Emails: []email.Address{"alice@example.com"},
+		}, []email.Suppression{sups[0]})
+
+		assertSuppressions(t, store, email.SuppressionFilter{
+			Emails: []email.Address{"eva@example.com"},
+		}, []email.Suppression{})
+	})
+
+	t.Run("ok, save replaces existing suppression", func(t *testing.T) {
+		store := storeForTest(t, openDB(t))
+
+		first := newSuppression(t, "alice@example.com", email.SuppressionReasonHardBounce, 1)
+		second := newSuppression(t, "alice@example.com", email.SuppressionReasonSpamComplaint, 2)
+
+		for _, sup := range []email.Suppression{first, second} {
+			err := store.SaveSuppression(context.Background(), sup)
+			if err != nil {
+				t.Fatalf("failed to save suppression: %v", err)
+			}
+		}
+
+		assertSuppressions(t, store, email.SuppressionFilter{}, []email.Suppression{second})
+	})
+
+	t.Run("ok, delete", func(t *testing.T) {
+		store := storeForTest(t, openDB(t))
+
+		sup := newSuppression(t, "alice@example.com", email.SuppressionReasonHardBounce, 1)
+		err := store.SaveSuppression(context.Background(), sup)
+		if err != nil {
+			t.Fatalf("failed to save suppression: %v", err)
+		}
+
+		err = store.DeleteSuppression(context.Background(), sup.Email)
+		if err != nil {
+			t.Fatalf("failed to delete suppression: %v", err)
+		}
+
+		assertSuppressions(t, store, email.SuppressionFilter{}, []email.Suppression{})
+	})
+
+	t.Run("fail, delete not found", func(t *testing.T) {
+		store := storeForTest(t, openDB(t))
+
+		err := store.DeleteSuppression(context.Background(), "alice@example.com")
+		if !errors.Is(err, errorz.ErrNotFound) {
+			t.Fatalf("expected errors to be %v got %v (via errors.Is)", errorz.ErrNotFound, err)
+		}
+	})
+}
+
+func storeForTest(t *testing.T, testDB *sql.DB) *db.Store {
+	t.Helper()
+
+	encryptor := must(krypto.NewEncryptor([]krypto.Key{
+		must(krypto.ParseKey("2b671594b775f371eab4050b4d58326682df6b1a6cc2e886717b1a26b4d6c45d")),
+	}))
+	indexKey := must(krypto.ParseKey("90303dfed7994260ea4817a5ca8a392915cd401115b2f97495dadfcbcd14adbf"))
+
+	return db.New(testDB, testDB, encryptor, indexKey)
+}
+
+func newSuppression(t *testing.T, addr string, reason email.SuppressionReason, sec int) email.Suppression {
+	t.Helper()
+
+	return email.Suppression{
+		Email:     must(email.ParseAddress(addr)),
+		Reason:    reason,
+		CreatedAt: time.Date(2021, 1, 1, 0, 0, sec, 0, time.UTC),
+	}
+}
+
+func assertSuppressions(t *testing.T, store *db.Store, filter email.SuppressionFilter, want []email.Suppression) {
+	t.Helper()
+
+	got, err := store.FindSuppressions(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("failed to find suppressions: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%#v\nwant\n%#v\n", got, want)
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
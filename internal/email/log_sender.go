@@ -3,6 +3,8 @@ package email
 import (
 	"context"
 	"log/slog"
+
+	"github.com/willemschots/househunt/internal/logz"
 )
 
 // LogSender is a Sender that logs the email to the logger instead of sending it.
@@ -19,9 +21,9 @@ func NewLogSender(logger *slog.Logger) *LogSender {
 	}
 }
 
-// Send logs the email to the logger.
-func (s *LogSender) Send(_ context.Context, from, recipient Address, subject, body string) error {
-	s.logger.Info("send email",
+// Send logs the email to the logger. If ctx carries a request-scoped logger, it is used instead.
+func (s *LogSender) Send(ctx context.Context, from, recipient Address, subject, body string) error {
+	logz.FromContext(ctx, s.logger).Info("send email",
 		"from", from,
 		"recipient", recipient,
 		"subject", subject,
@@ -0,0 +1,67 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/willemschots/househunt/internal/errorz"
+)
+
+// MemorySuppressionStore is a SuppressionStore that keeps suppressions in memory.
+type MemorySuppressionStore struct {
+	mu           *sync.Mutex
+	suppressions map[Address]Suppression
+}
+
+func NewMemorySuppressionStore() *MemorySuppressionStore {
+	return &MemorySuppressionStore{
+		mu:           &sync.Mutex{},
+		suppressions: make(map[Address]Suppression),
+	}
+}
+
+func (s *MemorySuppressionStore) SaveSuppression(_ context.Context, sup Suppression) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.suppressions[sup.Email] = sup
+	return nil
+}
+
+func (s *MemorySuppressionStore) DeleteSuppression(_ context.Context, addr Address) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.suppressions[addr]; !ok {
+		return fmt.Errorf("suppression not found: %w", errorz.ErrNotFound)
+	}
+
+	delete(s.suppressions, addr)
+	return nil
+}
+
+func (s *MemorySuppressionStore) FindSuppressions(_ context.Context, filter SuppressionFilter) ([]Suppression, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Suppression, 0)
+	if len(filter.Emails) > 0 {
+		for _, addr := range filter.Emails {
+			if sup, ok := s.suppressions[addr]; ok {
+				out = append(out, sup)
+			}
+		}
+	} else {
+		for _, sup := range s.suppressions {
+			out = append(out, sup)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+
+	return out, nil
+}
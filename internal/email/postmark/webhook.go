@@ -0,0 +1,51 @@
+package postmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/willemschots/househunt/internal/email"
+)
+
+// webhookJSON contains the fields of the bounce and spam complaint webhooks
+// that we're interested in. See https://postmarkapp.com/developer/webhooks/bounce-webhook
+type webhookJSON struct {
+	RecordType string
+	Type       string
+	Email      string
+	BouncedAt  time.Time
+}
+
+// ParseWebhook parses a bounce or spam complaint webhook payload. The returned
+// bool reports whether the event means the address should be suppressed, soft bounces
+// and other transient failures don't warrant a suppression.
+func ParseWebhook(r io.Reader) (email.Suppression, bool, error) {
+	var data webhookJSON
+	err := json.NewDecoder(r).Decode(&data)
+	if err != nil {
+		return email.Suppression{}, false, fmt.Errorf("failed to decode webhook json: %w", err)
+	}
+
+	var reason email.SuppressionReason
+	switch {
+	case data.RecordType == "SpamComplaint":
+		reason = email.SuppressionReasonSpamComplaint
+	case data.RecordType == "Bounce" && (data.Type == "HardBounce" || data.Type == "BadEmailAddress"):
+		reason = email.SuppressionReasonHardBounce
+	default:
+		return email.Suppression{}, false, nil
+	}
+
+	addr, err := email.ParseAddress(data.Email)
+	if err != nil {
+		return email.Suppression{}, false, err
+	}
+
+	return email.Suppression{
+		Email:     addr,
+		Reason:    reason,
+		CreatedAt: data.BouncedAt,
+	}, true, nil
+}
@@ -0,0 +1,86 @@
+package postmark_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/email/postmark"
+)
+
+func Test_ParseWebhook(t *testing.T) {
+	okTests := map[string]struct {
+		payload string
+		want    email.Suppression
+		wantOK  bool
+	}{
+		"ok, hard bounce": {
+			payload: `{"RecordType":"Bounce","Type":"HardBounce","TypeCode":1,"Email":"alice@example.com","BouncedAt":"2024-05-01T12:00:00Z"}`,
+			want: email.Suppression{
+				Email:     "alice@example.com",
+				Reason:    email.SuppressionReasonHardBounce,
+				CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+			},
+			wantOK: true,
+		},
+		"ok, bad email address": {
+			payload: `{"RecordType":"Bounce","Type":"BadEmailAddress","Email":"alice@example.com","BouncedAt":"2024-05-01T12:00:00Z"}`,
+			want: email.Suppression{
+				Email:     "alice@example.com",
+				Reason:    email.SuppressionReasonHardBounce,
+				CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+			},
+			wantOK: true,
+		},
+		"ok, spam complaint": {
+			payload: `{"RecordType":"SpamComplaint","Type":"SpamComplaint","Email":"alice@example.com","BouncedAt":"2024-05-01T12:00:00Z"}`,
+			want: email.Suppression{
+				Email:     "alice@example.com",
+				Reason:    email.SuppressionReasonSpamComplaint,
+				CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+			},
+			wantOK: true,
+		},
+		"ok, soft bounce is ignored": {
+			payload: `{"RecordType":"Bounce","Type":"SoftBounce","Email":"alice@example.com","BouncedAt":"2024-05-01T12:00:00Z"}`,
+			wantOK:  false,
+		},
+		"ok, other record type is ignored": {
+			payload: `{"RecordType":"Delivery","Email":"alice@example.com"}`,
+			wantOK:  false,
+		},
+	}
+
+	for name, tc := range okTests {
+		t.Run(name, func(t *testing.T) {
+			got, ok, err := postmark.ParseWebhook(strings.NewReader(tc.payload))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if ok != tc.wantOK {
+				t.Fatalf("got ok %v, want %v", ok, tc.wantOK)
+			}
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got\n%#v\nwant\n%#v", got, tc.want)
+			}
+		})
+	}
+
+	failTests := map[string]string{
+		"invalid json":  `{"RecordType":`,
+		"invalid email": `{"RecordType":"SpamComplaint","Email":"not-an-email","BouncedAt":"2024-05-01T12:00:00Z"}`,
+	}
+
+	for name, payload := range failTests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := postmark.ParseWebhook(strings.NewReader(payload))
+			if err == nil {
+				t.Fatal("expected error, got <nil>")
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/willemschots/househunt/internal/i18n"
+	"github.com/willemschots/househunt/internal/jobs"
+)
+
+// SendKind is the kind of the background jobs that send emails.
+const SendKind = "email.send"
+
+// QueuedSender sends emails in background jobs. Sending only stores a job, the
+// email is sent once the queue runs it. This way emails are not lost when the
+// app stops, and sends that fail are retried.
+//
+// QueuedSender has the same Send method as Service, so it can be used instead.
+type QueuedSender struct {
+	kind *jobs.Kind[sendArgs]
+}
+
+// sendArgs are the arguments of a job that sends an email.
+type sendArgs struct {
+	Template  string
+	Recipient Address
+	// Locale is the locale of the context the email was sent from.
+	Locale i18n.Locale
+	// Data is the JSON encoded template data. Templates receive it
+	// decoded into maps, so they can only use its fields.
+	Data json.RawMessage
+}
+
+// NewQueuedSender registers the job kind that sends emails using svc.
+//
+// Emails to suppressed recipients are not retried, the SuppressedError is
+// passed to errHandler instead.
+func NewQueuedSender(q *jobs.Queue, svc *Service, cfg jobs.KindConfig, errHandler jobs.ErrFunc) *QueuedSender {
+	kind := jobs.Register(q, SendKind, cfg, func(ctx context.Context, args sendArgs) error {
+		var data any
+		err := json.Unmarshal(args.Data, &data)
+		if err != nil {
+			return fmt.Errorf("failed to decode template data: %w", err)
+		}
+
+		ctx = i18n.WithLocale(ctx, args.Locale)
+
+		err = svc.Send(ctx, args.Template, args.Recipient, data)
+		if errors.As(err, &SuppressedError{}) {
+			errHandler(ctx, err)
+			return nil
+		}
+
+		return err
+	})
+
+	return &QueuedSender{
+		kind: kind,
+	}
+}
+
+// Send enqueues a job that sends the named template to recipient. data
+// should survive a round trip through encoding/json.
+func (s *QueuedSender) Send(ctx context.Context, name string, recipient Address, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode template data: %w", err)
+	}
+
+	return s.kind.Enqueue(ctx, sendArgs{
+		Template:  name,
+		Recipient: recipient,
+		Locale:    i18n.LocaleFromContext(ctx),
+		Data:      raw,
+	}, jobs.EnqueueOptions{})
+}
@@ -0,0 +1,174 @@
+package email_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/willemschots/househunt/internal/db/testdb"
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/email/view"
+	"github.com/willemschots/househunt/internal/i18n"
+	"github.com/willemschots/househunt/internal/jobs"
+	jobsdb "github.com/willemschots/househunt/internal/jobs/db"
+	"github.com/willemschots/househunt/internal/krypto"
+)
+
+func Test_QueuedSender(t *testing.T) {
+	t.Run("ok, sends localized email in a job", func(t *testing.T) {
+		qt := newQueuedSenderTest(t)
+
+		ctx := i18n.WithLocale(context.Background(), i18n.Dutch)
+		data := struct{ Name, Message string }{"Jacob", "Hi"}
+		err := qt.queued.Send(ctx, "test", "jacob@example.com", data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		qt.waitForJobs(t)
+
+		if len(qt.sender.Emails) != 1 {
+			t.Fatalf("expected 1 email to be sent, got %d", len(qt.sender.Emails))
+		}
+
+		got := qt.sender.Emails[0]
+		if got.Recipient != "jacob@example.com" {
+			t.Errorf("got recipient %q", got.Recipient)
+		}
+
+		if got.Subject != "Hallo Jacob!" {
+			t.Errorf("got subject %q, want %q", got.Subject, "Hallo Jacob!")
+		}
+
+		if got.Body != "Je bericht is Hi" {
+			t.Errorf("got body %q, want %q", got.Body, "Je bericht is Hi")
+		}
+
+		qt.mu.Lock()
+		defer qt.mu.Unlock()
+
+		if len(qt.errs) != 0 {
+			t.Errorf("unexpected errors: %v", qt.errs)
+		}
+	})
+
+	t.Run("fail, suppressed recipient is not retried", func(t *testing.T) {
+		qt := newQueuedSenderTest(t)
+
+		err := qt.svc.Suppress(context.Background(), email.Suppression{
+			Email:  "jacob@example.com",
+			Reason: email.SuppressionReasonHardBounce,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		data := struct{ Name, Message string }{"Jacob", "Hi"}
+		err = qt.queued.Send(context.Background(), "test", "jacob@example.com", data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		qt.waitForJobs(t)
+
+		if len(qt.sender.Emails) != 0 {
+			t.Errorf("expected no emails to be sent, got %d", len(qt.sender.Emails))
+		}
+
+		qt.mu.Lock()
+		defer qt.mu.Unlock()
+
+		if len(qt.errs) != 1 || !errors.As(qt.errs[0], &email.SuppressedError{}) {
+			t.Errorf("expected a suppressed error, got %v", qt.errs)
+		}
+	})
+}
+
+type queuedSenderTest struct {
+	svc    *email.Service
+	sender *email.MemorySender
+	queued *email.QueuedSender
+	queue  *jobs.Queue
+	store  *jobsdb.Store
+
+	mu   *sync.Mutex
+	errs []error
+}
+
+func newQueuedSenderTest(t *testing.T) *queuedSenderTest {
+	t.Helper()
+
+	catalogue := must(i18n.LoadCatalogue(fstest.MapFS{
+		"en.json": {Data: []byte(`{"test.message": "Your message is"}`)},
+		"nl.json": {Data: []byte(`{"test.message": "Je bericht is"}`)},
+	}))
+	cfg := email.ServiceConfig{
+		From:    must(email.ParseAddress("alice@example.com")),
+		BaseURL: must(url.Parse("http://example.com")),
+	}
+
+	qt := &queuedSenderTest{
+		sender: email.NewMemorySender(),
+		mu:     &sync.Mutex{},
+	}
+	qt.svc = email.NewService(view.NewFSRenderer(os.DirFS("testdata")), qt.sender, email.NewMemorySuppressionStore(), catalogue, cfg)
+
+	encryptor := must(krypto.NewEncryptor([]krypto.Key{
+		must(krypto.ParseKey("2b671594b775f371eab4050b4d58326682df6b1a6cc2e886717b1a26b4d6c45d")),
+	}))
+
+	// The in-memory database only exists on its connection, so the same
+	// handle is used for reading and writing.
+	testDB := testdb.RunWhile(t, true)
+	qt.store = jobsdb.New(testDB, testDB, encryptor)
+
+	errHandler := func(_ context.Context, err error) {
+		qt.mu.Lock()
+		defer qt.mu.Unlock()
+		qt.errs = append(qt.errs, err)
+	}
+
+	qt.queue = jobs.NewQueue(qt.store, jobs.Config{PollInterval: 5 * time.Millisecond}, nil, errHandler)
+	qt.queued = email.NewQueuedSender(qt.queue, qt.svc, jobs.KindConfig{}, errHandler)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		qt.queue.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return qt
+}
+
+// waitForJobs waits until all jobs are done.
+func (qt *queuedSenderTest) waitForJobs(t *testing.T) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := qt.store.FindJobs(context.Background(), jobs.JobFilter{})
+		if err != nil {
+			t.Fatalf("failed to find jobs: %v", err)
+		}
+
+		if len(got) == 0 && qt.queue.Running() == 0 {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("jobs did not finish in time: %+v", got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
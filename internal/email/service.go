@@ -3,8 +3,16 @@ package email
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/url"
+	"slices"
+	"sync"
+
+	"github.com/willemschots/househunt/internal/i18n"
+	"github.com/willemschots/househunt/internal/tracing"
 )
 
 // TemplateElement is used by a renderer to identify the different parts of an email template.
@@ -17,7 +25,9 @@ const (
 
 // Renderer is responsible for rendering email templates.
 type Renderer interface {
-	Render(w io.Writer, name string, element TemplateElement, data any) error
+	// Render renders the named template, preferring the version localized for
+	// locale if it exists.
+	Render(w io.Writer, name string, locale i18n.Locale, element TemplateElement, data any) error
 }
 
 // Sender is responsible for actually sending an email.
@@ -25,6 +35,15 @@ type Sender interface {
 	Send(ctx context.Context, from, recipient Address, subject, body string) error
 }
 
+// Outcome is the outcome of an attempt to send an email.
+type Outcome string
+
+const (
+	OutcomeSent       Outcome = "sent"
+	OutcomeSuppressed Outcome = "suppressed"
+	OutcomeFailed     Outcome = "failed"
+)
+
 // ServiceConfig is the configuration for the email service.
 type ServiceConfig struct {
 	From    Address
@@ -33,42 +52,187 @@ type ServiceConfig struct {
 
 // Service provides the main functionality for sending emails.
 type Service struct {
-	cfg      ServiceConfig
-	renderer Renderer
-	sender   Sender
+	cfg          ServiceConfig
+	renderer     Renderer
+	sender       Sender
+	suppressions SuppressionStore
+	catalogue    *i18n.Catalogue
+
+	statsMu *sync.Mutex
+	stats   map[Outcome]uint64
 }
 
-func NewService(renderer Renderer, sender Sender, cfg ServiceConfig) *Service {
+func NewService(renderer Renderer, sender Sender, suppressions SuppressionStore, catalogue *i18n.Catalogue, cfg ServiceConfig) *Service {
 	return &Service{
-		cfg:      cfg,
-		renderer: renderer,
-		sender:   sender,
+		cfg:          cfg,
+		renderer:     renderer,
+		sender:       sender,
+		suppressions: suppressions,
+		catalogue:    catalogue,
+		statsMu:      &sync.Mutex{},
+		stats:        make(map[Outcome]uint64),
+	}
+}
+
+// Stats returns the number of attempts to send an email per outcome, since the
+// service was created.
+func (s *Service) Stats() map[Outcome]uint64 {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	out := make(map[Outcome]uint64, len(s.stats))
+	for k, v := range s.stats {
+		out[k] = v
 	}
+
+	return out
 }
 
+// viewData is the data passed to the email templates.
+type viewData struct {
+	Global     any
+	View       any
+	Locale     i18n.Locale
+	translator i18n.Translator
+}
+
+// T translates the message for key, see i18n.Translator.T.
+func (vd viewData) T(key string, args ...any) string {
+	return vd.translator.T(key, args...)
+}
+
+// Send renders the named template and sends it to the recipient. The template is
+// localized using the locale carried by ctx. If the recipient is suppressed, a
+// SuppressedError is returned and nothing is sent.
 func (s *Service) Send(ctx context.Context, name string, recipient Address, data any) error {
+	ctx, span := tracing.Start(ctx, "email.Service.Send", tracing.String("email.template", name))
+
+	err := s.send(ctx, name, recipient, data)
+
+	outcome := OutcomeSent
+	if errors.As(err, &SuppressedError{}) {
+		outcome = OutcomeSuppressed
+	} else if err != nil {
+		outcome = OutcomeFailed
+	}
+
+	s.statsMu.Lock()
+	s.stats[outcome]++
+	s.statsMu.Unlock()
+
+	span.SetAttributes(tracing.String("email.outcome", string(outcome)))
+	span.EndErr(err)
+
+	return err
+}
+
+func (s *Service) send(ctx context.Context, name string, recipient Address, data any) error {
+	suppressions, err := s.suppressions.FindSuppressions(ctx, SuppressionFilter{
+		Emails: []Address{recipient},
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(suppressions) > 0 {
+		return SuppressedError{
+			Recipient: recipient,
+			Reason:    suppressions[0].Reason,
+		}
+	}
+
+	subject, body, err := s.render(name, i18n.LocaleFromContext(ctx), data)
+	if err != nil {
+		return err
+	}
+
+	ctx, span := tracing.Start(ctx, "email.Sender.Send")
+	span.SetKind(tracing.KindClient)
+	err = s.sender.Send(ctx, s.cfg.From, recipient, subject, body)
+	span.EndErr(err)
+
+	return err
+}
+
+// CheckTemplates renders every template in templates with the sample data it's
+// mapped to, for every supported locale. Nothing is sent. It returns an error if
+// a template can't be found or fails to render.
+//
+// Like QueuedSender, the sample data is round tripped through encoding/json
+// first, so templates that rely on methods of the data fail the check.
+func (s *Service) CheckTemplates(templates map[string]any) error {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	samples := make(map[string]any, len(templates))
+	for _, name := range names {
+		raw, err := json.Marshal(templates[name])
+		if err != nil {
+			return fmt.Errorf("email template %q: failed to encode sample data: %w", name, err)
+		}
+
+		var data any
+		err = json.Unmarshal(raw, &data)
+		if err != nil {
+			return fmt.Errorf("email template %q: failed to decode sample data: %w", name, err)
+		}
+
+		samples[name] = data
+	}
+
+	var errs []error
+	for _, locale := range i18n.Supported {
+		for _, name := range names {
+			_, _, err := s.render(name, locale, samples[name])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("email template %q (locale %s): %w", name, locale, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Service) render(name string, locale i18n.Locale, data any) (string, string, error) {
 	var (
 		sBuf bytes.Buffer
 		bBuf bytes.Buffer
 	)
 
-	viewData := struct {
-		Global any
-		View   any
-	}{
-		Global: s.cfg,
-		View:   data,
+	vd := viewData{
+		Global:     s.cfg,
+		View:       data,
+		Locale:     locale,
+		translator: s.catalogue.Translator(locale),
 	}
 
-	err := s.renderer.Render(&sBuf, name, ElementSubject, viewData)
+	err := s.renderer.Render(&sBuf, name, locale, ElementSubject, vd)
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
-	err = s.renderer.Render(&bBuf, name, ElementBody, viewData)
+	err = s.renderer.Render(&bBuf, name, locale, ElementBody, vd)
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
-	return s.sender.Send(ctx, s.cfg.From, recipient, sBuf.String(), bBuf.String())
+	return sBuf.String(), bBuf.String(), nil
+}
+
+// Suppress prevents any further emails being sent to the address in sup.
+func (s *Service) Suppress(ctx context.Context, sup Suppression) error {
+	return s.suppressions.SaveSuppression(ctx, sup)
+}
+
+// LiftSuppression allows emails to be sent to addr again.
+func (s *Service) LiftSuppression(ctx context.Context, addr Address) error {
+	return s.suppressions.DeleteSuppression(ctx, addr)
+}
+
+// Suppressions returns all suppressed addresses.
+func (s *Service) Suppressions(ctx context.Context) ([]Suppression, error) {
+	return s.suppressions.FindSuppressions(ctx, SuppressionFilter{})
 }
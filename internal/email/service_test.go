@@ -3,14 +3,18 @@ package email_test
 import (
 	"bytes"
 	"context"
+	"errors"
 	"log/slog"
 	"net/url"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/willemschots/househunt/internal/email"
 	"github.com/willemschots/househunt/internal/email/view"
+	"github.com/willemschots/househunt/internal/i18n"
 )
 
 func Test_SendEmail(t *testing.T) {
@@ -26,7 +30,7 @@ func Test_SendEmail(t *testing.T) {
 			BaseURL: must(url.Parse("http://example.com")),
 		}
 
-		svc := email.NewService(renderer, sender, cfg)
+		svc := email.NewService(renderer, sender, email.NewMemorySuppressionStore(), nil, cfg)
 
 		data := struct {
 			Name    string
@@ -55,6 +59,183 @@ func Test_SendEmail(t *testing.T) {
 	})
 }
 
+func Test_SendEmail_Localized(t *testing.T) {
+	catalogue := must(i18n.LoadCatalogue(fstest.MapFS{
+		"en.json": {Data: []byte(`{"test.message": "Your message is"}`)},
+		"nl.json": {Data: []byte(`{"test.message": "Je bericht is"}`)},
+	}))
+
+	tests := map[string]struct {
+		locale      i18n.Locale
+		wantSubject string
+		wantBody    string
+	}{
+		"ok, localized template": {
+			locale:      i18n.Dutch,
+			wantSubject: "Hallo Jacob!",
+			wantBody:    "Je bericht is Hi",
+		},
+		"ok, fallback to default template": {
+			locale:      i18n.English,
+			wantSubject: "Hello Jacob!",
+			wantBody:    "Your message is Hi",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			renderer := view.NewFSRenderer(os.DirFS("testdata"))
+			sender := email.NewMemorySender()
+
+			cfg := email.ServiceConfig{
+				From:    must(email.ParseAddress("alice@example.com")),
+				BaseURL: must(url.Parse("http://example.com")),
+			}
+
+			svc := email.NewService(renderer, sender, email.NewMemorySuppressionStore(), catalogue, cfg)
+
+			ctx := i18n.WithLocale(context.Background(), tc.locale)
+			data := struct{ Name, Message string }{"Jacob", "Hi"}
+			err := svc.Send(ctx, "test", "jacob@example.com", data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(sender.Emails) != 1 {
+				t.Fatalf("expected 1 email to be sent, got %d", len(sender.Emails))
+			}
+
+			got := sender.Emails[0]
+			if got.Subject != tc.wantSubject {
+				t.Errorf("got subject %q, want %q", got.Subject, tc.wantSubject)
+			}
+
+			if got.Body != tc.wantBody {
+				t.Errorf("got body %q, want %q", got.Body, tc.wantBody)
+			}
+		})
+	}
+}
+
+func Test_SendEmail_Suppressed(t *testing.T) {
+	t.Run("fail, recipient is suppressed", func(t *testing.T) {
+		renderer := view.NewFSRenderer(os.DirFS("testdata"))
+		sender := email.NewMemorySender()
+		suppressions := email.NewMemorySuppressionStore()
+
+		cfg := email.ServiceConfig{
+			From:    must(email.ParseAddress("alice@example.com")),
+			BaseURL: must(url.Parse("http://example.com")),
+		}
+
+		svc := email.NewService(renderer, sender, suppressions, nil, cfg)
+
+		err := svc.Suppress(context.Background(), email.Suppression{
+			Email:  "jacob@example.com",
+			Reason: email.SuppressionReasonHardBounce,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		data := struct{ Name, Message string }{"Jacob", "Hi"}
+		err = svc.Send(context.Background(), "test", "jacob@example.com", data)
+
+		var supErr email.SuppressedError
+		if !errors.As(err, &supErr) {
+			t.Fatalf("expected error to be email.SuppressedError via errors.As, got %v", err)
+		}
+
+		if supErr.Reason != email.SuppressionReasonHardBounce {
+			t.Errorf("got reason %q, want %q", supErr.Reason, email.SuppressionReasonHardBounce)
+		}
+
+		if len(sender.Emails) != 0 {
+			t.Errorf("expected no emails to be sent, got %d", len(sender.Emails))
+		}
+
+		// After lifting the suppression we can send again.
+		err = svc.LiftSuppression(context.Background(), "jacob@example.com")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		err = svc.Send(context.Background(), "test", "jacob@example.com", data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(sender.Emails) != 1 {
+			t.Errorf("expected 1 email to be sent, got %d", len(sender.Emails))
+		}
+
+		want := map[email.Outcome]uint64{
+			email.OutcomeSuppressed: 1,
+			email.OutcomeSent:       1,
+		}
+		if got := svc.Stats(); !reflect.DeepEqual(got, want) {
+			t.Errorf("got stats %v, want %v", got, want)
+		}
+	})
+}
+
+func Test_CheckTemplates(t *testing.T) {
+	newService := func(t *testing.T) *email.Service {
+		renderer, err := view.NewMemRenderer(os.DirFS("testdata"))
+		if err != nil {
+			t.Fatalf("failed to create renderer: %v", err)
+		}
+
+		cfg := email.ServiceConfig{
+			From:    must(email.ParseAddress("alice@example.com")),
+			BaseURL: must(url.Parse("http://example.com")),
+		}
+
+		sender := email.NewMemorySender()
+
+		return email.NewService(renderer, sender, email.NewMemorySuppressionStore(), nil, cfg)
+	}
+
+	t.Run("ok, templates render", func(t *testing.T) {
+		svc := newService(t)
+
+		err := svc.CheckTemplates(map[string]any{
+			"test": struct{ Name, Message string }{},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("fail, template calls a method of the data", func(t *testing.T) {
+		svc := newService(t)
+
+		err := svc.CheckTemplates(map[string]any{
+			"method": greeter{},
+		})
+		if err == nil || !strings.Contains(err.Error(), `"method"`) {
+			t.Fatalf("expected render error, got: %v", err)
+		}
+	})
+
+	t.Run("fail, template is missing", func(t *testing.T) {
+		svc := newService(t)
+
+		err := svc.CheckTemplates(map[string]any{
+			"missing": nil,
+		})
+		if err == nil || !strings.Contains(err.Error(), `"missing" not found`) {
+			t.Fatalf("expected missing template error, got: %v", err)
+		}
+	})
+}
+
+type greeter struct{}
+
+func (greeter) Greet(name string) string {
+	return "Hello " + name
+}
+
 func must[T any](v T, err error) T {
 	if err != nil {
 		panic(err)
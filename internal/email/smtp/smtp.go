@@ -0,0 +1,331 @@
+package smtp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	netsmtp "net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/krypto"
+)
+
+var (
+	ErrInvalidTLSMode       = errors.New("invalid tls mode")
+	ErrInvalidAuthMechanism = errors.New("invalid auth mechanism")
+)
+
+// TLSMode determines how the connection to the SMTP server is secured.
+type TLSMode string
+
+const (
+	// TLSModeNone sends everything in plaintext. Only use this for local development.
+	TLSModeNone TLSMode = "none"
+	// TLSModeStartTLS upgrades a plaintext connection using the STARTTLS command.
+	TLSModeStartTLS TLSMode = "starttls"
+	// TLSModeImplicit connects using TLS from the start (usually port 465).
+	TLSModeImplicit TLSMode = "implicit"
+)
+
+// ParseTLSMode parses raw as a TLSMode.
+func ParseTLSMode(raw string) (TLSMode, error) {
+	switch m := TLSMode(raw); m {
+	case TLSModeNone, TLSModeStartTLS, TLSModeImplicit:
+		return m, nil
+	default:
+		return "", ErrInvalidTLSMode
+	}
+}
+
+// AuthMechanism is the mechanism used to authenticate with the SMTP server.
+type AuthMechanism string
+
+const (
+	AuthNone  AuthMechanism = "none"
+	AuthPlain AuthMechanism = "plain"
+	AuthLogin AuthMechanism = "login"
+)
+
+// ParseAuthMechanism parses raw as an AuthMechanism.
+func ParseAuthMechanism(raw string) (AuthMechanism, error) {
+	switch m := AuthMechanism(raw); m {
+	case AuthNone, AuthPlain, AuthLogin:
+		return m, nil
+	default:
+		return "", ErrInvalidAuthMechanism
+	}
+}
+
+// Settings contains the settings for the SMTP server.
+type Settings struct {
+	Host     string
+	Port     int
+	Username krypto.Secret
+	Password krypto.Secret
+	TLSMode  TLSMode
+	Auth     AuthMechanism
+	// Timeout is the max duration of a single Send call. The deadline of the
+	// context passed to Send takes precedence if it's earlier.
+	Timeout time.Duration
+}
+
+// Sender is an email sender that sends emails via a SMTP server.
+type Sender struct {
+	settings Settings
+	// TLSConfig is used for both STARTTLS and implicit TLS. If nil, a config
+	// verifying the certificate against Settings.Host is used.
+	// Exposed for testing purposes.
+	TLSConfig *tls.Config
+	// NowFunc is used to get the current time.
+	// Exposed for testing purposes.
+	NowFunc func() time.Time
+}
+
+// NewSender creates a new sender.
+func NewSender(s Settings) *Sender {
+	return &Sender{
+		settings: s,
+		NowFunc:  time.Now,
+	}
+}
+
+// Send sends an email via the configured SMTP server.
+func (s *Sender) Send(ctx context.Context, from, recipient email.Address, subject, body string) error {
+	msg, err := buildMessage(from, recipient, subject, body, s.NowFunc())
+	if err != nil {
+		return fmt.Errorf("failed to build message: %w", err)
+	}
+
+	if s.settings.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.settings.Timeout)
+		defer cancel()
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	// net/smtp does not support contexts, so we use the deadline of the
+	// connection instead.
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to set deadline: %w", err)
+		}
+	}
+
+	c, err := netsmtp.NewClient(conn, s.settings.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer c.Close()
+
+	if s.settings.TLSMode == TLSModeStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("server does not support STARTTLS")
+		}
+
+		err = c.StartTLS(s.tlsConfig())
+		if err != nil {
+			return fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+
+	if a := s.auth(); a != nil {
+		err = c.Auth(a)
+		if err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	err = c.Mail(string(from))
+	if err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+
+	err = c.Rcpt(string(recipient))
+	if err != nil {
+		return fmt.Errorf("failed to set recipient: %w", err)
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start data: %w", err)
+	}
+
+	_, err = w.Write(msg)
+	if err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return c.Quit()
+}
+
+func (s *Sender) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(s.settings.Host, strconv.Itoa(s.settings.Port))
+
+	if s.settings.TLSMode == TLSModeImplicit {
+		d := &tls.Dialer{Config: s.tlsConfig()}
+		return d.DialContext(ctx, "tcp", addr)
+	}
+
+	d := &net.Dialer{}
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+func (s *Sender) tlsConfig() *tls.Config {
+	if s.TLSConfig != nil {
+		return s.TLSConfig
+	}
+
+	return &tls.Config{
+		ServerName: s.settings.Host,
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
+func (s *Sender) auth() netsmtp.Auth {
+	username := string(s.settings.Username.SecretValue())
+	password := string(s.settings.Password.SecretValue())
+
+	switch s.settings.Auth {
+	case AuthPlain:
+		return netsmtp.PlainAuth("", username, password, s.settings.Host)
+	case AuthLogin:
+		return &loginAuth{
+			host:     s.settings.Host,
+			username: username,
+			password: password,
+		}
+	default:
+		return nil
+	}
+}
+
+// loginAuth implements the LOGIN authentication mechanism, which net/smtp
+// does not provide. Some (older) mail servers only support this mechanism.
+type loginAuth struct {
+	host     string
+	username string
+	password string
+}
+
+func (a *loginAuth) Start(server *netsmtp.ServerInfo) (string, []byte, error) {
+	// Like netsmtp.PlainAuth, refuse to send credentials over an unencrypted
+	// connection unless we're talking to localhost.
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge: %q", fromServer)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+// buildMessage builds a plain text MIME message.
+func buildMessage(from, recipient email.Address, subject, body string, now time.Time) ([]byte, error) {
+	msgID, err := messageID(from)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+
+	headers := [][2]string{
+		{"From", string(from)},
+		{"To", string(recipient)},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", now.Format(time.RFC1123Z)},
+		{"Message-ID", msgID},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	}
+
+	for _, h := range headers {
+		// Header values should never contain line breaks, these
+		// could be used to inject additional headers.
+		if strings.ContainsAny(h[1], "\r\n") {
+			return nil, fmt.Errorf("header %s contains a line break", h[0])
+		}
+
+		b.WriteString(h[0])
+		b.WriteString(": ")
+		b.WriteString(h[1])
+		b.WriteString("\r\n")
+	}
+
+	b.WriteString("\r\n")
+
+	// SMTP requires CRLF line endings.
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	body = strings.ReplaceAll(body, "\n", "\r\n")
+
+	qp := quotedprintable.NewWriter(&b)
+	_, err = qp.Write([]byte(body))
+	if err != nil {
+		return nil, err
+	}
+
+	err = qp.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func messageID(from email.Address) (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	domain := "localhost"
+	if i := strings.LastIndex(string(from), "@"); i != -1 {
+		domain = string(from)[i+1:]
+	}
+
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain), nil
+}
@@ -0,0 +1,276 @@
+package smtp_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/willemschots/househunt/internal/email/smtp"
+	"github.com/willemschots/househunt/internal/krypto"
+)
+
+func Test_Sender_Send(t *testing.T) {
+	okTests := map[string]struct {
+		auth     smtp.AuthMechanism
+		wantAuth string
+	}{
+		"ok, no auth": {
+			auth:     smtp.AuthNone,
+			wantAuth: "",
+		},
+		"ok, plain auth": {
+			auth:     smtp.AuthPlain,
+			wantAuth: "PLAIN alice:secret",
+		},
+		"ok, login auth": {
+			auth:     smtp.AuthLogin,
+			wantAuth: "LOGIN alice:secret",
+		},
+	}
+
+	for name, tc := range okTests {
+		t.Run(name, func(t *testing.T) {
+			srv := newFakeServer(t)
+
+			sender := smtp.NewSender(srv.settings(tc.auth))
+			sender.NowFunc = func() time.Time {
+				return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			}
+
+			err := sender.Send(context.Background(), "househunt@example.com", "jacob@example.com", "Hëllo", "Line 1\nLine 2")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := srv.wait(t)
+
+			if got.auth != tc.wantAuth {
+				t.Errorf("got auth %q, want %q", got.auth, tc.wantAuth)
+			}
+
+			if got.from != "<househunt@example.com>" {
+				t.Errorf("got from %q", got.from)
+			}
+
+			if got.rcpt != "<jacob@example.com>" {
+				t.Errorf("got rcpt %q", got.rcpt)
+			}
+
+			for _, want := range []string{
+				"From: househunt@example.com\r\n",
+				"To: jacob@example.com\r\n",
+				"Subject: =?utf-8?q?H=C3=ABllo?=\r\n",
+				"Date: Wed, 01 May 2024 12:00:00 +0000\r\n",
+				"Message-ID: <",
+				"@example.com>\r\n",
+				"MIME-Version: 1.0\r\n",
+				"Content-Type: text/plain; charset=utf-8\r\n",
+				"Content-Transfer-Encoding: quoted-printable\r\n",
+				"\r\n\r\nLine 1\r\nLine 2",
+			} {
+				if !strings.Contains(got.data, want) {
+					t.Errorf("want message to contain %q, got:\n%s", want, got.data)
+				}
+			}
+		})
+	}
+
+	t.Run("fail, starttls not supported by server", func(t *testing.T) {
+		srv := newFakeServer(t)
+
+		settings := srv.settings(smtp.AuthNone)
+		settings.TLSMode = smtp.TLSModeStartTLS
+
+		err := smtp.NewSender(settings).Send(context.Background(), "househunt@example.com", "jacob@example.com", "Hello", "Body")
+		if err == nil {
+			t.Fatal("expected error, got <nil>")
+		}
+	})
+
+	t.Run("fail, header injection", func(t *testing.T) {
+		srv := newFakeServer(t)
+
+		sender := smtp.NewSender(srv.settings(smtp.AuthNone))
+
+		err := sender.Send(context.Background(), "househunt@example.com", "jacob@example.com\r\nBcc: eve@example.com", "Hello", "Body")
+		if err == nil {
+			t.Fatal("expected error, got <nil>")
+		}
+	})
+}
+
+func Test_ParseTLSMode(t *testing.T) {
+	for _, raw := range []string{"none", "starttls", "implicit"} {
+		got, err := smtp.ParseTLSMode(raw)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", raw, err)
+		}
+
+		if string(got) != raw {
+			t.Errorf("got %q, want %q", got, raw)
+		}
+	}
+
+	_, err := smtp.ParseTLSMode("ssl")
+	if err == nil {
+		t.Fatal("expected error, got <nil>")
+	}
+}
+
+// received contains what the fake server received from the client.
+type received struct {
+	auth string
+	from string
+	rcpt string
+	data string
+}
+
+// fakeServer is a minimal SMTP server that accepts a single connection.
+type fakeServer struct {
+	ln     net.Listener
+	mu     *sync.Mutex
+	done   chan struct{}
+	result received
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	srv := &fakeServer{
+		ln:   ln,
+		mu:   &sync.Mutex{},
+		done: make(chan struct{}),
+	}
+
+	t.Cleanup(func() {
+		ln.Close()
+	})
+
+	go srv.serve()
+
+	return srv
+}
+
+func (s *fakeServer) settings(auth smtp.AuthMechanism) smtp.Settings {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	return smtp.Settings{
+		Host:     host,
+		Port:     must(strconv.Atoi(port)),
+		Username: krypto.NewSecret("alice"),
+		Password: krypto.NewSecret("secret"),
+		TLSMode:  smtp.TLSModeNone,
+		Auth:     auth,
+		Timeout:  time.Second,
+	}
+}
+
+func (s *fakeServer) wait(t *testing.T) received {
+	t.Helper()
+
+	select {
+	case <-s.done:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for fake server")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.result
+}
+
+func (s *fakeServer) serve() {
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	defer close(s.done)
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+	readLine := func() string {
+		line, _ := r.ReadString('\n')
+		return strings.TrimRight(line, "\r\n")
+	}
+	decode := func(s string) string {
+		b, _ := base64.StdEncoding.DecodeString(s)
+		return string(b)
+	}
+
+	reply("220 fake ESMTP")
+	for {
+		line := readLine()
+		cmd, arg, _ := strings.Cut(line, " ")
+
+		s.mu.Lock()
+		switch strings.ToUpper(cmd) {
+		case "EHLO":
+			reply("250-fake")
+			reply("250 AUTH PLAIN LOGIN")
+		case "AUTH":
+			mech, initial, _ := strings.Cut(arg, " ")
+			switch mech {
+			case "PLAIN":
+				parts := strings.Split(decode(initial), "\x00")
+				s.result.auth = "PLAIN " + parts[1] + ":" + parts[2]
+			case "LOGIN":
+				reply("334 " + base64.StdEncoding.EncodeToString([]byte("Username:")))
+				user := decode(readLine())
+				reply("334 " + base64.StdEncoding.EncodeToString([]byte("Password:")))
+				pass := decode(readLine())
+				s.result.auth = "LOGIN " + user + ":" + pass
+			}
+			reply("235 authenticated")
+		case "MAIL":
+			s.result.from = strings.TrimPrefix(arg, "FROM:")
+			reply("250 ok")
+		case "RCPT":
+			s.result.rcpt = strings.TrimPrefix(arg, "TO:")
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var b strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				b.WriteString(l)
+			}
+			s.result.data = b.String()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			s.mu.Unlock()
+			return
+		default:
+			reply("502 not implemented")
+		}
+		s.mu.Unlock()
+
+		if line == "" {
+			return
+		}
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
@@ -0,0 +1,53 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SuppressionReason is the reason an address was suppressed.
+type SuppressionReason string
+
+const (
+	// SuppressionReasonHardBounce indicates the address does not (or no longer) exist.
+	SuppressionReasonHardBounce SuppressionReason = "hard_bounce"
+	// SuppressionReasonSpamComplaint indicates the recipient marked one of our emails as spam.
+	SuppressionReasonSpamComplaint SuppressionReason = "spam_complaint"
+)
+
+// Suppression marks an address that we should no longer send emails to.
+type Suppression struct {
+	Email     Address
+	Reason    SuppressionReason
+	CreatedAt time.Time
+}
+
+// SuppressionFilter is used to filter suppressions.
+// Returned suppressions must match all the provided fields.
+// If a field is empty or nil, it's ignored.
+type SuppressionFilter struct {
+	Emails []Address
+}
+
+// SuppressionStore stores suppressed addresses.
+type SuppressionStore interface {
+	// SaveSuppression creates a suppression, or replaces an existing
+	// suppression for the same address.
+	SaveSuppression(ctx context.Context, s Suppression) error
+	// DeleteSuppression deletes the suppression for the address, it
+	// returns errorz.ErrNotFound if the address is not suppressed.
+	DeleteSuppression(ctx context.Context, addr Address) error
+	FindSuppressions(ctx context.Context, filter SuppressionFilter) ([]Suppression, error)
+}
+
+// SuppressedError is returned when attempting to send an email to a suppressed address.
+type SuppressedError struct {
+	Recipient Address
+	Reason    SuppressionReason
+}
+
+func (e SuppressedError) Error() string {
+	// Don't include the address, errors end up in logs.
+	return fmt.Sprintf("recipient is suppressed: %s", e.Reason)
+}
@@ -5,6 +5,7 @@ import (
 	"io/fs"
 
 	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/i18n"
 )
 
 type FSRenderer struct {
@@ -15,8 +16,8 @@ func NewFSRenderer(fs fs.FS) *FSRenderer {
 	return &FSRenderer{fs: fs}
 }
 
-func (r *FSRenderer) Render(w io.Writer, name string, element email.TemplateElement, data any) error {
-	v, err := Parse(r.fs, name)
+func (r *FSRenderer) Render(w io.Writer, name string, locale i18n.Locale, element email.TemplateElement, data any) error {
+	v, err := ParseLocalized(r.fs, name, locale)
 	if err != nil {
 		return err
 	}
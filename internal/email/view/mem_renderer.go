@@ -7,10 +7,12 @@ import (
 	"strings"
 
 	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/i18n"
 )
 
 // MemRenderer renders views from memory.
 type MemRenderer struct {
+	// views are keyed by "{name}" or "{name}.{locale}" for localized views.
 	views map[string]*View
 }
 
@@ -23,13 +25,21 @@ func NewMemRenderer(viewFS fs.FS) (*MemRenderer, error) {
 
 	views := make(map[string]*View, len(files))
 	for _, file := range files {
-		viewName := strings.TrimSuffix(file, ".tmpl")
-		view, err := Parse(viewFS, viewName)
+		key := strings.TrimSuffix(file, ".tmpl")
+		viewName, locale, _ := strings.Cut(key, ".")
+
+		for _, part := range []string{viewName, locale} {
+			if err := validateName(part); err != nil {
+				return nil, err
+			}
+		}
+
+		view, err := parseFile(viewFS, viewName, file)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse view %q: %w", viewName, err)
+			return nil, fmt.Errorf("failed to parse view %q: %w", key, err)
 		}
 
-		views[viewName] = view
+		views[key] = view
 	}
 
 	return &MemRenderer{
@@ -37,8 +47,14 @@ func NewMemRenderer(viewFS fs.FS) (*MemRenderer, error) {
 	}, nil
 }
 
-func (r *MemRenderer) Render(w io.Writer, name string, element email.TemplateElement, data any) error {
-	v, ok := r.views[name]
+// Render renders the view for name, it prefers a view localized for locale
+// if there is one.
+func (r *MemRenderer) Render(w io.Writer, name string, locale i18n.Locale, element email.TemplateElement, data any) error {
+	v, ok := r.views[name+"."+string(locale)]
+	if !ok {
+		v, ok = r.views[name]
+	}
+
 	if !ok {
 		return fmt.Errorf("view %q not found", name)
 	}
@@ -7,6 +7,7 @@ import (
 	"text/template"
 
 	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/i18n"
 )
 
 // View is a template used to render email messages.
@@ -27,7 +28,30 @@ func Parse(fs fs.FS, name string) (*View, error) {
 		return nil, err
 	}
 
-	filename := fmt.Sprintf("%s.tmpl", name)
+	return parseFile(fs, name, fmt.Sprintf("%s.tmpl", name))
+}
+
+// ParseLocalized parses the view for the given name and locale. It prefers
+// a {name}.{locale}.tmpl file and falls back to {name}.tmpl if there is none.
+func ParseLocalized(viewFS fs.FS, name string, locale i18n.Locale) (*View, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+
+	if err := validateName(string(locale)); err != nil {
+		return nil, err
+	}
+
+	filename := fmt.Sprintf("%s.%s.tmpl", name, locale)
+	_, err := fs.Stat(viewFS, filename)
+	if err != nil {
+		return Parse(viewFS, name)
+	}
+
+	return parseFile(viewFS, name, filename)
+}
+
+func parseFile(fs fs.FS, name, filename string) (*View, error) {
 	tmpl, err := template.New(name).ParseFS(fs, filename)
 	if err != nil {
 		return nil, err
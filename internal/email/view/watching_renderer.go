@@ -0,0 +1,84 @@
+package view
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/fswatch"
+	"github.com/willemschots/househunt/internal/i18n"
+)
+
+// WatchingRenderer renders views from a file system. Parsed views are cached
+// until files in the file system change, so changes show up without restarting
+// the server and without parsing the views for every email.
+type WatchingRenderer struct {
+	fs fs.FS
+	mu *sync.Mutex
+	// views are keyed by "{name}.{locale}".
+	views   map[string]*View
+	watcher *fswatch.Watcher
+}
+
+// NewWatchingRenderer returns a new WatchingRenderer that checks viewFS for
+// changes every interval. Call Close to stop watching.
+func NewWatchingRenderer(viewFS fs.FS, interval time.Duration) (*WatchingRenderer, error) {
+	r := &WatchingRenderer{
+		fs:    viewFS,
+		mu:    &sync.Mutex{},
+		views: make(map[string]*View),
+	}
+
+	w, err := fswatch.Watch(viewFS, interval, r.invalidate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch views: %w", err)
+	}
+
+	r.watcher = w
+
+	return r, nil
+}
+
+// Render renders the view for name, it prefers a view localized for locale
+// if there is one.
+func (r *WatchingRenderer) Render(w io.Writer, name string, locale i18n.Locale, element email.TemplateElement, data any) error {
+	v, err := r.view(name, locale)
+	if err != nil {
+		return err
+	}
+
+	return v.Render(w, element, data)
+}
+
+// Close stops watching the file system.
+func (r *WatchingRenderer) Close() error {
+	return r.watcher.Close()
+}
+
+func (r *WatchingRenderer) view(name string, locale i18n.Locale) (*View, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := name + "." + string(locale)
+	if v, ok := r.views[key]; ok {
+		return v, nil
+	}
+
+	v, err := ParseLocalized(r.fs, name, locale)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse view %q: %w", name, err)
+	}
+
+	r.views[key] = v
+	return v, nil
+}
+
+func (r *WatchingRenderer) invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	clear(r.views)
+}
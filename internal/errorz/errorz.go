@@ -3,7 +3,9 @@ package errorz
 import (
 	"database/sql"
 	"errors"
+	"strings"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/mattn/go-sqlite3"
 )
 
@@ -30,5 +32,14 @@ func MapDBErr(err error) error {
 		}
 	}
 
+	// Postgres error codes of class 23 are integrity constraint violations,
+	// like unique (23505), foreign key (23503) and not null (23502) violations.
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		if strings.HasPrefix(pgErr.Code, "23") {
+			return ErrConstraintViolated
+		}
+	}
+
 	return err
 }
@@ -0,0 +1,115 @@
+// Package fswatch watches file systems for changes.
+//
+// Changes are detected by polling instead of OS notifications, because those
+// don't work reliably for directories that are mounted into containers. Which
+// is how files are usually edited during development.
+package fswatch
+
+import (
+	"io/fs"
+	"maps"
+	"time"
+)
+
+// Watcher polls a file system and calls a function when files in it change.
+type Watcher struct {
+	fsys     fs.FS
+	interval time.Duration
+	onChange func()
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// Watch starts watching fsys for changes to files, including files in
+// subdirectories. Every interval, fsys is checked for created, modified
+// and removed files. If there are any, onChange is called.
+//
+// onChange is called from a separate goroutine. Call Close to stop watching.
+func Watch(fsys fs.FS, interval time.Duration, onChange func()) (*Watcher, error) {
+	state, err := snapshot(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		fsys:     fsys,
+		interval: interval,
+		onChange: onChange,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go w.loop(state)
+
+	return w, nil
+}
+
+// Close stops watching and waits for a running onChange call to return.
+func (w *Watcher) Close() error {
+	close(w.stop)
+	<-w.done
+	return nil
+}
+
+func (w *Watcher) loop(state map[string]fileState) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		next, err := snapshot(w.fsys)
+		if err != nil {
+			// Files can be removed while we walk the file system, so we
+			// try again on the next tick.
+			continue
+		}
+
+		if !maps.Equal(state, next) {
+			state = next
+			w.onChange()
+		}
+	}
+}
+
+// fileState is the state of a file that is compared to detect changes.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func snapshot(fsys fs.FS) (map[string]fileState, error) {
+	state := make(map[string]fileState)
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		state[path] = fileState{
+			modTime: info.ModTime(),
+			size:    info.Size(),
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
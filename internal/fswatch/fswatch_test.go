@@ -0,0 +1,118 @@
+package fswatch_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/willemschots/househunt/internal/fswatch"
+)
+
+func Test_Watch(t *testing.T) {
+	tests := map[string]func(t *testing.T, dir string){
+		"ok, create file": func(t *testing.T, dir string) {
+			writeFile(t, filepath.Join(dir, "new.html"), "new", time.Now())
+		},
+		"ok, create file in subdirectory": func(t *testing.T, dir string) {
+			writeFile(t, filepath.Join(dir, "sub", "new.html"), "new", time.Now())
+		},
+		"ok, modify file": func(t *testing.T, dir string) {
+			// The modification time is moved, file systems with a coarse
+			// resolution would otherwise not report a change.
+			writeFile(t, filepath.Join(dir, "base.html"), "base", time.Now().Add(time.Hour))
+		},
+		"ok, modify file in subdirectory": func(t *testing.T, dir string) {
+			writeFile(t, filepath.Join(dir, "partials", "partial.html"), "changed partial", time.Now())
+		},
+		"ok, remove file": func(t *testing.T, dir string) {
+			err := os.Remove(filepath.Join(dir, "base.html"))
+			if err != nil {
+				t.Fatalf("failed to remove file: %v", err)
+			}
+		},
+	}
+
+	for name, change := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := dirForTest(t)
+
+			changed := make(chan struct{}, 10)
+			w, err := fswatch.Watch(os.DirFS(dir), 5*time.Millisecond, func() {
+				changed <- struct{}{}
+			})
+			if err != nil {
+				t.Fatalf("failed to watch: %v", err)
+			}
+			defer w.Close()
+
+			change(t, dir)
+
+			select {
+			case <-changed:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("expected change to be reported")
+			}
+		})
+	}
+
+	t.Run("ok, no change", func(t *testing.T) {
+		dir := dirForTest(t)
+
+		changed := make(chan struct{}, 10)
+		w, err := fswatch.Watch(os.DirFS(dir), 5*time.Millisecond, func() {
+			changed <- struct{}{}
+		})
+		if err != nil {
+			t.Fatalf("failed to watch: %v", err)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+
+		err = w.Close()
+		if err != nil {
+			t.Fatalf("failed to close: %v", err)
+		}
+
+		if len(changed) != 0 {
+			t.Errorf("expected no changes to be reported, got %d", len(changed))
+		}
+	})
+
+	t.Run("fail, directory does not exist", func(t *testing.T) {
+		_, err := fswatch.Watch(os.DirFS(filepath.Join(t.TempDir(), "missing")), time.Second, func() {})
+		if err == nil {
+			t.Fatalf("expected error, got <nil>")
+		}
+	})
+}
+
+func dirForTest(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	past := time.Now().Add(-time.Hour)
+	writeFile(t, filepath.Join(dir, "base.html"), "base", past)
+	writeFile(t, filepath.Join(dir, "partials", "partial.html"), "partial", past)
+
+	return dir
+}
+
+func writeFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+
+	err = os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	err = os.Chtimes(path, modTime, modTime)
+	if err != nil {
+		t.Fatalf("failed to change times: %v", err)
+	}
+}
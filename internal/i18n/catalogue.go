@@ -0,0 +1,136 @@
+package i18n
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/willemschots/househunt/internal/errorz"
+)
+
+// Catalogue contains the translated messages for all supported locales.
+type Catalogue struct {
+	messages map[Locale]map[string]string
+}
+
+// LoadCatalogue loads a catalogue from the root of fsys. Every supported locale
+// is expected to have a flat JSON file named after it, for example "nl.json",
+// mapping message keys to translations.
+//
+// Translations are formatted using fmt.Sprintf, so they can contain verbs
+// like %s for arguments.
+func LoadCatalogue(fsys fs.FS) (*Catalogue, error) {
+	c := &Catalogue{
+		messages: make(map[Locale]map[string]string, len(Supported)),
+	}
+
+	for _, l := range Supported {
+		filename := string(l) + ".json"
+		data, err := fs.ReadFile(fsys, filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read catalogue %q: %w", filename, err)
+		}
+
+		messages := make(map[string]string)
+		err = json.Unmarshal(data, &messages)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode catalogue %q: %w", filename, err)
+		}
+
+		c.messages[l] = messages
+	}
+
+	return c, nil
+}
+
+// MissingKeys returns the keys that are present for DefaultLocale but missing for l.
+func (c *Catalogue) MissingKeys(l Locale) []string {
+	missing := make([]string, 0)
+	for key := range c.messages[DefaultLocale] {
+		if _, ok := c.messages[l][key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+
+	return missing
+}
+
+// Translator returns a Translator for the locale. It's safe to call
+// on a nil catalogue, the translator will then return all keys as-is.
+func (c *Catalogue) Translator(l Locale) Translator {
+	if c == nil {
+		return Translator{locale: l}
+	}
+
+	return Translator{
+		locale:   l,
+		messages: c.messages[l],
+		fallback: c.messages[DefaultLocale],
+	}
+}
+
+// Translator translates messages for a single locale.
+// The zero value is ready to use and returns all keys as-is.
+type Translator struct {
+	locale   Locale
+	messages map[string]string
+	fallback map[string]string
+}
+
+// Locale returns the locale of the translator.
+func (t Translator) Locale() Locale {
+	return t.locale
+}
+
+// Lookup looks up the message for key. If the message is missing for the locale
+// of the translator the message for DefaultLocale is used.
+func (t Translator) Lookup(key string) (string, bool) {
+	if msg, ok := t.messages[key]; ok {
+		return msg, true
+	}
+
+	msg, ok := t.fallback[key]
+	return msg, ok
+}
+
+// T translates the message for key and formats it with args. If no message
+// can be found, the key itself is returned.
+func (t Translator) T(key string, args ...any) string {
+	msg, ok := t.Lookup(key)
+	if !ok {
+		msg = key
+	}
+
+	if len(args) == 0 {
+		return msg
+	}
+
+	return fmt.Sprintf(msg, args...)
+}
+
+// Error translates an error for display to the user. Error messages are looked
+// up using the "error." prefix. Keyed errors are rendered using the "error.keyed"
+// message, where the key is looked up using the "field." prefix.
+//
+// If no translation is found the original error message is used.
+func (t Translator) Error(err error) string {
+	var keyed errorz.Keyed
+	if errors.As(err, &keyed) {
+		field := t.or("field."+strings.ToLower(keyed.Key), keyed.Key)
+		msg := t.or("error.keyed", "%s: %s")
+		return fmt.Sprintf(msg, field, t.Error(keyed.Err))
+	}
+
+	return t.or("error."+err.Error(), err.Error())
+}
+
+func (t Translator) or(key, fallback string) string {
+	msg, ok := t.Lookup(key)
+	if !ok {
+		return fallback
+	}
+
+	return msg
+}
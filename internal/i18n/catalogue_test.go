@@ -0,0 +1,83 @@
+package i18n_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/willemschots/househunt/assets"
+	"github.com/willemschots/househunt/internal/errorz"
+	"github.com/willemschots/househunt/internal/i18n"
+)
+
+func Test_Catalogue_Translator(t *testing.T) {
+	catalogue := must(i18n.LoadCatalogue(fstest.MapFS{
+		"en.json": {Data: []byte(`{
+			"greeting": "Hello %s",
+			"only-en": "Only in English",
+			"field.email": "Email",
+			"error.keyed": "%s: %s",
+			"error.invalid email": "invalid email"
+		}`)},
+		"nl.json": {Data: []byte(`{
+			"greeting": "Hallo %s",
+			"field.email": "E-mail",
+			"error.keyed": "%s: %s",
+			"error.invalid email": "ongeldige e-mail"
+		}`)},
+	}))
+
+	tr := catalogue.Translator(i18n.Dutch)
+
+	tests := map[string]struct {
+		got  string
+		want string
+	}{
+		"translated with args":      {got: tr.T("greeting", "Jacob"), want: "Hallo Jacob"},
+		"fallback to default":       {got: tr.T("only-en"), want: "Only in English"},
+		"missing key":               {got: tr.T("missing"), want: "missing"},
+		"translated error":          {got: tr.Error(errors.New("invalid email")), want: "ongeldige e-mail"},
+		"untranslated error":        {got: tr.Error(errors.New("boom")), want: "boom"},
+		"keyed error":               {got: tr.Error(errorz.Keyed{Key: "Email", Err: errors.New("invalid email")}), want: "E-mail: ongeldige e-mail"},
+		"nil catalogue returns key": {got: (*i18n.Catalogue)(nil).Translator(i18n.Dutch).T("greeting"), want: "greeting"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if tc.got != tc.want {
+				t.Errorf("got %q, want %q", tc.got, tc.want)
+			}
+		})
+	}
+}
+
+func Test_LoadCatalogue(t *testing.T) {
+	t.Run("fail, missing locale", func(t *testing.T) {
+		_, err := i18n.LoadCatalogue(fstest.MapFS{
+			"en.json": {Data: []byte(`{}`)},
+		})
+		if err == nil {
+			t.Fatal("expected error, got <nil>")
+		}
+	})
+
+	// All keys available in the default locale should be translated.
+	t.Run("ok, assets are complete", func(t *testing.T) {
+		catalogue := must(i18n.LoadCatalogue(assets.LocaleFS))
+
+		for _, l := range i18n.Supported {
+			missing := catalogue.MissingKeys(l)
+			if len(missing) > 0 {
+				t.Errorf("locale %q is missing keys: %v", l, missing)
+			}
+		}
+	})
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
@@ -0,0 +1,105 @@
+package i18n
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupportedLocale indicates a locale is not supported by househunt.
+var ErrUnsupportedLocale = errors.New("unsupported locale")
+
+// Locale identifies a language, for example "en" or "nl".
+type Locale string
+
+const (
+	English Locale = "en"
+	Dutch   Locale = "nl"
+
+	// DefaultLocale is used if no better match can be found. It's also the
+	// locale we fall back to if a message is missing from a catalogue.
+	DefaultLocale = English
+)
+
+// Supported contains all locales supported by househunt.
+var Supported = []Locale{English, Dutch}
+
+// ParseLocale parses raw as a supported locale.
+func ParseLocale(raw string) (Locale, error) {
+	for _, l := range Supported {
+		if strings.EqualFold(raw, string(l)) {
+			return l, nil
+		}
+	}
+
+	return "", ErrUnsupportedLocale
+}
+
+func (l *Locale) UnmarshalText(text []byte) error {
+	locale, err := ParseLocale(string(text))
+	if err != nil {
+		return err
+	}
+
+	*l = locale
+
+	return nil
+}
+
+// Negotiate picks the locale to use. An explicit preference of the user always wins,
+// if there is none (or it's not supported) we pick the best match from the
+// Accept-Language header. If nothing matches DefaultLocale is returned.
+func Negotiate(preferred Locale, acceptLanguage string) Locale {
+	if l, err := ParseLocale(string(preferred)); err == nil {
+		return l
+	}
+
+	best := DefaultLocale
+	bestQ := 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		// We only care about the primary language, "nl-BE" is treated as "nl".
+		lang, _, _ := strings.Cut(tag, "-")
+		l, err := ParseLocale(lang)
+		if err != nil {
+			continue
+		}
+
+		if q > bestQ {
+			best = l
+			bestQ = q
+		}
+	}
+
+	return best
+}
+
+type ctxKey string
+
+const localeCtxKey ctxKey = "_locale"
+
+// WithLocale returns a copy of ctx that carries the locale.
+func WithLocale(ctx context.Context, l Locale) context.Context {
+	return context.WithValue(ctx, localeCtxKey, l)
+}
+
+// LocaleFromContext returns the locale carried by ctx, or DefaultLocale if there is none.
+func LocaleFromContext(ctx context.Context) Locale {
+	l, ok := ctx.Value(localeCtxKey).(Locale)
+	if !ok {
+		return DefaultLocale
+	}
+
+	return l
+}
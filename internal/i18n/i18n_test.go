@@ -0,0 +1,68 @@
+package i18n_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/willemschots/househunt/internal/i18n"
+)
+
+func Test_Negotiate(t *testing.T) {
+	tests := map[string]struct {
+		preferred      i18n.Locale
+		acceptLanguage string
+		want           i18n.Locale
+	}{
+		"no preference, no header": {
+			want: i18n.DefaultLocale,
+		},
+		"preference wins over header": {
+			preferred:      i18n.English,
+			acceptLanguage: "nl",
+			want:           i18n.English,
+		},
+		"unsupported preference uses header": {
+			preferred:      "fr",
+			acceptLanguage: "nl",
+			want:           i18n.Dutch,
+		},
+		"region is ignored": {
+			acceptLanguage: "nl-BE",
+			want:           i18n.Dutch,
+		},
+		"highest quality wins": {
+			acceptLanguage: "en;q=0.5, nl;q=0.8, fr",
+			want:           i18n.Dutch,
+		},
+		"unsupported languages only": {
+			acceptLanguage: "fr, de;q=0.9",
+			want:           i18n.DefaultLocale,
+		},
+		"invalid quality is skipped": {
+			acceptLanguage: "nl;q=abc, en;q=0.1",
+			want:           i18n.English,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := i18n.Negotiate(tc.preferred, tc.acceptLanguage)
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func Test_LocaleFromContext(t *testing.T) {
+	got := i18n.LocaleFromContext(context.Background())
+	if got != i18n.DefaultLocale {
+		t.Errorf("got %q, want %q", got, i18n.DefaultLocale)
+	}
+
+	ctx := i18n.WithLocale(context.Background(), i18n.Dutch)
+	got = i18n.LocaleFromContext(ctx)
+	if got != i18n.Dutch {
+		t.Errorf("got %q, want %q", got, i18n.Dutch)
+	}
+}
@@ -0,0 +1,132 @@
+// Code generated by querygen. DO NOT EDIT.
+
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/errorz"
+	"github.com/willemschots/househunt/internal/jobs"
+)
+
+func insertJob(q db.Query, ef execFunc, v jobs.Job) error {
+	if db.IsZero(v.ID) {
+		return fmt.Errorf("zero id provided: %w", errorz.ErrConstraintViolated)
+	}
+
+	q.Unsafe(`INSERT INTO jobs (id, kind, args_encrypted, unique_key, status, attempts, max_attempts, run_at, locked_until, last_error, trace_parent, request_id, created_at, updated_at) VALUES (`)
+	q.Param(v.ID)
+	q.Unsafe(`, `)
+	q.Param(v.Kind)
+	q.Unsafe(`, `)
+	q.ParamEncrypted([]byte(v.Args))
+	q.Unsafe(`, `)
+	q.Param(db.NullIfZero(v.UniqueKey))
+	q.Unsafe(`, `)
+	q.Param(v.Status)
+	q.Unsafe(`, `)
+	q.Param(v.Attempts)
+	q.Unsafe(`, `)
+	q.Param(v.MaxAttempts)
+	q.Unsafe(`, `)
+	q.Param(v.RunAt)
+	q.Unsafe(`, `)
+	q.Param(db.NullIfZero(v.LockedUntil))
+	q.Unsafe(`, `)
+	q.Param(db.NullIfZero(v.LastError))
+	q.Unsafe(`, `)
+	q.Param(db.NullIfZero(v.TraceParent))
+	q.Unsafe(`, `)
+	q.Param(db.NullIfZero(v.RequestID))
+	q.Unsafe(`, `)
+	q.Param(v.CreatedAt)
+	q.Unsafe(`, `)
+	q.Param(v.UpdatedAt)
+	q.Unsafe(`)`)
+
+	s, params, err := q.Get()
+	if err != nil {
+		return err
+	}
+
+	_, err = ef(s, params...)
+	if err != nil {
+		return errorz.MapDBErr(err)
+	}
+
+	return nil
+}
+
+func selectJobs(q db.Query, qf queryFunc, f jobs.JobFilter) ([]jobs.Job, error) {
+	q.Unsafe(`SELECT id, kind, args_encrypted, unique_key, status, attempts, max_attempts, run_at, locked_until, last_error, trace_parent, request_id, created_at, updated_at FROM jobs WHERE 1=1 `)
+
+	if len(f.IDs) > 0 {
+		q.Unsafe(`AND id IN (`)
+		q.Params(db.AnySlice(f.IDs)...)
+		q.Unsafe(`) `)
+	}
+
+	if len(f.Kinds) > 0 {
+		q.Unsafe(`AND kind IN (`)
+		q.Params(db.AnySlice(f.Kinds)...)
+		q.Unsafe(`) `)
+	}
+
+	if len(f.Statuses) > 0 {
+		q.Unsafe(`AND status IN (`)
+		q.Params(db.AnySlice(f.Statuses)...)
+		q.Unsafe(`) `)
+	}
+
+	q.Unsafe(`ORDER BY updated_at DESC, id ASC`)
+
+	if f.Limit > 0 {
+		q.Unsafe(` LIMIT `)
+		q.Param(f.Limit)
+	}
+
+	s, params, err := q.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := qf(s, params...)
+	if err != nil {
+		return nil, errorz.MapDBErr(err)
+	}
+
+	defer rows.Close()
+
+	out := make([]jobs.Job, 0)
+	for rows.Next() {
+		var v jobs.Job
+		argsData := q.DecryptionTarget()
+		var uniqueKeyNull sql.Null[string]
+		var lockedUntilNull sql.Null[time.Time]
+		var lastErrorNull sql.Null[string]
+		var traceParentNull sql.Null[string]
+		var requestIDNull sql.Null[string]
+		err := rows.Scan(&v.ID, &v.Kind, argsData, &uniqueKeyNull, &v.Status, &v.Attempts, &v.MaxAttempts, &v.RunAt, &lockedUntilNull, &lastErrorNull, &traceParentNull, &requestIDNull, &v.CreatedAt, &v.UpdatedAt)
+		if err != nil {
+			return nil, errorz.MapDBErr(err)
+		}
+
+		v.Args = []byte(argsData.Data)
+		v.UniqueKey = uniqueKeyNull.V
+		v.LockedUntil = lockedUntilNull.V
+		v.LastError = lastErrorNull.V
+		v.TraceParent = traceParentNull.V
+		v.RequestID = requestIDNull.V
+
+		out = append(out, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errorz.MapDBErr(err)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/errorz"
+	"github.com/willemschots/househunt/internal/jobs"
+)
+
+//go:generate go run ../../../cmd/querygen -src .. -type Job -table jobs -filter JobFilter -order "updated_at DESC, id ASC" -funcs insert,select -out jobs.gen.go
+
+type execFunc func(query string, params ...any) (sql.Result, error)
+type queryFunc func(query string, params ...any) (*sql.Rows, error)
+
+// claimJobs claims the due jobs of kind and returns their IDs.
+func claimJobs(q db.Query, qf queryFunc, kind string, now, lockedUntil time.Time, limit int) ([]uuid.UUID, error) {
+	q.Unsafe(`UPDATE jobs SET status = `)
+	q.Param(jobs.StatusRunning)
+	q.Unsafe(`, attempts = attempts + 1, locked_until = `)
+	q.Param(lockedUntil)
+	q.Unsafe(`, updated_at = `)
+	q.Param(now)
+	q.Unsafe(` WHERE id IN (SELECT id FROM jobs WHERE kind = `)
+	q.Param(kind)
+	q.Unsafe(` AND ((status = `)
+	q.Param(jobs.StatusPending)
+	q.Unsafe(` AND run_at <= `)
+	q.Param(now)
+	q.Unsafe(`) OR (status = `)
+	q.Param(jobs.StatusRunning)
+	q.Unsafe(` AND locked_until <= `)
+	q.Param(now)
+	q.Unsafe(`)) ORDER BY run_at ASC, id ASC LIMIT `)
+	q.Param(limit)
+	if q.Dialect == db.Postgres {
+		// Don't wait for rows that are being claimed by another transaction.
+		q.Unsafe(` FOR UPDATE SKIP LOCKED`)
+	}
+	q.Unsafe(`) RETURNING id`)
+
+	s, params, err := q.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := qf(s, params...)
+	if err != nil {
+		return nil, errorz.MapDBErr(err)
+	}
+
+	defer rows.Close()
+
+	ids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, errorz.MapDBErr(err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errorz.MapDBErr(err)
+	}
+
+	return ids, nil
+}
+
+func updateJob(q db.Query, ef execFunc, j jobs.Job) error {
+	q.Unsafe(`UPDATE jobs SET args_encrypted = `)
+	q.ParamEncrypted(j.Args)
+	q.Unsafe(`, status = `)
+	q.Param(j.Status)
+	q.Unsafe(`, run_at = `)
+	q.Param(j.RunAt)
+	q.Unsafe(`, locked_until = `)
+	q.Param(db.NullIfZero(j.LockedUntil))
+	q.Unsafe(`, last_error = `)
+	q.Param(db.NullIfZero(j.LastError))
+	q.Unsafe(`, updated_at = `)
+	q.Param(j.UpdatedAt)
+	whereClaimed(&q, j)
+
+	s, params, err := q.Get()
+	if err != nil {
+		return err
+	}
+
+	return execOne(ef, s, params)
+}
+
+func deleteJob(q db.Query, ef execFunc, j jobs.Job) error {
+	q.Unsafe(`DELETE FROM jobs`)
+	whereClaimed(&q, j)
+
+	s, params, err := q.Get()
+	if err != nil {
+		return err
+	}
+
+	return execOne(ef, s, params)
+}
+
+// whereClaimed only matches j if it's still running with the same number of attempts.
+func whereClaimed(q *db.Query, j jobs.Job) {
+	q.Unsafe(` WHERE id = `)
+	q.Param(j.ID)
+	q.Unsafe(` AND status = `)
+	q.Param(jobs.StatusRunning)
+	q.Unsafe(` AND attempts = `)
+	q.Param(j.Attempts)
+}
+
+// execOne executes a statement that should affect exactly one row.
+func execOne(ef execFunc, s string, params []any) error {
+	result, err := ef(s, params...)
+	if err != nil {
+		return errorz.MapDBErr(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return errorz.MapDBErr(err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("claimed job not found: %w", errorz.ErrNotFound)
+	}
+
+	return nil
+}
+
+func countJobs(q db.Query, qf queryFunc) ([]jobs.JobCount, error) {
+	q.Unsafe(`SELECT kind, status, COUNT(*) FROM jobs GROUP BY kind, status ORDER BY kind ASC, status ASC`)
+
+	s, params, err := q.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := qf(s, params...)
+	if err != nil {
+		return nil, errorz.MapDBErr(err)
+	}
+
+	defer rows.Close()
+
+	out := make([]jobs.JobCount, 0)
+	for rows.Next() {
+		var c jobs.JobCount
+		err := rows.Scan(&c.Kind, &c.Status, &c.Count)
+		if err != nil {
+			return nil, errorz.MapDBErr(err)
+		}
+
+		out = append(out, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errorz.MapDBErr(err)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/jobs"
+	"github.com/willemschots/househunt/internal/krypto"
+)
+
+// Store is responsible for storing jobs in a database.
+type Store struct {
+	writeDB   *sql.DB
+	readDB    *sql.DB
+	dialect   db.Dialect
+	encryptor *krypto.Encryptor
+}
+
+// New creates a new Store. The dialect is based on the driver of writeDB.
+func New(writeDB, readDB *sql.DB, encryptor *krypto.Encryptor) *Store {
+	return &Store{
+		writeDB:   writeDB,
+		readDB:    readDB,
+		dialect:   db.DialectOf(writeDB),
+		encryptor: encryptor,
+	}
+}
+
+func (s *Store) newQuery() db.Query {
+	return db.Query{
+		Encryptor: s.encryptor,
+		Dialect:   s.dialect,
+	}
+}
+
+// CreateJob creates a job.
+func (s *Store) CreateJob(ctx context.Context, j jobs.Job) error {
+	return insertJob(s.newQuery(), db.TracedExec(ctx, s.writeDB), j)
+}
+
+// ClaimJobs claims the jobs of kind that are due at now, see jobs.Store.
+func (s *Store) ClaimJobs(ctx context.Context, kind string, now, lockedUntil time.Time, limit int) ([]jobs.Job, error) {
+	ids, err := claimJobs(s.newQuery(), db.TracedQuery(ctx, s.writeDB), kind, now, lockedUntil, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return []jobs.Job{}, nil
+	}
+
+	// The claimed jobs are read from the write handle, so the claim is
+	// guaranteed to be visible.
+	return selectJobs(s.newQuery(), db.TracedQuery(ctx, s.writeDB), jobs.JobFilter{IDs: ids})
+}
+
+// UpdateJob updates a claimed job.
+// It returns errorz.ErrNotFound if the job is no longer claimed.
+func (s *Store) UpdateJob(ctx context.Context, j jobs.Job) error {
+	return updateJob(s.newQuery(), db.TracedExec(ctx, s.writeDB), j)
+}
+
+// DeleteJob deletes a claimed job.
+// It returns errorz.ErrNotFound if the job is no longer claimed.
+func (s *Store) DeleteJob(ctx context.Context, j jobs.Job) error {
+	return deleteJob(s.newQuery(), db.TracedExec(ctx, s.writeDB), j)
+}
+
+// FindJobs queries for jobs based on the provided filter, most recently updated first.
+// It returns an empty slice if no jobs are found.
+func (s *Store) FindJobs(ctx context.Context, filter jobs.JobFilter) ([]jobs.Job, error) {
+	return selectJobs(s.newQuery(), db.TracedQuery(ctx, s.readDB), filter)
+}
+
+// CountJobs returns the number of jobs per kind and status.
+func (s *Store) CountJobs(ctx context.Context) ([]jobs.JobCount, error) {
+	return countJobs(s.newQuery(), db.TracedQuery(ctx, s.readDB))
+}
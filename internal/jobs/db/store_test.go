@@ -0,0 +1,179 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/db/testdb"
+	"github.com/willemschots/househunt/internal/errorz"
+	"github.com/willemschots/househunt/internal/jobs"
+	"github.com/willemschots/househunt/internal/jobs/db"
+	"github.com/willemschots/househunt/internal/krypto"
+)
+
+func Test_Store(t *testing.T) {
+	for _, b := range testdb.Backends {
+		t.Run(b.Name, func(t *testing.T) {
+			testStore(t, b.Open)
+		})
+	}
+}
+
+func testStore(t *testing.T, openDB func(t *testing.T) *sql.DB) {
+	ctx := context.Background()
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("ok, claims due jobs and deletes them", func(t *testing.T) {
+		store := storeForTest(t, openDB(t))
+
+		due := []jobs.Job{newJob(t, "greet", now.Add(-2*time.Second)), newJob(t, "greet", now.Add(-time.Second))}
+		later := newJob(t, "greet", now.Add(time.Minute))
+		other := newJob(t, "other", now)
+
+		for _, j := range append(due, later, other) {
+			err := store.CreateJob(ctx, j)
+			if err != nil {
+				t.Fatalf("failed to create job: %v", err)
+			}
+		}
+
+		claimed, err := store.ClaimJobs(ctx, "greet", now, now.Add(time.Minute), 10)
+		if err != nil {
+			t.Fatalf("failed to claim jobs: %v", err)
+		}
+
+		if len(claimed) != 2 {
+			t.Fatalf("expected 2 claimed jobs, got %+v", claimed)
+		}
+
+		for _, j := range claimed {
+			if j.ID != due[0].ID && j.ID != due[1].ID {
+				t.Errorf("claimed job %s is not due", j.ID)
+			}
+
+			if j.Status != jobs.StatusRunning || j.Attempts != 1 || !j.LockedUntil.Equal(now.Add(time.Minute)) {
+				t.Errorf("unexpected claimed job %+v", j)
+			}
+
+			if string(j.Args) != `{"name":"alice"}` || j.RequestID != "trace-42" {
+				t.Errorf("job did not round-trip: %+v", j)
+			}
+
+			err := store.DeleteJob(ctx, j)
+			if err != nil {
+				t.Fatalf("failed to delete job: %v", err)
+			}
+		}
+
+		counts, err := store.CountJobs(ctx)
+		if err != nil {
+			t.Fatalf("failed to count jobs: %v", err)
+		}
+
+		want := []jobs.JobCount{
+			{Kind: "greet", Status: jobs.StatusPending, Count: 1},
+			{Kind: "other", Status: jobs.StatusPending, Count: 1},
+		}
+		if !reflect.DeepEqual(counts, want) {
+			t.Errorf("got counts %+v, want %+v", counts, want)
+		}
+	})
+
+	t.Run("fail, update after the job was claimed again", func(t *testing.T) {
+		store := storeForTest(t, openDB(t))
+
+		err := store.CreateJob(ctx, newJob(t, "greet", now))
+		if err != nil {
+			t.Fatalf("failed to create job: %v", err)
+		}
+
+		first, err := store.ClaimJobs(ctx, "greet", now, now.Add(time.Minute), 1)
+		if err != nil || len(first) != 1 {
+			t.Fatalf("failed to claim job: %v %+v", err, first)
+		}
+
+		// The first claim is abandoned once its lock expires.
+		second, err := store.ClaimJobs(ctx, "greet", now.Add(2*time.Minute), now.Add(3*time.Minute), 1)
+		if err != nil || len(second) != 1 || second[0].Attempts != 2 {
+			t.Fatalf("failed to claim abandoned job: %v %+v", err, second)
+		}
+
+		err = store.UpdateJob(ctx, first[0])
+		if !errors.Is(err, errorz.ErrNotFound) {
+			t.Fatalf("expected error %v, got %v (via errors.Is)", errorz.ErrNotFound, err)
+		}
+
+		err = store.DeleteJob(ctx, first[0])
+		if !errors.Is(err, errorz.ErrNotFound) {
+			t.Fatalf("expected error %v, got %v (via errors.Is)", errorz.ErrNotFound, err)
+		}
+
+		second[0].Status = jobs.StatusFailed
+		second[0].Args = []byte("null")
+		err = store.UpdateJob(ctx, second[0])
+		if err != nil {
+			t.Fatalf("failed to update job: %v", err)
+		}
+
+		got, err := store.FindJobs(ctx, jobs.JobFilter{Statuses: []jobs.Status{jobs.StatusFailed}})
+		if err != nil {
+			t.Fatalf("failed to find jobs: %v", err)
+		}
+
+		if len(got) != 1 || string(got[0].Args) != "null" {
+			t.Errorf("expected a failed job with null args, got %+v", got)
+		}
+	})
+
+	t.Run("fail, duplicate unique key", func(t *testing.T) {
+		store := storeForTest(t, openDB(t))
+
+		for i, want := range []error{nil, errorz.ErrConstraintViolated} {
+			j := newJob(t, "greet", now)
+			j.UniqueKey = "alice"
+
+			err := store.CreateJob(ctx, j)
+			if !errors.Is(err, want) {
+				t.Fatalf("job %d: expected error %v, got %v (via errors.Is)", i, want, err)
+			}
+		}
+	})
+}
+
+func storeForTest(t *testing.T, testDB *sql.DB) *db.Store {
+	t.Helper()
+
+	encryptor := must(krypto.NewEncryptor([]krypto.Key{
+		must(krypto.ParseKey("2b671594b775f371eab4050b4d58326682df6b1a6cc2e886717b1a26b4d6c45d")),
+	}))
+
+	return db.New(testDB, testDB, encryptor)
+}
+
+func newJob(t *testing.T, kind string, runAt time.Time) jobs.Job {
+	t.Helper()
+
+	return jobs.Job{
+		ID:          must(uuid.NewRandom()),
+		Kind:        kind,
+		Args:        []byte(`{"name":"alice"}`),
+		Status:      jobs.StatusPending,
+		MaxAttempts: jobs.DefaultMaxAttempts,
+		RunAt:       runAt,
+		RequestID:   "trace-42",
+		CreatedAt:   runAt,
+		UpdatedAt:   runAt,
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Status is the status of a job.
+type Status string
+
+const (
+	// StatusPending jobs wait until their RunAt time to be claimed.
+	StatusPending Status = "pending"
+	// StatusRunning jobs are claimed by a queue until their LockedUntil time.
+	// If the job didn't finish by then, it's considered abandoned (for
+	// example because the app crashed) and can be claimed again.
+	StatusRunning Status = "running"
+	// StatusFailed jobs failed on every attempt, they're no longer retried.
+	// Their Args are replaced by a JSON null, since they may contain secrets
+	// such as tokens.
+	StatusFailed Status = "failed"
+)
+
+// Job is a unit of background work. Jobs that succeed are removed from the
+// store, failed jobs are kept so they can be inspected.
+type Job struct {
+	ID   uuid.UUID `db:"id,pk"`
+	Kind string    `db:"kind"`
+	// Args are the JSON encoded arguments of the handler.
+	Args []byte `db:"args_encrypted,encrypted"`
+	// UniqueKey prevents duplicate jobs. At most one pending or running job
+	// of a kind can have the same key. If empty, the job is not unique.
+	UniqueKey   string `db:"unique_key,nullzero"`
+	Status      Status `db:"status"`
+	Attempts    int    `db:"attempts"`
+	MaxAttempts int    `db:"max_attempts"`
+	// RunAt is the earliest time the job can be claimed.
+	RunAt time.Time `db:"run_at"`
+	// LockedUntil is the time a running job is considered abandoned.
+	LockedUntil time.Time `db:"locked_until,nullzero"`
+	// LastError is the error of the last failed attempt.
+	LastError string `db:"last_error,nullzero"`
+	// TraceParent and RequestID are taken from the context the job was
+	// enqueued from, so the job can be traced back to the request that caused it.
+	TraceParent string    `db:"trace_parent,nullzero"`
+	RequestID   string    `db:"request_id,nullzero"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+// JobFilter is used to filter jobs.
+// Returned jobs must match all the provided fields.
+// If a field is empty or nil, it's ignored.
+type JobFilter struct {
+	IDs      []uuid.UUID `db:"id,in"`
+	Kinds    []string    `db:"kind,in"`
+	Statuses []Status    `db:"status,in"`
+	// Limit is the max number of jobs returned, 0 means no limit.
+	Limit int `db:",limit"`
+}
+
+// JobCount is the number of jobs of a kind with a status.
+type JobCount struct {
+	Kind   string
+	Status Status
+	Count  int
+}
+
+// Store stores jobs.
+type Store interface {
+	// CreateJob creates a job. It returns errorz.ErrConstraintViolated if
+	// the ID is taken, or if another pending or running job of the same
+	// kind has the same UniqueKey.
+	CreateJob(ctx context.Context, j Job) error
+	// ClaimJobs claims at most limit jobs of kind that are due at now. These
+	// are pending jobs with a RunAt before or at now, and running jobs that
+	// were abandoned before now. Claimed jobs are set to running until
+	// lockedUntil, and their Attempts is incremented. The jobs with the
+	// oldest RunAt are claimed first.
+	ClaimJobs(ctx context.Context, kind string, now, lockedUntil time.Time, limit int) ([]Job, error)
+	// UpdateJob updates the Args, Status, RunAt, LockedUntil, LastError and
+	// UpdatedAt of a job, if it's still running with the same number of
+	// Attempts. Otherwise another claim took over the job, and
+	// errorz.ErrNotFound is returned.
+	UpdateJob(ctx context.Context, j Job) error
+	// DeleteJob deletes a job under the same conditions as UpdateJob.
+	DeleteJob(ctx context.Context, j Job) error
+	// FindJobs returns the jobs matching the filter, most recently updated first.
+	FindJobs(ctx context.Context, filter JobFilter) ([]Job, error)
+	// CountJobs returns the number of jobs per kind and status, sorted by
+	// kind and status. Combinations without jobs are left out.
+	CountJobs(ctx context.Context) ([]JobCount, error)
+}
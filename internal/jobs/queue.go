@@ -0,0 +1,548 @@
+// Package jobs runs background work that survives restarts.
+//
+// Jobs are stored before they're run, and only removed once they succeed. Jobs
+// that fail are retried with an exponential backoff, and jobs that were running
+// when the app stopped are picked up again once their lock expires.
+//
+// Handlers are registered for a kind of job, together with the type of their
+// arguments:
+//
+//	welcome := jobs.Register(queue, "welcome-email", jobs.KindConfig{}, func(ctx context.Context, args welcomeArgs) error {
+//		return sendWelcome(ctx, args.UserID)
+//	})
+//
+//	err := welcome.Enqueue(ctx, welcomeArgs{UserID: id}, jobs.EnqueueOptions{Delay: time.Hour})
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/errorz"
+	"github.com/willemschots/househunt/internal/logz"
+	"github.com/willemschots/househunt/internal/tracing"
+)
+
+// ErrDuplicateJob is returned when enqueueing a unique job while another job
+// with the same key is pending or running.
+var ErrDuplicateJob = errors.New("duplicate job")
+
+const (
+	// DefaultMaxAttempts is the number of attempts of a job, if not configured.
+	DefaultMaxAttempts = 5
+	// DefaultTimeout is the max duration of an attempt, if not configured.
+	DefaultTimeout = time.Minute
+	// lockMargin is added to the timeout of an attempt when claiming a job,
+	// so the lock doesn't expire while the result of the attempt is saved.
+	lockMargin = 30 * time.Second
+)
+
+// Config is the configuration of a Queue.
+type Config struct {
+	// PollInterval is the time between checks for jobs that are due. Enqueued
+	// jobs that can run immediately don't wait for the next check.
+	PollInterval time.Duration
+	// BackoffBase is the delay before the first retry of a failed job, it's
+	// doubled for every following retry.
+	BackoffBase time.Duration
+	// BackoffMax is the max delay between two attempts.
+	BackoffMax time.Duration
+}
+
+// KindConfig is the configuration of a kind of job.
+type KindConfig struct {
+	// Concurrency is the max number of jobs of the kind running at the same
+	// time. Defaults to 1.
+	Concurrency int
+	// MaxAttempts is the number of times a job is attempted before it's
+	// marked as failed. Defaults to DefaultMaxAttempts.
+	MaxAttempts int
+	// Timeout is the max duration of a single attempt. Defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// EnqueueOptions are the options of an enqueued job.
+type EnqueueOptions struct {
+	// RunAt schedules the job to run at (or after) this time. If zero,
+	// the job runs after Delay.
+	RunAt time.Time
+	// Delay postpones the job by this duration. It's ignored if RunAt is set.
+	Delay time.Duration
+	// UniqueKey makes the job unique, see Job.UniqueKey.
+	UniqueKey string
+}
+
+// ErrFunc is a function that handles errors. ctx is the context of the job
+// that caused the error, or of the queue if the error is not about a job.
+type ErrFunc func(ctx context.Context, err error)
+
+// Queue claims jobs from a store and runs them using the handler of their kind.
+// Jobs can be enqueued as soon as their kind is registered, but only run once
+// Run is called.
+type Queue struct {
+	store      Store
+	cfg        Config
+	logger     *slog.Logger
+	errHandler ErrFunc
+
+	mu      *sync.Mutex
+	kinds   map[string]*kind
+	closed  bool
+	running *sync.WaitGroup
+	wake    chan struct{}
+	stop    chan struct{}
+
+	// NowFunc is used to get the current time.
+	// Exposed for testing purposes.
+	NowFunc func() time.Time
+}
+
+// kind is a registered kind of job, running is guarded by the mutex of the queue.
+type kind struct {
+	name    string
+	cfg     KindConfig
+	handle  func(ctx context.Context, args []byte) error
+	running int
+}
+
+// NewQueue creates a new Queue. Errors of jobs and of claiming jobs are
+// passed to errHandler.
+//
+// Jobs run with the request ID of the call that enqueued them, and a logger
+// derived from logger that includes it (see logz.FromContext). If logger is
+// nil, only the request ID is passed.
+func NewQueue(store Store, cfg Config, logger *slog.Logger, errHandler ErrFunc) *Queue {
+	return &Queue{
+		store:      store,
+		cfg:        cfg,
+		logger:     logger,
+		errHandler: errHandler,
+		mu:         &sync.Mutex{},
+		kinds:      make(map[string]*kind),
+		running:    &sync.WaitGroup{},
+		wake:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		NowFunc:    time.Now,
+	}
+}
+
+// Kind is a registered kind of job with arguments of type T.
+type Kind[T any] struct {
+	queue *Queue
+	name  string
+	cfg   KindConfig
+}
+
+// Register registers handler for jobs of the named kind and returns the Kind
+// to enqueue them with. The arguments of the jobs are stored as JSON, so T
+// should survive a round trip through encoding/json.
+//
+// Register panics if a handler for the kind is already registered.
+func Register[T any](q *Queue, name string, cfg KindConfig, handler func(ctx context.Context, args T) error) *Kind[T] {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.kinds[name]; ok {
+		panic(fmt.Sprintf("jobs: handler for kind %q is already registered", name))
+	}
+
+	q.kinds[name] = &kind{
+		name: name,
+		cfg:  cfg,
+		handle: func(ctx context.Context, raw []byte) error {
+			var args T
+			err := json.Unmarshal(raw, &args)
+			if err != nil {
+				return fmt.Errorf("failed to decode args: %w", err)
+			}
+
+			return handler(ctx, args)
+		},
+	}
+
+	return &Kind[T]{
+		queue: q,
+		name:  name,
+		cfg:   cfg,
+	}
+}
+
+// Enqueue stores a job of the kind with args. It returns ErrDuplicateJob if
+// the job is unique and a job with the same key is pending or running.
+func (k *Kind[T]) Enqueue(ctx context.Context, args T, opts EnqueueOptions) error {
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Errorf("failed to encode args: %w", err)
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	now := k.queue.now()
+	runAt := opts.RunAt.UTC()
+	if opts.RunAt.IsZero() {
+		runAt = now.Add(opts.Delay)
+	}
+
+	err = k.queue.store.CreateJob(ctx, Job{
+		ID:          id,
+		Kind:        k.name,
+		Args:        raw,
+		UniqueKey:   opts.UniqueKey,
+		Status:      StatusPending,
+		MaxAttempts: k.cfg.MaxAttempts,
+		RunAt:       runAt,
+		TraceParent: tracing.TraceParent(ctx),
+		RequestID:   logz.RequestIDFromContext(ctx),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	})
+	if err != nil {
+		if opts.UniqueKey != "" && errors.Is(err, errorz.ErrConstraintViolated) {
+			return fmt.Errorf("%s job with key %q: %w", k.name, opts.UniqueKey, ErrDuplicateJob)
+		}
+		return err
+	}
+
+	if !runAt.After(now) {
+		k.queue.notify()
+	}
+
+	return nil
+}
+
+// Run claims and runs jobs that are due, until ctx is cancelled or the queue
+// is shut down. Jobs that are running at that time are not stopped, use
+// Shutdown to wait for them.
+func (q *Queue) Run(ctx context.Context) {
+	ticker := time.NewTicker(q.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		q.claim(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.stop:
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// Shutdown stops the queue from claiming new jobs and waits for the running
+// jobs to finish. If ctx is done before that, an error is returned that reports
+// how many jobs are still running. These jobs are claimed again once their
+// lock expires, possibly after a restart.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.stop)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d jobs did not finish: %w", q.Running(), ctx.Err())
+	}
+}
+
+// Running returns the number of jobs that are currently running.
+func (q *Queue) Running() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := 0
+	for _, k := range q.kinds {
+		n += k.running
+	}
+
+	return n
+}
+
+// KindStatus is the status of the jobs of a kind.
+type KindStatus struct {
+	Kind string
+	// Registered reports whether a handler for the kind is registered.
+	// Jobs of unregistered kinds are never run.
+	Registered  bool
+	Concurrency int
+	Pending     int
+	Running     int
+	Failed      int
+}
+
+// Overview is an overview of the jobs in the queue.
+type Overview struct {
+	Kinds []KindStatus
+	// Failed are the most recently failed jobs.
+	Failed []Job
+}
+
+// Overview returns the status of the jobs per kind, together with at most
+// limit failed jobs.
+func (q *Queue) Overview(ctx context.Context, limit int) (Overview, error) {
+	counts, err := q.store.CountJobs(ctx)
+	if err != nil {
+		return Overview{}, err
+	}
+
+	failed, err := q.store.FindJobs(ctx, JobFilter{
+		Statuses: []Status{StatusFailed},
+		Limit:    limit,
+	})
+	if err != nil {
+		return Overview{}, err
+	}
+
+	byKind := make(map[string]*KindStatus)
+	get := func(name string) *KindStatus {
+		if ks, ok := byKind[name]; ok {
+			return ks
+		}
+		ks := &KindStatus{Kind: name}
+		byKind[name] = ks
+		return ks
+	}
+
+	q.mu.Lock()
+	for name, k := range q.kinds {
+		ks := get(name)
+		ks.Registered = true
+		ks.Concurrency = k.cfg.Concurrency
+	}
+	q.mu.Unlock()
+
+	for _, c := range counts {
+		ks := get(c.Kind)
+		switch c.Status {
+		case StatusPending:
+			ks.Pending = c.Count
+		case StatusRunning:
+			ks.Running = c.Count
+		case StatusFailed:
+			ks.Failed = c.Count
+		}
+	}
+
+	out := Overview{
+		Kinds:  make([]KindStatus, 0, len(byKind)),
+		Failed: failed,
+	}
+	for _, ks := range byKind {
+		out.Kinds = append(out.Kinds, *ks)
+	}
+
+	sort.Slice(out.Kinds, func(i, j int) bool {
+		return out.Kinds[i].Kind < out.Kinds[j].Kind
+	})
+
+	return out, nil
+}
+
+// claim claims as many due jobs as every kind has room for, and runs them.
+func (q *Queue) claim(ctx context.Context) {
+	q.mu.Lock()
+	kinds := make([]*kind, 0, len(q.kinds))
+	for _, k := range q.kinds {
+		kinds = append(kinds, k)
+	}
+	q.mu.Unlock()
+
+	sort.Slice(kinds, func(i, j int) bool {
+		return kinds[i].name < kinds[j].name
+	})
+
+	for _, k := range kinds {
+		q.mu.Lock()
+		free := k.cfg.Concurrency - k.running
+		closed := q.closed
+		q.mu.Unlock()
+
+		if closed {
+			return
+		}
+
+		if free <= 0 {
+			continue
+		}
+
+		now := q.now()
+		claimed, err := q.store.ClaimJobs(ctx, k.name, now, now.Add(k.cfg.Timeout+lockMargin), free)
+		if err != nil {
+			if ctx.Err() != nil {
+				// The queue is stopping.
+				return
+			}
+			q.errHandler(ctx, fmt.Errorf("failed to claim %s jobs: %w", k.name, err))
+			continue
+		}
+
+		for _, j := range claimed {
+			q.start(ctx, k, j)
+		}
+	}
+}
+
+// start runs the claimed job j in a separate goroutine.
+//
+// The context of the job doesn't carry the cancellation of ctx, a running job
+// is allowed to finish when the queue stops. It does carry the trace and request
+// ID of the call that enqueued the job, see jobContext.
+func (q *Queue) start(ctx context.Context, k *kind, j Job) {
+	q.mu.Lock()
+	if q.closed {
+		// The job is claimed again once its lock expires.
+		q.mu.Unlock()
+		return
+	}
+	k.running++
+	q.running.Add(1)
+	q.mu.Unlock()
+
+	go func() {
+		defer func() {
+			q.mu.Lock()
+			k.running--
+			q.mu.Unlock()
+
+			q.running.Done()
+
+			// There's room for another job of this kind.
+			q.notify()
+		}()
+
+		jCtx, span := tracing.Start(q.jobContext(context.WithoutCancel(ctx), j), "jobs."+k.name)
+		err := q.run(jCtx, k, j)
+		span.EndErr(err)
+		if err != nil {
+			q.errHandler(jCtx, err)
+		}
+	}()
+}
+
+// jobContext returns a copy of ctx that continues the trace and carries the
+// request ID of the call that enqueued j.
+func (q *Queue) jobContext(ctx context.Context, j Job) context.Context {
+	ctx = tracing.WithTraceParent(ctx, j.TraceParent)
+	if j.RequestID == "" {
+		return ctx
+	}
+
+	ctx = logz.WithRequestID(ctx, j.RequestID)
+	if q.logger != nil {
+		ctx = logz.WithLogger(ctx, q.logger.With("request_id", j.RequestID))
+	}
+
+	return ctx
+}
+
+// run runs job j and saves the outcome.
+func (q *Queue) run(ctx context.Context, k *kind, j Job) error {
+	var jobErr error
+	if j.Attempts > j.MaxAttempts {
+		// The job was abandoned on its last attempt.
+		jobErr = errors.New("abandoned, the job did not finish before its lock expired")
+	} else {
+		jobErr = q.handle(ctx, k, j)
+	}
+
+	if jobErr == nil {
+		err := q.store.DeleteJob(ctx, j)
+		if err != nil {
+			return fmt.Errorf("failed to complete %s job %s: %w", k.name, j.ID, err)
+		}
+		return nil
+	}
+
+	now := q.now()
+	j.LastError = jobErr.Error()
+	j.LockedUntil = time.Time{}
+	j.UpdatedAt = now
+
+	if j.Attempts >= j.MaxAttempts {
+		j.Status = StatusFailed
+		j.Args = []byte("null")
+		jobErr = fmt.Errorf("%s job %s failed after %d attempts: %w", k.name, j.ID, j.Attempts, jobErr)
+	} else {
+		j.Status = StatusPending
+		j.RunAt = now.Add(q.backoff(j.Attempts))
+		jobErr = fmt.Errorf("%s job %s failed on attempt %d of %d, retrying at %s: %w",
+			k.name, j.ID, j.Attempts, j.MaxAttempts, j.RunAt.Format(time.RFC3339), jobErr)
+	}
+
+	err := q.store.UpdateJob(ctx, j)
+	if err != nil {
+		return errors.Join(jobErr, fmt.Errorf("failed to update %s job %s: %w", k.name, j.ID, err))
+	}
+
+	return jobErr
+}
+
+// handle calls the handler of the kind with a timeout, panics are returned as errors.
+func (q *Queue) handle(ctx context.Context, k *kind, j Job) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, k.cfg.Timeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return k.handle(ctx, j.Args)
+}
+
+// backoff returns the delay after the given failed attempt.
+func (q *Queue) backoff(attempt int) time.Duration {
+	d := q.cfg.BackoffBase
+	for i := 1; i < attempt && d < q.cfg.BackoffMax; i++ {
+		d *= 2
+	}
+
+	return min(d, q.cfg.BackoffMax)
+}
+
+// notify wakes up Run to claim jobs, without waiting if it's busy.
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// now returns the current time in UTC. Times are compared in the store, SQLite
+// compares them as text, which only works if they're in the same time zone.
+func (q *Queue) now() time.Time {
+	return q.NowFunc().UTC().Round(0)
+}
@@ -0,0 +1,631 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/db/testdb"
+	"github.com/willemschots/househunt/internal/jobs"
+	jobsdb "github.com/willemschots/househunt/internal/jobs/db"
+	"github.com/willemschots/househunt/internal/krypto"
+	"github.com/willemschots/househunt/internal/logz"
+)
+
+type greetArgs struct {
+	Name string
+}
+
+func Test_Queue_Run(t *testing.T) {
+	t.Run("ok, runs enqueued job with its args", func(t *testing.T) {
+		qt := newQueueTest(t)
+
+		got := make(chan greetArgs, 1)
+		greet := jobs.Register(qt.queue, "greet", jobs.KindConfig{}, func(ctx context.Context, args greetArgs) error {
+			got <- args
+			return nil
+		})
+
+		qt.run(t)
+
+		err := greet.Enqueue(context.Background(), greetArgs{Name: "alice"}, jobs.EnqueueOptions{})
+		if err != nil {
+			t.Fatalf("failed to enqueue: %v", err)
+		}
+
+		if args := receive(t, got); args.Name != "alice" {
+			t.Errorf("got args %+v", args)
+		}
+
+		qt.waitForJobs(t, 0)
+		qt.assertNoError(t)
+	})
+
+	t.Run("ok, job runs with the request ID of the enqueueing call", func(t *testing.T) {
+		qt := newQueueTest(t)
+
+		got := make(chan string, 1)
+		greet := jobs.Register(qt.queue, "greet", jobs.KindConfig{}, func(ctx context.Context, args greetArgs) error {
+			got <- logz.RequestIDFromContext(ctx)
+			return nil
+		})
+
+		qt.run(t)
+
+		ctx := logz.WithRequestID(context.Background(), "trace-42")
+		err := greet.Enqueue(ctx, greetArgs{Name: "alice"}, jobs.EnqueueOptions{})
+		if err != nil {
+			t.Fatalf("failed to enqueue: %v", err)
+		}
+
+		if id := receive(t, got); id != "trace-42" {
+			t.Errorf("got request ID %q, want %q", id, "trace-42")
+		}
+
+		qt.waitForJobs(t, 0)
+		qt.assertNoError(t)
+	})
+
+	t.Run("ok, delayed and scheduled jobs run once they're due", func(t *testing.T) {
+		qt := newQueueTest(t)
+
+		got := make(chan greetArgs, 2)
+		greet := jobs.Register(qt.queue, "greet", jobs.KindConfig{}, func(ctx context.Context, args greetArgs) error {
+			got <- args
+			return nil
+		})
+
+		qt.run(t)
+
+		ctx := context.Background()
+		err := greet.Enqueue(ctx, greetArgs{Name: "delayed"}, jobs.EnqueueOptions{Delay: time.Minute})
+		if err != nil {
+			t.Fatalf("failed to enqueue: %v", err)
+		}
+
+		err = greet.Enqueue(ctx, greetArgs{Name: "scheduled"}, jobs.EnqueueOptions{RunAt: qt.clock.now().Add(time.Hour)})
+		if err != nil {
+			t.Fatalf("failed to enqueue: %v", err)
+		}
+
+		assertNothingReceived(t, got)
+
+		qt.clock.advance(time.Minute)
+		if args := receive(t, got); args.Name != "delayed" {
+			t.Errorf("got args %+v, want delayed", args)
+		}
+
+		assertNothingReceived(t, got)
+
+		qt.clock.advance(time.Hour)
+		if args := receive(t, got); args.Name != "scheduled" {
+			t.Errorf("got args %+v, want scheduled", args)
+		}
+	})
+
+	t.Run("ok, failed job is retried with backoff", func(t *testing.T) {
+		qt := newQueueTest(t)
+
+		attempts := make(chan int, 3)
+		n := 0
+		greet := jobs.Register(qt.queue, "greet", jobs.KindConfig{MaxAttempts: 3}, func(ctx context.Context, args greetArgs) error {
+			n++
+			attempts <- n
+			if n < 3 {
+				return errors.New("test error")
+			}
+			return nil
+		})
+
+		qt.run(t)
+
+		err := greet.Enqueue(context.Background(), greetArgs{}, jobs.EnqueueOptions{})
+		if err != nil {
+			t.Fatalf("failed to enqueue: %v", err)
+		}
+
+		receive(t, attempts)
+
+		// The first retry is after BackoffBase.
+		qt.clock.advance(time.Second - time.Millisecond)
+		assertNothingReceived(t, attempts)
+		qt.clock.advance(time.Millisecond)
+		receive(t, attempts)
+
+		// The second retry is after twice the BackoffBase.
+		qt.clock.advance(time.Second)
+		assertNothingReceived(t, attempts)
+		qt.clock.advance(time.Second)
+		receive(t, attempts)
+
+		qt.waitForJobs(t, 0)
+		qt.assertErrors(t, 2)
+	})
+
+	t.Run("ok, job is marked as failed after max attempts", func(t *testing.T) {
+		qt := newQueueTest(t)
+
+		greet := jobs.Register(qt.queue, "greet", jobs.KindConfig{MaxAttempts: 1}, func(ctx context.Context, args greetArgs) error {
+			return errors.New("test error")
+		})
+
+		qt.run(t)
+
+		err := greet.Enqueue(context.Background(), greetArgs{}, jobs.EnqueueOptions{})
+		if err != nil {
+			t.Fatalf("failed to enqueue: %v", err)
+		}
+
+		j := qt.waitForStatus(t, jobs.StatusFailed)
+		if j.Attempts != 1 || j.LastError != "test error" {
+			t.Errorf("unexpected failed job %+v", j)
+		}
+
+		if string(j.Args) != "null" {
+			t.Errorf("expected args of failed job to be cleared, got %s", j.Args)
+		}
+
+		qt.assertErrors(t, 1)
+	})
+
+	t.Run("ok, panic in handler fails the attempt", func(t *testing.T) {
+		qt := newQueueTest(t)
+
+		greet := jobs.Register(qt.queue, "greet", jobs.KindConfig{MaxAttempts: 1}, func(ctx context.Context, args greetArgs) error {
+			panic("oops")
+		})
+
+		qt.run(t)
+
+		err := greet.Enqueue(context.Background(), greetArgs{}, jobs.EnqueueOptions{})
+		if err != nil {
+			t.Fatalf("failed to enqueue: %v", err)
+		}
+
+		j := qt.waitForStatus(t, jobs.StatusFailed)
+		if j.LastError != "panic: oops" {
+			t.Errorf("unexpected last error %q", j.LastError)
+		}
+	})
+
+	t.Run("ok, concurrency is limited per kind", func(t *testing.T) {
+		qt := newQueueTest(t)
+
+		var (
+			running atomic.Int64
+			maxSeen atomic.Int64
+		)
+		release := make(chan struct{})
+		greet := jobs.Register(qt.queue, "greet", jobs.KindConfig{Concurrency: 2}, func(ctx context.Context, args greetArgs) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				m := maxSeen.Load()
+				if n <= m || maxSeen.CompareAndSwap(m, n) {
+					break
+				}
+			}
+
+			<-release
+			return nil
+		})
+
+		qt.run(t)
+
+		for range 5 {
+			err := greet.Enqueue(context.Background(), greetArgs{}, jobs.EnqueueOptions{})
+			if err != nil {
+				t.Fatalf("failed to enqueue: %v", err)
+			}
+		}
+
+		waitFor(t, func() bool { return qt.queue.Running() == 2 })
+		time.Sleep(20 * time.Millisecond)
+
+		close(release)
+		qt.waitForJobs(t, 0)
+
+		if got := maxSeen.Load(); got != 2 {
+			t.Errorf("expected at most 2 jobs to run at the same time, got %d", got)
+		}
+	})
+
+	t.Run("ok, abandoned job is claimed again", func(t *testing.T) {
+		qt := newQueueTest(t)
+
+		// The job was claimed by a previous run that crashed.
+		now := qt.clock.now()
+		err := qt.store.CreateJob(context.Background(), jobs.Job{
+			ID:          uuid.New(),
+			Kind:        "greet",
+			Args:        []byte(`{"Name":"alice"}`),
+			Status:      jobs.StatusRunning,
+			Attempts:    1,
+			MaxAttempts: 3,
+			RunAt:       now,
+			LockedUntil: now.Add(time.Minute),
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		})
+		if err != nil {
+			t.Fatalf("failed to create job: %v", err)
+		}
+
+		got := make(chan greetArgs, 1)
+		jobs.Register(qt.queue, "greet", jobs.KindConfig{}, func(ctx context.Context, args greetArgs) error {
+			got <- args
+			return nil
+		})
+
+		qt.run(t)
+
+		assertNothingReceived(t, got)
+
+		qt.clock.advance(time.Minute)
+		if args := receive(t, got); args.Name != "alice" {
+			t.Errorf("got args %+v", args)
+		}
+	})
+
+	t.Run("fail, duplicate unique job", func(t *testing.T) {
+		qt := newQueueTest(t)
+
+		greet := jobs.Register(qt.queue, "greet", jobs.KindConfig{}, func(ctx context.Context, args greetArgs) error {
+			return nil
+		})
+
+		opts := jobs.EnqueueOptions{UniqueKey: "alice", Delay: time.Hour}
+		err := greet.Enqueue(context.Background(), greetArgs{Name: "alice"}, opts)
+		if err != nil {
+			t.Fatalf("failed to enqueue: %v", err)
+		}
+
+		err = greet.Enqueue(context.Background(), greetArgs{Name: "alice"}, opts)
+		if !errors.Is(err, jobs.ErrDuplicateJob) {
+			t.Fatalf("expected %v, got %v via errors.Is()", jobs.ErrDuplicateJob, err)
+		}
+	})
+
+	t.Run("fail, kind is registered twice", func(t *testing.T) {
+		qt := newQueueTest(t)
+
+		h := func(ctx context.Context, args greetArgs) error { return nil }
+		jobs.Register(qt.queue, "greet", jobs.KindConfig{}, h)
+
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected a panic")
+			}
+		}()
+
+		jobs.Register(qt.queue, "greet", jobs.KindConfig{}, h)
+	})
+}
+
+func Test_Queue_Shutdown(t *testing.T) {
+	t.Run("ok, waits for running jobs", func(t *testing.T) {
+		qt := newQueueTest(t)
+
+		started := make(chan greetArgs, 1)
+		release := make(chan struct{})
+		greet := jobs.Register(qt.queue, "greet", jobs.KindConfig{}, func(ctx context.Context, args greetArgs) error {
+			started <- args
+			<-release
+			return nil
+		})
+
+		qt.run(t)
+
+		err := greet.Enqueue(context.Background(), greetArgs{}, jobs.EnqueueOptions{})
+		if err != nil {
+			t.Fatalf("failed to enqueue: %v", err)
+		}
+
+		receive(t, started)
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+		}()
+
+		err = qt.queue.Shutdown(context.Background())
+		if err != nil {
+			t.Fatalf("failed to shutdown: %v", err)
+		}
+
+		qt.assertJobs(t, 0)
+	})
+
+	t.Run("ok, no jobs are claimed after shutdown", func(t *testing.T) {
+		qt := newQueueTest(t)
+
+		got := make(chan greetArgs, 1)
+		greet := jobs.Register(qt.queue, "greet", jobs.KindConfig{}, func(ctx context.Context, args greetArgs) error {
+			got <- args
+			return nil
+		})
+
+		qt.run(t)
+
+		err := qt.queue.Shutdown(context.Background())
+		if err != nil {
+			t.Fatalf("failed to shutdown: %v", err)
+		}
+
+		// Jobs can still be enqueued, they're run after a restart.
+		err = greet.Enqueue(context.Background(), greetArgs{}, jobs.EnqueueOptions{})
+		if err != nil {
+			t.Fatalf("failed to enqueue: %v", err)
+		}
+
+		assertNothingReceived(t, got)
+		qt.assertJobs(t, 1)
+	})
+
+	t.Run("fail, jobs don't finish before the deadline", func(t *testing.T) {
+		qt := newQueueTest(t)
+
+		started := make(chan greetArgs, 1)
+		release := make(chan struct{})
+		greet := jobs.Register(qt.queue, "greet", jobs.KindConfig{}, func(ctx context.Context, args greetArgs) error {
+			started <- args
+			<-release
+			return nil
+		})
+
+		qt.run(t)
+		defer close(release)
+
+		err := greet.Enqueue(context.Background(), greetArgs{}, jobs.EnqueueOptions{})
+		if err != nil {
+			t.Fatalf("failed to enqueue: %v", err)
+		}
+
+		receive(t, started)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err = qt.queue.Shutdown(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v, got %v via errors.Is()", context.DeadlineExceeded, err)
+		}
+	})
+}
+
+func Test_Queue_Overview(t *testing.T) {
+	qt := newQueueTest(t)
+
+	jobs.Register(qt.queue, "greet", jobs.KindConfig{Concurrency: 3}, func(ctx context.Context, args greetArgs) error {
+		return nil
+	})
+
+	now := qt.clock.now()
+	for i, st := range []jobs.Status{jobs.StatusPending, jobs.StatusPending, jobs.StatusFailed} {
+		kind := "greet"
+		if i == 0 {
+			kind = "removed"
+		}
+
+		err := qt.store.CreateJob(context.Background(), jobs.Job{
+			ID:        uuid.New(),
+			Kind:      kind,
+			Args:      []byte(`{}`),
+			Status:    st,
+			RunAt:     now,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		if err != nil {
+			t.Fatalf("failed to create job: %v", err)
+		}
+	}
+
+	got, err := qt.queue.Overview(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("failed to get overview: %v", err)
+	}
+
+	want := []jobs.KindStatus{
+		{Kind: "greet", Registered: true, Concurrency: 3, Pending: 1, Failed: 1},
+		{Kind: "removed", Pending: 1},
+	}
+
+	if len(got.Kinds) != len(want) {
+		t.Fatalf("got %d kinds, want %d: %+v", len(got.Kinds), len(want), got.Kinds)
+	}
+
+	for i := range want {
+		if got.Kinds[i] != want[i] {
+			t.Errorf("got %+v, want %+v", got.Kinds[i], want[i])
+		}
+	}
+
+	if len(got.Failed) != 1 || got.Failed[0].Kind != "greet" {
+		t.Errorf("unexpected failed jobs %+v", got.Failed)
+	}
+}
+
+type queueTest struct {
+	queue *jobs.Queue
+	store *jobsdb.Store
+	clock *testClock
+
+	mu   *sync.Mutex
+	errs []error
+}
+
+func newQueueTest(t *testing.T) *queueTest {
+	t.Helper()
+
+	encryptor, err := krypto.NewEncryptor([]krypto.Key{
+		must(krypto.ParseKey("2b671594b775f371eab4050b4d58326682df6b1a6cc2e886717b1a26b4d6c45d")),
+	})
+	if err != nil {
+		t.Fatalf("failed to create encryptor: %v", err)
+	}
+
+	// The in-memory database only exists on its connection, so the same
+	// handle is used for reading and writing.
+	testDB := testdb.RunWhile(t, true)
+
+	qt := &queueTest{
+		store: jobsdb.New(testDB, testDB, encryptor),
+		clock: &testClock{mu: &sync.Mutex{}, t: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		mu:    &sync.Mutex{},
+	}
+
+	cfg := jobs.Config{
+		PollInterval: 5 * time.Millisecond,
+		BackoffBase:  time.Second,
+		BackoffMax:   time.Minute,
+	}
+
+	qt.queue = jobs.NewQueue(qt.store, cfg, nil, func(_ context.Context, err error) {
+		qt.mu.Lock()
+		defer qt.mu.Unlock()
+		qt.errs = append(qt.errs, err)
+	})
+	qt.queue.NowFunc = qt.clock.now
+
+	return qt
+}
+
+// run runs the queue until the test is cleaned up.
+func (qt *queueTest) run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		qt.queue.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func (qt *queueTest) findJobs(t *testing.T) []jobs.Job {
+	t.Helper()
+
+	got, err := qt.store.FindJobs(context.Background(), jobs.JobFilter{})
+	if err != nil {
+		t.Fatalf("failed to find jobs: %v", err)
+	}
+
+	return got
+}
+
+func (qt *queueTest) assertJobs(t *testing.T, want int) {
+	t.Helper()
+
+	if got := len(qt.findJobs(t)); got != want {
+		t.Errorf("expected %d jobs, got %d", want, got)
+	}
+}
+
+// waitForJobs waits until there are n jobs in the store and none are running.
+func (qt *queueTest) waitForJobs(t *testing.T, n int) {
+	t.Helper()
+
+	waitFor(t, func() bool {
+		return len(qt.findJobs(t)) == n && qt.queue.Running() == 0
+	})
+}
+
+// waitForStatus waits until the single job in the store has status st.
+func (qt *queueTest) waitForStatus(t *testing.T, st jobs.Status) jobs.Job {
+	t.Helper()
+
+	var j jobs.Job
+	waitFor(t, func() bool {
+		got := qt.findJobs(t)
+		if len(got) != 1 || got[0].Status != st {
+			return false
+		}
+		j = got[0]
+		return qt.queue.Running() == 0
+	})
+
+	return j
+}
+
+func (qt *queueTest) assertNoError(t *testing.T) {
+	t.Helper()
+	qt.assertErrors(t, 0)
+}
+
+func (qt *queueTest) assertErrors(t *testing.T, n int) {
+	t.Helper()
+
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+
+	if len(qt.errs) != n {
+		t.Errorf("expected %d errors, got %v", n, qt.errs)
+	}
+}
+
+type testClock struct {
+	mu *sync.Mutex
+	t  time.Time
+}
+
+func (c *testClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func receive[T any](t *testing.T, c chan T) T {
+	t.Helper()
+
+	select {
+	case v := <-c:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting to receive")
+		return *new(T)
+	}
+}
+
+// assertNothingReceived asserts nothing is received on c for a few poll intervals.
+func assertNothingReceived[T any](t *testing.T, c chan T) {
+	t.Helper()
+
+	select {
+	case v := <-c:
+		t.Fatalf("unexpectedly received %v", v)
+	case <-time.After(30 * time.Millisecond):
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
@@ -40,6 +40,18 @@ func ParseKey(raw string) (Key, error) {
 	}, nil
 }
 
+// GenerateKey creates a new random key.
+func GenerateKey() (Key, error) {
+	b, err := genRandomBytes(keyLen)
+	if err != nil {
+		return Key{}, err
+	}
+
+	return Key{
+		value: b,
+	}, nil
+}
+
 func (k Key) Format(f fmt.State, verb rune) {
 	f.Write([]byte(SecretMarker))
 }
@@ -54,3 +66,10 @@ func (k Key) MarshalText() ([]byte, error) {
 func (k Key) SecretValue() []byte {
 	return k.value
 }
+
+// SecretHex returns the key hex encoded, in the format ParseKey expects.
+// Like SecretValue, it's an escape hatch for the few cases where the key
+// needs to be exposed, like when generating configuration.
+func (k Key) SecretHex() string {
+	return hex.EncodeToString(k.value)
+}
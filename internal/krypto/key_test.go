@@ -35,6 +35,32 @@ func Test_ParseKey(t *testing.T) {
 	}
 }
 
+func Test_GenerateKey(t *testing.T) {
+	key1, err := krypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	key2, err := krypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	if bytes.Equal(key1.SecretValue(), key2.SecretValue()) {
+		t.Errorf("expected different keys, got the same key twice")
+	}
+
+	// The generated key should round trip via ParseKey.
+	parsed, err := krypto.ParseKey(key1.SecretHex())
+	if err != nil {
+		t.Fatalf("failed to parse generated key: %v", err)
+	}
+
+	if !bytes.Equal(parsed.SecretValue(), key1.SecretValue()) {
+		t.Errorf("parsed key does not equal generated key")
+	}
+}
+
 func Test_Key_PreventExposure(t *testing.T) {
 	raw := "2b671594b775f371eab4050b4d58326682df6b1a6cc2e886717b1a26b4d6c45d"
 	key := must(krypto.ParseKey(raw))
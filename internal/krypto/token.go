@@ -54,6 +54,12 @@ func (t Token) LogValue() slog.Value {
 	return slog.StringValue(SecretMarker)
 }
 
+// MarshalText returns the same representation as String, so tokens can be
+// stored as arguments of background jobs.
+func (t Token) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
 func (t *Token) UnmarshalText(text []byte) error {
 	token, err := ParseToken(string(text))
 	if err != nil {
@@ -2,6 +2,7 @@ package krypto_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"log/slog"
 	"strings"
@@ -70,6 +71,32 @@ func Test_Token_ParseString(t *testing.T) {
 	}
 }
 
+func Test_Token_JSON(t *testing.T) {
+	tok, err := krypto.GenerateToken()
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	raw, err := json.Marshal(tok)
+	if err != nil {
+		t.Fatalf("failed to marshal token: %v", err)
+	}
+
+	if want := `"` + tok.String() + `"`; string(raw) != want {
+		t.Errorf("got %s, want %s", raw, want)
+	}
+
+	var got krypto.Token
+	err = json.Unmarshal(raw, &got)
+	if err != nil {
+		t.Fatalf("failed to unmarshal token: %v", err)
+	}
+
+	if got != tok {
+		t.Errorf("got %v, want %v", got.String(), tok.String())
+	}
+}
+
 func Test_Token_PreventExposure(t *testing.T) {
 	t.Run("ok, log output", func(t *testing.T) {
 		tok, err := krypto.GenerateToken()
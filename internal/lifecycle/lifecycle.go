@@ -0,0 +1,100 @@
+// Package lifecycle stops the background workers of the app when it shuts down.
+//
+// Requests may hand off work to goroutines that outlive them, like sending an
+// email after registering. Killing these goroutines on shutdown loses that
+// work, so the Manager gives them a chance to finish first.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Worker does work in the background. Shutdown should stop accepting new work
+// and wait for the work in progress to finish. If ctx is done before that, it
+// should return an error describing the work that didn't finish.
+type Worker interface {
+	Shutdown(ctx context.Context) error
+}
+
+// WorkerFunc is an adapter to use a function as a Worker.
+type WorkerFunc func(ctx context.Context) error
+
+// Shutdown calls f(ctx).
+func (f WorkerFunc) Shutdown(ctx context.Context) error {
+	return f(ctx)
+}
+
+// ReportFunc is called once a worker stopped, or failed to stop. took is
+// the duration the worker took to shut down.
+type ReportFunc func(name string, took time.Duration, err error)
+
+// Manager shuts down a collection of named workers.
+type Manager struct {
+	mu       *sync.Mutex
+	workers  []namedWorker
+	report   ReportFunc
+	shutdown bool
+}
+
+type namedWorker struct {
+	name   string
+	worker Worker
+}
+
+// NewManager creates a new Manager, report is called for every worker that is
+// shut down.
+func NewManager(report ReportFunc) *Manager {
+	return &Manager{
+		mu:     &sync.Mutex{},
+		report: report,
+	}
+}
+
+// Add adds a worker to the manager. The name is used to report on the worker.
+func (m *Manager) Add(name string, w Worker) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.workers = append(m.workers, namedWorker{name: name, worker: w})
+}
+
+// Shutdown shuts down all workers concurrently and waits for them to finish,
+// ctx is passed to every worker so they share its deadline. The errors of the
+// workers that didn't finish are joined and returned.
+//
+// Shutdown can only be called once.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	if m.shutdown {
+		m.mu.Unlock()
+		return errors.New("already shut down")
+	}
+	m.shutdown = true
+	workers := m.workers
+	m.mu.Unlock()
+
+	errs := make([]error, len(workers))
+
+	wg := &sync.WaitGroup{}
+	for i, w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			err := w.worker.Shutdown(ctx)
+			m.report(w.name, time.Since(start), err)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", w.name, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,121 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/willemschots/househunt/internal/lifecycle"
+)
+
+func TestManager(t *testing.T) {
+	t.Run("ok, all workers are shut down and reported", func(t *testing.T) {
+		r := &reports{mu: &sync.Mutex{}, errs: make(map[string]error)}
+		m := lifecycle.NewManager(r.report)
+
+		calls := make(chan string, 2)
+		for _, name := range []string{"a", "b"} {
+			m.Add(name, lifecycle.WorkerFunc(func(ctx context.Context) error {
+				calls <- name
+				return nil
+			}))
+		}
+
+		err := m.Shutdown(context.Background())
+		if err != nil {
+			t.Fatalf("failed to shut down: %v", err)
+		}
+
+		if len(calls) != 2 {
+			t.Errorf("expected 2 workers to be shut down, got %d", len(calls))
+		}
+
+		r.assert(t, map[string]error{"a": nil, "b": nil})
+	})
+
+	t.Run("ok, workers share the deadline", func(t *testing.T) {
+		r := &reports{mu: &sync.Mutex{}, errs: make(map[string]error)}
+		m := lifecycle.NewManager(r.report)
+
+		block := func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+
+		m.Add("slow", lifecycle.WorkerFunc(block))
+		m.Add("slower", lifecycle.WorkerFunc(block))
+		m.Add("fast", lifecycle.WorkerFunc(func(ctx context.Context) error {
+			return nil
+		}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := m.Shutdown(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v, got %v via errors.Is()", context.DeadlineExceeded, err)
+		}
+
+		if took := time.Since(start); took > time.Second {
+			t.Errorf("expected workers to be shut down concurrently, took %v", took)
+		}
+
+		r.assert(t, map[string]error{
+			"slow":   context.DeadlineExceeded,
+			"slower": context.DeadlineExceeded,
+			"fast":   nil,
+		})
+	})
+
+	t.Run("fail, shut down twice", func(t *testing.T) {
+		m := lifecycle.NewManager(func(string, time.Duration, error) {})
+
+		err := m.Shutdown(context.Background())
+		if err != nil {
+			t.Fatalf("failed to shut down: %v", err)
+		}
+
+		err = m.Shutdown(context.Background())
+		if err == nil {
+			t.Fatalf("expected error, got <nil>")
+		}
+	})
+}
+
+type reports struct {
+	mu   *sync.Mutex
+	errs map[string]error
+}
+
+func (r *reports) report(name string, _ time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.errs[name] = err
+}
+
+func (r *reports) assert(t *testing.T, want map[string]error) {
+	t.Helper()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.errs) != len(want) {
+		t.Fatalf("got %d reports, want %d: %v", len(r.errs), len(want), r.errs)
+	}
+
+	for name, wantErr := range want {
+		got, ok := r.errs[name]
+		if !ok {
+			t.Errorf("no report for %s", name)
+			continue
+		}
+
+		if !errors.Is(got, wantErr) {
+			t.Errorf("%s: expected %v, got %v via errors.Is()", name, wantErr, got)
+		}
+	}
+}
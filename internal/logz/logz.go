@@ -0,0 +1,40 @@
+package logz
+
+import (
+	"context"
+	"log/slog"
+)
+
+type ctxKey string
+
+const (
+	loggerCtxKey    ctxKey = "_logger"
+	requestIDCtxKey ctxKey = "_request_id"
+)
+
+// WithLogger returns a copy of ctx that carries the logger.
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerCtxKey, l)
+}
+
+// FromContext returns the logger carried by ctx, or fallback if there is none.
+// Loggers in a context are request-scoped, they include the request ID.
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	l, ok := ctx.Value(loggerCtxKey).(*slog.Logger)
+	if !ok {
+		return fallback
+	}
+
+	return l
+}
+
+// WithRequestID returns a copy of ctx that carries the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDCtxKey, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, or an empty string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey).(string)
+	return id
+}
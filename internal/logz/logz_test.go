@@ -0,0 +1,39 @@
+package logz_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/willemschots/househunt/internal/logz"
+)
+
+func Test_FromContext(t *testing.T) {
+	var fallbackBuf, ctxBuf bytes.Buffer
+	fallback := slog.New(slog.NewTextHandler(&fallbackBuf, nil))
+	ctxLogger := slog.New(slog.NewTextHandler(&ctxBuf, nil)).With("request_id", "abc")
+
+	logz.FromContext(context.Background(), fallback).Info("without logger")
+	logz.FromContext(logz.WithLogger(context.Background(), ctxLogger), fallback).Info("with logger")
+
+	if !strings.Contains(fallbackBuf.String(), "without logger") {
+		t.Errorf("expected fallback logger to be used, got %q", fallbackBuf.String())
+	}
+
+	if !strings.Contains(ctxBuf.String(), "with logger") || !strings.Contains(ctxBuf.String(), "request_id=abc") {
+		t.Errorf("expected context logger to be used, got %q", ctxBuf.String())
+	}
+}
+
+func Test_RequestIDFromContext(t *testing.T) {
+	if got := logz.RequestIDFromContext(context.Background()); got != "" {
+		t.Errorf("expected empty request ID, got %q", got)
+	}
+
+	ctx := logz.WithRequestID(context.Background(), "abc")
+	if got := logz.RequestIDFromContext(ctx); got != "abc" {
+		t.Errorf("got request ID %q, want %q", got, "abc")
+	}
+}
@@ -0,0 +1,105 @@
+package metrics
+
+import "sort"
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	f *family
+}
+
+// With returns the counter for the label values, in the order the label names were registered.
+func (v *CounterVec) With(values ...string) *Counter {
+	return &Counter{f: v.f, s: v.f.with(values)}
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	f *family
+	s *series
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds delta to the counter, it panics if delta is negative.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counters can not decrease")
+	}
+
+	c.f.update(c.s, func(s *series) {
+		s.value += delta
+	})
+}
+
+// SetTotal sets the counter to total, for counters that mirror a total that is
+// kept elsewhere, like the stats of a sql.DB. A total lower than the current
+// value is ignored, so the counter never decreases.
+func (c *Counter) SetTotal(total float64) {
+	c.f.update(c.s, func(s *series) {
+		s.value = max(s.value, total)
+	})
+}
+
+// GaugeVec is a gauge partitioned by labels.
+type GaugeVec struct {
+	f *family
+}
+
+// With returns the gauge for the label values, in the order the label names were registered.
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return &Gauge{f: v.f, s: v.f.with(values)}
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	f *family
+	s *series
+}
+
+// Set sets the gauge to value.
+func (g *Gauge) Set(value float64) {
+	g.f.update(g.s, func(s *series) {
+		s.value = value
+	})
+}
+
+// Add adds delta to the gauge, delta can be negative.
+func (g *Gauge) Add(delta float64) {
+	g.f.update(g.s, func(s *series) {
+		s.value += delta
+	})
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	f *family
+}
+
+// With returns the histogram for the label values, in the order the label names were registered.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return &Histogram{f: v.f, s: v.f.with(values)}
+}
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	f *family
+	s *series
+}
+
+// Observe adds an observation to the histogram.
+func (h *Histogram) Observe(value float64) {
+	// The first bucket the value fits in, values that don't fit any bucket
+	// are only counted in the implicit +Inf bucket.
+	i := sort.SearchFloat64s(h.f.buckets, value)
+
+	h.f.update(h.s, func(s *series) {
+		if i < len(s.counts) {
+			s.counts[i]++
+		}
+		s.count++
+		s.value += value
+	})
+}
@@ -0,0 +1,127 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/willemschots/househunt/internal/metrics"
+)
+
+func Test_Registry_Write(t *testing.T) {
+	reg := metrics.NewRegistry()
+
+	requests := reg.NewCounterVec("test_requests_total", "Total number of requests.", "pattern", "code")
+	requests.With("GET /{$}", "200").Inc()
+	requests.With("GET /{$}", "200").Add(2)
+	requests.With("POST /login", "400").Inc()
+
+	workers := reg.NewGaugeVec("test_workers", "Number of running workers.")
+	reg.OnCollect(func() {
+		workers.With().Set(3)
+	})
+
+	latency := reg.NewHistogramVec("test_duration_seconds", "Duration with \"quotes\" and a \\.", []float64{0.1, 1}, "pattern")
+	latency.With(`say "hi"`).Observe(0.05)
+	latency.With(`say "hi"`).Observe(0.1)
+	latency.With(`say "hi"`).Observe(0.5)
+	latency.With(`say "hi"`).Observe(2)
+
+	var buf bytes.Buffer
+	err := reg.Write(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `# HELP test_duration_seconds Duration with "quotes" and a \\.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{pattern="say \"hi\"",le="0.1"} 2
+test_duration_seconds_bucket{pattern="say \"hi\"",le="1"} 3
+test_duration_seconds_bucket{pattern="say \"hi\"",le="+Inf"} 4
+test_duration_seconds_sum{pattern="say \"hi\""} 2.65
+test_duration_seconds_count{pattern="say \"hi\""} 4
+# HELP test_requests_total Total number of requests.
+# TYPE test_requests_total counter
+test_requests_total{pattern="GET /{$}",code="200"} 3
+test_requests_total{pattern="POST /login",code="400"} 1
+# HELP test_workers Number of running workers.
+# TYPE test_workers gauge
+test_workers 3
+`
+
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func Test_Counter_SetTotal(t *testing.T) {
+	reg := metrics.NewRegistry()
+
+	waits := reg.NewCounterVec("test_waits_total", "Total number of waits.")
+	waits.With().SetTotal(3)
+	waits.With().SetTotal(5)
+	// Lower totals, for example of a collect that finished late, are ignored.
+	waits.With().SetTotal(4)
+
+	var buf bytes.Buffer
+	err := reg.Write(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `# HELP test_waits_total Total number of waits.
+# TYPE test_waits_total counter
+test_waits_total 5
+`
+
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func Test_Registry_ServeHTTP(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reg.NewCounterVec("test_total", "Test.").With().Inc()
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if got := rec.Header().Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("got content type %q", got)
+	}
+}
+
+func Test_Registry_Panics(t *testing.T) {
+	tests := map[string]func(reg *metrics.Registry){
+		"duplicate name": func(reg *metrics.Registry) {
+			reg.NewCounterVec("test_total", "Test.")
+			reg.NewGaugeVec("test_total", "Test.")
+		},
+		"wrong number of label values": func(reg *metrics.Registry) {
+			reg.NewCounterVec("test_total", "Test.", "a", "b").With("a")
+		},
+		"unsorted buckets": func(reg *metrics.Registry) {
+			reg.NewHistogramVec("test_seconds", "Test.", []float64{1, 0.1})
+		},
+		"decreasing counter": func(reg *metrics.Registry) {
+			reg.NewCounterVec("test_total", "Test.").With().Add(-1)
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic")
+				}
+			}()
+
+			tc(metrics.NewRegistry())
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace, all spans in a trace share the same TraceID.
+type TraceID [16]byte
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanKind describes the relationship between a span and its parent,
+// the values match the OTLP span kinds.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Attribute is a key value pair describing a span. Value
+// is one of string, int64, float64 or bool.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+func String(key, v string) Attribute {
+	return Attribute{Key: key, Value: v}
+}
+
+func Int(key string, v int) Attribute {
+	return Attribute{Key: key, Value: int64(v)}
+}
+
+func Bool(key string, v bool) Attribute {
+	return Attribute{Key: key, Value: v}
+}
+
+// SpanData is the exported representation of an ended span.
+type SpanData struct {
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	Name         string
+	Kind         SpanKind
+	Start        time.Time
+	End          time.Time
+	Attributes   []Attribute
+	// Err is the error message of a failed span, empty if the span succeeded.
+	Err string
+}
+
+// Span tracks a single operation. A nil *Span is valid and does nothing,
+// this is what Start returns if ctx does not carry a Tracer.
+type Span struct {
+	tracer *Tracer
+	mu     *sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// TraceID returns the ID of the trace the span belongs to.
+func (s *Span) TraceID() TraceID {
+	if s == nil {
+		return TraceID{}
+	}
+	return s.data.TraceID
+}
+
+// SetKind sets the kind of the span, it defaults to KindInternal.
+func (s *Span) SetKind(k SpanKind) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Kind = k
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Attributes = append(s.data.Attributes, attrs...)
+}
+
+// End ends the span and passes it to the tracer for exporting.
+// Calling End more than once has no effect.
+func (s *Span) End() {
+	s.EndErr(nil)
+}
+
+// EndErr ends the span like End, the span is marked as failed if err is not nil.
+// It is meant to be deferred with a named error return value:
+//
+//	ctx, span := tracing.Start(ctx, "name")
+//	defer func() { span.EndErr(err) }()
+func (s *Span) EndErr(err error) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = s.tracer.NowFunc()
+	if err != nil {
+		s.data.Err = err.Error()
+	}
+	data := s.data
+	s.mu.Unlock()
+
+	s.tracer.enqueue(data)
+}
+
+type ctxKey string
+
+const (
+	tracerCtxKey ctxKey = "_tracer"
+	spanCtxKey   ctxKey = "_span"
+	remoteCtxKey ctxKey = "_remote_span"
+)
+
+// WithTracer returns a copy of ctx that carries t. Spans are only
+// recorded for contexts that carry a tracer.
+func WithTracer(ctx context.Context, t *Tracer) context.Context {
+	return context.WithValue(ctx, tracerCtxKey, t)
+}
+
+// SpanFromContext returns the current span in ctx, or nil if there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanCtxKey).(*Span)
+	return s
+}
+
+// Start starts a new span as a child of the current span in ctx. If ctx has no
+// current span, the span starts a new trace, or continues a remote trace
+// if ctx carries one (see WithTraceParent).
+//
+// The returned context carries the new span, so spans started from it become children.
+// This also holds for goroutines started with the returned context, as long as the
+// context values are kept.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	t, _ := ctx.Value(tracerCtxKey).(*Tracer)
+	if t == nil {
+		return ctx, nil
+	}
+
+	data := SpanData{
+		Name:       name,
+		Kind:       KindInternal,
+		Start:      t.NowFunc(),
+		Attributes: attrs,
+	}
+
+	if parent := SpanFromContext(ctx); parent != nil {
+		data.TraceID = parent.data.TraceID
+		data.ParentSpanID = parent.data.SpanID
+	} else if remote, ok := ctx.Value(remoteCtxKey).(remoteParent); ok {
+		data.TraceID = remote.traceID
+		data.ParentSpanID = remote.spanID
+	} else {
+		_, _ = rand.Read(data.TraceID[:])
+	}
+
+	_, _ = rand.Read(data.SpanID[:])
+
+	s := &Span{
+		tracer: t,
+		mu:     &sync.Mutex{},
+		data:   data,
+	}
+
+	return context.WithValue(ctx, spanCtxKey, s), s
+}
+
+type remoteParent struct {
+	traceID TraceID
+	spanID  SpanID
+}
+
+// WithTraceParent returns a copy of ctx that continues the trace described by a
+// W3C traceparent header. Invalid headers are ignored and ctx is returned as is.
+func WithTraceParent(ctx context.Context, header string) context.Context {
+	// Format: version-traceid-parentid-flags, e.g.
+	// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[3]) != 2 {
+		return ctx
+	}
+
+	var remote remoteParent
+	if !decodeHex(remote.traceID[:], parts[1]) || !decodeHex(remote.spanID[:], parts[2]) {
+		return ctx
+	}
+
+	if !remote.traceID.IsValid() || !remote.spanID.IsValid() {
+		return ctx
+	}
+
+	return context.WithValue(ctx, remoteCtxKey, remote)
+}
+
+// TraceParent formats the W3C traceparent header for the current span in
+// ctx. It returns an empty string if there is no current span.
+func TraceParent(ctx context.Context) string {
+	s := SpanFromContext(ctx)
+	if s == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("00-%s-%s-01", s.data.TraceID, s.data.SpanID)
+}
+
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
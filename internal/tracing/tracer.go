@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Exporter exports ended spans.
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+}
+
+// Config configures a Tracer.
+type Config struct {
+	// FlushInterval is the time between two exports of buffered spans.
+	FlushInterval time.Duration
+	// MaxQueueSize is the max number of buffered spans, spans
+	// that end while the buffer is full are dropped.
+	MaxQueueSize int
+}
+
+// Tracer buffers ended spans and periodically exports them in batches,
+// so exporting never slows down the operation that is being traced.
+type Tracer struct {
+	exporter Exporter
+	cfg      Config
+
+	mu      *sync.Mutex
+	queue   []SpanData
+	dropped int
+	closed  bool
+	stop    chan struct{}
+	running *sync.WaitGroup
+
+	// NowFunc is used to get the current time.
+	// Exposed for testing purposes.
+	NowFunc func() time.Time
+}
+
+// NewTracer creates a new Tracer that exports spans to exporter.
+func NewTracer(exporter Exporter, cfg Config) *Tracer {
+	return &Tracer{
+		exporter: exporter,
+		cfg:      cfg,
+		mu:       &sync.Mutex{},
+		stop:     make(chan struct{}),
+		running:  &sync.WaitGroup{},
+		NowFunc:  time.Now,
+	}
+}
+
+func (t *Tracer) enqueue(data SpanData) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.queue) >= t.cfg.MaxQueueSize {
+		t.dropped++
+		return
+	}
+
+	t.queue = append(t.queue, data)
+}
+
+// Flush exports all buffered spans.
+func (t *Tracer) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	spans := t.queue
+	dropped := t.dropped
+	t.queue = nil
+	t.dropped = 0
+	t.mu.Unlock()
+
+	var errs []error
+	if dropped > 0 {
+		errs = append(errs, fmt.Errorf("dropped %d spans, the queue was full", dropped))
+	}
+
+	if len(spans) > 0 {
+		err := t.exporter.Export(ctx, spans)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to export %d spans: %w", len(spans), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Run flushes the buffered spans on every interval until ctx is cancelled or the
+// tracer is shut down. Errors are passed to errFunc. Spans that end after Run
+// returns are exported by calling Flush.
+func (t *Tracer) Run(ctx context.Context, errFunc func(error)) {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	t.running.Add(1)
+	t.mu.Unlock()
+
+	defer t.running.Done()
+
+	ticker := time.NewTicker(t.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		}
+
+		err := t.Flush(ctx)
+		if err != nil {
+			errFunc(err)
+		}
+	}
+}
+
+// Shutdown stops Run and waits for an export in progress to finish. If ctx is
+// done before that, an error is returned. Spans can still be recorded and
+// exported by calling Flush.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.stop)
+	}
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("exporting spans did not finish: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,492 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/willemschots/househunt/internal/tracing"
+)
+
+func Test_Start(t *testing.T) {
+	t.Run("ok, no tracer in context", func(t *testing.T) {
+		ctx := context.Background()
+		gotCtx, span := tracing.Start(ctx, "test")
+		if span != nil {
+			t.Errorf("expected nil span, got %v", span)
+		}
+
+		if gotCtx != ctx {
+			t.Errorf("expected context to be returned as is")
+		}
+
+		// a nil span should be safe to use.
+		span.SetKind(tracing.KindServer)
+		span.SetAttributes(tracing.String("key", "value"))
+		span.EndErr(errors.New("test error"))
+	})
+
+	t.Run("ok, children share the trace of their parent", func(t *testing.T) {
+		tracer, exp := newTracer(t)
+		ctx := tracing.WithTracer(context.Background(), tracer)
+
+		ctx, root := tracing.Start(ctx, "root")
+		childCtx, child := tracing.Start(ctx, "child")
+
+		// spans should also be children when started in another
+		// goroutine, as long as the context values are kept.
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, worker := tracing.Start(context.WithoutCancel(childCtx), "worker")
+			worker.End()
+		}()
+		wg.Wait()
+
+		child.End()
+		root.End()
+
+		spans := exp.mustFlush(t, tracer)
+		if len(spans) != 3 {
+			t.Fatalf("expected 3 spans, got %d", len(spans))
+		}
+
+		byName := spansByName(spans)
+		if byName["root"].ParentSpanID.IsValid() {
+			t.Errorf("expected root span to have no parent")
+		}
+
+		assertChildOf(t, byName["child"], byName["root"])
+		assertChildOf(t, byName["worker"], byName["child"])
+	})
+
+	t.Run("ok, continue remote trace", func(t *testing.T) {
+		tracer, exp := newTracer(t)
+		ctx := tracing.WithTracer(context.Background(), tracer)
+		ctx = tracing.WithTraceParent(ctx, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+		ctx, span := tracing.Start(ctx, "server")
+		span.End()
+
+		spans := exp.mustFlush(t, tracer)
+		if got := spans[0].TraceID.String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("got trace ID %s, want the remote trace ID", got)
+		}
+
+		if got := spans[0].ParentSpanID.String(); got != "00f067aa0ba902b7" {
+			t.Errorf("got parent span ID %s, want the remote span ID", got)
+		}
+
+		want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + spans[0].SpanID.String() + "-01"
+		if got := tracing.TraceParent(ctx); got != want {
+			t.Errorf("got traceparent %q, want %q", got, want)
+		}
+	})
+
+	invalidTraceParents := map[string]string{
+		"empty":             "",
+		"unknown version":   "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"too few parts":     "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"short trace ID":    "00-4bf92f3577b34da6-00f067aa0ba902b7-01",
+		"upper case":        "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"not hex":           "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+		"all zero trace ID": "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"all zero span ID":  "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+	}
+
+	for name, header := range invalidTraceParents {
+		t.Run("ok, ignore invalid traceparent, "+name, func(t *testing.T) {
+			tracer, exp := newTracer(t)
+			ctx := tracing.WithTracer(context.Background(), tracer)
+			ctx = tracing.WithTraceParent(ctx, header)
+
+			_, span := tracing.Start(ctx, "server")
+			span.End()
+
+			spans := exp.mustFlush(t, tracer)
+			if spans[0].ParentSpanID.IsValid() {
+				t.Errorf("expected a new trace, got parent %s", spans[0].ParentSpanID)
+			}
+		})
+	}
+}
+
+func Test_Span(t *testing.T) {
+	t.Run("ok, attributes, kind and error are recorded", func(t *testing.T) {
+		tracer, exp := newTracer(t)
+		start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		tracer.NowFunc = func() time.Time { return start }
+
+		ctx := tracing.WithTracer(context.Background(), tracer)
+		_, span := tracing.Start(ctx, "test", tracing.String("a", "1"))
+		span.SetKind(tracing.KindClient)
+		span.SetAttributes(tracing.Int("b", 2), tracing.Bool("c", true))
+
+		tracer.NowFunc = func() time.Time { return start.Add(time.Second) }
+		span.EndErr(errors.New("test error"))
+
+		// ending a second time has no effect.
+		span.End()
+
+		spans := exp.mustFlush(t, tracer)
+		if len(spans) != 1 {
+			t.Fatalf("expected 1 span, got %d", len(spans))
+		}
+
+		got := spans[0]
+		if got.Kind != tracing.KindClient {
+			t.Errorf("got kind %d, want %d", got.Kind, tracing.KindClient)
+		}
+
+		if got.End.Sub(got.Start) != time.Second {
+			t.Errorf("got duration %s, want 1s", got.End.Sub(got.Start))
+		}
+
+		if got.Err != "test error" {
+			t.Errorf("got error %q, want %q", got.Err, "test error")
+		}
+
+		want := []tracing.Attribute{
+			tracing.String("a", "1"),
+			tracing.Int("b", 2),
+			tracing.Bool("c", true),
+		}
+		if len(got.Attributes) != len(want) {
+			t.Fatalf("got attributes %v, want %v", got.Attributes, want)
+		}
+		for i := range want {
+			if got.Attributes[i] != want[i] {
+				t.Errorf("got attribute %v, want %v", got.Attributes[i], want[i])
+			}
+		}
+	})
+}
+
+func Test_Tracer(t *testing.T) {
+	t.Run("ok, flush without spans", func(t *testing.T) {
+		tracer, exp := newTracer(t)
+
+		spans := exp.mustFlush(t, tracer)
+		if len(spans) != 0 {
+			t.Errorf("expected no spans, got %d", len(spans))
+		}
+	})
+
+	t.Run("fail, spans are dropped when the queue is full", func(t *testing.T) {
+		exp := &recordingExporter{}
+		tracer := tracing.NewTracer(exp, tracing.Config{
+			FlushInterval: time.Minute,
+			MaxQueueSize:  2,
+		})
+
+		ctx := tracing.WithTracer(context.Background(), tracer)
+		for range 3 {
+			_, span := tracing.Start(ctx, "test")
+			span.End()
+		}
+
+		err := tracer.Flush(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "dropped 1 spans") {
+			t.Errorf("expected dropped spans error, got %v", err)
+		}
+
+		if len(exp.spans) != 2 {
+			t.Errorf("expected 2 exported spans, got %d", len(exp.spans))
+		}
+	})
+
+	t.Run("fail, export error", func(t *testing.T) {
+		exp := &recordingExporter{err: errors.New("test error")}
+		tracer := tracing.NewTracer(exp, tracing.Config{
+			FlushInterval: time.Minute,
+			MaxQueueSize:  10,
+		})
+
+		_, span := tracing.Start(tracing.WithTracer(context.Background(), tracer), "test")
+		span.End()
+
+		err := tracer.Flush(context.Background())
+		if !errors.Is(err, exp.err) {
+			t.Errorf("expected %v, got %v", exp.err, err)
+		}
+	})
+
+	t.Run("ok, run flushes periodically", func(t *testing.T) {
+		exp := &recordingExporter{}
+		tracer := tracing.NewTracer(exp, tracing.Config{
+			FlushInterval: time.Millisecond,
+			MaxQueueSize:  10,
+		})
+
+		_, span := tracing.Start(tracing.WithTracer(context.Background(), tracer), "test")
+		span.End()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		go tracer.Run(ctx, func(err error) {
+			t.Errorf("unexpected error: %v", err)
+		})
+
+		for exp.count() == 0 {
+			select {
+			case <-ctx.Done():
+				t.Fatalf("spans were not exported")
+			case <-time.After(time.Millisecond):
+			}
+		}
+	})
+
+	t.Run("ok, shutdown stops run", func(t *testing.T) {
+		tracer := tracing.NewTracer(&recordingExporter{}, tracing.Config{
+			FlushInterval: time.Millisecond,
+			MaxQueueSize:  10,
+		})
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			tracer.Run(context.Background(), func(err error) {
+				t.Errorf("unexpected error: %v", err)
+			})
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		err := tracer.Shutdown(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			t.Fatalf("run did not stop after shutdown")
+		}
+	})
+}
+
+func Test_OTLPExporter(t *testing.T) {
+	t.Run("ok, spans are posted as OTLP/JSON", func(t *testing.T) {
+		var got map[string]any
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			}
+
+			if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("got content type %q, want application/json", ct)
+			}
+
+			err := json.NewDecoder(r.Body).Decode(&got)
+			if err != nil {
+				t.Errorf("failed to decode body: %v", err)
+			}
+		}))
+		defer srv.Close()
+
+		exp := tracing.NewOTLPExporter(srv.Client(), must(url.Parse(srv.URL+"/v1/traces")), "test-service")
+
+		err := exp.Export(context.Background(), []tracing.SpanData{testSpan()})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := map[string]any{
+			"resourceSpans": []any{map[string]any{
+				"resource": map[string]any{
+					"attributes": []any{
+						map[string]any{"key": "service.name", "value": map[string]any{"stringValue": "test-service"}},
+					},
+				},
+				"scopeSpans": []any{map[string]any{
+					"scope": map[string]any{"name": "github.com/willemschots/househunt/internal/tracing"},
+					"spans": []any{map[string]any{
+						"traceId":           "0102030405060708090a0b0c0d0e0f10",
+						"spanId":            "0102030405060708",
+						"parentSpanId":      "0807060504030201",
+						"name":              "test",
+						"kind":              float64(2),
+						"startTimeUnixNano": "1704110400000000000",
+						"endTimeUnixNano":   "1704110401000000000",
+						"attributes": []any{
+							map[string]any{"key": "s", "value": map[string]any{"stringValue": "v"}},
+							map[string]any{"key": "i", "value": map[string]any{"intValue": "42"}},
+							map[string]any{"key": "b", "value": map[string]any{"boolValue": true}},
+						},
+						"status": map[string]any{"code": float64(2), "message": "test error"},
+					}},
+				}},
+			}},
+		}
+
+		assertJSONEqual(t, want, got)
+	})
+
+	t.Run("fail, collector responds with error", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer srv.Close()
+
+		exp := tracing.NewOTLPExporter(srv.Client(), must(url.Parse(srv.URL)), "test-service")
+
+		err := exp.Export(context.Background(), []tracing.SpanData{testSpan()})
+		if err == nil || !strings.Contains(err.Error(), "400") {
+			t.Errorf("expected status error, got %v", err)
+		}
+	})
+}
+
+func Test_WriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	exp := tracing.NewWriterExporter(&buf)
+
+	err := exp.Export(context.Background(), []tracing.SpanData{testSpan(), testSpan()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d:\n%s", len(lines), buf.String())
+	}
+
+	var got map[string]any
+	err = json.Unmarshal([]byte(lines[0]), &got)
+	if err != nil {
+		t.Fatalf("failed to decode line: %v", err)
+	}
+
+	want := map[string]any{
+		"trace_id":  "0102030405060708090a0b0c0d0e0f10",
+		"span_id":   "0102030405060708",
+		"parent_id": "0807060504030201",
+		"name":      "test",
+		"start":     "2024-01-01T12:00:00Z",
+		"duration":  "1s",
+		"attributes": map[string]any{
+			"s": "v",
+			"i": float64(42),
+			"b": true,
+		},
+		"error": "test error",
+	}
+
+	assertJSONEqual(t, want, got)
+}
+
+func testSpan() tracing.SpanData {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	return tracing.SpanData{
+		TraceID:      tracing.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		SpanID:       tracing.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		ParentSpanID: tracing.SpanID{8, 7, 6, 5, 4, 3, 2, 1},
+		Name:         "test",
+		Kind:         tracing.KindServer,
+		Start:        start,
+		End:          start.Add(time.Second),
+		Attributes: []tracing.Attribute{
+			tracing.String("s", "v"),
+			tracing.Int("i", 42),
+			tracing.Bool("b", true),
+		},
+		Err: "test error",
+	}
+}
+
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+	err   error
+}
+
+func (e *recordingExporter) Export(_ context.Context, spans []tracing.SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.err != nil {
+		return e.err
+	}
+
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *recordingExporter) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return len(e.spans)
+}
+
+func (e *recordingExporter) mustFlush(t *testing.T, tracer *tracing.Tracer) []tracing.SpanData {
+	t.Helper()
+
+	err := tracer.Flush(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error flushing: %v", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.spans
+}
+
+func newTracer(t *testing.T) (*tracing.Tracer, *recordingExporter) {
+	t.Helper()
+
+	exp := &recordingExporter{}
+	return tracing.NewTracer(exp, tracing.Config{
+		FlushInterval: time.Minute,
+		MaxQueueSize:  100,
+	}), exp
+}
+
+func spansByName(spans []tracing.SpanData) map[string]tracing.SpanData {
+	out := make(map[string]tracing.SpanData, len(spans))
+	for _, s := range spans {
+		out[s.Name] = s
+	}
+	return out
+}
+
+func assertChildOf(t *testing.T, child, parent tracing.SpanData) {
+	t.Helper()
+
+	if child.TraceID != parent.TraceID {
+		t.Errorf("span %s has trace ID %s, want %s", child.Name, child.TraceID, parent.TraceID)
+	}
+
+	if child.ParentSpanID != parent.SpanID {
+		t.Errorf("span %s has parent %s, want %s", child.Name, child.ParentSpanID, parent.SpanID)
+	}
+}
+
+func assertJSONEqual(t *testing.T, want, got any) {
+	t.Helper()
+
+	wantJSON := must(json.MarshalIndent(want, "", "  "))
+	gotJSON := must(json.MarshalIndent(got, "", "  "))
+	if !bytes.Equal(wantJSON, gotJSON) {
+		t.Errorf("got:\n%s\nwant:\n%s", gotJSON, wantJSON)
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// WriterExporter writes spans as JSON lines to a writer. It's meant for local
+// development, so traces can be inspected without running a collector.
+type WriterExporter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter creates a new WriterExporter.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{
+		mu: &sync.Mutex{},
+		w:  w,
+	}
+}
+
+type writerSpan struct {
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	ParentID   string         `json:"parent_id,omitempty"`
+	Name       string         `json:"name"`
+	Start      time.Time      `json:"start"`
+	Duration   string         `json:"duration"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Err        string         `json:"error,omitempty"`
+}
+
+// Export writes every span on its own line.
+func (e *WriterExporter) Export(_ context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		out := writerSpan{
+			TraceID:  s.TraceID.String(),
+			SpanID:   s.SpanID.String(),
+			Name:     s.Name,
+			Start:    s.Start,
+			Duration: s.End.Sub(s.Start).String(),
+			Err:      s.Err,
+		}
+
+		if s.ParentSpanID.IsValid() {
+			out.ParentID = s.ParentSpanID.String()
+		}
+
+		if len(s.Attributes) > 0 {
+			out.Attributes = make(map[string]any, len(s.Attributes))
+			for _, a := range s.Attributes {
+				out.Attributes[a.Key] = a.Value
+			}
+		}
+
+		err := enc.Encode(out)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,8 +1,16 @@
 package web
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"strings"
 
+	"github.com/google/uuid"
+	"github.com/gorilla/csrf"
+	"github.com/willemschots/househunt/internal/audit"
+	"github.com/willemschots/househunt/internal/auth"
 	"github.com/willemschots/househunt/internal/errorz"
 )
 
@@ -10,6 +18,21 @@ const (
 	authCookieName      = "hh-auth"
 	csrfTokenCookieName = "csrf"
 	csrfTokenField      = "csrfToken"
+
+	// maxWebhookBytes is the max size of a webhook request body.
+	maxWebhookBytes = 64 * 1024
+
+	// maxAuditLogEntries is the max number of entries shown on the audit log page.
+	maxAuditLogEntries = 200
+
+	// maxFailedJobs is the max number of failed jobs shown on the jobs page.
+	maxFailedJobs = 50
+
+	// maxSecurityEvents is the max number of security events shown on the settings page.
+	maxSecurityEvents = 50
+
+	// maxUserAgentLen is the max length of a user agent we record in the audit log.
+	maxUserAgentLen = 512
 )
 
 func (s *Server) public(pattern string, handler http.Handler) {
@@ -36,14 +59,24 @@ func (s *Server) publicOnly(pattern string, handler http.Handler) {
 
 func (s *Server) loggedIn(pattern string, handler http.Handler) {
 	s.mux.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		sess, err := sessionFromCtx(r.Context())
-		if err != nil {
-			s.writeError(w, r, err)
+		_, ok := s.activeUser(w, r)
+		if !ok {
 			return
 		}
 
-		_, ok := sess.UserID()
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+func (s *Server) admin(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := s.activeUser(w, r)
 		if !ok {
+			return
+		}
+
+		if user.Role != auth.RoleAdmin {
+			// Don't reveal the admin pages exist.
 			s.writeError(w, r, errorz.ErrNotFound)
 			return
 		}
@@ -51,3 +84,85 @@ func (s *Server) loggedIn(pattern string, handler http.Handler) {
 		handler.ServeHTTP(w, r)
 	}))
 }
+
+// activeUser returns the logged in user. The user is looked up on every request,
+// so that users that were deactivated by an admin are logged out immediately.
+// If false is returned, an error response has already been written.
+func (s *Server) activeUser(w http.ResponseWriter, r *http.Request) (auth.User, bool) {
+	sess, err := sessionFromCtx(r.Context())
+	if err != nil {
+		s.writeError(w, r, err)
+		return auth.User{}, false
+	}
+
+	userID, ok := sess.UserID()
+	if !ok {
+		s.writeError(w, r, errorz.ErrNotFound)
+		return auth.User{}, false
+	}
+
+	user, err := s.deps.AuthService.ActiveUser(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, errorz.ErrNotFound) {
+			sess.DeleteUserID()
+		}
+
+		s.writeError(w, r, err)
+		return auth.User{}, false
+	}
+
+	return user, true
+}
+
+// userIDFromCtx returns the ID of the logged in user. It should only be used by
+// handlers that are protected by the loggedIn or admin guards.
+func userIDFromCtx(ctx context.Context) (uuid.UUID, error) {
+	sess, err := sessionFromCtx(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	userID, ok := sess.UserID()
+	if !ok {
+		return uuid.Nil, errorz.ErrNotFound
+	}
+
+	return userID, nil
+}
+
+// clientMiddleware stores information about the client in the request context,
+// so it can be recorded alongside security events.
+func clientMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+
+		userAgent := r.UserAgent()
+		if len(userAgent) > maxUserAgentLen {
+			userAgent = userAgent[:maxUserAgentLen]
+		}
+
+		ctx := audit.WithClient(r.Context(), audit.Client{
+			IP:        ip,
+			UserAgent: userAgent,
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// skipCSRF is a middleware that exempts requests with the given path prefix from CSRF
+// protection. Only use this for endpoints that are authenticated by other means,
+// like webhooks called by third parties.
+func skipCSRF(prefix string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				r = csrf.UnsafeSkipCheck(r)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
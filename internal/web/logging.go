@@ -0,0 +1,131 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/logz"
+	"github.com/willemschots/househunt/internal/tracing"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+
+	// maxRequestIDLen is the max length of a request ID we accept from a client.
+	maxRequestIDLen = 128
+
+	// unmatchedPattern is used as the pattern for requests that did not match any route.
+	unmatchedPattern = "unmatched"
+)
+
+// loggingMiddleware assigns an ID to every request and stores a logger that includes
+// this ID in the request context. A valid X-Request-ID provided by the client (or a
+// proxy in front of us) is used as is, so requests can be traced across services.
+// Once the request is handled a summary is logged. If the request is traced,
+// the trace ID is logged as well.
+func loggingMiddleware(s *Server) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(requestIDHeader)
+			if !validRequestID(id) {
+				id = uuid.NewString()
+			}
+
+			w.Header().Set(requestIDHeader, id)
+
+			logger := s.deps.Logger.With("request_id", id)
+			if span := tracing.SpanFromContext(r.Context()); span != nil {
+				logger = logger.With("trace_id", span.TraceID().String())
+			}
+
+			ctx := logz.WithRequestID(r.Context(), id)
+			ctx = logz.WithLogger(ctx, logger)
+
+			start := time.Now()
+			rec := &responseRecorder{ResponseWriter: w}
+
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			logger.Info("http request",
+				"method", r.Method,
+				"pattern", s.pattern(r),
+				"status", rec.statusCode(),
+				"bytes", rec.bytes,
+				"duration", time.Since(start),
+			)
+		})
+	}
+}
+
+// validRequestID reports whether id is safe to use as a request ID. Only
+// a limited set of characters is allowed, to prevent log injection.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// logger returns the request-scoped logger.
+func (s *Server) logger(r *http.Request) *slog.Logger {
+	return logz.FromContext(r.Context(), s.deps.Logger)
+}
+
+// pattern returns the mux pattern that matches the request.
+func (s *Server) pattern(r *http.Request) string {
+	_, pattern := s.mux.Handler(r)
+	if pattern == "" {
+		return unmatchedPattern
+	}
+
+	return pattern
+}
+
+// responseRecorder records the status code and number of bytes written to a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to access the underlying ResponseWriter.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// statusCode returns the recorded status code, handlers that don't write
+// anything implicitly respond with 200.
+func (r *responseRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
@@ -0,0 +1,30 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/willemschots/househunt/internal/metrics"
+)
+
+// metricsMiddleware records the number of requests and their latency per mux pattern.
+// Patterns are used instead of paths, so that the number of series stays bounded.
+func metricsMiddleware(s *Server, reg *metrics.Registry) func(http.Handler) http.Handler {
+	requests := reg.NewCounterVec("househunt_http_requests_total", "Total number of HTTP requests by mux pattern and status code.", "pattern", "code")
+	duration := reg.NewHistogramVec("househunt_http_request_duration_seconds", "Latency of HTTP requests by mux pattern.", metrics.DefaultBuckets, "pattern")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pattern := s.pattern(r)
+
+			start := time.Now()
+			rec := &responseRecorder{ResponseWriter: w}
+
+			next.ServeHTTP(rec, r)
+
+			duration.With(pattern).Observe(time.Since(start).Seconds())
+			requests.With(pattern, strconv.Itoa(rec.statusCode())).Inc()
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultCSP is a Content-Security-Policy that only allows resources from
+	// our own origin, and inline scripts and styles that carry the nonce of the request.
+	DefaultCSP = "default-src 'self'; script-src 'self' {nonce}; style-src 'self' {nonce}; img-src 'self' data:; " +
+		"object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'; report-uri " + cspReportPath
+
+	// cspNoncePlaceholder is replaced by the nonce source of the request in the CSP.
+	cspNoncePlaceholder = "{nonce}"
+
+	// cspReportPath is where browsers send reports of CSP violations to.
+	cspReportPath = "/csp-report"
+
+	// maxCSPReportBytes is the max size of a CSP violation report.
+	maxCSPReportBytes = 16 * 1024
+
+	// nonceBytes is the number of random bytes in a CSP nonce.
+	nonceBytes = 16
+)
+
+const cspNonceCtxKey ctxKey = "_csp_nonce"
+
+// securityMiddleware sets the security headers on every response, including a
+// Content-Security-Policy with a fresh nonce that is made available to the views.
+func securityMiddleware(srv *Server) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", "DENY")
+			h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+			h.Set("Permissions-Policy", "camera=(), microphone=(), geolocation=(), payment=()")
+
+			if srv.cfg.HSTSMaxAge > 0 {
+				h.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(int(srv.cfg.HSTSMaxAge.Seconds()))+"; includeSubDomains")
+			}
+
+			if srv.cfg.CSP != "" {
+				nonce, err := newNonce()
+				if err != nil {
+					srv.logger(r).Error("failed to generate CSP nonce", "error", err)
+					http.Error(w, "internal server error", http.StatusInternalServerError)
+					return
+				}
+
+				header := "Content-Security-Policy"
+				if srv.cfg.CSPReportOnly {
+					header = "Content-Security-Policy-Report-Only"
+				}
+
+				h.Set(header, strings.ReplaceAll(srv.cfg.CSP, cspNoncePlaceholder, "'nonce-"+nonce+"'"))
+
+				r = r.WithContext(context.WithValue(r.Context(), cspNonceCtxKey, nonce))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// cspNonceFromCtx returns the CSP nonce of the request, or an empty string if
+// no CSP is set.
+func cspNonceFromCtx(ctx context.Context) string {
+	nonce, _ := ctx.Value(cspNonceCtxKey).(string)
+	return nonce
+}
+
+// newNonce returns a random nonce, it's URL safe so it doesn't need to be
+// escaped in HTML attributes.
+func newNonce() (string, error) {
+	b := make([]byte, nonceBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// cspReport is a CSP violation report as sent by browsers using the report-uri
+// directive, see https://www.w3.org/TR/CSP2/#violation-reports.
+type cspReport struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		BlockedURI         string `json:"blocked-uri"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+		Disposition        string `json:"disposition"`
+	} `json:"csp-report"`
+}
+
+// cspReportHandler logs the CSP violations reported by browsers.
+func cspReportHandler(srv *Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCSPReportBytes))
+		if err != nil {
+			http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		var report cspReport
+		err = json.Unmarshal(body, &report)
+		if err != nil {
+			http.Error(w, "invalid report", http.StatusBadRequest)
+			return
+		}
+
+		rep := report.Report
+		srv.logger(r).Warn("content security policy violation",
+			"document_uri", rep.DocumentURI,
+			"violated_directive", rep.ViolatedDirective,
+			"effective_directive", rep.EffectiveDirective,
+			"blocked_uri", rep.BlockedURI,
+			"source_file", rep.SourceFile,
+			"line_number", rep.LineNumber,
+			"disposition", rep.Disposition,
+		)
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
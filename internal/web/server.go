@@ -2,18 +2,30 @@ package web
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/csrf"
 	"github.com/gorilla/schema"
+	"github.com/willemschots/househunt/internal/audit"
 	"github.com/willemschots/househunt/internal/auth"
 	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/email/postmark"
 	"github.com/willemschots/househunt/internal/errorz"
+	"github.com/willemschots/househunt/internal/i18n"
+	"github.com/willemschots/househunt/internal/jobs"
 	"github.com/willemschots/househunt/internal/krypto"
+	"github.com/willemschots/househunt/internal/metrics"
+	"github.com/willemschots/househunt/internal/tracing"
 	"github.com/willemschots/househunt/internal/web/sessions"
+	"github.com/willemschots/househunt/internal/web/static"
 )
 
 // ViewRenderer renders named views with the given data.
@@ -26,14 +38,35 @@ type ServerDeps struct {
 	Logger       *slog.Logger
 	ViewRenderer ViewRenderer
 	AuthService  *auth.Service
+	Jobs         *jobs.Queue
+	Auditor      *audit.Recorder
+	EmailService *email.Service
+	Catalogue    *i18n.Catalogue
 	SessionStore *sessions.Store
-	DistFS       http.FileSystem
+	// Static serves the static frontend files under /static/.
+	Static *static.Handler
+	// Metrics is the registry HTTP metrics are recorded in. If nil, no metrics are recorded.
+	Metrics *metrics.Registry
+	// Tracer records a span for every request. If nil, no spans are recorded.
+	Tracer *tracing.Tracer
 }
 
 // ServerConfig is the configuration for the server.
 type ServerConfig struct {
 	CSRFKey      krypto.Key
 	SecureCookie bool
+	// PostmarkWebhookSecret is the password Postmark needs to provide (via basic auth)
+	// when calling our webhooks. If empty, the webhook endpoint is disabled.
+	PostmarkWebhookSecret krypto.Secret
+	// CSP is the Content-Security-Policy set on every response. Every "{nonce}" in
+	// it is replaced by a nonce source that is unique per request, inline scripts
+	// need to carry this nonce (see viewData.CSPNonce). If empty, no policy is set.
+	CSP string
+	// CSPReportOnly makes browsers report violations of the CSP instead of enforcing it.
+	CSPReportOnly bool
+	// HSTSMaxAge is how long browsers should only connect to the server using HTTPS.
+	// If zero, no HSTS header is set.
+	HSTSMaxAge time.Duration
 }
 
 // Server implements the server for the application.
@@ -42,6 +75,7 @@ type ServerConfig struct {
 // - Methods prefixed with "render" only write a response body.
 type Server struct {
 	deps    *ServerDeps
+	cfg     ServerConfig
 	mux     *http.ServeMux
 	decoder *schema.Decoder
 	handler http.Handler
@@ -50,6 +84,7 @@ type Server struct {
 func NewServer(deps *ServerDeps, cfg ServerConfig) *Server {
 	s := &Server{
 		deps:    deps,
+		cfg:     cfg,
 		mux:     http.NewServeMux(),
 		decoder: schema.NewDecoder(),
 	}
@@ -61,20 +96,20 @@ func NewServer(deps *ServerDeps, cfg ServerConfig) *Server {
 	// The request mapping and response writing is customizable.
 
 	// Homepage endpoint.
-	s.public("GET /{$}", newViewHandler(s, "hello-world"))
+	s.public("GET /{$}", newViewHandler(s, viewHelloWorld))
 
 	// Register user endpoints.
 	{
-		s.publicOnly("GET /register", newViewHandler(s, "register-user"))
+		s.publicOnly("GET /register", newViewHandler(s, viewRegisterUser))
 	}
 	{
 		const route = "POST /register"
 		h := newInputHandler(s, deps.AuthService.RegisterUser)
 		h.onFail = func(r shared, err error) {
-			s.writeErrorView(r.w, r.r, "register-user", err)
+			s.writeErrorView(r.w, r.r, viewRegisterUser, err)
 		}
 		h.onSuccess = func(r result[auth.Credentials, struct{}]) error {
-			r.sess.AddFlash("Thank you for your registration. Please follow the instructions that have arrived in your inbox.")
+			r.sess.AddFlash("flash.registered")
 			s.writeRedirect(r.w, r.r, "/register", http.StatusFound)
 			return nil
 		}
@@ -90,7 +125,7 @@ func NewServer(deps *ServerDeps, cfg ServerConfig) *Server {
 			return token, nil
 		})
 		h.onSuccess = func(r result[auth.EmailTokenRaw, auth.EmailTokenRaw]) error {
-			s.writeView(r.w, r.r, "activate-user", r.out)
+			s.writeView(r.w, r.r, viewActivateUser, r.out)
 			return nil
 		}
 
@@ -100,10 +135,10 @@ func NewServer(deps *ServerDeps, cfg ServerConfig) *Server {
 		const route = "POST /user-activations"
 		h := newInputHandler(s, deps.AuthService.ActivateUser)
 		h.onFail = func(r shared, err error) {
-			s.writeErrorView(r.w, r.r, "activate-user", err)
+			s.writeErrorView(r.w, r.r, viewActivateUser, err)
 		}
 		h.onSuccess = func(r result[auth.EmailTokenRaw, struct{}]) error {
-			r.sess.AddFlash("Your account has been activated, login below.")
+			r.sess.AddFlash("flash.activated")
 			s.writeRedirect(r.w, r.r, "/login", http.StatusFound)
 			return nil
 		}
@@ -113,13 +148,13 @@ func NewServer(deps *ServerDeps, cfg ServerConfig) *Server {
 
 	// Login user endpoints
 	{
-		s.publicOnly("GET /login", newViewHandler(s, "login-user"))
+		s.publicOnly("GET /login", newViewHandler(s, viewLoginUser))
 	}
 	{
 		const route = "POST /login"
 		h := newHandler(s, deps.AuthService.Authenticate)
 		h.onFail = func(r shared, err error) {
-			s.writeErrorView(r.w, r.r, "login-user", err)
+			s.writeErrorView(r.w, r.r, viewLoginUser, err)
 		}
 		h.onSuccess = func(r result[auth.Credentials, auth.User]) error {
 			// If we get here, the user has been authenticated.
@@ -163,7 +198,7 @@ func NewServer(deps *ServerDeps, cfg ServerConfig) *Server {
 
 	// Request password reset endpoints
 	{
-		s.publicOnly("GET /forgot-password", newViewHandler(s, "forgot-password"))
+		s.publicOnly("GET /forgot-password", newViewHandler(s, viewForgotPassword))
 	}
 	{
 		const route = "POST /forgot-password"
@@ -178,10 +213,10 @@ func NewServer(deps *ServerDeps, cfg ServerConfig) *Server {
 			return nil
 		})
 		h.onFail = func(r shared, err error) {
-			s.writeErrorView(r.w, r.r, "forgot-password", err)
+			s.writeErrorView(r.w, r.r, viewForgotPassword, err)
 		}
 		h.onSuccess = func(r result[passwordReset, struct{}]) error {
-			r.sess.AddFlash("Check your inbox for instructions to reset your password.")
+			r.sess.AddFlash("flash.password-reset-requested")
 			s.writeRedirect(r.w, r.r, "/forgot-password", http.StatusFound)
 			return nil
 		}
@@ -197,7 +232,7 @@ func NewServer(deps *ServerDeps, cfg ServerConfig) *Server {
 			return token, nil
 		})
 		h.onSuccess = func(r result[auth.EmailTokenRaw, auth.EmailTokenRaw]) error {
-			s.writeView(r.w, r.r, "reset-password", r.out)
+			s.writeView(r.w, r.r, viewResetPassword, r.out)
 			return nil
 		}
 
@@ -208,10 +243,10 @@ func NewServer(deps *ServerDeps, cfg ServerConfig) *Server {
 		const route = "POST /password-resets"
 		h := newInputHandler(s, deps.AuthService.ResetPassword)
 		h.onFail = func(r shared, err error) {
-			s.writeErrorView(r.w, r.r, "reset-password", err)
+			s.writeErrorView(r.w, r.r, viewResetPassword, err)
 		}
 		h.onSuccess = func(r result[auth.NewPassword, struct{}]) error {
-			r.sess.AddFlash("Your password was reset, login with your new password below")
+			r.sess.AddFlash("flash.password-reset")
 			s.writeRedirect(r.w, r.r, "/login", http.StatusFound)
 			return nil
 		}
@@ -219,11 +254,322 @@ func NewServer(deps *ServerDeps, cfg ServerConfig) *Server {
 		s.publicOnly(route, h)
 	}
 
+	// Switch locale endpoint.
+	{
+		const route = "POST /locale"
+
+		type switchLocale struct {
+			Locale i18n.Locale
+		}
+
+		h := newInputHandler(s, func(ctx context.Context, in switchLocale) error {
+			return nil
+		})
+		h.onSuccess = func(r result[switchLocale, struct{}]) error {
+			r.sess.SetLocale(string(r.in.Locale))
+			s.writeRedirect(r.w, r.r, localRedirect(r.r), http.StatusFound)
+			return nil
+		}
+
+		s.public(route, h)
+	}
+
 	// Dashboard endpoints
-	s.loggedIn("GET /dashboard", newViewHandler(s, "dashboard"))
+	s.loggedIn("GET /dashboard", newViewHandler(s, viewDashboard))
+
+	// Settings endpoints.
+	{
+		const route = "GET /settings"
+
+		h := newHandler(s, func(ctx context.Context, _ struct{}) (settings, error) {
+			userID, err := userIDFromCtx(ctx)
+			if err != nil {
+				return settings{}, err
+			}
+
+			events, err := deps.Auditor.Events(ctx, userID, maxSecurityEvents)
+			if err != nil {
+				return settings{}, err
+			}
+
+			return settings{Events: events}, nil
+		})
+		h.onSuccess = func(r result[struct{}, settings]) error {
+			s.writeView(r.w, r.r, viewSettings, r.out)
+			return nil
+		}
+
+		s.loggedIn(route, h)
+	}
+
+	// Admin endpoints.
+	s.admin("GET /admin", newViewHandler(s, viewAdmin))
+
+	// User moderation admin endpoints.
+	{
+		const route = "GET /admin/users"
+
+		type userSearch struct {
+			Email email.Address
+		}
+
+		h := newHandler(s, func(ctx context.Context, in userSearch) (searchResult, error) {
+			if in.Email == "" {
+				return searchResult{}, nil
+			}
+
+			users, err := deps.AuthService.FindUsers(ctx, auth.UserFilter{
+				Emails: []email.Address{in.Email},
+			})
+			if err != nil {
+				return searchResult{}, err
+			}
+
+			return searchResult{
+				Email: in.Email,
+				Users: users,
+			}, nil
+		})
+		h.onFail = func(r shared, err error) {
+			s.writeErrorView(r.w, r.r, viewAdminUsers, err)
+		}
+		h.onSuccess = func(r result[userSearch, searchResult]) error {
+			s.writeView(r.w, r.r, viewAdminUsers, r.out)
+			return nil
+		}
+
+		s.admin(route, h)
+	}
+	{
+		const route = "GET /admin/users/{id}"
+
+		h := newHandler(s, func(ctx context.Context, id uuid.UUID) (userDetails, error) {
+			users, err := deps.AuthService.FindUsers(ctx, auth.UserFilter{
+				IDs: []uuid.UUID{id},
+			})
+			if err != nil {
+				return userDetails{}, err
+			}
+
+			if len(users) != 1 {
+				return userDetails{}, errorz.ErrNotFound
+			}
+
+			tokens, err := deps.AuthService.EmailTokens(ctx, id)
+			if err != nil {
+				return userDetails{}, err
+			}
+
+			actions, err := deps.AuthService.AdminActions(ctx, auth.AdminActionFilter{
+				TargetUserIDs: []uuid.UUID{id},
+			})
+			if err != nil {
+				return userDetails{}, err
+			}
+
+			return userDetails{
+				User:    users[0],
+				Tokens:  tokens,
+				Actions: actions,
+			}, nil
+		})
+		h.reqToInFunc = func(r shared) (uuid.UUID, error) {
+			id, err := uuid.Parse(r.r.PathValue("id"))
+			if err != nil {
+				return uuid.Nil, errorz.ErrNotFound
+			}
+
+			return id, nil
+		}
+		h.onSuccess = func(r result[uuid.UUID, userDetails]) error {
+			s.writeView(r.w, r.r, viewAdminUser, r.out)
+			return nil
+		}
+
+		s.admin(route, h)
+	}
+	{
+		type userAction struct {
+			UserID uuid.UUID
+			Role   auth.Role
+		}
+
+		actions := map[string]struct {
+			flash string
+			do    func(ctx context.Context, actorID uuid.UUID, in userAction) error
+		}{
+			"POST /admin/users/deactivate": {
+				flash: "flash.user-deactivated",
+				do: func(ctx context.Context, actorID uuid.UUID, in userAction) error {
+					return deps.AuthService.DeactivateUser(ctx, actorID, in.UserID)
+				},
+			},
+			"POST /admin/users/reactivate": {
+				flash: "flash.user-reactivated",
+				do: func(ctx context.Context, actorID uuid.UUID, in userAction) error {
+					return deps.AuthService.ReactivateUser(ctx, actorID, in.UserID)
+				},
+			},
+			"POST /admin/users/resend-activation": {
+				flash: "flash.activation-resent",
+				do: func(ctx context.Context, actorID uuid.UUID, in userAction) error {
+					return deps.AuthService.ResendActivation(ctx, actorID, in.UserID)
+				},
+			},
+			"POST /admin/users/role": {
+				flash: "flash.role-changed",
+				do: func(ctx context.Context, actorID uuid.UUID, in userAction) error {
+					return deps.AuthService.ChangeRole(ctx, actorID, in.UserID, in.Role)
+				},
+			},
+		}
+
+		for route, action := range actions {
+			h := newInputHandler(s, func(ctx context.Context, in userAction) error {
+				actorID, err := userIDFromCtx(ctx)
+				if err != nil {
+					return err
+				}
+
+				return action.do(ctx, actorID, in)
+			})
+			h.onFail = func(r shared, err error) {
+				s.writeErrorView(r.w, r.r, viewAdminUser, err)
+			}
+			h.onSuccess = func(r result[userAction, struct{}]) error {
+				r.sess.AddFlash(action.flash)
+				s.writeRedirect(r.w, r.r, "/admin/users/"+r.in.UserID.String(), http.StatusFound)
+				return nil
+			}
+
+			s.admin(route, h)
+		}
+	}
+
+	// Admin audit log endpoint.
+	{
+		const route = "GET /admin/audit-log"
+
+		h := newHandler(s, func(ctx context.Context, _ struct{}) (auditLog, error) {
+			actions, err := deps.AuthService.AdminActions(ctx, auth.AdminActionFilter{
+				Limit: maxAuditLogEntries,
+			})
+			if err != nil {
+				return auditLog{}, err
+			}
+
+			return auditLog{Actions: actions}, nil
+		})
+		h.onSuccess = func(r result[struct{}, auditLog]) error {
+			s.writeView(r.w, r.r, viewAdminAuditLog, r.out)
+			return nil
+		}
+
+		s.admin(route, h)
+	}
+
+	// Email suppression admin endpoints.
+	{
+		const route = "GET /admin/email-suppressions"
+		h := newHandler(s, func(ctx context.Context, _ struct{}) ([]email.Suppression, error) {
+			return deps.EmailService.Suppressions(ctx)
+		})
+		h.onSuccess = func(r result[struct{}, []email.Suppression]) error {
+			s.writeView(r.w, r.r, viewAdminEmailSuppressions, r.out)
+			return nil
+		}
+
+		s.admin(route, h)
+	}
+	{
+		const route = "POST /admin/email-suppressions/lift"
+
+		type liftSuppression struct {
+			Email email.Address
+		}
+
+		h := newInputHandler(s, func(ctx context.Context, in liftSuppression) error {
+			actorID, err := userIDFromCtx(ctx)
+			if err != nil {
+				return err
+			}
+
+			err = deps.EmailService.LiftSuppression(ctx, in.Email)
+			if err != nil {
+				return err
+			}
+
+			return deps.AuthService.RecordAdminAction(ctx, actorID, auth.AdminActionLiftSuppression, uuid.Nil, string(in.Email))
+		})
+		h.onFail = func(r shared, err error) {
+			s.writeErrorView(r.w, r.r, viewAdminEmailSuppressions, err)
+		}
+		h.onSuccess = func(r result[liftSuppression, struct{}]) error {
+			r.sess.AddFlash("flash.suppression-lifted")
+			s.writeRedirect(r.w, r.r, "/admin/email-suppressions", http.StatusFound)
+			return nil
+		}
+
+		s.admin(route, h)
+	}
+
+	// Background jobs admin endpoint.
+	{
+		const route = "GET /admin/jobs"
+		h := newHandler(s, func(ctx context.Context, _ struct{}) (jobs.Overview, error) {
+			return deps.Jobs.Overview(ctx, maxFailedJobs)
+		})
+		h.onSuccess = func(r result[struct{}, jobs.Overview]) error {
+			s.writeView(r.w, r.r, viewAdminJobs, r.out)
+			return nil
+		}
+
+		s.admin(route, h)
+	}
+
+	// Webhook endpoints.
+	// These are called by third parties and are authenticated using a shared secret.
+	{
+		const route = "POST /webhooks/postmark"
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			secret := s.cfg.PostmarkWebhookSecret.SecretValue()
+			if len(secret) == 0 {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+
+			_, password, ok := r.BasicAuth()
+			if !ok || subtle.ConstantTimeCompare([]byte(password), secret) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			sup, ok, err := postmark.ParseWebhook(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+			if err != nil {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+
+			if ok {
+				err = deps.EmailService.Suppress(r.Context(), sup)
+				if err != nil {
+					s.logger(r).Error("failed to suppress email address", "error", err)
+					http.Error(w, "internal server error", http.StatusInternalServerError)
+					return
+				}
+			}
+
+			w.WriteHeader(http.StatusOK)
+		})
+
+		s.public(route, h)
+	}
+
+	// CSP violation reports endpoint.
+	s.public("POST "+cspReportPath, cspReportHandler(s))
 
 	// Static frontend files endpoint.
-	s.mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(s.deps.DistFS)))
+	s.mux.Handle(staticPrefix, http.StripPrefix(staticPrefix, s.deps.Static))
 
 	// Below we set up the global middlewares.
 	//
@@ -236,9 +582,29 @@ func NewServer(deps *ServerDeps, cfg ServerConfig) *Server {
 	)
 
 	middlewares := []func(http.Handler) http.Handler{
+		securityMiddleware(s),
+		skipCSRF("/webhooks/"),
+		// Browsers send CSP reports without a CSRF token.
+		skipCSRF(cspReportPath),
 		csrfMW,
 		sessionMiddleware(s),
+		localeMiddleware(s),
+		clientMiddleware,
 	}
+
+	if deps.Metrics != nil {
+		// Record metrics early, so that requests rejected by other middlewares are also measured.
+		middlewares = append([]func(http.Handler) http.Handler{metricsMiddleware(s, deps.Metrics)}, middlewares...)
+	}
+
+	// Logging comes before the other middlewares, so that they have access to the request logger.
+	middlewares = append([]func(http.Handler) http.Handler{loggingMiddleware(s)}, middlewares...)
+
+	if deps.Tracer != nil {
+		// Tracing wraps logging, so that request logs can include the trace ID.
+		middlewares = append([]func(http.Handler) http.Handler{tracingMiddleware(s, deps.Tracer)}, middlewares...)
+	}
+
 	s.handler = s.mux
 	for i := len(middlewares) - 1; i >= 0; i-- {
 		s.handler = middlewares[i](s.handler)
@@ -247,6 +613,17 @@ func NewServer(deps *ServerDeps, cfg ServerConfig) *Server {
 	return s
 }
 
+// localRedirect returns the path of the referring page if it's on this site, so
+// we can send the user back to where they came from. It falls back to the homepage.
+func localRedirect(r *http.Request) string {
+	ref, err := url.Parse(r.Referer())
+	if err != nil || ref.Host != r.Host || !strings.HasPrefix(ref.Path, "/") || strings.HasPrefix(ref.Path, "//") {
+		return "/"
+	}
+
+	return ref.Path
+}
+
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.handler.ServeHTTP(w, r)
 }
@@ -256,7 +633,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (s *Server) preWrite(w http.ResponseWriter, r *http.Request) bool {
 	sess, err := sessionFromCtx(r.Context())
 	if err != nil {
-		s.deps.Logger.Error("failed to get session from context", "error", err)
+		s.logger(r).Error("failed to get session from context", "error", err)
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return false
 	}
@@ -264,7 +641,7 @@ func (s *Server) preWrite(w http.ResponseWriter, r *http.Request) bool {
 	if sess.NeedsSave() {
 		err = s.deps.SessionStore.Save(r, w, sess)
 		if err != nil {
-			s.deps.Logger.Error("failed to save session", "error", err)
+			s.logger(r).Error("failed to save session", "error", err)
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return false
 		}
@@ -291,7 +668,7 @@ func (s *Server) writeView(w http.ResponseWriter, r *http.Request, name string,
 		return
 	}
 
-	s.renderView(w, name, vd)
+	s.renderView(w, r, name, vd)
 }
 
 func (s *Server) writeErrorView(w http.ResponseWriter, r *http.Request, name string, err error) {
@@ -306,7 +683,7 @@ func (s *Server) writeErrorView(w http.ResponseWriter, r *http.Request, name str
 
 	if errors.Is(err, errorz.ErrNotFound) {
 		w.WriteHeader(http.StatusNotFound)
-		s.renderView(w, name, vd)
+		s.renderView(w, r, name, vd)
 		return
 	}
 
@@ -314,23 +691,23 @@ func (s *Server) writeErrorView(w http.ResponseWriter, r *http.Request, name str
 	if errors.As(err, &invalidInput) {
 		vd.InputErrors = invalidInput
 		w.WriteHeader(http.StatusBadRequest)
-		s.renderView(w, name, vd)
+		s.renderView(w, r, name, vd)
 		return
 	}
 
-	s.deps.Logger.Error("internal server error", "url", r.URL.String(), "error", err)
+	s.logger(r).Error("internal server error", "url", r.URL.String(), "error", err)
 	w.WriteHeader(http.StatusInternalServerError)
-	s.renderView(w, name, vd)
+	s.renderView(w, r, name, vd)
 }
 
 func (s *Server) writeError(w http.ResponseWriter, r *http.Request, err error) {
-	s.writeErrorView(w, r, "error", err)
+	s.writeErrorView(w, r, viewError, err)
 }
 
-func (s *Server) renderView(w http.ResponseWriter, name string, vd *viewData) {
+func (s *Server) renderView(w http.ResponseWriter, r *http.Request, name string, vd *viewData) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	err := s.deps.ViewRenderer.Render(w, name, vd)
 	if err != nil {
-		s.deps.Logger.Error("failed to render view", "error", err)
+		s.logger(r).Error("failed to render view", "error", err)
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/willemschots/househunt/internal/i18n"
 	"github.com/willemschots/househunt/internal/web/sessions"
 )
 
@@ -24,6 +25,30 @@ func sessionMiddleware(srv *Server) func(http.Handler) http.Handler {
 	}
 }
 
+// localeMiddleware determines the locale of the request and injects it in the context.
+// It needs to run after the session middleware, because the user might have
+// explicitly picked a locale before.
+func localeMiddleware(srv *Server) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sess, err := sessionFromCtx(r.Context())
+			if err != nil {
+				srv.writeError(w, r, err)
+				return
+			}
+
+			preferred, _ := sess.Locale()
+			locale := i18n.Negotiate(i18n.Locale(preferred), r.Header.Get("Accept-Language"))
+
+			w.Header().Set("Content-Language", string(locale))
+			w.Header().Add("Vary", "Accept-Language")
+
+			ctx := i18n.WithLocale(r.Context(), locale)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 type ctxKey string
 
 const sessionCtxKey ctxKey = "_session"
@@ -29,6 +29,17 @@ func (s *Session) DeleteUserID() {
 	delete(s.base.Values, "userID")
 }
 
+// Locale returns the locale the user explicitly picked, if any.
+func (s *Session) Locale() (string, bool) {
+	locale, ok := s.base.Values["locale"].(string)
+	return locale, ok
+}
+
+func (s *Session) SetLocale(locale string) {
+	s.needsSave = true
+	s.base.Values["locale"] = locale
+}
+
 func (s *Session) AddFlash(flash any, vars ...string) {
 	s.needsSave = true
 	s.base.AddFlash(flash, vars...)
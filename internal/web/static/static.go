@@ -0,0 +1,239 @@
+// Package static serves static frontend files under fingerprinted names.
+//
+// On creation, every file is hashed and gets a fingerprinted name that
+// includes the hash, like "bundle.3f2a9c1d0b7e6a45.css". Because the name
+// changes whenever the content does, fingerprinted files can be cached by
+// browsers forever. Views resolve logical names to fingerprinted ones
+// using Handler.Path.
+//
+// If a file has precompressed variants next to it ("{name}.br" or "{name}.gz"),
+// these are served to clients that accept the encoding.
+package static
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hashLen is the number of hex characters of the hash used in fingerprinted names.
+const hashLen = 16
+
+const (
+	cacheImmutable = "public, max-age=31536000, immutable"
+	// cacheRevalidate is used for files requested by their logical name, these
+	// may change between deploys so clients should check the ETag.
+	cacheRevalidate = "no-cache"
+)
+
+// encoding is a content encoding of a precompressed variant.
+type encoding struct {
+	name   string // name as used in the Accept-Encoding and Content-Encoding headers.
+	suffix string // suffix of the file containing the variant.
+}
+
+// encodings are the supported precompressed variants, in order of preference.
+var encodings = []encoding{
+	{name: "br", suffix: ".br"},
+	{name: "gzip", suffix: ".gz"},
+}
+
+// file is a file that can be served.
+type file struct {
+	name string // name is the logical name of the file.
+	hash string
+	// variants are the encodings that a precompressed variant exists for.
+	variants []encoding
+}
+
+// Handler serves files from a file system, by both their logical and
+// fingerprinted names.
+type Handler struct {
+	fs           fs.FS
+	logical      map[string]*file
+	fingerprints map[string]*file
+}
+
+// New hashes all the files in fsys and returns a Handler that serves them.
+func New(fsys fs.FS) (*Handler, error) {
+	h := &Handler{
+		fs:           fsys,
+		logical:      make(map[string]*file),
+		fingerprints: make(map[string]*file),
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || isVariant(name) {
+			return nil
+		}
+
+		hash, err := hashFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		f := &file{
+			name: name,
+			hash: hash,
+		}
+
+		for _, enc := range encodings {
+			_, err := fs.Stat(fsys, name+enc.suffix)
+			if err == nil {
+				f.variants = append(f.variants, enc)
+			}
+		}
+
+		h.logical[name] = f
+		h.fingerprints[fingerprint(name, hash)] = f
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fingerprint static files: %w", err)
+	}
+
+	return h, nil
+}
+
+// Path returns the fingerprinted name for the file with the logical name. If
+// there is no such file, name is returned unchanged.
+func (h *Handler) Path(name string) string {
+	f, ok := h.logical[name]
+	if !ok {
+		return name
+	}
+
+	return fingerprint(f.name, f.hash)
+}
+
+// ServeHTTP serves the file named by the request path, the path should be
+// relative to the root of the file system (see http.StripPrefix).
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Path
+
+	cacheControl := cacheImmutable
+	f, ok := h.fingerprints[name]
+	if !ok {
+		cacheControl = cacheRevalidate
+		f, ok = h.logical[name]
+	}
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	filename := f.name
+	etag := f.hash
+
+	if len(f.variants) > 0 {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+
+	for _, enc := range f.variants {
+		if acceptsEncoding(r.Header.Get("Accept-Encoding"), enc.name) {
+			filename += enc.suffix
+			etag += "-" + enc.name
+			w.Header().Set("Content-Encoding", enc.name)
+			break
+		}
+	}
+
+	content, err := h.fs.Open(filename)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	rs, ok := content.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The content type is determined by the logical name, a precompressed
+	// variant would otherwise be served as a compressed archive.
+	if ct := mime.TypeByExtension(path.Ext(f.name)); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", `"`+etag+`"`)
+
+	// The ETag is used for conditional requests, so there's no need to
+	// provide a modification time.
+	http.ServeContent(w, r, f.name, time.Time{}, rs)
+}
+
+// fingerprint returns the name with the hash inserted before the extension.
+func fingerprint(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+func isVariant(name string) bool {
+	for _, enc := range encodings {
+		if strings.HasSuffix(name, enc.suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hashFile(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[:hashLen], nil
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header accepts the encoding.
+func acceptsEncoding(header, name string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), name) {
+			continue
+		}
+
+		// An encoding with a quality of 0 is explicitly not accepted.
+		raw, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+
+		q, err := strconv.ParseFloat(raw, 64)
+		return err == nil && q > 0
+	}
+
+	return false
+}
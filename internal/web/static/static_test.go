@@ -0,0 +1,189 @@
+package static_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/willemschots/househunt/internal/web/static"
+)
+
+func TestHandler(t *testing.T) {
+	fsys := fstest.MapFS{
+		"bundle.css":    {Data: []byte("body{}")},
+		"bundle.css.br": {Data: []byte("br-css")},
+		"bundle.css.gz": {Data: []byte("gz-css")},
+		"bundle.js":     {Data: []byte("alert(1)")},
+		"bundle.js.gz":  {Data: []byte("gz-js")},
+		"img/logo.svg":  {Data: []byte("<svg></svg>")},
+	}
+
+	h, err := static.New(fsys)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	t.Run("ok, path is fingerprinted", func(t *testing.T) {
+		got := h.Path("img/logo.svg")
+		if !regexp.MustCompile(`^img/logo\.[0-9a-f]{16}\.svg$`).MatchString(got) {
+			t.Errorf("unexpected fingerprinted path %q", got)
+		}
+
+		if h.Path("bundle.css") == h.Path("bundle.js") {
+			t.Errorf("expected different files to have different paths")
+		}
+	})
+
+	t.Run("ok, unknown path is unchanged", func(t *testing.T) {
+		got := h.Path("missing.css")
+		if got != "missing.css" {
+			t.Errorf("got %q, want %q", got, "missing.css")
+		}
+	})
+
+	tests := map[string]struct {
+		path           string
+		acceptEncoding string
+		wantBody       string
+		wantEncoding   string
+		wantCache      string
+	}{
+		"ok, fingerprinted file is immutable": {
+			path:      h.Path("img/logo.svg"),
+			wantBody:  "<svg></svg>",
+			wantCache: "public, max-age=31536000, immutable",
+		},
+		"ok, logical file must be revalidated": {
+			path:      "img/logo.svg",
+			wantBody:  "<svg></svg>",
+			wantCache: "no-cache",
+		},
+		"ok, brotli is preferred": {
+			path:           h.Path("bundle.css"),
+			acceptEncoding: "gzip, deflate, br",
+			wantBody:       "br-css",
+			wantEncoding:   "br",
+			wantCache:      "public, max-age=31536000, immutable",
+		},
+		"ok, gzip if brotli is not accepted": {
+			path:           h.Path("bundle.css"),
+			acceptEncoding: "gzip, br;q=0",
+			wantBody:       "gz-css",
+			wantEncoding:   "gzip",
+			wantCache:      "public, max-age=31536000, immutable",
+		},
+		"ok, gzip if there is no brotli variant": {
+			path:           h.Path("bundle.js"),
+			acceptEncoding: "br, gzip;q=0.5",
+			wantBody:       "gz-js",
+			wantEncoding:   "gzip",
+			wantCache:      "public, max-age=31536000, immutable",
+		},
+		"ok, identity if no encoding is accepted": {
+			path:      h.Path("bundle.css"),
+			wantBody:  "body{}",
+			wantCache: "public, max-age=31536000, immutable",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tc.path, nil)
+			req.URL.Path = tc.path
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			if rec.Body.String() != tc.wantBody {
+				t.Errorf("got body %q, want %q", rec.Body.String(), tc.wantBody)
+			}
+
+			assertHeader(t, rec, "Content-Encoding", tc.wantEncoding)
+			assertHeader(t, rec, "Cache-Control", tc.wantCache)
+
+			if rec.Header().Get("ETag") == "" {
+				t.Errorf("expected ETag header")
+			}
+		})
+	}
+
+	t.Run("ok, content type of logical name is used for variants", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = h.Path("bundle.css")
+		req.Header.Set("Accept-Encoding", "br")
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		assertHeader(t, rec, "Content-Type", "text/css; charset=utf-8")
+		assertHeader(t, rec, "Vary", "Accept-Encoding")
+	})
+
+	t.Run("ok, not modified if ETag matches", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = h.Path("bundle.css")
+		req.Header.Set("Accept-Encoding", "gzip")
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotModified {
+			t.Fatalf("got status %d, want %d", rec.Code, http.StatusNotModified)
+		}
+	})
+
+	t.Run("ok, variants have different ETags", func(t *testing.T) {
+		etags := make(map[string]bool)
+		for _, enc := range []string{"", "gzip", "br"} {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.URL.Path = h.Path("bundle.css")
+			req.Header.Set("Accept-Encoding", enc)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			etags[rec.Header().Get("ETag")] = true
+		}
+
+		if len(etags) != 3 {
+			t.Errorf("expected 3 different ETags, got %v", etags)
+		}
+	})
+
+	t.Run("fail, not found", func(t *testing.T) {
+		for _, path := range []string{"missing.css", "bundle.0000000000000000.css", "bundle.css.br"} {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.URL.Path = path
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("%s: got status %d, want %d", path, rec.Code, http.StatusNotFound)
+			}
+		}
+	})
+}
+
+func assertHeader(t *testing.T, rec *httptest.ResponseRecorder, key, want string) {
+	t.Helper()
+
+	got := rec.Header().Get(key)
+	if got != want {
+		t.Errorf("got %s header %q, want %q", key, got, want)
+	}
+}
@@ -0,0 +1,48 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/willemschots/househunt/internal/tracing"
+)
+
+const traceParentHeader = "traceparent"
+
+// tracingMiddleware records a span for every request, named after the mux pattern.
+// A W3C traceparent header provided by the client (or a proxy in front of us) is
+// used to continue an existing trace.
+func tracingMiddleware(s *Server, t *tracing.Tracer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pattern := s.pattern(r)
+
+			ctx := tracing.WithTracer(r.Context(), t)
+			ctx = tracing.WithTraceParent(ctx, r.Header.Get(traceParentHeader))
+			ctx, span := tracing.Start(ctx, pattern,
+				tracing.String("http.request.method", r.Method),
+				tracing.String("http.route", pattern),
+			)
+			span.SetKind(tracing.KindServer)
+
+			rec := &responseRecorder{ResponseWriter: w}
+
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			status := rec.statusCode()
+			span.SetAttributes(tracing.Int("http.response.status_code", status))
+
+			// Only server errors mark a span as failed, client errors are expected.
+			var err error
+			if status >= http.StatusInternalServerError {
+				err = httpError(status)
+			}
+			span.EndErr(err)
+		})
+	}
+}
+
+type httpError int
+
+func (e httpError) Error() string {
+	return http.StatusText(int(e))
+}
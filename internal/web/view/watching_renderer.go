@@ -0,0 +1,204 @@
+package view
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/willemschots/househunt/internal/fswatch"
+)
+
+// WatchingRenderer renders views from a file system. Parsed views are cached
+// until files in the file system change, so changes show up without restarting
+// the server and without parsing the views on every request.
+//
+// It's meant for development: when a view fails to parse or render, an overlay
+// describing the error is written instead of the view.
+type WatchingRenderer struct {
+	fs      fs.FS
+	mu      *sync.Mutex
+	views   map[string]*View
+	watcher *fswatch.Watcher
+}
+
+// NewWatchingRenderer returns a new WatchingRenderer that checks viewFS for
+// changes every interval. Call Close to stop watching.
+func NewWatchingRenderer(viewFS fs.FS, interval time.Duration) (*WatchingRenderer, error) {
+	r := &WatchingRenderer{
+		fs:    viewFS,
+		mu:    &sync.Mutex{},
+		views: make(map[string]*View),
+	}
+
+	w, err := fswatch.Watch(viewFS, interval, r.invalidate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch views: %w", err)
+	}
+
+	r.watcher = w
+
+	return r, nil
+}
+
+// Nonced is implemented by view data that carries the Content-Security-Policy
+// nonce of the request. The error overlay sets it on its inline styles, so
+// they're allowed by a policy with the nonce in style-src.
+type Nonced interface {
+	Nonce() string
+}
+
+// Render renders the view with name. If it fails, the error is returned and
+// the error overlay is written to w.
+func (r *WatchingRenderer) Render(w io.Writer, name string, data any) error {
+	var nonce string
+	if n, ok := data.(Nonced); ok {
+		nonce = n.Nonce()
+	}
+
+	v, err := r.view(name)
+	if err != nil {
+		return r.writeOverlay(w, nonce, err)
+	}
+
+	// Render to a buffer first, so a view that fails half-way doesn't
+	// end up in the overlay.
+	var buf bytes.Buffer
+	err = v.Render(&buf, data)
+	if err != nil {
+		return r.writeOverlay(w, nonce, fmt.Errorf("failed to render view %q: %w", name, err))
+	}
+
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// Close stops watching the file system.
+func (r *WatchingRenderer) Close() error {
+	return r.watcher.Close()
+}
+
+func (r *WatchingRenderer) view(name string) (*View, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if v, ok := r.views[name]; ok {
+		return v, nil
+	}
+
+	v, err := Parse(r.fs, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse view %q: %w", name, err)
+	}
+
+	r.views[name] = v
+	return v, nil
+}
+
+func (r *WatchingRenderer) invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	clear(r.views)
+}
+
+// errLocation matches the file and line in template errors, like:
+// - template: home.html:3: function "foo" not defined
+// - template: home.html:3:5: executing "content" at <.Foo>: ...
+// - html/template:home.html:3:10: ...
+var errLocation = regexp.MustCompile(`template: ?([^:\s]+):(\d+)`)
+
+// sourceContext is the number of lines shown before and after the line of an error.
+const sourceContext = 3
+
+type overlayData struct {
+	Nonce string
+	Err   string
+	File  string
+	Line  int
+	Lines []overlayLine
+}
+
+type overlayLine struct {
+	Number  int
+	Text    string
+	IsError bool
+}
+
+var overlayTmpl = template.Must(template.New("overlay").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Template error</title>
+<style{{ if .Nonce }} nonce="{{ .Nonce }}"{{ end }}>
+body { margin: 0; padding: 2rem; background: #1e1e1e; color: #eee; font-family: monospace; }
+h1 { color: #ff6b6b; font-size: 1.5rem; }
+pre { white-space: pre-wrap; }
+.source { background: #2b2b2b; padding: 1rem; }
+.error { background: #5c1f1f; display: block; }
+</style>
+</head>
+<body>
+<h1>Template error</h1>
+<pre>{{ .Err }}</pre>
+{{ if .File }}<p>{{ .File }}:{{ .Line }}</p>
+<pre class="source">{{ range .Lines }}<span{{ if .IsError }} class="error"{{ end }}>{{ printf "%4d" .Number }} | {{ .Text }}</span>
+{{ end }}</pre>{{ end }}
+</body>
+</html>
+`))
+
+// writeOverlay writes the overlay for err to w, including the source around the
+// line of the error if it can be found. It returns err.
+func (r *WatchingRenderer) writeOverlay(w io.Writer, nonce string, err error) error {
+	data := overlayData{
+		Nonce: nonce,
+		Err:   err.Error(),
+	}
+
+	if m := errLocation.FindStringSubmatch(err.Error()); m != nil {
+		data.File = m[1]
+		data.Line, _ = strconv.Atoi(m[2])
+		data.Lines = r.sourceLines(data.File, data.Line)
+	}
+
+	overlayErr := overlayTmpl.Execute(w, data)
+	if overlayErr != nil {
+		return fmt.Errorf("%w (failed to write error overlay: %v)", err, overlayErr)
+	}
+
+	return err
+}
+
+// sourceLines returns the lines around line in file, file is looked up in the
+// root and the partials directory.
+func (r *WatchingRenderer) sourceLines(file string, line int) []overlayLine {
+	src, err := fs.ReadFile(r.fs, file)
+	if err != nil {
+		src, err = fs.ReadFile(r.fs, "partials/"+file)
+		if err != nil {
+			return nil
+		}
+	}
+
+	lines := strings.Split(string(src), "\n")
+	first := max(line-sourceContext, 1)
+	last := min(line+sourceContext, len(lines))
+
+	var out []overlayLine
+	for i := first; i <= last; i++ {
+		out = append(out, overlayLine{
+			Number:  i,
+			Text:    lines[i-1],
+			IsError: i == line,
+		})
+	}
+
+	return out
+}
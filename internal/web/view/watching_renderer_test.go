@@ -0,0 +1,198 @@
+package view_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/willemschots/househunt/internal/web/view"
+)
+
+func TestWatchingRenderer(t *testing.T) {
+	t.Run("ok, views are cached until files change", func(t *testing.T) {
+		dir := t.TempDir()
+		writeView(t, dir, "base.html", `<html>{{template "content" . }}</html>`)
+		writeView(t, dir, "home.html", `{{define "content"}}Hello {{ . }}{{end}}`)
+
+		r := newWatchingRenderer(t, dir, time.Hour)
+
+		assertRender(t, r, "home", "<html>Hello World!</html>")
+
+		// The interval is too long to notice the change, so the cached view is used.
+		writeView(t, dir, "home.html", `{{define "content"}}Bye {{ . }}{{end}}`)
+		assertRender(t, r, "home", "<html>Hello World!</html>")
+	})
+
+	t.Run("ok, changes are picked up", func(t *testing.T) {
+		dir := t.TempDir()
+		writeView(t, dir, "base.html", `<html>{{template "content" . }}</html>`)
+		writeView(t, dir, "home.html", `{{define "content"}}Hello {{ . }}{{end}}`)
+		writeView(t, dir, "partials/greeting.html", `{{define "greeting"}}Hi{{end}}`)
+
+		r := newWatchingRenderer(t, dir, 5*time.Millisecond)
+
+		assertRender(t, r, "home", "<html>Hello World!</html>")
+
+		writeView(t, dir, "home.html", `{{define "content"}}{{template "greeting"}} {{ . }}{{end}}`)
+		eventuallyRender(t, r, "home", "<html>Hi World!</html>")
+
+		writeView(t, dir, "partials/greeting.html", `{{define "greeting"}}Hey{{end}}`)
+		eventuallyRender(t, r, "home", "<html>Hey World!</html>")
+	})
+
+	t.Run("fail, parse error is shown in overlay", func(t *testing.T) {
+		dir := t.TempDir()
+		writeView(t, dir, "base.html", `<html>{{template "content" . }}</html>`)
+		writeView(t, dir, "home.html", "{{define \"content\"}}\n<p>{{ .Missing }</p>\n{{end}}")
+
+		r := newWatchingRenderer(t, dir, time.Hour)
+
+		var buf bytes.Buffer
+		err := r.Render(&buf, "home", "World!")
+		if err == nil {
+			t.Fatalf("expected error, got <nil>")
+		}
+
+		for _, want := range []string{"Template error", "home.html:2", "&lt;p&gt;{{ .Missing }&lt;/p&gt;", `class="error"`} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("expected overlay to contain %q, got:\n%s", want, buf.String())
+			}
+		}
+	})
+
+	t.Run("fail, overlay styles carry the nonce of the view data", func(t *testing.T) {
+		dir := t.TempDir()
+		writeView(t, dir, "base.html", `<html>{{template "content" . }}</html>`)
+		writeView(t, dir, "home.html", `{{define "content"}}{{ .Missing }{{end}}`)
+
+		r := newWatchingRenderer(t, dir, time.Hour)
+
+		var buf bytes.Buffer
+		err := r.Render(&buf, "home", noncedData("abc123"))
+		if err == nil {
+			t.Fatalf("expected error, got <nil>")
+		}
+
+		if !strings.Contains(buf.String(), `<style nonce="abc123">`) {
+			t.Errorf("expected overlay styles to carry the nonce, got:\n%s", buf.String())
+		}
+	})
+
+	t.Run("fail, execution error is shown in overlay", func(t *testing.T) {
+		dir := t.TempDir()
+		writeView(t, dir, "base.html", `<html>{{template "content" . }}</html>`)
+		writeView(t, dir, "home.html", `{{define "content"}}Hello {{ .Missing }}{{end}}`)
+
+		r := newWatchingRenderer(t, dir, time.Hour)
+
+		var buf bytes.Buffer
+		err := r.Render(&buf, "home", "World!")
+		if err == nil {
+			t.Fatalf("expected error, got <nil>")
+		}
+
+		if strings.Contains(buf.String(), "<html>Hello") {
+			t.Errorf("expected partially rendered view to be discarded, got:\n%s", buf.String())
+		}
+
+		if !strings.Contains(buf.String(), "home.html:1") {
+			t.Errorf("expected overlay to contain location of error, got:\n%s", buf.String())
+		}
+	})
+
+	t.Run("fail, directory does not exist", func(t *testing.T) {
+		_, err := view.NewWatchingRenderer(os.DirFS(filepath.Join(t.TempDir(), "missing")), time.Hour)
+		if err == nil {
+			t.Fatalf("expected error, got <nil>")
+		}
+	})
+}
+
+func newWatchingRenderer(t *testing.T, dir string, interval time.Duration) *view.WatchingRenderer {
+	t.Helper()
+
+	r, err := view.NewWatchingRenderer(os.DirFS(dir), interval)
+	if err != nil {
+		t.Fatalf("failed to create renderer: %v", err)
+	}
+
+	t.Cleanup(func() {
+		err := r.Close()
+		if err != nil {
+			t.Errorf("failed to close renderer: %v", err)
+		}
+	})
+
+	return r
+}
+
+// writeView writes a view file, every write moves the modification time forward
+// so the change is noticed on file systems with a coarse resolution.
+func writeView(t *testing.T, dir, name, content string) {
+	t.Helper()
+
+	fn := filepath.Join(dir, name)
+	err := os.MkdirAll(filepath.Dir(fn), 0755)
+	if err != nil {
+		t.Fatalf("failed to create path for file: %v", err)
+	}
+
+	var modTime time.Time
+	if info, err := os.Stat(fn); err == nil {
+		modTime = info.ModTime().Add(time.Second)
+	} else {
+		modTime = time.Now()
+	}
+
+	err = os.WriteFile(fn, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	err = os.Chtimes(fn, modTime, modTime)
+	if err != nil {
+		t.Fatalf("failed to change times: %v", err)
+	}
+}
+
+func assertRender(t *testing.T, r *view.WatchingRenderer, name, want string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	err := r.Render(&buf, name, "World!")
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func eventuallyRender(t *testing.T, r *view.WatchingRenderer, name, want string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var buf bytes.Buffer
+		err := r.Render(&buf, name, "World!")
+		if err == nil && buf.String() == want {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("got\n%s\nwant\n%s\n(error: %v)", buf.String(), want, err)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+type noncedData string
+
+func (d noncedData) Nonce() string {
+	return string(d)
+}
@@ -8,17 +8,55 @@ import (
 	"github.com/gorilla/csrf"
 	"github.com/willemschots/househunt/internal"
 	"github.com/willemschots/househunt/internal/errorz"
+	"github.com/willemschots/househunt/internal/i18n"
+	"github.com/willemschots/househunt/internal/web/static"
 )
 
+// staticPrefix is the path static files are served under.
+const staticPrefix = "/static/"
+
 type viewData struct {
-	Version     string
-	CSRFToken   string
+	Version   string
+	Locale    i18n.Locale
+	Locales   []i18n.Locale
+	CSRFToken string
+	// CSPNonce needs to be set as the nonce attribute of inline scripts.
+	CSPNonce    string
 	IsLoggedIn  bool
 	UserID      uuid.UUID
 	Flashes     []any
 	InputForm   url.Values
 	InputErrors errorz.InvalidInput
 	Data        any
+
+	translator i18n.Translator
+	static     *static.Handler
+}
+
+// Nonce returns the CSP nonce, so the development error overlay can use it for
+// its inline styles (see view.Nonced).
+func (vd *viewData) Nonce() string {
+	return vd.CSPNonce
+}
+
+// T translates the message for key, see i18n.Translator.T.
+func (vd *viewData) T(key string, args ...any) string {
+	return vd.translator.T(key, args...)
+}
+
+// TError translates an error for display to the user, see i18n.Translator.Error.
+func (vd *viewData) TError(err error) string {
+	return vd.translator.Error(err)
+}
+
+// Asset returns the URL of the static file with the logical name, the URL
+// includes a fingerprint of the file so that it can be cached indefinitely.
+func (vd *viewData) Asset(name string) string {
+	if vd.static == nil {
+		return staticPrefix + name
+	}
+
+	return staticPrefix + vd.static.Path(name)
 }
 
 // prepViewData prepares the data that will be passed to the view.
@@ -26,21 +64,27 @@ type viewData struct {
 func (s *Server) prepViewData(r *http.Request, w http.ResponseWriter, data any) *viewData {
 	sess, err := sessionFromCtx(r.Context())
 	if err != nil {
-		s.deps.Logger.Error("failed to get session", "error", err)
+		s.logger(r).Error("failed to get session", "error", err)
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return nil
 	}
 
 	userID, loggedIn := sess.UserID()
+	locale := i18n.LocaleFromContext(r.Context())
 
 	return &viewData{
 		Version:     internal.BuildRevision,
+		Locale:      locale,
+		Locales:     i18n.Supported,
 		CSRFToken:   csrf.Token(r),
+		CSPNonce:    cspNonceFromCtx(r.Context()),
 		IsLoggedIn:  loggedIn,
 		UserID:      userID,
 		Flashes:     sess.ConsumeFlashes(),
 		InputForm:   r.Form,
 		InputErrors: nil,
 		Data:        data,
+		translator:  s.deps.Catalogue.Translator(locale),
+		static:      s.deps.Static,
 	}
 }
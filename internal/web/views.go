@@ -0,0 +1,127 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/willemschots/househunt/internal/audit"
+	"github.com/willemschots/househunt/internal/auth"
+	"github.com/willemschots/househunt/internal/email"
+	"github.com/willemschots/househunt/internal/i18n"
+	"github.com/willemschots/househunt/internal/jobs"
+)
+
+// Names of the views rendered by the server.
+const (
+	viewHelloWorld             = "hello-world"
+	viewRegisterUser           = "register-user"
+	viewActivateUser           = "activate-user"
+	viewLoginUser              = "login-user"
+	viewForgotPassword         = "forgot-password"
+	viewResetPassword          = "reset-password"
+	viewDashboard              = "dashboard"
+	viewSettings               = "settings"
+	viewAdmin                  = "admin"
+	viewAdminUsers             = "admin-users"
+	viewAdminUser              = "admin-user"
+	viewAdminAuditLog          = "admin-audit-log"
+	viewAdminEmailSuppressions = "admin-email-suppressions"
+	viewAdminJobs              = "admin-jobs"
+	viewError                  = "error"
+)
+
+// settings is the data for the settings view.
+type settings struct {
+	Events []audit.Event
+}
+
+// searchResult is the data for the admin-users view.
+type searchResult struct {
+	Email email.Address
+	Users []auth.User
+}
+
+// userDetails is the data for the admin-user view.
+type userDetails struct {
+	User    auth.User
+	Tokens  []auth.EmailToken
+	Actions []auth.AdminAction
+}
+
+// auditLog is the data for the admin-audit-log view.
+type auditLog struct {
+	Actions []auth.AdminAction
+}
+
+// viewSample is a view together with data it can be rendered with.
+type viewSample struct {
+	name string
+	data any
+}
+
+// viewSamples contains every view rendered by the server, with a sample of
+// each kind of data it's rendered with. Views rendered by writeErrorView or
+// newViewHandler are rendered without data, so those have a nil sample.
+var viewSamples = []viewSample{
+	{name: viewHelloWorld},
+	{name: viewRegisterUser},
+	{name: viewActivateUser},
+	{name: viewActivateUser, data: auth.EmailTokenRaw{ID: uuid.New()}},
+	{name: viewLoginUser},
+	{name: viewForgotPassword},
+	{name: viewResetPassword},
+	{name: viewResetPassword, data: auth.EmailTokenRaw{ID: uuid.New()}},
+	{name: viewDashboard},
+	{name: viewSettings, data: settings{}},
+	{name: viewSettings, data: settings{Events: []audit.Event{{}}}},
+	{name: viewAdmin},
+	{name: viewAdminUsers},
+	{name: viewAdminUsers, data: searchResult{}},
+	{name: viewAdminUsers, data: searchResult{Email: "jacques@example.com", Users: []auth.User{{}}}},
+	{name: viewAdminUser},
+	{name: viewAdminUser, data: userDetails{
+		User:    auth.User{ID: uuid.New()},
+		Tokens:  []auth.EmailToken{{}},
+		Actions: []auth.AdminAction{{}},
+	}},
+	{name: viewAdminAuditLog, data: auditLog{}},
+	{name: viewAdminAuditLog, data: auditLog{Actions: []auth.AdminAction{{}}}},
+	{name: viewAdminEmailSuppressions},
+	{name: viewAdminEmailSuppressions, data: []email.Suppression{{}}},
+	{name: viewAdminJobs, data: jobs.Overview{}},
+	{name: viewAdminJobs, data: jobs.Overview{
+		Kinds:  []jobs.KindStatus{{Kind: "example", Registered: true, Concurrency: 1}},
+		Failed: []jobs.Job{{Kind: "example"}},
+	}},
+	{name: viewError},
+}
+
+// CheckViews renders every view used by the server with sample data, for every
+// supported locale and both logged in and out. It returns an error if a view
+// can't be found or fails to render, so that broken views are caught at
+// startup instead of when a user requests them.
+func CheckViews(r ViewRenderer, c *i18n.Catalogue) error {
+	var errs []error
+	for _, locale := range i18n.Supported {
+		for _, loggedIn := range []bool{false, true} {
+			for _, sample := range viewSamples {
+				vd := &viewData{
+					Locale:     locale,
+					Locales:    i18n.Supported,
+					IsLoggedIn: loggedIn,
+					Data:       sample.data,
+					translator: c.Translator(locale),
+				}
+
+				err := r.Render(io.Discard, sample.name, vd)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("view %q (locale %s, data %T): %w", sample.name, locale, sample.data, err))
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
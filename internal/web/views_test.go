@@ -0,0 +1,46 @@
+package web_test
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/willemschots/househunt/assets"
+	"github.com/willemschots/househunt/internal/i18n"
+	"github.com/willemschots/househunt/internal/web"
+	"github.com/willemschots/househunt/internal/web/view"
+)
+
+func TestCheckViews(t *testing.T) {
+	catalogue, err := i18n.LoadCatalogue(assets.LocaleFS)
+	if err != nil {
+		t.Fatalf("failed to load catalogue: %v", err)
+	}
+
+	t.Run("ok, embedded views", func(t *testing.T) {
+		r, err := view.NewMemRenderer(assets.TemplateFS)
+		if err != nil {
+			t.Fatalf("failed to create renderer: %v", err)
+		}
+
+		err = web.CheckViews(r, catalogue)
+		if err != nil {
+			t.Fatalf("expected views to be ok, got:\n%v", err)
+		}
+	})
+
+	t.Run("fail, missing view", func(t *testing.T) {
+		r, err := view.NewMemRenderer(fstest.MapFS{
+			"base.html":        {Data: []byte(`{{ template "content" . }}`)},
+			"hello-world.html": {Data: []byte(`{{ define "content" }}Hello{{ end }}`)},
+		})
+		if err != nil {
+			t.Fatalf("failed to create renderer: %v", err)
+		}
+
+		err = web.CheckViews(r, catalogue)
+		if err == nil || !strings.Contains(err.Error(), `view "register-user" not found`) {
+			t.Fatalf("expected missing view error, got: %v", err)
+		}
+	})
+}
@@ -2,7 +2,8 @@ CREATE TABLE migrations (
 	sequence           INTEGER PRIMARY KEY,
 	filename           TEXT NOT NULL,
 	revision           TEXT NOT NULL,
-	revision_timestamp TIMESTAMP NOT NULL
+	revision_timestamp TIMESTAMP NOT NULL,
+	checksum           TEXT NOT NULL DEFAULT ''
 );
 CREATE TABLE users(
     id                TEXT PRIMARY KEY,
@@ -12,7 +13,7 @@ CREATE TABLE users(
     is_active         INTEGER NOT NULL,
     created_at        TIMESTAMP NOT NULL,
     updated_at        TIMESTAMP NOT NULL
-);
+, role TEXT NOT NULL DEFAULT 'user', deactivated_at TIMESTAMP);
 CREATE TABLE email_tokens (
     id              TEXT PRIMARY KEY,
     token_hash      TEXT NOT NULL,
@@ -23,3 +24,52 @@ CREATE TABLE email_tokens (
     consumed_at     TIMESTAMP,
     FOREIGN KEY(user_id) REFERENCES users(id)
 );
+CREATE TABLE email_suppressions (
+    email_encrypted   TEXT NOT NULL,
+    email_blind_index TEXT PRIMARY KEY,
+    reason            TEXT NOT NULL,
+    created_at        TIMESTAMP NOT NULL
+);
+CREATE TABLE admin_actions (
+    id               TEXT PRIMARY KEY,
+    actor_id         TEXT,
+    action           TEXT NOT NULL,
+    target_user_id   TEXT,
+    detail_encrypted TEXT,
+    created_at       TIMESTAMP NOT NULL,
+    FOREIGN KEY(actor_id) REFERENCES users(id),
+    FOREIGN KEY(target_user_id) REFERENCES users(id)
+);
+CREATE INDEX admin_actions_target_user_id ON admin_actions(target_user_id);
+CREATE TABLE audit_events (
+    id                   TEXT PRIMARY KEY,
+    user_id              TEXT,
+    type                 TEXT NOT NULL,
+    detail               TEXT,
+    ip_encrypted         TEXT,
+    user_agent_encrypted TEXT,
+    created_at           TIMESTAMP NOT NULL,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX audit_events_user_id_created_at ON audit_events(user_id, created_at);
+CREATE INDEX audit_events_created_at ON audit_events(created_at);
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit events are append-only');
+END;
+CREATE TABLE jobs (
+    id             TEXT PRIMARY KEY,
+    kind           TEXT NOT NULL,
+    args_encrypted TEXT NOT NULL,
+    unique_key     TEXT,
+    status         TEXT NOT NULL,
+    attempts       INTEGER NOT NULL,
+    max_attempts   INTEGER NOT NULL,
+    run_at         TIMESTAMP NOT NULL,
+    locked_until   TIMESTAMP,
+    last_error     TEXT,
+    created_at     TIMESTAMP NOT NULL,
+    updated_at     TIMESTAMP NOT NULL
+, trace_parent TEXT, request_id TEXT);
+CREATE INDEX jobs_kind_status_run_at ON jobs(kind, status, run_at);
+CREATE UNIQUE INDEX jobs_kind_unique_key ON jobs(kind, unique_key) WHERE unique_key IS NOT NULL AND status <> 'failed';
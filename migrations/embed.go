@@ -1,6 +1,59 @@
 package migrations
 
-import "embed"
+import (
+	"embed"
+	"io/fs"
 
-//go:embed *.sql
-var FS embed.FS
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/db/migrate"
+	"github.com/willemschots/househunt/internal/krypto"
+)
+
+// The migrations of every dialect are kept in their own directory. They should
+// result in the same schema and have the same names, so a database can be moved
+// between dialects.
+//
+//go:embed sqlite/*.sql postgres/*.sql
+var sqlFS embed.FS
+
+// Deps are the dependencies of the Go migrations. They're only known at runtime,
+// for example the keys needed to re-encrypt data or rebuild blind indexes.
+//
+// The zero value can be used to check or list migrations. Go migrations that need
+// a missing dependency return an error when they run.
+type Deps struct {
+	Encryptor     *krypto.Encryptor
+	BlindIndexKey krypto.Key
+}
+
+// SQLite returns the migrations for SQLite databases.
+func SQLite(deps Deps) migrate.Source {
+	return source("sqlite", db.SQLite, deps)
+}
+
+// Postgres returns the migrations for Postgres databases.
+func Postgres(deps Deps) migrate.Source {
+	return source("postgres", db.Postgres, deps)
+}
+
+// ForDialect returns the migrations for the given dialect.
+func ForDialect(d db.Dialect, deps Deps) migrate.Source {
+	if d == db.Postgres {
+		return Postgres(deps)
+	}
+	return SQLite(deps)
+}
+
+// source returns the SQL files in dir together with the Go migrations in funcs.
+func source(dir string, d db.Dialect, deps Deps) migrate.Source {
+	sub, err := fs.Sub(sqlFS, dir)
+	if err != nil {
+		// Only happens if dir is not a valid path.
+		panic(err)
+	}
+
+	return migrate.Source{
+		FS:    sub,
+		Funcs: funcs(d, deps),
+	}
+}
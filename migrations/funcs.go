@@ -0,0 +1,18 @@
+package migrations
+
+import (
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/db/migrate"
+)
+
+// funcs returns the migrations that can't be written in SQL, like migrations that need to
+// decrypt and encrypt data. The name decides where in the sequence a Go migration runs, for
+// example "0007_reencrypt_emails.go" runs after "0006_job_context.sql".
+//
+// Go migrations get the deps the source was built with, and should return an error if a
+// dependency they need is missing. They run for every dialect, so they should only use SQL
+// that is supported by all of them. Use d for the placeholders. Like SQL migrations, Go
+// migrations are append-only: once released they should not be renamed, removed or changed.
+func funcs(d db.Dialect, deps Deps) map[string]migrate.Func {
+	return map[string]migrate.Func{}
+}
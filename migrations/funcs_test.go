@@ -0,0 +1,244 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/willemschots/househunt/internal/db"
+	"github.com/willemschots/househunt/internal/db/migrate"
+	"github.com/willemschots/househunt/internal/krypto"
+)
+
+func Test_Source_Deps(t *testing.T) {
+	oldKey := mustKey(t)
+	newKey := mustKey(t)
+
+	oldEnc := mustEncryptor(t, oldKey)
+	// The new key is added last, so it's used for encrypting.
+	rotatedEnc := mustEncryptor(t, oldKey, newKey)
+
+	args := []byte(`{"name":"alice"}`)
+
+	// reencryptJobs is registered as a Go migration that runs after the SQL
+	// migrations, it gets the encryptor from the deps of the source.
+	reencryptJobs := func(deps Deps) migrate.Source {
+		src := SQLite(deps)
+		src.Funcs["9999_reencrypt_jobs.go"] = func(ctx context.Context, tx *sql.Tx) error {
+			return reencrypt(ctx, tx, db.SQLite, deps.Encryptor, "jobs", "args_encrypted")
+		}
+		return src
+	}
+
+	t.Run("ok, encrypts with the latest key", func(t *testing.T) {
+		sqlDB := migratedDB(t, oldEnc)
+		insertJob(t, sqlDB, mustEncrypt(t, oldEnc, args))
+
+		_, err := migrate.RunFS(context.Background(), sqlDB, reencryptJobs(Deps{Encryptor: rotatedEnc}), migrate.Metadata{})
+		if err != nil {
+			t.Fatalf("failed to run migrations: %v", err)
+		}
+
+		got := jobArgs(t, sqlDB)
+		if index := binary.BigEndian.Uint32(got[:4]); index != 1 {
+			t.Errorf("expected args to be encrypted with key 1, got key %d", index)
+		}
+
+		data, err := rotatedEnc.Decrypt(got)
+		if err != nil {
+			t.Fatalf("failed to decrypt: %v", err)
+		}
+
+		if string(data) != string(args) {
+			t.Errorf("got args %s, want %s", data, args)
+		}
+
+		_, err = oldEnc.Decrypt(got)
+		if !errors.Is(err, krypto.ErrUnknownKey) {
+			t.Errorf("expected %v, got %v via errors.Is()", krypto.ErrUnknownKey, err)
+		}
+	})
+
+	t.Run("ok, no rows without encryptor", func(t *testing.T) {
+		sqlDB := migratedDB(t, oldEnc)
+
+		_, err := migrate.RunFS(context.Background(), sqlDB, reencryptJobs(Deps{}), migrate.Metadata{})
+		if err != nil {
+			t.Fatalf("failed to run migrations: %v", err)
+		}
+	})
+
+	t.Run("fail, rows without encryptor", func(t *testing.T) {
+		sqlDB := migratedDB(t, oldEnc)
+		enc := mustEncrypt(t, oldEnc, args)
+		insertJob(t, sqlDB, enc)
+
+		_, err := migrate.RunFS(context.Background(), sqlDB, reencryptJobs(Deps{}), migrate.Metadata{})
+		if !errors.Is(err, errNoEncryptor) {
+			t.Fatalf("expected %v, got %v via errors.Is()", errNoEncryptor, err)
+		}
+
+		if got := jobArgs(t, sqlDB); string(got) != string(enc) {
+			t.Errorf("expected args to be unchanged")
+		}
+	})
+
+	t.Run("fail, encrypted with unknown key", func(t *testing.T) {
+		sqlDB := migratedDB(t, oldEnc)
+		insertJob(t, sqlDB, mustEncrypt(t, rotatedEnc, args))
+
+		_, err := migrate.RunFS(context.Background(), sqlDB, reencryptJobs(Deps{Encryptor: oldEnc}), migrate.Metadata{})
+		if !errors.Is(err, krypto.ErrUnknownKey) {
+			t.Fatalf("expected %v, got %v via errors.Is()", krypto.ErrUnknownKey, err)
+		}
+	})
+}
+
+// migratedDB returns a database with the SQL migrations applied.
+func migratedDB(t *testing.T, enc *krypto.Encryptor) *sql.DB {
+	t.Helper()
+
+	sqlDB, err := db.OpenSQLite(":memory:", true)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		err := sqlDB.Close()
+		if err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	})
+
+	_, err = migrate.RunFS(context.Background(), sqlDB, SQLite(Deps{Encryptor: enc}), migrate.Metadata{})
+	if err != nil {
+		t.Fatalf("failed to run migrations: %v", err)
+	}
+
+	return sqlDB
+}
+
+func insertJob(t *testing.T, sqlDB *sql.DB, args []byte) {
+	t.Helper()
+
+	now := time.Now().UTC()
+	_, err := sqlDB.Exec(`INSERT INTO jobs (id, kind, args_encrypted, status, attempts, max_attempts, run_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		"00000000-0000-4000-8000-000000000001", "test", args, "pending", 0, 3, now, now, now)
+	if err != nil {
+		t.Fatalf("failed to insert job: %v", err)
+	}
+}
+
+func jobArgs(t *testing.T, sqlDB *sql.DB) []byte {
+	t.Helper()
+
+	var args []byte
+	err := sqlDB.QueryRow("SELECT args_encrypted FROM jobs").Scan(&args)
+	if err != nil {
+		t.Fatalf("failed to select job: %v", err)
+	}
+
+	return args
+}
+
+func mustKey(t *testing.T) krypto.Key {
+	t.Helper()
+
+	key, err := krypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	return key
+}
+
+func mustEncryptor(t *testing.T, keys ...krypto.Key) *krypto.Encryptor {
+	t.Helper()
+
+	enc, err := krypto.NewEncryptor(keys)
+	if err != nil {
+		t.Fatalf("failed to create encryptor: %v", err)
+	}
+
+	return enc
+}
+
+func mustEncrypt(t *testing.T, enc *krypto.Encryptor, data []byte) []byte {
+	t.Helper()
+
+	out, err := enc.Encrypt(data)
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
+	return out
+}
+
+// errNoEncryptor is returned by reencrypt when no encryptor was provided.
+var errNoEncryptor = errors.New("migration needs the encryption keys, but none were provided")
+
+// reencrypt is a Go migration that needs deps: it decrypts column in every row of
+// table, and encrypts it again with the latest key of enc. Rows are identified by their
+// id column.
+func reencrypt(ctx context.Context, tx *sql.Tx, d db.Dialect, enc *krypto.Encryptor, table, column string) error {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT id, %s FROM %s WHERE %s IS NOT NULL", column, table, column))
+	if err != nil {
+		return err
+	}
+
+	type row struct {
+		id   any
+		data []byte
+	}
+
+	var all []row
+	for rows.Next() {
+		var r row
+		err = rows.Scan(&r.id, &r.data)
+		if err != nil {
+			return errors.Join(err, rows.Close())
+		}
+		all = append(all, r)
+	}
+
+	err = errors.Join(rows.Err(), rows.Close())
+	if err != nil {
+		return err
+	}
+
+	if len(all) > 0 && enc == nil {
+		return errNoEncryptor
+	}
+
+	// Rows are updated after reading all of them, the tx only allows one query at a time.
+	for _, r := range all {
+		q := &db.Query{Encryptor: enc, Dialect: d}
+		q.Unsafe(fmt.Sprintf("UPDATE %s SET %s = ", table, column))
+
+		data, err := enc.Decrypt(r.data)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s of %s %v: %w", column, table, r.id, err)
+		}
+
+		q.ParamEncrypted(data)
+		q.Unsafe(" WHERE id = ")
+		q.Param(r.id)
+
+		qry, params, err := q.Get()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, qry, params...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+CREATE TABLE users(
+    id                UUID PRIMARY KEY,
+    email_encrypted   BYTEA NOT NULL,
+    email_blind_index TEXT NOT NULL UNIQUE,
+    password_hash     TEXT NOT NULL,
+    is_active         BOOLEAN NOT NULL,
+    created_at        TIMESTAMP NOT NULL,
+    updated_at        TIMESTAMP NOT NULL
+);
+
+CREATE TABLE email_tokens (
+    id              UUID PRIMARY KEY,
+    token_hash      TEXT NOT NULL,
+    user_id         UUID NOT NULL,
+    email_encrypted BYTEA NOT NULL,
+    purpose         TEXT NOT NULL,
+    created_at      TIMESTAMP NOT NULL,
+    consumed_at     TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
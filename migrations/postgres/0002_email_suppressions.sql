@@ -0,0 +1,6 @@
+CREATE TABLE email_suppressions (
+    email_encrypted   BYTEA NOT NULL,
+    email_blind_index TEXT PRIMARY KEY,
+    reason            TEXT NOT NULL,
+    created_at        TIMESTAMP NOT NULL
+);
@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD COLUMN deactivated_at TIMESTAMP;
+
+CREATE TABLE admin_actions (
+    id               UUID PRIMARY KEY,
+    actor_id         UUID,
+    action           TEXT NOT NULL,
+    target_user_id   UUID,
+    detail_encrypted BYTEA,
+    created_at       TIMESTAMP NOT NULL,
+    FOREIGN KEY(actor_id) REFERENCES users(id),
+    FOREIGN KEY(target_user_id) REFERENCES users(id)
+);
+
+CREATE INDEX admin_actions_target_user_id ON admin_actions(target_user_id);
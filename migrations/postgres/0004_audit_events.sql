@@ -0,0 +1,23 @@
+CREATE TABLE audit_events (
+    id                   UUID PRIMARY KEY,
+    user_id              UUID,
+    type                 TEXT NOT NULL,
+    detail               TEXT,
+    ip_encrypted         BYTEA,
+    user_agent_encrypted BYTEA,
+    created_at           TIMESTAMP NOT NULL,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX audit_events_user_id_created_at ON audit_events(user_id, created_at);
+CREATE INDEX audit_events_created_at ON audit_events(created_at);
+
+-- Audit events are append-only, they can only be removed by the retention job.
+CREATE FUNCTION audit_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit events are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,4 @@
+-- The request ID and trace of the call that enqueued a job, so its work can
+-- be traced back to the request that caused it.
+ALTER TABLE jobs ADD COLUMN trace_parent TEXT;
+ALTER TABLE jobs ADD COLUMN request_id TEXT;
@@ -0,0 +1,6 @@
+CREATE TABLE email_suppressions (
+    email_encrypted   TEXT NOT NULL,
+    email_blind_index TEXT PRIMARY KEY,
+    reason            TEXT NOT NULL,
+    created_at        TIMESTAMP NOT NULL
+);
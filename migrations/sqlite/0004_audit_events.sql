@@ -0,0 +1,19 @@
+CREATE TABLE audit_events (
+    id                   TEXT PRIMARY KEY,
+    user_id              TEXT,
+    type                 TEXT NOT NULL,
+    detail               TEXT,
+    ip_encrypted         TEXT,
+    user_agent_encrypted TEXT,
+    created_at           TIMESTAMP NOT NULL,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX audit_events_user_id_created_at ON audit_events(user_id, created_at);
+CREATE INDEX audit_events_created_at ON audit_events(created_at);
+
+-- Audit events are append-only, they can only be removed by the retention job.
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit events are append-only');
+END;
@@ -0,0 +1,19 @@
+CREATE TABLE jobs (
+    id             TEXT PRIMARY KEY,
+    kind           TEXT NOT NULL,
+    args_encrypted TEXT NOT NULL,
+    unique_key     TEXT,
+    status         TEXT NOT NULL,
+    attempts       INTEGER NOT NULL,
+    max_attempts   INTEGER NOT NULL,
+    run_at         TIMESTAMP NOT NULL,
+    locked_until   TIMESTAMP,
+    last_error     TEXT,
+    created_at     TIMESTAMP NOT NULL,
+    updated_at     TIMESTAMP NOT NULL
+);
+
+CREATE INDEX jobs_kind_status_run_at ON jobs(kind, status, run_at);
+
+-- Only one pending or running job of a kind can have the same unique key.
+CREATE UNIQUE INDEX jobs_kind_unique_key ON jobs(kind, unique_key) WHERE unique_key IS NOT NULL AND status <> 'failed';